@@ -0,0 +1,36 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+)
+
+// AbandonedCartHandler handles HTTP requests for abandoned cart reporting
+type AbandonedCartHandler struct {
+    AbandonedCartService *services.AbandonedCartService
+}
+
+// NewAbandonedCartHandler creates a new AbandonedCartHandler
+func NewAbandonedCartHandler(abandonedCartService *services.AbandonedCartService) *AbandonedCartHandler {
+    return &AbandonedCartHandler{AbandonedCartService: abandonedCartService}
+}
+
+// GetStats handles GET /api/v1/admin/abandoned-carts/stats?days=30
+func (h *AbandonedCartHandler) GetStats(c *gin.Context) {
+    days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+    if err != nil || days < 1 || days > 365 {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid days, must be between 1 and 365")
+        return
+    }
+    stats, err := h.AbandonedCartService.GetStats(time.Now().AddDate(0, 0, -days))
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch abandoned cart stats")
+        return
+    }
+    c.JSON(http.StatusOK, stats)
+}
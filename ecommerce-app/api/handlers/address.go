@@ -0,0 +1,144 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// AddressHandler handles HTTP requests for the user's address book
+type AddressHandler struct {
+    AddressService *services.AddressService
+}
+
+// NewAddressHandler creates a new AddressHandler
+func NewAddressHandler(addressService *services.AddressService) *AddressHandler {
+    return &AddressHandler{AddressService: addressService}
+}
+
+// CreateAddress handles POST /api/v1/users/addresses
+func (h *AddressHandler) CreateAddress(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    var address models.Address
+    if err := c.ShouldBindJSON(&address); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    if err := h.AddressService.CreateAddress(userID, &address); err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusCreated, address)
+}
+
+// GetAddresses handles GET /api/v1/users/addresses
+func (h *AddressHandler) GetAddresses(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    addresses, err := h.AddressService.GetAddresses(userID)
+    if err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, addresses)
+}
+
+// UpdateAddress handles PUT /api/v1/users/addresses/:id
+func (h *AddressHandler) UpdateAddress(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c)
+    if !ok {
+        return
+    }
+    var input models.Address
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    address, err := h.AddressService.UpdateAddress(userID, id, &input)
+    if err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, address)
+}
+
+// SetDefaultAddress handles PUT /api/v1/users/addresses/:id/default
+func (h *AddressHandler) SetDefaultAddress(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c)
+    if !ok {
+        return
+    }
+    if err := h.AddressService.SetDefaultAddress(userID, id); err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Default address updated successfully"})
+}
+
+// DeleteAddress handles DELETE /api/v1/users/addresses/:id
+func (h *AddressHandler) DeleteAddress(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c)
+    if !ok {
+        return
+    }
+    if err := h.AddressService.DeleteAddress(userID, id); err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Address deleted successfully"})
+}
+
+func (h *AddressHandler) userID(c *gin.Context) (uint, bool) {
+    user, exists := c.Get("user")
+    if !exists {
+        h.AddressService.Logger.WithFields(logrus.Fields{
+            "path": c.Request.URL.Path,
+        }).Warn("No user in context for address request")
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return 0, false
+    }
+    return user.(models.User).ID, true
+}
+
+func (h *AddressHandler) parseID(c *gin.Context) (uint, bool) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid address ID")
+        return 0, false
+    }
+    return uint(id), true
+}
+
+func (h *AddressHandler) respondWithServiceError(c *gin.Context, err error) {
+    switch errors.Cause(err) {
+    case services.ErrAddressNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Address not found")
+    case services.ErrInvalidAddress:
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, "Address request failed")
+    }
+}
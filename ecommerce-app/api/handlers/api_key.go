@@ -0,0 +1,78 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// APIKeyHandler handles HTTP requests for managing API keys
+type APIKeyHandler struct {
+    APIKeyService *services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+    return &APIKeyHandler{APIKeyService: apiKeyService}
+}
+
+// CreateAPIKey handles POST /api/v1/admin/api-keys. The key is in the response once
+// and cannot be retrieved again.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+    var input services.APIKeyInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    u := c.MustGet("user").(models.User)
+    key, plaintext, err := h.APIKeyService.CreateAPIKey(u.ID, &input)
+    if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrInvalidAPIKey:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        case services.ErrUserNotFound:
+            utils.RespondWithError(c, http.StatusBadRequest, "User not found")
+        case services.ErrAPIKeyBeyondIssuer:
+            utils.RespondWithError(c, http.StatusForbidden, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to create API key")
+        }
+        return
+    }
+    c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": plaintext})
+}
+
+// GetAPIKeys handles GET /api/v1/admin/api-keys
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+    keys, err := h.APIKeyService.GetAPIKeys()
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch API keys")
+        return
+    }
+    c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey handles DELETE /api/v1/admin/api-keys/:id
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid API key ID")
+        return
+    }
+    u := c.MustGet("user").(models.User)
+    switch err := h.APIKeyService.RevokeAPIKey(uint(id), u.ID); errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+    case services.ErrAPIKeyNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, err.Error())
+    case services.ErrAPIKeyAlreadyRevoked:
+        utils.RespondWithError(c, http.StatusConflict, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to revoke API key")
+    }
+}
@@ -8,6 +8,7 @@ import (
     "github.com/inquisitivefrog/ecommerce-app/models"
     "github.com/inquisitivefrog/ecommerce-app/services"
     "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
     "github.com/sirupsen/logrus" // Added import
 )
 
@@ -21,14 +22,14 @@ func NewCartHandler(cartService *services.CartService) *CartHandler {
     return &CartHandler{CartService: cartService}
 }
 
-// AddToCart handles POST /api/cart
+// AddToCart handles POST /api/cart. In sync cart mode the updated line is returned;
+// otherwise the add is queued and its operation_id can be polled at
+// GET /api/cart/operations/:id. Requests without a user add to the guest cart named by
+// the guest cart token, starting one when there is none.
 func (h *CartHandler) AddToCart(c *gin.Context) {
     user, exists := c.Get("user")
     if !exists {
-        h.CartService.Logger.WithFields(logrus.Fields{
-            "path": c.Request.URL.Path,
-        }).Warn("No user in context for POST /api/cart")
-        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        h.addToGuestCart(c)
         return
     }
     userID := user.(models.User).ID // Extract UserID from models.User
@@ -45,7 +46,7 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
         return
     }
 
-    err := h.CartService.AddToCart(userID, input.ProductID, input.Quantity)
+    result, err := h.CartService.AddToCart(userID, input.ProductID, input.Quantity)
     if err != nil {
         h.CartService.Logger.WithFields(logrus.Fields{
             "user_id":    userID,
@@ -56,22 +57,28 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
         return
     }
 
+    if result.Item != nil {
+        c.JSON(http.StatusOK, newCartLineResponse(*result.Item))
+        return
+    }
     h.CartService.Logger.WithFields(logrus.Fields{
         "user_id":    userID,
         "product_id": input.ProductID,
         "quantity":   input.Quantity,
     }).Info("Enqueued add to cart request")
-    c.JSON(http.StatusAccepted, gin.H{"message": "Item enqueued for addition to cart"})
+    response := gin.H{"message": "Item enqueued for addition to cart"}
+    if result.Operation != nil {
+        response["operation_id"] = result.Operation.ID
+        response["status"] = result.Operation.Status
+    }
+    c.JSON(http.StatusAccepted, response)
 }
 
-// GetCart handles GET /api/cart
+// GetCart handles GET /api/cart, for users and guests
 func (h *CartHandler) GetCart(c *gin.Context) {
     user, exists := c.Get("user")
     if !exists {
-        h.CartService.Logger.WithFields(logrus.Fields{
-            "path": c.Request.URL.Path,
-        }).Warn("No user in context for GET /api/cart")
-        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        h.getGuestCart(c)
         return
     }
     userID := user.(models.User).ID // Extract UserID from models.User
@@ -87,18 +94,9 @@ func (h *CartHandler) GetCart(c *gin.Context) {
     }
 
     // Format response to include product details
-    type CartResponse struct {
-        models.Cart
-        ProductName  string  `json:"product_name"`
-        ProductPrice float64 `json:"product_price"`
-    }
-    var response []CartResponse
+    var response []cartLineResponse
     for _, item := range cartItems {
-        response = append(response, CartResponse{
-            Cart:         item,
-            ProductName:  item.Product.Name,
-            ProductPrice: item.Product.Price,
-        })
+        response = append(response, newCartLineResponse(item))
     }
 
     h.CartService.Logger.WithFields(logrus.Fields{
@@ -108,14 +106,12 @@ func (h *CartHandler) GetCart(c *gin.Context) {
     c.JSON(http.StatusOK, response)
 }
 
-// GetCartItem handles GET /api/cart/:id
+// GetCartItem handles GET /api/cart/:id. Items in other users' carts are not found. In a
+// guest cart :id is the product ID.
 func (h *CartHandler) GetCartItem(c *gin.Context) {
     user, exists := c.Get("user")
     if !exists {
-        h.CartService.Logger.WithFields(logrus.Fields{
-            "path": c.Request.URL.Path,
-        }).Warn("No user in context for GET /api/cart/:id")
-        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        h.getGuestCartItem(c)
         return
     }
     userID := user.(models.User).ID // Extract UserID from models.User
@@ -130,7 +126,7 @@ func (h *CartHandler) GetCartItem(c *gin.Context) {
         return
     }
 
-    cartItem, err := h.CartService.GetCartItemByID(uint(cartID))
+    cartItem, err := h.CartService.GetCartItemByID(userID, uint(cartID))
     if err != nil {
         h.CartService.Logger.WithFields(logrus.Fields{
             "cart_id": cartID,
@@ -140,24 +136,8 @@ func (h *CartHandler) GetCartItem(c *gin.Context) {
         utils.RespondWithError(c, http.StatusNotFound, "Cart item not found")
         return
     }
-    if cartItem.UserID != userID {
-        h.CartService.Logger.WithFields(logrus.Fields{
-            "cart_id": cartID,
-            "user_id": userID,
-        }).Warn("Unauthorized cart access")
-        utils.RespondWithError(c, http.StatusForbidden, "Unauthorized")
-        return
-    }
 
-    response := struct {
-        models.Cart
-        ProductName  string  `json:"product_name"`
-        ProductPrice float64 `json:"product_price"`
-    }{
-        Cart:         *cartItem,
-        ProductName:  cartItem.Product.Name,
-        ProductPrice: cartItem.Product.Price,
-    }
+    response := newCartLineResponse(*cartItem)
 
     h.CartService.Logger.WithFields(logrus.Fields{
         "cart_id": cartID,
@@ -166,14 +146,11 @@ func (h *CartHandler) GetCartItem(c *gin.Context) {
     c.JSON(http.StatusOK, response)
 }
 
-// UpdateCartItem handles PUT /api/cart/:id
+// UpdateCartItem handles PUT /api/cart/:id. In a guest cart :id is the product ID.
 func (h *CartHandler) UpdateCartItem(c *gin.Context) {
     user, exists := c.Get("user")
     if !exists {
-        h.CartService.Logger.WithFields(logrus.Fields{
-            "path": c.Request.URL.Path,
-        }).Warn("No user in context for PUT /api/cart/:id")
-        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        h.updateGuestCartItem(c)
         return
     }
     userID := user.(models.User).ID // Extract UserID from models.User
@@ -199,12 +176,16 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
         return
     }
 
-    if err := h.CartService.UpdateCartItem(uint(cartID), input.Quantity); err != nil {
+    if err := h.CartService.UpdateCartItem(userID, uint(cartID), input.Quantity); err != nil {
         h.CartService.Logger.WithFields(logrus.Fields{
             "cart_id": cartID,
             "user_id": userID,
             "error":   err,
         }).Warn("Failed to update cart item")
+        if errors.Cause(err) == services.ErrCartItemNotFound {
+            utils.RespondWithError(c, http.StatusNotFound, "Cart item not found")
+            return
+        }
         utils.RespondWithError(c, http.StatusBadRequest, err.Error())
         return
     }
@@ -217,14 +198,11 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"message": "Cart item updated successfully"})
 }
 
-// DeleteCartItem handles DELETE /api/cart/:id
+// DeleteCartItem handles DELETE /api/cart/:id. In a guest cart :id is the product ID.
 func (h *CartHandler) DeleteCartItem(c *gin.Context) {
     user, exists := c.Get("user")
     if !exists {
-        h.CartService.Logger.WithFields(logrus.Fields{
-            "path": c.Request.URL.Path,
-        }).Warn("No user in context for DELETE /api/cart/:id")
-        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        h.deleteGuestCartItem(c)
         return
     }
     userID := user.(models.User).ID // Extract UserID from models.User
@@ -239,13 +217,17 @@ func (h *CartHandler) DeleteCartItem(c *gin.Context) {
         return
     }
 
-    if err := h.CartService.DeleteCartItem(uint(cartID)); err != nil {
+    if err := h.CartService.DeleteCartItem(userID, uint(cartID)); err != nil {
         h.CartService.Logger.WithFields(logrus.Fields{
             "cart_id": cartID,
             "user_id": userID,
             "error":   err,
-        }).Warn("Cart item not found")
-        utils.RespondWithError(c, http.StatusNotFound, "Cart item not found")
+        }).Warn("Failed to delete cart item")
+        if errors.Cause(err) == services.ErrCartItemNotFound {
+            utils.RespondWithError(c, http.StatusNotFound, "Cart item not found")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to delete cart item")
         return
     }
 
@@ -255,3 +237,166 @@ func (h *CartHandler) DeleteCartItem(c *gin.Context) {
     }).Info("Deleted cart item")
     c.JSON(http.StatusOK, gin.H{"message": "Cart item deleted successfully"})
 }
+
+// GetCartSummary handles GET /api/cart/summary?country=US&region=CA&postal_code=94103&shipping_method=standard
+// Tax lines and shipping quotes are only included when a country is given. Guests get
+// the summary of their guest cart.
+func (h *CartHandler) GetCartSummary(c *gin.Context) {
+    var address *services.TaxAddress
+    if country := c.Query("country"); country != "" {
+        address = &services.TaxAddress{
+            Country:    country,
+            Region:     c.Query("region"),
+            PostalCode: c.Query("postal_code"),
+        }
+    }
+
+    var userID uint
+    var summary *services.CartSummary
+    var err error
+    if user, exists := c.Get("user"); exists {
+        userID = user.(models.User).ID
+        summary, err = h.CartService.GetCartSummary(userID, address, c.Query("shipping_method"))
+    } else {
+        summary, err = h.CartService.GetGuestCartSummary(h.guestCartID(c), address, c.Query("shipping_method"))
+    }
+    if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrGuestCartsDisabled:
+            utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        case services.ErrShippingAddressRequired:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        case services.ErrShippingMethodNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, err.Error())
+        case services.ErrShippingUnavailable:
+            utils.RespondWithError(c, http.StatusUnprocessableEntity, err.Error())
+        default:
+            h.CartService.Logger.WithFields(logrus.Fields{
+                "user_id": userID,
+                "error":   err,
+            }).Error("Failed to calculate cart summary")
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to calculate cart summary")
+        }
+        return
+    }
+    c.JSON(http.StatusOK, summary)
+}
+
+// GetCartOperation handles GET /api/cart/operations/:id, reporting whether a queued
+// add to cart has been applied
+func (h *CartHandler) GetCartOperation(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    userID := user.(models.User).ID
+
+    operation, err := h.CartService.GetCartOperation(userID, c.Param("id"))
+    if err != nil {
+        if errors.Cause(err) == services.ErrCartOperationNotFound {
+            utils.RespondWithError(c, http.StatusNotFound, "Cart operation not found")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch cart operation")
+        return
+    }
+    c.JSON(http.StatusOK, operation)
+}
+
+// AcknowledgeCartChanges handles POST /api/cart/acknowledge. It accepts the changes
+// flagged on the cart's lines, which checkout requires, and returns the updated cart.
+func (h *CartHandler) AcknowledgeCartChanges(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    userID := user.(models.User).ID
+
+    cartItems, err := h.CartService.AcknowledgeCartChanges(userID)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to update cart")
+        return
+    }
+    response := make([]cartLineResponse, 0, len(cartItems))
+    for _, item := range cartItems {
+        response = append(response, newCartLineResponse(item))
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// cartLineResponse is a cart line with its product's name and price
+type cartLineResponse struct {
+    models.Cart
+    ProductName  string  `json:"product_name"`
+    ProductPrice float64 `json:"product_price"`
+}
+
+func newCartLineResponse(item models.Cart) cartLineResponse {
+    return cartLineResponse{
+        Cart:         item,
+        ProductName:  item.Product.Name,
+        ProductPrice: item.Product.Price,
+    }
+}
+
+// ApplyCoupon handles POST /api/cart/coupons
+func (h *CartHandler) ApplyCoupon(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        h.CartService.Logger.WithFields(logrus.Fields{
+            "path": c.Request.URL.Path,
+        }).Warn("No user in context for POST /api/cart/coupons")
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    userID := user.(models.User).ID
+
+    var input struct {
+        Code string `json:"code" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    summary, err := h.CartService.ApplyCoupon(userID, input.Code)
+    if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrCouponNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, "Coupon not found")
+        case services.ErrCouponNotActive, services.ErrCouponExpired, services.ErrCouponUsageLimit,
+            services.ErrCouponUserLimit, services.ErrCouponMinCartValue, services.ErrCouponNotApplicable,
+            services.ErrCouponNotStackable:
+            utils.RespondWithError(c, http.StatusUnprocessableEntity, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to apply coupon")
+        }
+        return
+    }
+    c.JSON(http.StatusOK, summary)
+}
+
+// RemoveCoupon handles DELETE /api/cart/coupons/:code
+func (h *CartHandler) RemoveCoupon(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        h.CartService.Logger.WithFields(logrus.Fields{
+            "path": c.Request.URL.Path,
+        }).Warn("No user in context for DELETE /api/cart/coupons/:code")
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    userID := user.(models.User).ID
+
+    if err := h.CartService.RemoveCoupon(userID, c.Param("code")); err != nil {
+        if errors.Cause(err) == services.ErrCouponNotFound {
+            utils.RespondWithError(c, http.StatusNotFound, "Coupon not applied to cart")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to remove coupon")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Coupon removed from cart"})
+}
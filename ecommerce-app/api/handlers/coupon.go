@@ -0,0 +1,115 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// CouponHandler handles admin HTTP requests for coupons
+type CouponHandler struct {
+    CouponService *services.CouponService
+}
+
+// NewCouponHandler creates a new CouponHandler
+func NewCouponHandler(couponService *services.CouponService) *CouponHandler {
+    return &CouponHandler{CouponService: couponService}
+}
+
+// CreateCoupon handles POST /api/v1/admin/coupons
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+    var coupon models.Coupon
+    if err := c.ShouldBindJSON(&coupon); err != nil {
+        h.CouponService.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "INVALID_INPUT",
+        }).Warn("Invalid input for POST /api/v1/admin/coupons")
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    if err := h.CouponService.CreateCoupon(&coupon); err != nil {
+        if errors.Cause(err) == services.ErrInvalidCoupon {
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to create coupon")
+        return
+    }
+    c.JSON(http.StatusCreated, coupon)
+}
+
+// GetCoupons handles GET /api/v1/admin/coupons
+func (h *CouponHandler) GetCoupons(c *gin.Context) {
+    coupons, err := h.CouponService.GetCoupons()
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch coupons")
+        return
+    }
+    c.JSON(http.StatusOK, coupons)
+}
+
+// GetCoupon handles GET /api/v1/admin/coupons/:id
+func (h *CouponHandler) GetCoupon(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid coupon ID")
+        return
+    }
+    coupon, err := h.CouponService.GetCouponByID(uint(id))
+    if err != nil {
+        utils.RespondWithError(c, http.StatusNotFound, "Coupon not found")
+        return
+    }
+    c.JSON(http.StatusOK, coupon)
+}
+
+// UpdateCoupon handles PUT /api/v1/admin/coupons/:id
+func (h *CouponHandler) UpdateCoupon(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid coupon ID")
+        return
+    }
+    var coupon models.Coupon
+    if err := c.ShouldBindJSON(&coupon); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    coupon.ID = uint(id)
+    if err := h.CouponService.UpdateCoupon(&coupon); err != nil {
+        switch errors.Cause(err) {
+        case services.ErrCouponNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, "Coupon not found")
+        case services.ErrInvalidCoupon:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to update coupon")
+        }
+        return
+    }
+    c.JSON(http.StatusOK, coupon)
+}
+
+// DeleteCoupon handles DELETE /api/v1/admin/coupons/:id
+func (h *CouponHandler) DeleteCoupon(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid coupon ID")
+        return
+    }
+    if err := h.CouponService.DeleteCoupon(uint(id)); err != nil {
+        if errors.Cause(err) == services.ErrCouponNotFound {
+            utils.RespondWithError(c, http.StatusNotFound, "Coupon not found")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to delete coupon")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Coupon deleted successfully"})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// Guest carts are named by a signed token kept in a cookie. Clients that cannot keep
+// cookies send it in a header instead.
+const (
+    guestCartCookie = "guest_cart_token"
+    guestCartHeader = "X-Guest-Cart-Token"
+)
+
+func (h *CartHandler) addToGuestCart(c *gin.Context) {
+    var input struct {
+        ProductID uint `json:"product_id" binding:"required"`
+        Quantity  int  `json:"quantity" binding:"required,min=1"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    token := guestCartToken(c)
+    cartID := h.guestCartID(c)
+    if cartID == "" {
+        var err error
+        token, cartID, err = h.CartService.NewGuestCart()
+        if err != nil {
+            respondWithGuestCartError(c, err, "Failed to add item to cart")
+            return
+        }
+    }
+    if err := h.CartService.AddToGuestCart(cartID, input.ProductID, input.Quantity); err != nil {
+        respondWithGuestCartError(c, err, "Failed to add item to cart")
+        return
+    }
+
+    // Re-issue the cookie so it lives as long as the cart
+    setGuestCartCookie(c, token, h.CartService.GuestCartTTL)
+    c.JSON(http.StatusOK, gin.H{"message": "Item added to cart", "guest_cart_token": token})
+}
+
+func (h *CartHandler) getGuestCart(c *gin.Context) {
+    cartID := h.guestCartID(c)
+    if cartID == "" {
+        c.JSON(http.StatusOK, []cartLineResponse{})
+        return
+    }
+    cartItems, err := h.CartService.GetGuestCart(cartID)
+    if err != nil {
+        respondWithGuestCartError(c, err, "Failed to fetch cart")
+        return
+    }
+    response := make([]cartLineResponse, 0, len(cartItems))
+    for _, item := range cartItems {
+        response = append(response, newCartLineResponse(item))
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+func (h *CartHandler) getGuestCartItem(c *gin.Context) {
+    productID, ok := parseGuestCartLine(c)
+    if !ok {
+        return
+    }
+    cartItem, err := h.CartService.GetGuestCartItem(h.guestCartID(c), productID)
+    if err != nil {
+        respondWithGuestCartError(c, err, "Failed to fetch cart item")
+        return
+    }
+    c.JSON(http.StatusOK, newCartLineResponse(*cartItem))
+}
+
+func (h *CartHandler) updateGuestCartItem(c *gin.Context) {
+    productID, ok := parseGuestCartLine(c)
+    if !ok {
+        return
+    }
+    var input struct {
+        Quantity int `json:"quantity" binding:"required,min=1"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+    if err := h.CartService.UpdateGuestCartItem(h.guestCartID(c), productID, input.Quantity); err != nil {
+        respondWithGuestCartError(c, err, "Failed to update cart item")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Cart item updated successfully"})
+}
+
+func (h *CartHandler) deleteGuestCartItem(c *gin.Context) {
+    productID, ok := parseGuestCartLine(c)
+    if !ok {
+        return
+    }
+    if err := h.CartService.DeleteGuestCartItem(h.guestCartID(c), productID); err != nil {
+        respondWithGuestCartError(c, err, "Failed to delete cart item")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Cart item deleted successfully"})
+}
+
+// guestCartID returns the guest cart named by the request's token, or "" when the
+// request has no valid token
+func (h *CartHandler) guestCartID(c *gin.Context) string {
+    token := guestCartToken(c)
+    if token == "" {
+        return ""
+    }
+    cartID, err := h.CartService.GuestCartID(token)
+    if err != nil {
+        return ""
+    }
+    return cartID
+}
+
+func guestCartToken(c *gin.Context) string {
+    if token := c.GetHeader(guestCartHeader); token != "" {
+        return token
+    }
+    token, _ := c.Cookie(guestCartCookie)
+    return token
+}
+
+func setGuestCartCookie(c *gin.Context, token string, ttl time.Duration) {
+    c.SetSameSite(http.SameSiteLaxMode)
+    c.SetCookie(guestCartCookie, token, int(ttl.Seconds()), "/", "", c.Request.TLS != nil, true)
+}
+
+func clearGuestCartCookie(c *gin.Context) {
+    c.SetSameSite(http.SameSiteLaxMode)
+    c.SetCookie(guestCartCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+}
+
+func parseGuestCartLine(c *gin.Context) (uint, bool) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid cart ID")
+        return 0, false
+    }
+    return uint(id), true
+}
+
+func respondWithGuestCartError(c *gin.Context, err error, fallback string) {
+    switch errors.Cause(err) {
+    case services.ErrGuestCartsDisabled:
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+    case services.ErrCartItemNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Cart item not found")
+    case services.ErrProductNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Product not found")
+    case services.ErrInvalidQuantity, services.ErrInsufficientStock, services.ErrGuestCartFull:
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, fallback)
+    }
+}
+
+// mergeGuestCart moves the request's guest cart into the user's cart once they have
+// logged in or registered. A failed merge is logged and leaves the guest cart for the
+// next login; it never fails the login itself.
+func mergeGuestCart(c *gin.Context, carts *services.CartService, userID uint) {
+    if carts == nil {
+        return
+    }
+    token := guestCartToken(c)
+    if token == "" {
+        return
+    }
+    cartID, err := carts.GuestCartID(token)
+    if err == nil {
+        err = carts.MergeGuestCart(cartID, userID)
+    }
+    switch errors.Cause(err) {
+    case nil, services.ErrInvalidGuestCart:
+        clearGuestCartCookie(c)
+    case services.ErrGuestCartsDisabled:
+    default:
+        carts.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "MERGE_CART_FAILED",
+        }).Warn("Failed to merge guest cart")
+    }
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// MFAHandler handles HTTP requests for TOTP enrollment and the second login step
+type MFAHandler struct {
+    MFAService   *services.MFAService
+    TokenService *services.TokenService
+    Carts        *services.CartService // optional; merges guest carts on login
+}
+
+// NewMFAHandler creates a new MFAHandler
+func NewMFAHandler(mfaService *services.MFAService, tokenService *services.TokenService) *MFAHandler {
+    return &MFAHandler{MFAService: mfaService, TokenService: tokenService}
+}
+
+// mfaCodeInput carries either a TOTP code or a recovery code
+type mfaCodeInput struct {
+    Code         string `json:"code"`
+    RecoveryCode string `json:"recovery_code"`
+}
+
+// VerifyLogin handles POST /api/v1/mfa/verify, exchanging the challenge from Login
+// and a code for a token pair
+func (h *MFAHandler) VerifyLogin(c *gin.Context) {
+    var input struct {
+        MFAToken string `json:"mfa_token" binding:"required"`
+        mfaCodeInput
+    }
+    if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+        utils.RespondWithError(c, http.StatusBadRequest, "mfa_token and code or recovery_code are required")
+        return
+    }
+
+    userID, recoveryCodes, err := h.MFAService.CompleteLogin(input.MFAToken, input.Code, input.RecoveryCode)
+    if err != nil {
+        h.respondWithMFAError(c, err, "Failed to verify two-factor code")
+        return
+    }
+    pair, err := h.TokenService.IssueTokens(userID)
+    if err == services.ErrAccountSuspended {
+        c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "ACCOUNT_SUSPENDED"})
+        return
+    }
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+        return
+    }
+    mergeGuestCart(c, h.Carts, userID)
+    response := loginResponse(pair)
+    if recoveryCodes != nil {
+        response["recovery_codes"] = recoveryCodes
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// EnrollForLogin handles POST /api/v1/mfa/enroll, for users who must enroll before
+// their login can complete
+func (h *MFAHandler) EnrollForLogin(c *gin.Context) {
+    var input struct {
+        MFAToken string `json:"mfa_token" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    enrollment, err := h.MFAService.EnrollForChallenge(input.MFAToken)
+    if err != nil {
+        h.respondWithMFAError(c, err, "Failed to start two-factor enrollment")
+        return
+    }
+    c.JSON(http.StatusOK, enrollment)
+}
+
+// GetStatus handles GET /api/v1/users/mfa
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+    u := c.MustGet("user").(models.User)
+    status, err := h.MFAService.Status(u.ID)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch two-factor status")
+        return
+    }
+    c.JSON(http.StatusOK, status)
+}
+
+// StartEnrollment handles POST /api/v1/users/mfa/totp
+func (h *MFAHandler) StartEnrollment(c *gin.Context) {
+    u := c.MustGet("user").(models.User)
+    enrollment, err := h.MFAService.StartEnrollment(u.ID)
+    if err != nil {
+        h.respondWithMFAError(c, err, "Failed to start two-factor enrollment")
+        return
+    }
+    c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmEnrollment handles POST /api/v1/users/mfa/totp/confirm
+func (h *MFAHandler) ConfirmEnrollment(c *gin.Context) {
+    var input struct {
+        Code string `json:"code" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    u := c.MustGet("user").(models.User)
+    codes, err := h.MFAService.ConfirmEnrollment(u.ID, input.Code)
+    if err != nil {
+        h.respondWithMFAError(c, err, "Failed to confirm two-factor enrollment")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable handles DELETE /api/v1/users/mfa/totp
+func (h *MFAHandler) Disable(c *gin.Context) {
+    var input mfaCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+        utils.RespondWithError(c, http.StatusBadRequest, "code or recovery_code is required")
+        return
+    }
+    u := c.MustGet("user").(models.User)
+    if err := h.MFAService.Disable(u.ID, input.Code, input.RecoveryCode); err != nil {
+        h.respondWithMFAError(c, err, "Failed to disable two-factor authentication")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes handles POST /api/v1/users/mfa/recovery-codes
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+    var input mfaCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+        utils.RespondWithError(c, http.StatusBadRequest, "code or recovery_code is required")
+        return
+    }
+    u := c.MustGet("user").(models.User)
+    codes, err := h.MFAService.RegenerateRecoveryCodes(u.ID, input.Code, input.RecoveryCode)
+    if err != nil {
+        h.respondWithMFAError(c, err, "Failed to regenerate recovery codes")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *MFAHandler) respondWithMFAError(c *gin.Context, err error, fallback string) {
+    switch errors.Cause(err) {
+    case services.ErrInvalidMFACode, services.ErrInvalidMFAChallenge:
+        utils.RespondWithError(c, http.StatusUnauthorized, err.Error())
+    case services.ErrMFAAlreadyEnabled:
+        utils.RespondWithError(c, http.StatusConflict, err.Error())
+    case services.ErrMFANotEnabled, services.ErrMFAEnrollmentNeeded:
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+    case services.ErrMFARequired:
+        utils.RespondWithError(c, http.StatusForbidden, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, fallback)
+    }
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// OIDCHandler handles HTTP requests for logging in with, and linking, external
+// identity providers
+type OIDCHandler struct {
+    OIDCService  *services.OIDCService
+    MFAService   *services.MFAService
+    TokenService *services.TokenService
+    Config       *config.Config
+    Carts        *services.CartService // optional; merges guest carts on login
+}
+
+// NewOIDCHandler creates a new OIDCHandler
+func NewOIDCHandler(oidcService *services.OIDCService, mfaService *services.MFAService, tokenService *services.TokenService, cfg *config.Config) *OIDCHandler {
+    return &OIDCHandler{OIDCService: oidcService, MFAService: mfaService, TokenService: tokenService, Config: cfg}
+}
+
+// GetProviders handles GET /api/v1/auth/oidc/providers
+func (h *OIDCHandler) GetProviders(c *gin.Context) {
+    c.JSON(http.StatusOK, gin.H{"providers": h.OIDCService.Providers()})
+}
+
+// Login handles GET /api/v1/auth/oidc/:provider/login by redirecting to the provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+    target, err := h.OIDCService.AuthorizationURL(c.Request.Context(), c.Param("provider"), 0)
+    if err != nil {
+        h.respondWithOIDCError(c, err, "Failed to start login")
+        return
+    }
+    c.Redirect(http.StatusFound, target)
+}
+
+// Callback handles GET /api/v1/auth/oidc/:provider/callback. Logins get the same
+// response as a password login, including the MFA challenge when one is due.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+    if reason := c.Query("error"); reason != "" {
+        utils.RespondWithError(c, http.StatusBadRequest, "Identity provider denied the login: "+reason)
+        return
+    }
+    user, linked, err := h.OIDCService.HandleCallback(c.Request.Context(), c.Param("provider"), c.Query("code"), c.Query("state"))
+    if err != nil {
+        h.respondWithOIDCError(c, err, "Failed to complete login")
+        return
+    }
+    if linked {
+        c.JSON(http.StatusOK, gin.H{"message": "Identity provider linked"})
+        return
+    }
+
+    if h.Config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+        c.JSON(http.StatusForbidden, gin.H{"error": services.ErrEmailNotVerified.Error(), "code": "EMAIL_NOT_VERIFIED"})
+        return
+    }
+    challenge, err := h.MFAService.BeginLogin(user)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to complete login")
+        return
+    }
+    if challenge != nil {
+        c.JSON(http.StatusOK, mfaChallengeResponse(challenge))
+        return
+    }
+    pair, err := h.TokenService.IssueTokens(user.ID)
+    if err == services.ErrAccountSuspended {
+        c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "ACCOUNT_SUSPENDED"})
+        return
+    }
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to generate token")
+        return
+    }
+    mergeGuestCart(c, h.Carts, user.ID)
+    c.JSON(http.StatusOK, loginResponse(pair))
+}
+
+// GetIdentities handles GET /api/v1/users/identities
+func (h *OIDCHandler) GetIdentities(c *gin.Context) {
+    u := c.MustGet("user").(models.User)
+    identities, err := h.OIDCService.Identities(u.ID)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch linked providers")
+        return
+    }
+    c.JSON(http.StatusOK, identities)
+}
+
+// LinkIdentity handles POST /api/v1/users/identities/:provider. It returns the URL to
+// send the browser to; the provider's callback completes the link.
+func (h *OIDCHandler) LinkIdentity(c *gin.Context) {
+    u := c.MustGet("user").(models.User)
+    target, err := h.OIDCService.AuthorizationURL(c.Request.Context(), c.Param("provider"), u.ID)
+    if err != nil {
+        h.respondWithOIDCError(c, err, "Failed to start linking")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"authorization_url": target})
+}
+
+// UnlinkIdentity handles DELETE /api/v1/users/identities/:provider
+func (h *OIDCHandler) UnlinkIdentity(c *gin.Context) {
+    u := c.MustGet("user").(models.User)
+    if err := h.OIDCService.Unlink(u.ID, c.Param("provider")); err != nil {
+        h.respondWithOIDCError(c, err, "Failed to unlink provider")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Identity provider unlinked"})
+}
+
+func (h *OIDCHandler) respondWithOIDCError(c *gin.Context, err error, fallback string) {
+    switch errors.Cause(err) {
+    case services.ErrUnknownOIDCProvider, services.ErrIdentityNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, err.Error())
+    case services.ErrInvalidOIDCState, services.ErrLastLoginMethod:
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+    case services.ErrInvalidIDToken, services.ErrOIDCExchangeFailed:
+        utils.RespondWithError(c, http.StatusBadGateway, errors.Cause(err).Error())
+    case services.ErrOIDCAccountExists, services.ErrIdentityInUse:
+        utils.RespondWithError(c, http.StatusConflict, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, fallback)
+    }
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// OrderHandler handles HTTP requests for orders
+type OrderHandler struct {
+    OrderService *services.OrderService
+}
+
+// NewOrderHandler creates a new OrderHandler
+func NewOrderHandler(orderService *services.OrderService) *OrderHandler {
+    return &OrderHandler{OrderService: orderService}
+}
+
+// Checkout handles POST /api/v1/orders/checkout
+func (h *OrderHandler) Checkout(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        h.OrderService.Logger.WithFields(logrus.Fields{
+            "path": c.Request.URL.Path,
+        }).Warn("No user in context for POST /api/v1/orders/checkout")
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    userID := user.(models.User).ID
+
+    var input struct {
+        AddressID      uint   `json:"address_id"` // 0 ships to the default address
+        ShippingMethod string `json:"shipping_method"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    order, err := h.OrderService.Checkout(userID, input.AddressID, input.ShippingMethod)
+    if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrEmptyCart, services.ErrTaxAddressRequired, services.ErrShippingAddressRequired, services.ErrShippingMethodRequired:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        case services.ErrAddressNotFound, services.ErrShippingMethodNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, err.Error())
+        case services.ErrShippingUnavailable:
+            utils.RespondWithError(c, http.StatusUnprocessableEntity, err.Error())
+        case services.ErrInsufficientStock, services.ErrCouponUsageLimit, services.ErrCouponUserLimit, services.ErrCartChanged:
+            utils.RespondWithError(c, http.StatusConflict, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to place order")
+        }
+        return
+    }
+    c.JSON(http.StatusCreated, order)
+}
+
+// GetOrders handles GET /api/v1/orders
+func (h *OrderHandler) GetOrders(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    orders, err := h.OrderService.GetOrders(user.(models.User).ID)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch orders")
+        return
+    }
+    c.JSON(http.StatusOK, orders)
+}
+
+// GetOrder handles GET /api/v1/orders/:id
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid order ID")
+        return
+    }
+    order, err := h.OrderService.GetOrder(user.(models.User).ID, uint(id))
+    if err != nil {
+        utils.RespondWithError(c, http.StatusNotFound, "Order not found")
+        return
+    }
+    c.JSON(http.StatusOK, order)
+}
+
+// ListOrders handles GET /api/v1/admin/orders?status=paid&page=1&limit=10
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+    page, limit, ok := parsePagination(c)
+    if !ok {
+        return
+    }
+    orders, total, err := h.OrderService.ListOrders(c.Query("status"), page, limit)
+    if err != nil {
+        if errors.Cause(err) == services.ErrInvalidOrderStatus {
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid order status")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch orders")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "orders": orders,
+        "page":   page,
+        "limit":  limit,
+        "total":  total,
+    })
+}
+
+// GetOrderAdmin handles GET /api/v1/admin/orders/:id
+func (h *OrderHandler) GetOrderAdmin(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid order ID")
+        return
+    }
+    order, err := h.OrderService.GetOrderByID(uint(id))
+    if err != nil {
+        utils.RespondWithError(c, http.StatusNotFound, "Order not found")
+        return
+    }
+    c.JSON(http.StatusOK, order)
+}
+
+// AdvanceOrder handles PUT /api/v1/admin/orders/:id/status
+func (h *OrderHandler) AdvanceOrder(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid order ID")
+        return
+    }
+    var input struct {
+        Status string `json:"status" binding:"required"`
+        Reason string `json:"reason"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    order, err := h.OrderService.AdvanceOrder(user.(models.User).ID, uint(id), input.Status, input.Reason)
+    if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrInvalidOrderStatus:
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid order status")
+        case services.ErrOrderStatusManaged:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        case services.ErrOrderNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, "Order not found")
+        case services.ErrInvalidOrderTransition, services.ErrOrderStatusChanged, services.ErrPaymentPending, services.ErrInvalidPaymentTransition:
+            utils.RespondWithError(c, http.StatusConflict, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to update order status")
+        }
+        return
+    }
+    c.JSON(http.StatusOK, order)
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+)
+
+// parsePagination reads page and limit query parameters, responding with 400 when they are invalid
+func parsePagination(c *gin.Context) (int, int, bool) {
+    page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+    if err != nil || page < 1 {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid page number")
+        return 0, 0, false
+    }
+
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+    if err != nil || limit < 1 || limit > 100 {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid limit, must be between 1 and 100")
+        return 0, 0, false
+    }
+    return page, limit, true
+}
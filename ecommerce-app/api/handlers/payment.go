@@ -0,0 +1,170 @@
+package handlers
+
+import (
+    "io"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// PaymentSignatureHeader carries the HMAC-SHA256 signature of a payment webhook body
+const PaymentSignatureHeader = "X-Payment-Signature"
+
+// PaymentHandler handles HTTP requests for order payments
+type PaymentHandler struct {
+    PaymentService *services.PaymentService
+}
+
+// NewPaymentHandler creates a new PaymentHandler
+func NewPaymentHandler(paymentService *services.PaymentService) *PaymentHandler {
+    return &PaymentHandler{PaymentService: paymentService}
+}
+
+// PayOrder handles POST /api/v1/orders/:id/payments
+func (h *PaymentHandler) PayOrder(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    orderID, ok := parsePaymentID(c, "Invalid order ID")
+    if !ok {
+        return
+    }
+    payment, err := h.PaymentService.PayOrder(user.(models.User).ID, orderID)
+    switch errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusCreated, payment)
+    case services.ErrPaymentPending:
+        c.JSON(http.StatusAccepted, payment)
+    case services.ErrPaymentDeclined:
+        utils.RespondWithError(c, http.StatusPaymentRequired, err.Error())
+    case services.ErrOrderNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Order not found")
+    case services.ErrOrderNotPayable, services.ErrOrderAlreadyPaid:
+        utils.RespondWithError(c, http.StatusConflict, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusBadGateway, "Payment failed")
+    }
+}
+
+// GetOrderPayments handles GET /api/v1/orders/:id/payments
+func (h *PaymentHandler) GetOrderPayments(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    orderID, ok := parsePaymentID(c, "Invalid order ID")
+    if !ok {
+        return
+    }
+    payments, err := h.PaymentService.GetOrderPayments(user.(models.User).ID, orderID)
+    if err != nil {
+        if errors.Cause(err) == services.ErrOrderNotFound {
+            utils.RespondWithError(c, http.StatusNotFound, "Order not found")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch payments")
+        return
+    }
+    c.JSON(http.StatusOK, payments)
+}
+
+// CapturePayment handles POST /api/v1/admin/payments/:id/capture
+func (h *PaymentHandler) CapturePayment(c *gin.Context) {
+    id, ok := parsePaymentID(c, "Invalid payment ID")
+    if !ok {
+        return
+    }
+    payment, err := h.PaymentService.CapturePayment(id)
+    if err != nil {
+        respondWithPaymentError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, payment)
+}
+
+// VoidPayment handles POST /api/v1/admin/payments/:id/void
+func (h *PaymentHandler) VoidPayment(c *gin.Context) {
+    id, ok := parsePaymentID(c, "Invalid payment ID")
+    if !ok {
+        return
+    }
+    payment, err := h.PaymentService.VoidPayment(id)
+    if err != nil {
+        respondWithPaymentError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, payment)
+}
+
+// RefundPayment handles POST /api/v1/admin/payments/:id/refund; omit amount for a full refund
+func (h *PaymentHandler) RefundPayment(c *gin.Context) {
+    id, ok := parsePaymentID(c, "Invalid payment ID")
+    if !ok {
+        return
+    }
+    var input struct {
+        Amount float64 `json:"amount"`
+    }
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&input); err != nil {
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+            return
+        }
+    }
+    payment, err := h.PaymentService.RefundPayment(id, input.Amount)
+    if err != nil {
+        respondWithPaymentError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, payment)
+}
+
+// HandleWebhook handles POST /api/v1/payments/webhook
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+    body, err := io.ReadAll(c.Request.Body)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid body")
+        return
+    }
+    err = h.PaymentService.HandleWebhook(body, c.GetHeader(PaymentSignatureHeader))
+    switch errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, gin.H{"message": "Webhook processed"})
+    case services.ErrInvalidWebhookSignature:
+        utils.RespondWithError(c, http.StatusUnauthorized, err.Error())
+    case services.ErrInvalidWebhookPayload, services.ErrInvalidRefundAmount:
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+    case services.ErrPaymentNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Payment not found")
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to process webhook")
+    }
+}
+
+func parsePaymentID(c *gin.Context, message string) (uint, bool) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, message)
+        return 0, false
+    }
+    return uint(id), true
+}
+
+func respondWithPaymentError(c *gin.Context, err error) {
+    switch errors.Cause(err) {
+    case services.ErrPaymentNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Payment not found")
+    case services.ErrInvalidPaymentTransition, services.ErrInvalidRefundAmount, services.ErrPaymentStatusChanged:
+        utils.RespondWithError(c, http.StatusConflict, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusBadGateway, "Payment provider request failed")
+    }
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// UpdateProfile handles PATCH /api/v1/users/profile. A new email address is only
+// used once the link mailed to it is followed; until then it is reported as pending.
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+    var input services.ProfileInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    u := c.MustGet("user").(models.User)
+    user, err := h.Profiles.UpdateProfile(u.ID, input)
+    switch errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, profileResponse(user))
+    case services.ErrNoProfileChanges, services.ErrInvalidUsername, services.ErrInvalidEmail, services.ErrEmailUnchanged:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case services.ErrUsernameTaken, services.ErrEmailInUse:
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        h.Logger.WithFields(logrus.Fields{
+            "user_id":    u.ID,
+            "error":      err,
+            "error_code": "UPDATE_PROFILE_FAILED",
+        }).Error("Failed to update profile")
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+    }
+}
+
+// ConfirmEmailChange handles POST /api/v1/email/change/confirm with the token mailed
+// to the new address
+func (h *UserHandler) ConfirmEmailChange(c *gin.Context) {
+    var input struct {
+        Token string `json:"token" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    switch err := h.AccountService.ConfirmEmailChange(input.Token); errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, gin.H{"message": "Email address changed"})
+    case services.ErrInvalidUserToken:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case services.ErrEmailInUse:
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+    }
+}
+
+// RequestDataExport handles POST /api/v1/users/data-exports. The archive is built in
+// the background; poll the export until its status is "ready".
+func (h *UserHandler) RequestDataExport(c *gin.Context) {
+    u := c.MustGet("user").(models.User)
+    export, err := h.Profiles.RequestDataExport(u.ID)
+    switch errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusAccepted, export)
+    case services.ErrExportInProgress:
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request data export"})
+    }
+}
+
+// GetDataExports handles GET /api/v1/users/data-exports
+func (h *UserHandler) GetDataExports(c *gin.Context) {
+    u := c.MustGet("user").(models.User)
+    exports, err := h.Profiles.GetDataExports(u.ID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch data exports"})
+        return
+    }
+    c.JSON(http.StatusOK, exports)
+}
+
+// GetDataExport handles GET /api/v1/users/data-exports/:id
+func (h *UserHandler) GetDataExport(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data export ID"})
+        return
+    }
+    u := c.MustGet("user").(models.User)
+    export, err := h.Profiles.GetDataExport(u.ID, uint(id))
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, export)
+}
+
+// DownloadDataExport handles GET /api/v1/users/data-exports/:id/download
+func (h *UserHandler) DownloadDataExport(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data export ID"})
+        return
+    }
+    u := c.MustGet("user").(models.User)
+    path, err := h.Profiles.DataExportFile(u.ID, uint(id))
+    switch errors.Cause(err) {
+    case nil:
+        c.Header("Cache-Control", "no-store")
+        c.FileAttachment(path, fmt.Sprintf("data-export-%d.json", id))
+    case services.ErrExportNotFound:
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+    case services.ErrExportNotReady:
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    case services.ErrExportExpired:
+        c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download data export"})
+    }
+}
+
+// DeleteAccount handles DELETE /api/v1/users/account. Personal data is erased and the
+// account can no longer log in; orders are kept without the recipient's details.
+func (h *UserHandler) DeleteAccount(c *gin.Context) {
+    var input struct {
+        Password string `json:"password"`
+        Confirm  string `json:"confirm" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    u := c.MustGet("user").(models.User)
+    switch err := h.Profiles.EraseAccount(u.ID, input.Password, input.Confirm); errors.Cause(err) {
+    case nil:
+        h.Logger.WithFields(logrus.Fields{
+            "user_id": u.ID,
+        }).Info("User erased their account")
+        c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+    case services.ErrErasureNotConfirmed:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case services.ErrIncorrectPassword:
+        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+    case services.ErrAccountAlreadyErased:
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+    }
+}
+
+// profileResponse is the body of profile reads and updates
+func profileResponse(u *models.User) gin.H {
+    profile := gin.H{
+        "id":             u.ID,
+        "username":       u.Username,
+        "email":          u.Email,
+        "email_verified": u.EmailVerifiedAt != nil,
+        "role":           u.Role,
+    }
+    if u.PendingEmail != "" {
+        profile["pending_email"] = u.PendingEmail
+    }
+    return profile
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// ReturnHandler handles HTTP requests for returns
+type ReturnHandler struct {
+    ReturnService *services.ReturnService
+}
+
+// NewReturnHandler creates a new ReturnHandler
+func NewReturnHandler(returnService *services.ReturnService) *ReturnHandler {
+    return &ReturnHandler{ReturnService: returnService}
+}
+
+// RequestReturn handles POST /api/v1/orders/:id/returns
+func (h *ReturnHandler) RequestReturn(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    orderID, ok := parseReturnID(c, "Invalid order ID")
+    if !ok {
+        return
+    }
+    var input struct {
+        Items []services.ReturnItemInput `json:"items" binding:"required,dive"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+    request, err := h.ReturnService.RequestReturn(user.(models.User).ID, orderID, input.Items)
+    if err != nil {
+        respondWithReturnError(c, err)
+        return
+    }
+    c.JSON(http.StatusCreated, request)
+}
+
+// GetReturns handles GET /api/v1/returns
+func (h *ReturnHandler) GetReturns(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    requests, err := h.ReturnService.GetReturns(user.(models.User).ID)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch returns")
+        return
+    }
+    c.JSON(http.StatusOK, requests)
+}
+
+// GetReturn handles GET /api/v1/returns/:id
+func (h *ReturnHandler) GetReturn(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    id, ok := parseReturnID(c, "Invalid return ID")
+    if !ok {
+        return
+    }
+    request, err := h.ReturnService.GetReturn(user.(models.User).ID, id)
+    if err != nil {
+        respondWithReturnError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, request)
+}
+
+// ListReturns handles GET /api/v1/admin/returns?status=requested&page=1&limit=10
+func (h *ReturnHandler) ListReturns(c *gin.Context) {
+    page, limit, ok := parsePagination(c)
+    if !ok {
+        return
+    }
+    requests, total, err := h.ReturnService.ListReturns(c.Query("status"), page, limit)
+    if err != nil {
+        if errors.Cause(err) == services.ErrInvalidReturnStatus {
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid return status")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch returns")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "returns": requests,
+        "page":    page,
+        "limit":   limit,
+        "total":   total,
+    })
+}
+
+// ApproveReturn handles PUT /api/v1/admin/returns/:id/approve; omit refund_amount to refund in full
+func (h *ReturnHandler) ApproveReturn(c *gin.Context) {
+    id, ok := parseReturnID(c, "Invalid return ID")
+    if !ok {
+        return
+    }
+    var input struct {
+        RefundAmount float64 `json:"refund_amount"`
+        Note         string  `json:"note"`
+    }
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&input); err != nil {
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+            return
+        }
+    }
+    request, err := h.ReturnService.ApproveReturn(id, input.RefundAmount, input.Note)
+    if err != nil {
+        respondWithReturnError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, request)
+}
+
+// RejectReturn handles PUT /api/v1/admin/returns/:id/reject
+func (h *ReturnHandler) RejectReturn(c *gin.Context) {
+    id, ok := parseReturnID(c, "Invalid return ID")
+    if !ok {
+        return
+    }
+    var input struct {
+        Note string `json:"note"`
+    }
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&input); err != nil {
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+            return
+        }
+    }
+    request, err := h.ReturnService.RejectReturn(id, input.Note)
+    if err != nil {
+        respondWithReturnError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, request)
+}
+
+// ReceiveReturn handles PUT /api/v1/admin/returns/:id/receive
+func (h *ReturnHandler) ReceiveReturn(c *gin.Context) {
+    id, ok := parseReturnID(c, "Invalid return ID")
+    if !ok {
+        return
+    }
+    request, err := h.ReturnService.ReceiveReturn(id)
+    if err != nil {
+        respondWithReturnError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, request)
+}
+
+// RefundReturn handles PUT /api/v1/admin/returns/:id/refund
+func (h *ReturnHandler) RefundReturn(c *gin.Context) {
+    id, ok := parseReturnID(c, "Invalid return ID")
+    if !ok {
+        return
+    }
+    request, err := h.ReturnService.RefundReturn(id)
+    if err != nil {
+        respondWithReturnError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, request)
+}
+
+func parseReturnID(c *gin.Context, message string) (uint, bool) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, message)
+        return 0, false
+    }
+    return uint(id), true
+}
+
+func respondWithReturnError(c *gin.Context, err error) {
+    switch errors.Cause(err) {
+    case services.ErrReturnNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Return not found")
+    case services.ErrOrderNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Order not found")
+    case services.ErrProductNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Product not found")
+    case services.ErrInvalidReturn, services.ErrReturnQuantityExceeded, services.ErrInvalidRefundAmount:
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+    case services.ErrOrderNotReturnable, services.ErrInvalidReturnTransition, services.ErrReturnStatusChanged:
+        utils.RespondWithError(c, http.StatusConflict, err.Error())
+    case services.ErrPaymentFailed:
+        utils.RespondWithError(c, http.StatusBadGateway, "Refund failed")
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, "Return request failed")
+    }
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// ReviewHandler handles HTTP requests for product reviews
+type ReviewHandler struct {
+    ReviewService *services.ReviewService
+}
+
+// NewReviewHandler creates a new ReviewHandler
+func NewReviewHandler(reviewService *services.ReviewService) *ReviewHandler {
+    return &ReviewHandler{ReviewService: reviewService}
+}
+
+// CreateReview handles POST /api/v1/products/:id/reviews
+func (h *ReviewHandler) CreateReview(c *gin.Context) {
+    user, exists := c.Get("user")
+    if !exists {
+        h.ReviewService.Logger.WithFields(logrus.Fields{
+            "path": c.Request.URL.Path,
+        }).Warn("No user in context for POST /api/v1/products/:id/reviews")
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return
+    }
+    userID := user.(models.User).ID
+
+    productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        h.ReviewService.Logger.WithFields(logrus.Fields{
+            "id":         c.Param("id"),
+            "error":      err,
+            "error_code": "INVALID_PRODUCT_ID",
+        }).Warn("Invalid product ID")
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid product ID")
+        return
+    }
+
+    var input struct {
+        Rating int    `json:"rating" binding:"required,min=1,max=5"`
+        Body   string `json:"body" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        h.ReviewService.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "INVALID_INPUT",
+        }).Warn("Invalid input for POST /api/v1/products/:id/reviews")
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    review, err := h.ReviewService.CreateReview(userID, uint(productID), input.Rating, input.Body)
+    if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrProductNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, "Product not found")
+        case services.ErrNotPurchased:
+            utils.RespondWithError(c, http.StatusForbidden, err.Error())
+        case services.ErrAlreadyReviewed:
+            utils.RespondWithError(c, http.StatusConflict, err.Error())
+        case services.ErrInvalidRating, services.ErrInvalidReviewBody:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to create review")
+        }
+        return
+    }
+
+    c.JSON(http.StatusCreated, review)
+}
+
+// ListProductReviews handles GET /api/v1/products/:id/reviews?page=1&limit=10&sort=newest
+func (h *ReviewHandler) ListProductReviews(c *gin.Context) {
+    productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        h.ReviewService.Logger.WithFields(logrus.Fields{
+            "id":         c.Param("id"),
+            "error":      err,
+            "error_code": "INVALID_PRODUCT_ID",
+        }).Warn("Invalid product ID")
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid product ID")
+        return
+    }
+
+    page, limit, ok := parsePagination(c)
+    if !ok {
+        return
+    }
+    sort := c.DefaultQuery("sort", "newest")
+
+    reviews, total, err := h.ReviewService.ListProductReviews(uint(productID), sort, page, limit)
+    if err != nil {
+        if errors.Cause(err) == services.ErrInvalidReviewSort {
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid sort, must be one of newest, oldest, rating_desc, rating_asc")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch reviews")
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "reviews": reviews,
+        "page":    page,
+        "limit":   limit,
+        "total":   total,
+    })
+}
+
+// ListReviewsByStatus handles GET /api/v1/admin/reviews?status=pending&page=1&limit=10
+func (h *ReviewHandler) ListReviewsByStatus(c *gin.Context) {
+    page, limit, ok := parsePagination(c)
+    if !ok {
+        return
+    }
+    status := c.DefaultQuery("status", models.ReviewStatusPending)
+
+    reviews, total, err := h.ReviewService.ListReviewsByStatus(status, page, limit)
+    if err != nil {
+        if errors.Cause(err) == services.ErrInvalidReviewStatus {
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid review status")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch reviews")
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "reviews": reviews,
+        "page":    page,
+        "limit":   limit,
+        "total":   total,
+    })
+}
+
+// ModerateReview handles PUT /api/v1/admin/reviews/:id/status
+func (h *ReviewHandler) ModerateReview(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        h.ReviewService.Logger.WithFields(logrus.Fields{
+            "id":         c.Param("id"),
+            "error":      err,
+            "error_code": "INVALID_REVIEW_ID",
+        }).Warn("Invalid review ID")
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid review ID")
+        return
+    }
+
+    var input struct {
+        Status string `json:"status" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    review, err := h.ReviewService.ModerateReview(uint(id), input.Status)
+    if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrInvalidReviewStatus:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        case services.ErrReviewNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, "Review not found")
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to moderate review")
+        }
+        return
+    }
+
+    c.JSON(http.StatusOK, review)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// RoleHandler handles HTTP requests for roles and role assignments
+type RoleHandler struct {
+    RoleService *services.RoleService
+}
+
+// NewRoleHandler creates a new RoleHandler
+func NewRoleHandler(roleService *services.RoleService) *RoleHandler {
+    return &RoleHandler{RoleService: roleService}
+}
+
+// GetPermissions handles GET /api/v1/admin/permissions
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+    c.JSON(http.StatusOK, models.AllPermissions)
+}
+
+// GetRoles handles GET /api/v1/admin/roles
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+    roles, err := h.RoleService.GetRoles()
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch roles")
+        return
+    }
+    c.JSON(http.StatusOK, roles)
+}
+
+// CreateRole handles POST /api/v1/admin/roles
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+    var role models.Role
+    if err := c.ShouldBindJSON(&role); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    if err := h.RoleService.CreateRole(c.MustGet("user").(models.User).ID, &role); err != nil {
+        switch errors.Cause(err) {
+        case services.ErrInvalidRole:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        case services.ErrRoleBeyondCaller:
+            utils.RespondWithError(c, http.StatusForbidden, err.Error())
+        case services.ErrRoleExists:
+            utils.RespondWithError(c, http.StatusConflict, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to create role")
+        }
+        return
+    }
+    c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole handles PUT /api/v1/admin/roles/:name
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+    var input models.Role
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    role, err := h.RoleService.UpdateRole(c.MustGet("user").(models.User).ID, c.Param("name"), &input)
+    if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrRoleNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, "Role not found")
+        case services.ErrInvalidRole:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        case services.ErrRoleBeyondCaller, services.ErrCannotEditOwnRole:
+            utils.RespondWithError(c, http.StatusForbidden, err.Error())
+        case services.ErrAdminRolePermissions:
+            utils.RespondWithError(c, http.StatusConflict, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to update role")
+        }
+        return
+    }
+    c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole handles DELETE /api/v1/admin/roles/:name
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+    if err := h.RoleService.DeleteRole(c.Param("name")); err != nil {
+        switch errors.Cause(err) {
+        case services.ErrRoleNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, "Role not found")
+        case services.ErrBuiltInRole, services.ErrRoleInUse:
+            utils.RespondWithError(c, http.StatusConflict, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to delete role")
+        }
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
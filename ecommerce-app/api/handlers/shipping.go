@@ -0,0 +1,104 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// ShippingHandler handles HTTP requests for shipping methods
+type ShippingHandler struct {
+    ShippingService *services.ShippingService
+}
+
+// NewShippingHandler creates a new ShippingHandler
+func NewShippingHandler(shippingService *services.ShippingService) *ShippingHandler {
+    return &ShippingHandler{ShippingService: shippingService}
+}
+
+// GetShippingMethods handles GET /api/v1/shipping-methods
+func (h *ShippingHandler) GetShippingMethods(c *gin.Context) {
+    methods, err := h.ShippingService.GetShippingMethods(true)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch shipping methods")
+        return
+    }
+    c.JSON(http.StatusOK, methods)
+}
+
+// GetAllShippingMethods handles GET /api/v1/admin/shipping-methods, including inactive ones
+func (h *ShippingHandler) GetAllShippingMethods(c *gin.Context) {
+    methods, err := h.ShippingService.GetShippingMethods(false)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch shipping methods")
+        return
+    }
+    c.JSON(http.StatusOK, methods)
+}
+
+// CreateShippingMethod handles POST /api/v1/admin/shipping-methods
+func (h *ShippingHandler) CreateShippingMethod(c *gin.Context) {
+    method := models.ShippingMethod{Active: true}
+    if err := c.ShouldBindJSON(&method); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    if err := h.ShippingService.CreateShippingMethod(&method); err != nil {
+        if errors.Cause(err) == services.ErrInvalidShippingMethod {
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to create shipping method")
+        return
+    }
+    c.JSON(http.StatusCreated, method)
+}
+
+// UpdateShippingMethod handles PUT /api/v1/admin/shipping-methods/:id
+func (h *ShippingHandler) UpdateShippingMethod(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid shipping method ID")
+        return
+    }
+    method := models.ShippingMethod{Active: true}
+    if err := c.ShouldBindJSON(&method); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    if err := h.ShippingService.UpdateShippingMethod(uint(id), &method); err != nil {
+        switch errors.Cause(err) {
+        case services.ErrShippingMethodNotFound:
+            utils.RespondWithError(c, http.StatusNotFound, "Shipping method not found")
+        case services.ErrInvalidShippingMethod:
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        default:
+            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to update shipping method")
+        }
+        return
+    }
+    c.JSON(http.StatusOK, method)
+}
+
+// DeleteShippingMethod handles DELETE /api/v1/admin/shipping-methods/:id
+func (h *ShippingHandler) DeleteShippingMethod(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid shipping method ID")
+        return
+    }
+    if err := h.ShippingService.DeleteShippingMethod(uint(id)); err != nil {
+        if errors.Cause(err) == services.ErrShippingMethodNotFound {
+            utils.RespondWithError(c, http.StatusNotFound, "Shipping method not found")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to delete shipping method")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Shipping method deleted successfully"})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// TaxRateHandler handles admin HTTP requests for the tax table
+type TaxRateHandler struct {
+    TaxRateService *services.TaxRateService
+}
+
+// NewTaxRateHandler creates a new TaxRateHandler
+func NewTaxRateHandler(taxRateService *services.TaxRateService) *TaxRateHandler {
+    return &TaxRateHandler{TaxRateService: taxRateService}
+}
+
+// CreateTaxRate handles POST /api/v1/admin/tax-rates
+func (h *TaxRateHandler) CreateTaxRate(c *gin.Context) {
+    var rate models.TaxRate
+    if err := c.ShouldBindJSON(&rate); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    if err := h.TaxRateService.CreateTaxRate(&rate); err != nil {
+        if errors.Cause(err) == services.ErrInvalidTaxRate {
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to create tax rate")
+        return
+    }
+    c.JSON(http.StatusCreated, rate)
+}
+
+// GetTaxRates handles GET /api/v1/admin/tax-rates
+func (h *TaxRateHandler) GetTaxRates(c *gin.Context) {
+    rates, err := h.TaxRateService.GetTaxRates()
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch tax rates")
+        return
+    }
+    c.JSON(http.StatusOK, rates)
+}
+
+// DeleteTaxRate handles DELETE /api/v1/admin/tax-rates/:id
+func (h *TaxRateHandler) DeleteTaxRate(c *gin.Context) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid tax rate ID")
+        return
+    }
+    if err := h.TaxRateService.DeleteTaxRate(uint(id)); err != nil {
+        if err == services.ErrTaxRateNotFound {
+            utils.RespondWithError(c, http.StatusNotFound, "Tax rate not found")
+            return
+        }
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to delete tax rate")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Tax rate deleted successfully"})
+}
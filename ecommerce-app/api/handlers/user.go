@@ -1,21 +1,31 @@
 package handlers
 
 import (
+    "math"
     "net/http"
+    "strconv"
 
     "github.com/gin-gonic/gin"
     "github.com/inquisitivefrog/ecommerce-app/config"
     "github.com/inquisitivefrog/ecommerce-app/middleware"
     "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
     "github.com/sirupsen/logrus"
-    "golang.org/x/crypto/bcrypt"
     "gorm.io/gorm"
 )
 
 type UserHandler struct {
-    DB     *gorm.DB
-    Config *config.Config
-    Logger *logrus.Logger
+    DB             *gorm.DB
+    Config         *config.Config
+    Logger         *logrus.Logger
+    TokenService   *services.TokenService
+    AccountService *services.AccountService
+    Passwords      *services.PasswordService
+    LoginGuard     *services.LoginGuard
+    MFA            *services.MFAService
+    Profiles       *services.ProfileService
+    Carts          *services.CartService // optional; merges guest carts on login
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
@@ -33,8 +43,13 @@ func (h *UserHandler) Register(c *gin.Context) {
         return
     }
 
-    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+    hashedPassword, err := h.Passwords.PreparePassword(input.Password, input.Username, input.Email)
     if err != nil {
+        switch errors.Cause(err) {
+        case services.ErrWeakPassword, services.ErrBreachedPassword:
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
         h.Logger.WithFields(logrus.Fields{
             "error":      err,
             "error_code": "HASH_PASSWORD_FAILED",
@@ -45,7 +60,7 @@ func (h *UserHandler) Register(c *gin.Context) {
 
     user := models.User{
         Username: input.Username,
-        Password: string(hashedPassword),
+        Password: hashedPassword,
         Email:    input.Email,
         Role:     "user",
     }
@@ -58,6 +73,17 @@ func (h *UserHandler) Register(c *gin.Context) {
         return
     }
 
+    // A failed email only delays verification; the user can ask for another link
+    if err := h.AccountService.SendVerificationEmail(user.ID); err != nil {
+        h.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "error":      err,
+            "error_code": "SEND_VERIFICATION_FAILED",
+        }).Warn("Failed to send verification email")
+    }
+
+    mergeGuestCart(c, h.Carts, user.ID)
+
     h.Logger.WithFields(logrus.Fields{
         "username": input.Username,
     }).Info("User registered successfully")
@@ -82,6 +108,16 @@ func (h *UserHandler) Login(c *gin.Context) {
         "username": input.Username,
     }).Debug("Login input received")
 
+    if wait, err := h.LoginGuard.Check(input.Username, c.ClientIP()); err != nil {
+        code := "TOO_MANY_ATTEMPTS"
+        if err == services.ErrAccountLocked {
+            code = "ACCOUNT_LOCKED"
+        }
+        c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+        c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "code": code})
+        return
+    }
+
     var user models.User
     if err := h.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
         h.Logger.WithFields(logrus.Fields{
@@ -89,6 +125,7 @@ func (h *UserHandler) Login(c *gin.Context) {
             "error":      err,
             "error_code": "USER_NOT_FOUND",
         }).Warn("User not found")
+        h.LoginGuard.RecordFailure(input.Username, c.ClientIP())
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
         return
     }
@@ -98,17 +135,56 @@ func (h *UserHandler) Login(c *gin.Context) {
         "user_id":  user.ID,
     }).Debug("User retrieved from database")
 
-    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+    if !h.Passwords.CheckPassword(&user, input.Password) {
         h.Logger.WithFields(logrus.Fields{
             "username":   input.Username,
-            "error":      err,
             "error_code": "INVALID_PASSWORD",
         }).Warn("Invalid password")
+        h.LoginGuard.RecordFailure(input.Username, c.ClientIP())
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
         return
     }
+    h.LoginGuard.RecordSuccess(input.Username, c.ClientIP())
+
+    if user.SuspendedAt != nil {
+        h.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "error_code": "ACCOUNT_SUSPENDED",
+        }).Warn("Login blocked for suspended account")
+        c.JSON(http.StatusForbidden, gin.H{"error": services.ErrAccountSuspended.Error(), "code": "ACCOUNT_SUSPENDED"})
+        return
+    }
 
-    token, err := middleware.GenerateJWT(user.ID, h.Config)
+    if h.Config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+        h.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "error_code": "EMAIL_NOT_VERIFIED",
+        }).Warn("Login blocked until email is verified")
+        c.JSON(http.StatusForbidden, gin.H{"error": services.ErrEmailNotVerified.Error(), "code": "EMAIL_NOT_VERIFIED"})
+        return
+    }
+
+    // With a second factor due, the password only earns a challenge for /mfa/verify
+    challenge, err := h.MFA.BeginLogin(&user)
+    if err != nil {
+        h.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "error":      err,
+            "error_code": "MFA_CHALLENGE_FAILED",
+        }).Error("Failed to start two-factor challenge")
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+        return
+    }
+    if challenge != nil {
+        h.Logger.WithFields(logrus.Fields{
+            "user_id":             user.ID,
+            "enrollment_required": challenge.EnrollmentRequired,
+        }).Info("Password accepted; awaiting two-factor code")
+        c.JSON(http.StatusOK, mfaChallengeResponse(challenge))
+        return
+    }
+
+    pair, err := h.TokenService.IssueTokens(user.ID)
     if err != nil {
         h.Logger.WithFields(logrus.Fields{
             "user_id":    user.ID,
@@ -118,12 +194,100 @@ func (h *UserHandler) Login(c *gin.Context) {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
         return
     }
+    mergeGuestCart(c, h.Carts, user.ID)
 
     h.Logger.WithFields(logrus.Fields{
         "username": input.Username,
         "user_id":  user.ID,
     }).Info("User logged in successfully")
-    c.JSON(http.StatusOK, gin.H{"token": token})
+    c.JSON(http.StatusOK, loginResponse(pair))
+}
+
+// loginResponse is the body of every successful login. "token" is kept for clients
+// that predate refresh tokens.
+func loginResponse(pair *services.TokenPair) gin.H {
+    return gin.H{
+        "token":         pair.AccessToken,
+        "access_token":  pair.AccessToken,
+        "refresh_token": pair.RefreshToken,
+        "token_type":    pair.TokenType,
+        "expires_in":    pair.ExpiresIn,
+    }
+}
+
+// mfaChallengeResponse is returned instead of tokens when a second factor is due
+func mfaChallengeResponse(challenge *services.MFAChallenge) gin.H {
+    return gin.H{
+        "mfa_required":        true,
+        "mfa_token":           challenge.Token,
+        "expires_in":          challenge.ExpiresIn,
+        "enrollment_required": challenge.EnrollmentRequired,
+    }
+}
+
+// RefreshToken handles POST /api/v1/token/refresh, rotating the presented refresh token
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+    var input struct {
+        RefreshToken string `json:"refresh_token" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    pair, err := h.TokenService.Refresh(input.RefreshToken)
+    switch errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, pair)
+    case services.ErrInvalidRefreshToken, services.ErrRefreshTokenExpired, services.ErrRefreshTokenReused:
+        h.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "INVALID_REFRESH_TOKEN",
+        }).Warn("Refresh token rejected")
+        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+    case services.ErrAccountSuspended:
+        c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "ACCOUNT_SUSPENDED"})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+    }
+}
+
+// Logout handles POST /api/v1/logout. The current access token is revoked by jti and,
+// when a refresh token is supplied, its whole family is revoked as well.
+func (h *UserHandler) Logout(c *gin.Context) {
+    var input struct {
+        RefreshToken string `json:"refresh_token"`
+    }
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&input); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    u := c.MustGet("user").(models.User)
+    jti := c.GetString("jti")
+    expiresAt := c.GetTime("token_exp")
+    if err := middleware.RevokeToken(c.Request.Context(), h.Config.Cache, jti, expiresAt); err != nil {
+        h.Logger.WithFields(logrus.Fields{
+            "user_id":    u.ID,
+            "error":      err,
+            "error_code": "REVOKE_TOKEN_FAILED",
+        }).Error("Failed to revoke access token")
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+        return
+    }
+    if input.RefreshToken != "" {
+        if err := h.TokenService.Logout(u.ID, input.RefreshToken); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+            return
+        }
+    }
+
+    h.Logger.WithFields(logrus.Fields{
+        "user_id": u.ID,
+    }).Info("User logged out")
+    c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
 }
 
 func (h *UserHandler) GetProfile(c *gin.Context) {
@@ -145,15 +309,137 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
         return
     }
 
-    profile := gin.H{
-        "id":       u.ID,
-        "username": u.Username,
-        "email":    u.Email,
-        "role":     u.Role,
-    }
+    profile := profileResponse(&u)
     h.Logger.WithFields(logrus.Fields{
         "user_id":  u.ID,
         "username": u.Username,
     }).Info("Fetched user profile")
     c.JSON(http.StatusOK, profile)
 }
+
+// VerifyEmail handles POST /api/v1/email/verify
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+    var input struct {
+        Token string `json:"token" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    switch err := h.AccountService.VerifyEmail(input.Token); errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+    case services.ErrInvalidUserToken:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+    }
+}
+
+// ResendVerification handles POST /api/v1/email/verification/resend. The response
+// is the same whether or not the address belongs to an account.
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+    var input struct {
+        Email string `json:"email" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err := h.AccountService.ResendVerificationEmail(input.Email); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+        return
+    }
+    c.JSON(http.StatusAccepted, gin.H{"message": "If the address needs verifying, a link has been sent"})
+}
+
+// ForgotPassword handles POST /api/v1/password/forgot. The response is the same
+// whether or not the address belongs to an account.
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+    var input struct {
+        Email string `json:"email" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err := h.AccountService.RequestPasswordReset(input.Email); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send password reset email"})
+        return
+    }
+    c.JSON(http.StatusAccepted, gin.H{"message": "If the address has an account, a reset link has been sent"})
+}
+
+// ResetPassword handles POST /api/v1/password/reset
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+    var input struct {
+        Token    string `json:"token" binding:"required"`
+        Password string `json:"password" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    switch err := h.AccountService.ResetPassword(input.Token, input.Password); errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+    case services.ErrInvalidUserToken, services.ErrWeakPassword, services.ErrBreachedPassword:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+    }
+}
+
+// ChangePassword handles PUT /api/v1/users/password. Every session is signed out,
+// so the response carries a fresh token pair for the caller.
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+    var input struct {
+        CurrentPassword string `json:"current_password" binding:"required"`
+        NewPassword     string `json:"new_password" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    u := c.MustGet("user").(models.User)
+    err := h.Passwords.ChangePassword(u.ID, input.CurrentPassword, input.NewPassword)
+    switch errors.Cause(err) {
+    case nil:
+    case services.ErrIncorrectPassword:
+        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+        return
+    case services.ErrWeakPassword, services.ErrBreachedPassword, services.ErrPasswordUnchanged:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+        return
+    }
+
+    pair, err := h.TokenService.IssueTokens(u.ID)
+    if err != nil {
+        c.JSON(http.StatusOK, gin.H{"message": "Password changed; please log in again"})
+        return
+    }
+    c.JSON(http.StatusOK, pair)
+}
+
+// UnlockAccount handles POST /api/v1/account/unlock with the token from the lockout email
+func (h *UserHandler) UnlockAccount(c *gin.Context) {
+    var input struct {
+        Token string `json:"token" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    switch err := h.AccountService.UnlockAccount(input.Token); errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+    case services.ErrInvalidUserToken:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+    }
+}
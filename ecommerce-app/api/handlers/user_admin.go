@@ -0,0 +1,236 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+)
+
+// UserAdminHandler handles HTTP requests for managing user accounts
+type UserAdminHandler struct {
+    UserAdminService *services.UserAdminService
+}
+
+// NewUserAdminHandler creates a new UserAdminHandler
+func NewUserAdminHandler(userAdminService *services.UserAdminService) *UserAdminHandler {
+    return &UserAdminHandler{UserAdminService: userAdminService}
+}
+
+// ListUsers handles GET /api/v1/admin/users?search=ann&role=user&page=1&limit=10
+func (h *UserAdminHandler) ListUsers(c *gin.Context) {
+    page, limit, ok := parsePagination(c)
+    if !ok {
+        return
+    }
+    users, total, err := h.UserAdminService.ListUsers(c.Query("search"), c.Query("role"), page, limit)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch users")
+        return
+    }
+    items := make([]gin.H, len(users))
+    for i := range users {
+        items[i] = adminUserResponse(&users[i])
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "users": items,
+        "page":  page,
+        "limit": limit,
+        "total": total,
+    })
+}
+
+// GetUser handles GET /api/v1/admin/users/:id
+func (h *UserAdminHandler) GetUser(c *gin.Context) {
+    userID, ok := parseUserID(c)
+    if !ok {
+        return
+    }
+    user, err := h.UserAdminService.GetUser(userID)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusNotFound, "User not found")
+        return
+    }
+    c.JSON(http.StatusOK, adminUserResponse(user))
+}
+
+// GetAuditLog handles GET /api/v1/admin/users/:id/audit-log
+func (h *UserAdminHandler) GetAuditLog(c *gin.Context) {
+    userID, ok := parseUserID(c)
+    if !ok {
+        return
+    }
+    page, limit, ok := parsePagination(c)
+    if !ok {
+        return
+    }
+    entries, total, err := h.UserAdminService.GetAuditLog(userID, page, limit)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch audit log")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "entries": entries,
+        "page":    page,
+        "limit":   limit,
+        "total":   total,
+    })
+}
+
+// ChangeRole handles PUT /api/v1/admin/users/:id/role
+func (h *UserAdminHandler) ChangeRole(c *gin.Context) {
+    userID, ok := parseUserID(c)
+    if !ok {
+        return
+    }
+    var input struct {
+        Role string `json:"role" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    err := h.UserAdminService.ChangeRole(adminActor(c), userID, input.Role)
+    switch errors.Cause(err) {
+    case nil:
+        c.JSON(http.StatusOK, gin.H{"user_id": userID, "role": input.Role})
+    case services.ErrRoleNotFound:
+        utils.RespondWithError(c, http.StatusBadRequest, "Role not found")
+    case services.ErrUserNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "User not found")
+    case services.ErrCannotChangeOwnRole, services.ErrUserErased:
+        utils.RespondWithError(c, http.StatusConflict, err.Error())
+    case services.ErrRoleBeyondCaller:
+        utils.RespondWithError(c, http.StatusForbidden, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to assign role")
+    }
+}
+
+// SuspendUser handles POST /api/v1/admin/users/:id/suspend
+func (h *UserAdminHandler) SuspendUser(c *gin.Context) {
+    userID, ok := parseUserID(c)
+    if !ok {
+        return
+    }
+    var input struct {
+        Reason string `json:"reason" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    if err := h.UserAdminService.Suspend(adminActor(c), userID, input.Reason); err != nil {
+        respondUserAdminError(c, err, "Failed to suspend user")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"user_id": userID, "suspended": true})
+}
+
+// ReactivateUser handles POST /api/v1/admin/users/:id/reactivate
+func (h *UserAdminHandler) ReactivateUser(c *gin.Context) {
+    userID, ok := parseUserID(c)
+    if !ok {
+        return
+    }
+    if err := h.UserAdminService.Reactivate(adminActor(c), userID); err != nil {
+        respondUserAdminError(c, err, "Failed to reactivate user")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"user_id": userID, "suspended": false})
+}
+
+// ForcePasswordReset handles POST /api/v1/admin/users/:id/password-reset
+func (h *UserAdminHandler) ForcePasswordReset(c *gin.Context) {
+    userID, ok := parseUserID(c)
+    if !ok {
+        return
+    }
+    var input struct {
+        Reason string `json:"reason"`
+    }
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&input); err != nil {
+            utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+            return
+        }
+    }
+    if err := h.UserAdminService.ForcePasswordReset(adminActor(c), userID, input.Reason); err != nil {
+        respondUserAdminError(c, err, "Failed to reset password")
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Password reset; the user has been signed out and emailed a reset link"})
+}
+
+// ImpersonateUser handles POST /api/v1/admin/users/:id/impersonate. The returned access
+// token acts as the user, cannot be refreshed and is refused by account management routes.
+func (h *UserAdminHandler) ImpersonateUser(c *gin.Context) {
+    userID, ok := parseUserID(c)
+    if !ok {
+        return
+    }
+    var input struct {
+        Reason string `json:"reason" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid input")
+        return
+    }
+    token, err := h.UserAdminService.Impersonate(adminActor(c), userID, input.Reason)
+    if err != nil {
+        respondUserAdminError(c, err, "Failed to impersonate user")
+        return
+    }
+    c.JSON(http.StatusOK, token)
+}
+
+func respondUserAdminError(c *gin.Context, err error, fallback string) {
+    switch errors.Cause(err) {
+    case services.ErrUserNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "User not found")
+    case services.ErrReasonRequired:
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+    case services.ErrCannotManageSelf, services.ErrCannotImpersonateAdmin:
+        utils.RespondWithError(c, http.StatusForbidden, err.Error())
+    case services.ErrUserAlreadySuspended, services.ErrUserNotSuspended, services.ErrAccountSuspended, services.ErrUserErased:
+        utils.RespondWithError(c, http.StatusConflict, err.Error())
+    case services.ErrImpersonationDisabled:
+        utils.RespondWithError(c, http.StatusNotImplemented, err.Error())
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, fallback)
+    }
+}
+
+func parseUserID(c *gin.Context) (uint, bool) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid user ID")
+        return 0, false
+    }
+    return uint(id), true
+}
+
+func adminActor(c *gin.Context) services.AdminActor {
+    admin := c.MustGet("user").(models.User)
+    return services.AdminActor{ID: admin.ID, IP: c.ClientIP()}
+}
+
+// adminUserResponse is the admin view of a user; credentials are never included
+func adminUserResponse(u *models.User) gin.H {
+    return gin.H{
+        "id":               u.ID,
+        "username":         u.Username,
+        "email":            u.Email,
+        "email_verified":   u.EmailVerifiedAt != nil,
+        "role":             u.Role,
+        "created_at":       u.CreatedAt,
+        "suspended":        u.SuspendedAt != nil,
+        "suspended_at":     u.SuspendedAt,
+        "suspended_reason": u.SuspendedReason,
+        "erased":           u.DeletedAt != nil,
+    }
+}
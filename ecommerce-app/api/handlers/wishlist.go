@@ -0,0 +1,278 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// WishlistHandler handles HTTP requests for wishlists
+type WishlistHandler struct {
+    WishlistService *services.WishlistService
+}
+
+// NewWishlistHandler creates a new WishlistHandler
+func NewWishlistHandler(wishlistService *services.WishlistService) *WishlistHandler {
+    return &WishlistHandler{WishlistService: wishlistService}
+}
+
+// CreateWishlist handles POST /api/v1/wishlists
+func (h *WishlistHandler) CreateWishlist(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    var input struct {
+        Name string `json:"name" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+    wishlist, err := h.WishlistService.CreateWishlist(userID, input.Name)
+    if err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusCreated, wishlist)
+}
+
+// GetWishlists handles GET /api/v1/wishlists
+func (h *WishlistHandler) GetWishlists(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    wishlists, err := h.WishlistService.GetWishlists(userID)
+    if err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, wishlists)
+}
+
+// GetWishlist handles GET /api/v1/wishlists/:id
+func (h *WishlistHandler) GetWishlist(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c, "id")
+    if !ok {
+        return
+    }
+    wishlist, err := h.WishlistService.GetWishlist(userID, id)
+    if err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, wishlist)
+}
+
+// RenameWishlist handles PUT /api/v1/wishlists/:id
+func (h *WishlistHandler) RenameWishlist(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c, "id")
+    if !ok {
+        return
+    }
+    var input struct {
+        Name string `json:"name" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+    wishlist, err := h.WishlistService.RenameWishlist(userID, id, input.Name)
+    if err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, wishlist)
+}
+
+// DeleteWishlist handles DELETE /api/v1/wishlists/:id
+func (h *WishlistHandler) DeleteWishlist(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c, "id")
+    if !ok {
+        return
+    }
+    if err := h.WishlistService.DeleteWishlist(userID, id); err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Wishlist deleted successfully"})
+}
+
+// AddItem handles POST /api/v1/wishlists/:id/items
+func (h *WishlistHandler) AddItem(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c, "id")
+    if !ok {
+        return
+    }
+    var input struct {
+        ProductID uint `json:"product_id" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+        return
+    }
+    if err := h.WishlistService.AddItem(userID, id, input.ProductID); err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusCreated, gin.H{"message": "Product added to wishlist"})
+}
+
+// RemoveItem handles DELETE /api/v1/wishlists/:id/items/:product_id
+func (h *WishlistHandler) RemoveItem(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c, "id")
+    if !ok {
+        return
+    }
+    productID, ok := h.parseID(c, "product_id")
+    if !ok {
+        return
+    }
+    if err := h.WishlistService.RemoveItem(userID, id, productID); err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Product removed from wishlist"})
+}
+
+// MoveToCart handles POST /api/v1/wishlists/:id/items/:product_id/move-to-cart
+func (h *WishlistHandler) MoveToCart(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c, "id")
+    if !ok {
+        return
+    }
+    productID, ok := h.parseID(c, "product_id")
+    if !ok {
+        return
+    }
+    input := struct {
+        Quantity int `json:"quantity" binding:"omitempty,min=1"`
+    }{Quantity: 1}
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&input); err != nil {
+            utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+            return
+        }
+    }
+    if err := h.WishlistService.MoveToCart(userID, id, productID, input.Quantity); err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusAccepted, gin.H{"message": "Item enqueued for addition to cart"})
+}
+
+// EnableSharing handles POST /api/v1/wishlists/:id/share
+func (h *WishlistHandler) EnableSharing(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c, "id")
+    if !ok {
+        return
+    }
+    wishlist, err := h.WishlistService.EnableSharing(userID, id)
+    if err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "share_token": *wishlist.ShareToken,
+        "share_path":  "/api/v1/wishlists/shared/" + *wishlist.ShareToken,
+    })
+}
+
+// DisableSharing handles DELETE /api/v1/wishlists/:id/share
+func (h *WishlistHandler) DisableSharing(c *gin.Context) {
+    userID, ok := h.userID(c)
+    if !ok {
+        return
+    }
+    id, ok := h.parseID(c, "id")
+    if !ok {
+        return
+    }
+    if err := h.WishlistService.DisableSharing(userID, id); err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "Wishlist sharing disabled"})
+}
+
+// GetSharedWishlist handles GET /api/v1/wishlists/shared/:token
+func (h *WishlistHandler) GetSharedWishlist(c *gin.Context) {
+    wishlist, err := h.WishlistService.GetSharedWishlist(c.Param("token"))
+    if err != nil {
+        h.respondWithServiceError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "name":  wishlist.Name,
+        "items": wishlist.Items,
+    })
+}
+
+func (h *WishlistHandler) userID(c *gin.Context) (uint, bool) {
+    user, exists := c.Get("user")
+    if !exists {
+        h.WishlistService.Logger.WithFields(logrus.Fields{
+            "path": c.Request.URL.Path,
+        }).Warn("No user in context for wishlist request")
+        utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+        return 0, false
+    }
+    return user.(models.User).ID, true
+}
+
+func (h *WishlistHandler) parseID(c *gin.Context, param string) (uint, bool) {
+    id, err := strconv.ParseUint(c.Param(param), 10, 32)
+    if err != nil {
+        utils.RespondWithError(c, http.StatusBadRequest, "Invalid "+param)
+        return 0, false
+    }
+    return uint(id), true
+}
+
+func (h *WishlistHandler) respondWithServiceError(c *gin.Context, err error) {
+    switch errors.Cause(err) {
+    case services.ErrWishlistNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, "Wishlist not found")
+    case services.ErrWishlistItemNotFound, services.ErrProductNotFound:
+        utils.RespondWithError(c, http.StatusNotFound, errors.Cause(err).Error())
+    case services.ErrInvalidWishlistName, services.ErrInvalidQuantity, services.ErrInsufficientStock:
+        utils.RespondWithError(c, http.StatusBadRequest, errors.Cause(err).Error())
+    default:
+        utils.RespondWithError(c, http.StatusInternalServerError, "Wishlist request failed")
+    }
+}
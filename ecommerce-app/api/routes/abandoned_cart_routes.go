@@ -0,0 +1,15 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupAbandonedCartRoutes(r *gin.RouterGroup, handler *handlers.AbandonedCartHandler, cfg *config.Config) {
+    admin := r.Group("/admin/abandoned-carts").Use(middleware.APIKeyOrAuthMiddleware(cfg), middleware.AdminMiddleware(cfg))
+    {
+        admin.GET("/stats", handler.GetStats)
+    }
+}
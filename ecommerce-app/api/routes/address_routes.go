@@ -0,0 +1,19 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupAddressRoutes(r *gin.RouterGroup, handler *handlers.AddressHandler, cfg *config.Config) {
+    protected := r.Group("/users/addresses").Use(middleware.AuthMiddleware(cfg))
+    {
+        protected.POST("", handler.CreateAddress)
+        protected.GET("", handler.GetAddresses)
+        protected.PUT("/:id", handler.UpdateAddress)
+        protected.PUT("/:id/default", handler.SetDefaultAddress)
+        protected.DELETE("/:id", handler.DeleteAddress)
+    }
+}
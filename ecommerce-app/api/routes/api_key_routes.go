@@ -0,0 +1,20 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+)
+
+// SetupAPIKeyRoutes registers key management. It deliberately does not accept API
+// keys, so a key can never mint or revoke keys.
+func SetupAPIKeyRoutes(r *gin.RouterGroup, handler *handlers.APIKeyHandler, cfg *config.Config) {
+    admin := r.Group("/admin/api-keys").Use(middleware.AuthMiddleware(cfg), middleware.ForbidImpersonation(), middleware.RequirePermission(cfg, models.PermissionAPIKeysManage))
+    {
+        admin.GET("", handler.GetAPIKeys)
+        admin.POST("", handler.CreateAPIKey)
+        admin.DELETE("/:id", handler.RevokeAPIKey)
+    }
+}
@@ -8,12 +8,22 @@ import (
 )
 
 func SetupCartRoutes(r *gin.RouterGroup, cartHandler *handlers.CartHandler, cfg *config.Config) {
+    // Guests shop without logging in; their cart is named by the guest cart token
+    cart := r.Group("/api").Use(middleware.OptionalAuthMiddleware(cfg))
+    {
+        cart.POST("/cart", cartHandler.AddToCart)
+        cart.GET("/cart", cartHandler.GetCart)
+        cart.GET("/cart/summary", cartHandler.GetCartSummary)
+        cart.GET("/cart/:id", cartHandler.GetCartItem)
+        cart.DELETE("/cart/:id", cartHandler.DeleteCartItem)
+        cart.PUT("/cart/:id", cartHandler.UpdateCartItem)
+    }
+
     protected := r.Group("/api").Use(middleware.AuthMiddleware(cfg))
     {
-        protected.POST("/cart", cartHandler.AddToCart)
-        protected.GET("/cart", cartHandler.GetCart)
-        protected.GET("/cart/:id", cartHandler.GetCartItem)
-        protected.DELETE("/cart/:id", cartHandler.DeleteCartItem)
-        protected.PUT("/cart/:id", cartHandler.UpdateCartItem)
+        protected.POST("/cart/coupons", cartHandler.ApplyCoupon)
+        protected.DELETE("/cart/coupons/:code", cartHandler.RemoveCoupon)
+        protected.GET("/cart/operations/:id", cartHandler.GetCartOperation)
+        protected.POST("/cart/acknowledge", cartHandler.AcknowledgeCartChanges)
     }
 }
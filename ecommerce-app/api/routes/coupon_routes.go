@@ -0,0 +1,19 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupCouponRoutes(r *gin.RouterGroup, handler *handlers.CouponHandler, cfg *config.Config) {
+    admin := r.Group("/admin/coupons").Use(middleware.APIKeyOrAuthMiddleware(cfg), middleware.AdminMiddleware(cfg))
+    {
+        admin.POST("", handler.CreateCoupon)
+        admin.GET("", handler.GetCoupons)
+        admin.GET("/:id", handler.GetCoupon)
+        admin.PUT("/:id", handler.UpdateCoupon)
+        admin.DELETE("/:id", handler.DeleteCoupon)
+    }
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupMFARoutes(r *gin.RouterGroup, handler *handlers.MFAHandler, cfg *config.Config) {
+    r.POST("/mfa/verify", handler.VerifyLogin)
+    r.POST("/mfa/enroll", handler.EnrollForLogin)
+    protected := r.Group("/users/mfa").Use(middleware.AuthMiddleware(cfg), middleware.ForbidImpersonation())
+    {
+        protected.GET("", handler.GetStatus)
+        protected.POST("/totp", handler.StartEnrollment)
+        protected.POST("/totp/confirm", handler.ConfirmEnrollment)
+        protected.DELETE("/totp", handler.Disable)
+        protected.POST("/recovery-codes", handler.RegenerateRecoveryCodes)
+    }
+}
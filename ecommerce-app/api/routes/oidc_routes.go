@@ -0,0 +1,20 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupOIDCRoutes(r *gin.RouterGroup, handler *handlers.OIDCHandler, cfg *config.Config) {
+    r.GET("/auth/oidc/providers", handler.GetProviders)
+    r.GET("/auth/oidc/:provider/login", handler.Login)
+    r.GET("/auth/oidc/:provider/callback", handler.Callback)
+    protected := r.Group("/users/identities").Use(middleware.AuthMiddleware(cfg), middleware.ForbidImpersonation())
+    {
+        protected.GET("", handler.GetIdentities)
+        protected.POST("/:provider", handler.LinkIdentity)
+        protected.DELETE("/:provider", handler.UnlinkIdentity)
+    }
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupOrderRoutes(r *gin.RouterGroup, handler *handlers.OrderHandler, cfg *config.Config) {
+    protected := r.Group("/orders").Use(middleware.AuthMiddleware(cfg))
+    {
+        protected.POST("/checkout", handler.Checkout)
+        protected.GET("", handler.GetOrders)
+        protected.GET("/:id", handler.GetOrder)
+    }
+
+    admin := r.Group("/admin/orders").Use(middleware.APIKeyOrAuthMiddleware(cfg), middleware.AdminMiddleware(cfg))
+    {
+        admin.GET("", handler.ListOrders)
+        admin.GET("/:id", handler.GetOrderAdmin)
+        admin.PUT("/:id/status", handler.AdvanceOrder)
+    }
+}
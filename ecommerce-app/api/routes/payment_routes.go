@@ -0,0 +1,27 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+)
+
+func SetupPaymentRoutes(r *gin.RouterGroup, handler *handlers.PaymentHandler, cfg *config.Config) {
+    // Providers call the webhook without a user token; the body signature authenticates it
+    r.POST("/payments/webhook", handler.HandleWebhook)
+
+    protected := r.Group("/orders/:id/payments").Use(middleware.AuthMiddleware(cfg))
+    {
+        protected.POST("", handler.PayOrder)
+        protected.GET("", handler.GetOrderPayments)
+    }
+
+    admin := r.Group("/admin/payments").Use(middleware.APIKeyOrAuthMiddleware(cfg), middleware.AdminMiddleware(cfg))
+    {
+        admin.POST("/:id/capture", handler.CapturePayment)
+        admin.POST("/:id/void", handler.VoidPayment)
+        admin.POST("/:id/refund", middleware.RequirePermission(cfg, models.PermissionOrdersRefund), handler.RefundPayment)
+    }
+}
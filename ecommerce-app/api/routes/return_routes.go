@@ -0,0 +1,27 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+)
+
+func SetupReturnRoutes(r *gin.RouterGroup, handler *handlers.ReturnHandler, cfg *config.Config) {
+    protected := r.Group("").Use(middleware.AuthMiddleware(cfg))
+    {
+        protected.POST("/orders/:id/returns", handler.RequestReturn)
+        protected.GET("/returns", handler.GetReturns)
+        protected.GET("/returns/:id", handler.GetReturn)
+    }
+
+    admin := r.Group("/admin/returns").Use(middleware.APIKeyOrAuthMiddleware(cfg), middleware.AdminMiddleware(cfg))
+    {
+        admin.GET("", handler.ListReturns)
+        admin.PUT("/:id/approve", handler.ApproveReturn)
+        admin.PUT("/:id/reject", handler.RejectReturn)
+        admin.PUT("/:id/receive", handler.ReceiveReturn)
+        admin.PUT("/:id/refund", middleware.RequirePermission(cfg, models.PermissionOrdersRefund), handler.RefundReturn)
+    }
+}
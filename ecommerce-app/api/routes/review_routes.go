@@ -0,0 +1,21 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupReviewRoutes(r *gin.RouterGroup, handler *handlers.ReviewHandler, cfg *config.Config) {
+    protected := r.Group("/products").Use(middleware.AuthMiddleware(cfg))
+    {
+        protected.GET("/:id/reviews", handler.ListProductReviews)
+        protected.POST("/:id/reviews", handler.CreateReview)
+    }
+    admin := r.Group("/admin/reviews").Use(middleware.APIKeyOrAuthMiddleware(cfg), middleware.AdminMiddleware(cfg))
+    {
+        admin.GET("", handler.ListReviewsByStatus)
+        admin.PUT("/:id/status", handler.ModerateReview)
+    }
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+)
+
+func SetupRoleRoutes(r *gin.RouterGroup, handler *handlers.RoleHandler, cfg *config.Config) {
+    // Session only: impersonation tokens may not manage roles
+    admin := r.Group("/admin").Use(middleware.AuthMiddleware(cfg), middleware.ForbidImpersonation(), middleware.RequirePermission(cfg, models.PermissionUsersManage))
+    {
+        admin.GET("/permissions", handler.GetPermissions)
+        admin.GET("/roles", handler.GetRoles)
+        admin.POST("/roles", handler.CreateRole)
+        admin.PUT("/roles/:name", handler.UpdateRole)
+        admin.DELETE("/roles/:name", handler.DeleteRole)
+    }
+}
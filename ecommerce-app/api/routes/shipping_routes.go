@@ -0,0 +1,20 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupShippingRoutes(r *gin.RouterGroup, handler *handlers.ShippingHandler, cfg *config.Config) {
+    r.GET("/shipping-methods", handler.GetShippingMethods)
+
+    admin := r.Group("/admin/shipping-methods").Use(middleware.APIKeyOrAuthMiddleware(cfg), middleware.AdminMiddleware(cfg))
+    {
+        admin.POST("", handler.CreateShippingMethod)
+        admin.GET("", handler.GetAllShippingMethods)
+        admin.PUT("/:id", handler.UpdateShippingMethod)
+        admin.DELETE("/:id", handler.DeleteShippingMethod)
+    }
+}
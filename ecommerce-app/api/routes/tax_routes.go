@@ -0,0 +1,17 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupTaxRoutes(r *gin.RouterGroup, handler *handlers.TaxRateHandler, cfg *config.Config) {
+    admin := r.Group("/admin/tax-rates").Use(middleware.APIKeyOrAuthMiddleware(cfg), middleware.AdminMiddleware(cfg))
+    {
+        admin.POST("", handler.CreateTaxRate)
+        admin.GET("", handler.GetTaxRates)
+        admin.DELETE("/:id", handler.DeleteTaxRate)
+    }
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+)
+
+func SetupUserAdminRoutes(r *gin.RouterGroup, handler *handlers.UserAdminHandler, cfg *config.Config) {
+    // Session only: neither API keys nor impersonation tokens may manage accounts
+    admin := r.Group("/admin/users").Use(middleware.AuthMiddleware(cfg), middleware.ForbidImpersonation(), middleware.RequirePermission(cfg, models.PermissionUsersManage))
+    {
+        admin.GET("", handler.ListUsers)
+        admin.GET("/:id", handler.GetUser)
+        admin.GET("/:id/audit-log", handler.GetAuditLog)
+        admin.PUT("/:id/role", handler.ChangeRole)
+        admin.POST("/:id/suspend", handler.SuspendUser)
+        admin.POST("/:id/reactivate", handler.ReactivateUser)
+        admin.POST("/:id/password-reset", handler.ForcePasswordReset)
+        admin.POST("/:id/impersonate", handler.ImpersonateUser)
+    }
+}
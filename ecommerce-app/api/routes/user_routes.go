@@ -10,8 +10,23 @@ import (
 func SetupUserRoutes(r *gin.RouterGroup, handler *handlers.UserHandler, cfg *config.Config) {
     r.POST("/register", handler.Register)
     r.POST("/login", handler.Login)
+    r.POST("/token/refresh", handler.RefreshToken)
+    r.POST("/logout", middleware.AuthMiddleware(cfg), handler.Logout)
+    r.POST("/email/verify", handler.VerifyEmail)
+    r.POST("/email/verification/resend", handler.ResendVerification)
+    r.POST("/email/change/confirm", handler.ConfirmEmailChange)
+    r.POST("/password/forgot", handler.ForgotPassword)
+    r.POST("/password/reset", handler.ResetPassword)
+    r.POST("/account/unlock", handler.UnlockAccount)
     protected := r.Group("/users").Use(middleware.AuthMiddleware(cfg))
     {
         protected.GET("/profile", handler.GetProfile)
+        protected.PATCH("/profile", middleware.ForbidImpersonation(), handler.UpdateProfile)
+        protected.PUT("/password", middleware.ForbidImpersonation(), handler.ChangePassword)
+        protected.POST("/data-exports", middleware.ForbidImpersonation(), handler.RequestDataExport)
+        protected.GET("/data-exports", handler.GetDataExports)
+        protected.GET("/data-exports/:id", handler.GetDataExport)
+        protected.GET("/data-exports/:id/download", middleware.ForbidImpersonation(), handler.DownloadDataExport)
+        protected.DELETE("/account", middleware.ForbidImpersonation(), handler.DeleteAccount)
     }
 }
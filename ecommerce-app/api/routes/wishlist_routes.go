@@ -0,0 +1,25 @@
+package routes
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/api/handlers"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/middleware"
+)
+
+func SetupWishlistRoutes(r *gin.RouterGroup, handler *handlers.WishlistHandler, cfg *config.Config) {
+    r.GET("/wishlists/shared/:token", handler.GetSharedWishlist)
+    protected := r.Group("/wishlists").Use(middleware.AuthMiddleware(cfg))
+    {
+        protected.POST("", handler.CreateWishlist)
+        protected.GET("", handler.GetWishlists)
+        protected.GET("/:id", handler.GetWishlist)
+        protected.PUT("/:id", handler.RenameWishlist)
+        protected.DELETE("/:id", handler.DeleteWishlist)
+        protected.POST("/:id/items", handler.AddItem)
+        protected.DELETE("/:id/items/:product_id", handler.RemoveItem)
+        protected.POST("/:id/items/:product_id/move-to-cart", handler.MoveToCart)
+        protected.POST("/:id/share", handler.EnableSharing)
+        protected.DELETE("/:id/share", handler.DisableSharing)
+    }
+}
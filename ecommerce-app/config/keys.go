@@ -0,0 +1,203 @@
+package config
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/sirupsen/logrus"
+)
+
+// keyManifestFile lists the keys in JWT_KEYS_DIR and their rotation schedule
+const keyManifestFile = "keys.json"
+
+// SigningKey is one asymmetric JWT key. A key signs from ActiveFrom until RetireAt and
+// keeps verifying for one access token lifetime after it retires.
+type SigningKey struct {
+    KID        string
+    Algorithm  string // RS256 or EdDSA
+    Private    crypto.Signer
+    Public     crypto.PublicKey
+    ActiveFrom time.Time
+    RetireAt   time.Time // zero means the key never retires
+}
+
+type keyManifest struct {
+    Keys []struct {
+        KID        string    `json:"kid"`
+        File       string    `json:"file"`
+        ActiveFrom time.Time `json:"active_from"`
+        RetireAt   time.Time `json:"retire_at"`
+    } `json:"keys"`
+}
+
+// KeySet holds the JWT keys loaded from disk and is safe for concurrent use
+type KeySet struct {
+    dir      string
+    tokenTTL time.Duration
+
+    mu   sync.RWMutex
+    keys []*SigningKey
+}
+
+// LoadKeySet reads keys.json and the PEM private keys it references from dir.
+// tokenTTL is how long a retired key keeps verifying tokens it already signed.
+func LoadKeySet(dir string, tokenTTL time.Duration) (*KeySet, error) {
+    ks := &KeySet{dir: dir, tokenTTL: tokenTTL}
+    if err := ks.Reload(); err != nil {
+        return nil, err
+    }
+    return ks, nil
+}
+
+// Reload re-reads the key directory, picking up keys added for a future rotation
+func (ks *KeySet) Reload() error {
+    data, err := os.ReadFile(filepath.Join(ks.dir, keyManifestFile))
+    if err != nil {
+        return fmt.Errorf("failed to read key manifest: %w", err)
+    }
+    var manifest keyManifest
+    if err := json.Unmarshal(data, &manifest); err != nil {
+        return fmt.Errorf("failed to parse key manifest: %w", err)
+    }
+    if len(manifest.Keys) == 0 {
+        return fmt.Errorf("key manifest lists no keys")
+    }
+
+    keys := make([]*SigningKey, 0, len(manifest.Keys))
+    seen := make(map[string]bool)
+    for _, entry := range manifest.Keys {
+        if entry.KID == "" || seen[entry.KID] {
+            return fmt.Errorf("key manifest has a missing or duplicate kid %q", entry.KID)
+        }
+        seen[entry.KID] = true
+        key, err := loadPrivateKey(filepath.Join(ks.dir, entry.File))
+        if err != nil {
+            return fmt.Errorf("failed to load key %s: %w", entry.KID, err)
+        }
+        key.KID = entry.KID
+        key.ActiveFrom = entry.ActiveFrom
+        key.RetireAt = entry.RetireAt
+        keys = append(keys, key)
+    }
+    // Newest first, so the first active key found is the one to sign with
+    sort.Slice(keys, func(i, j int) bool { return keys[i].ActiveFrom.After(keys[j].ActiveFrom) })
+
+    ks.mu.Lock()
+    ks.keys = keys
+    ks.mu.Unlock()
+    return nil
+}
+
+// Watch reloads the key set every interval until stop is closed. An interval that is
+// not positive, including an unparsable JWT_KEYS_RELOAD_INTERVAL, disables reloading.
+func (ks *KeySet) Watch(interval time.Duration, logger *logrus.Logger, stop <-chan struct{}) {
+    if interval <= 0 {
+        logger.WithFields(logrus.Fields{
+            "interval": interval,
+        }).Warn("JWT key reloading disabled; restart to pick up new keys")
+        return
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            if err := ks.Reload(); err != nil {
+                logger.WithFields(logrus.Fields{
+                    "error":      err,
+                    "error_code": "KEY_RELOAD_FAILED",
+                }).Error("Failed to reload JWT keys; keeping current keys")
+            }
+        case <-stop:
+            return
+        }
+    }
+}
+
+// SigningKey returns the key that signs new tokens at now
+func (ks *KeySet) SigningKey(now time.Time) (*SigningKey, error) {
+    ks.mu.RLock()
+    defer ks.mu.RUnlock()
+    for _, key := range ks.keys {
+        if !now.Before(key.ActiveFrom) && (key.RetireAt.IsZero() || now.Before(key.RetireAt)) {
+            return key, nil
+        }
+    }
+    return nil, fmt.Errorf("no active JWT signing key")
+}
+
+// VerificationKey returns the key with the given kid if it may still verify tokens at now
+func (ks *KeySet) VerificationKey(kid string, now time.Time) (*SigningKey, bool) {
+    ks.mu.RLock()
+    defer ks.mu.RUnlock()
+    for _, key := range ks.keys {
+        if key.KID == kid && ks.verifies(key, now) {
+            return key, true
+        }
+    }
+    return nil, false
+}
+
+// PublishedKeys returns every key that verifiers should know about at now, including
+// keys scheduled to become active so their public halves are cached ahead of use
+func (ks *KeySet) PublishedKeys(now time.Time) []*SigningKey {
+    ks.mu.RLock()
+    defer ks.mu.RUnlock()
+    var keys []*SigningKey
+    for _, key := range ks.keys {
+        if ks.verifies(key, now) {
+            keys = append(keys, key)
+        }
+    }
+    return keys
+}
+
+func (ks *KeySet) verifies(key *SigningKey, now time.Time) bool {
+    return key.RetireAt.IsZero() || now.Before(key.RetireAt.Add(ks.tokenTTL))
+}
+
+func loadPrivateKey(path string) (*SigningKey, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, fmt.Errorf("no PEM data found")
+    }
+
+    var parsed interface{}
+    switch block.Type {
+    case "RSA PRIVATE KEY":
+        parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+    case "PRIVATE KEY":
+        parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+    default:
+        return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    switch key := parsed.(type) {
+    case *rsa.PrivateKey:
+        if key.N.BitLen() < 2048 {
+            return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+        }
+        return &SigningKey{Algorithm: "RS256", Private: key, Public: &key.PublicKey}, nil
+    case ed25519.PrivateKey:
+        return &SigningKey{Algorithm: "EdDSA", Private: key, Public: key.Public()}, nil
+    default:
+        return nil, fmt.Errorf("unsupported key type %T", parsed)
+    }
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+
+    "github.com/spf13/viper"
+)
+
+// OIDCProvider is one OpenID Connect identity provider users can log in with
+type OIDCProvider struct {
+    Name         string   `mapstructure:"name" json:"name"`
+    Issuer       string   `mapstructure:"issuer" json:"issuer"`
+    ClientID     string   `mapstructure:"client_id" json:"client_id"`
+    ClientSecret string   `mapstructure:"client_secret" json:"client_secret"`
+    RedirectURL  string   `mapstructure:"redirect_url" json:"redirect_url"`
+    Scopes       []string `mapstructure:"scopes" json:"scopes"`
+}
+
+// loadOIDCProviders reads OIDC_PROVIDERS, either a list under oidc_providers in the
+// config file or a JSON array in the environment. Providers without a redirect_url
+// get the API callback under baseURL. When OIDC_MOCK_ISSUER is set, the built-in mock
+// provider is added as "mock".
+func loadOIDCProviders(baseURL string) ([]OIDCProvider, error) {
+    var providers []OIDCProvider
+    if raw, ok := viper.Get("OIDC_PROVIDERS").(string); ok {
+        if strings.TrimSpace(raw) != "" {
+            if err := json.Unmarshal([]byte(raw), &providers); err != nil {
+                return nil, fmt.Errorf("invalid OIDC_PROVIDERS: %w", err)
+            }
+        }
+    } else if err := viper.UnmarshalKey("OIDC_PROVIDERS", &providers); err != nil {
+        return nil, fmt.Errorf("invalid OIDC_PROVIDERS: %w", err)
+    }
+    if issuer := viper.GetString("OIDC_MOCK_ISSUER"); issuer != "" {
+        providers = append(providers, OIDCProvider{Name: "mock", Issuer: issuer, ClientID: "mock-client"})
+    }
+
+    seen := map[string]bool{}
+    for i := range providers {
+        p := &providers[i]
+        if p.Name == "" || p.Issuer == "" || p.ClientID == "" {
+            return nil, fmt.Errorf("OIDC provider %d needs a name, issuer and client_id", i)
+        }
+        if seen[p.Name] {
+            return nil, fmt.Errorf("duplicate OIDC provider %q", p.Name)
+        }
+        seen[p.Name] = true
+        if p.RedirectURL == "" {
+            p.RedirectURL = strings.TrimRight(baseURL, "/") + "/api/v1/auth/oidc/" + p.Name + "/callback"
+        }
+    }
+    return providers, nil
+}
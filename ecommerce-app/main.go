@@ -2,15 +2,22 @@ package main
 
 import (
     "log"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
 
     "github.com/gin-gonic/gin"
     "github.com/inquisitivefrog/ecommerce-app/config"
     "github.com/inquisitivefrog/ecommerce-app/docs"
     "github.com/inquisitivefrog/ecommerce-app/handlers"
     "github.com/inquisitivefrog/ecommerce-app/middleware"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/oidcmock"
     "github.com/inquisitivefrog/ecommerce-app/repositories"
     "github.com/inquisitivefrog/ecommerce-app/routes"
     "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/inquisitivefrog/ecommerce-app/worker"
 
     ginSwagger "github.com/swaggo/gin-swagger"
     swaggerFiles "github.com/swaggo/files"
@@ -51,30 +58,252 @@ func main() {
     // --- Prometheus metrics ---
     r.GET("/metrics", middleware.PrometheusHandler())
 
+    // --- Public signing keys for services verifying our tokens ---
+    r.GET("/.well-known/jwks.json", middleware.JWKSHandler(cfg))
+    if cfg.JWTKeys != nil {
+        go cfg.JWTKeys.Watch(cfg.JWTKeyReloadInterval, cfg.Logger, nil)
+    }
+
+    // --- Mock identity provider (local development only) ---
+    if cfg.OIDCMockIssuer != "" {
+        issuer, err := url.Parse(cfg.OIDCMockIssuer)
+        if err != nil || strings.Trim(issuer.Path, "/") == "" {
+            cfg.Logger.Fatalf("OIDC_MOCK_ISSUER must be a URL with a path, such as http://localhost:8080/oidc-mock")
+        }
+        mock, err := oidcmock.New(cfg.OIDCMockIssuer)
+        if err != nil {
+            cfg.Logger.Fatalf("failed to start mock identity provider: %v", err)
+        }
+        prefix := strings.TrimRight(issuer.Path, "/")
+        r.Any(prefix+"/*path", gin.WrapH(http.StripPrefix(prefix, mock)))
+        cfg.Logger.Warn("Mock OIDC provider enabled; it signs in anyone and must not run in production")
+    }
+
     // --- Repositories ---
     userRepo := repositories.NewUserRepository(cfg.DB)
     productRepo := repositories.NewProductRepository(cfg.DB)
     orderRepo := repositories.NewOrderRepository(cfg.DB)
     cartRepo := repositories.NewCartRepository(cfg.DB)
+    reviewRepo := repositories.NewReviewRepository(cfg.DB)
+    wishlistRepo := repositories.NewWishlistRepository(cfg.DB)
+    couponRepo := repositories.NewCouponRepository(cfg.DB)
+    taxRateRepo := repositories.NewTaxRateRepository(cfg.DB)
+    addressRepo := repositories.NewAddressRepository(cfg.DB)
+    shippingRepo := repositories.NewShippingRepository(cfg.DB)
+    paymentRepo := repositories.NewPaymentRepository(cfg.DB)
+    returnRepo := repositories.NewReturnRepository(cfg.DB)
+    refreshTokenRepo := repositories.NewRefreshTokenRepository(cfg.DB)
+    roleRepo := repositories.NewRoleRepository(cfg.DB)
+    userTokenRepo := repositories.NewUserTokenRepository(cfg.DB)
+    mfaRepo := repositories.NewMFARepository(cfg.DB)
+    identityRepo := repositories.NewUserIdentityRepository(cfg.DB)
+    apiKeyRepo := repositories.NewAPIKeyRepository(cfg.DB)
+    privacyRepo := repositories.NewPrivacyRepository(cfg.DB)
+    auditLogRepo := repositories.NewAuditLogRepository(cfg.DB)
+    abandonedCartRepo := repositories.NewAbandonedCartRepository(cfg.DB)
+
+    // --- Mailer ---
+    var mailer services.Mailer
+    switch cfg.MailDriver {
+    case "smtp":
+        mailer = services.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+    case "log":
+        mailer = services.NewLogMailer(cfg.MailFrom, cfg.MailOutboxDir, cfg.Logger)
+    default:
+        cfg.Logger.Fatalf("unsupported mail driver %q", cfg.MailDriver)
+    }
+
+    // --- Abandoned carts (detected and followed up by the worker) ---
+    abandonedCartService := services.NewAbandonedCartService(abandonedCartRepo, cartRepo, userRepo, mailer, cfg.QueueChan, cfg.AppBaseURL, services.AbandonedCartPolicy{
+        After:            cfg.AbandonedCartAfter,
+        ReminderInterval: cfg.AbandonedCartReminderInterval,
+        MaxReminders:     cfg.AbandonedCartMaxReminders,
+        BatchSize:        100,
+    }, cfg.Logger)
+
+    // --- Worker mode (docker-compose runs "./ecommerce-app worker") ---
+    if len(os.Args) > 1 && os.Args[1] == "worker" {
+        // Building an export only reads data and writes the archive, so no account
+        // or password services are needed here
+        exportService := services.NewProfileService(userRepo, privacyRepo, nil, nil, cfg.QueueChan, cfg.DataExportDir, cfg.DataExportTTL, cfg.Logger)
+        go worker.RunReviewWorker(reviewRepo, productRepo, cfg.QueueChan)
+        go worker.RunDataExportWorker(exportService.BuildDataExport, cfg.QueueChan)
+        go worker.RunDataExportCleanup(exportService.PurgeExpiredDataExports, cfg.DataExportCleanup)
+        go worker.RunOrderEventWorker(cfg.QueueChan, worker.LogOrderEvent)
+        go worker.RunCartEventWorker(cfg.QueueChan, worker.LogCartEvent)
+        go worker.RunAbandonedCartJob(abandonedCartService.ProcessAbandonedCarts, cfg.AbandonedCartCheckInterval)
+        // The worker only records the outcome of queued adds to cart
+        cartOperations := services.NewCartService(cartRepo, productRepo, nil, cfg.QueueChan, cfg.Cache, cfg.Logger)
+        cartOperations.Operations = services.NewRedisCartOperationStore(cfg.Cache)
+        cartOperations.OperationTTL = cfg.CartOperationTTL
+        worker.RunCartWorker(cartRepo, cfg.QueueChan, cfg.Cache, cartOperations.CompleteCartOperation)
+        return
+    }
+
+    // --- Passwords ---
+    passwordPolicy := &services.PasswordPolicy{
+        MinLength:     cfg.PasswordMinLength,
+        MaxLength:     cfg.PasswordMaxLength,
+        RequireUpper:  cfg.PasswordRequireUpper,
+        RequireLower:  cfg.PasswordRequireLower,
+        RequireDigit:  cfg.PasswordRequireDigit,
+        RequireSymbol: cfg.PasswordRequireSymbol,
+    }
+    if cfg.BreachedPasswordsFile != "" {
+        breached, err := services.LoadBreachedPasswords(cfg.BreachedPasswordsFile)
+        if err != nil {
+            cfg.Logger.Fatalf("failed to load breached passwords: %v", err)
+        }
+        passwordPolicy.Breached = breached
+    }
+    if cfg.PasswordHashAlgorithm != services.PasswordHashArgon2id && cfg.PasswordHashAlgorithm != services.PasswordHashBcrypt {
+        cfg.Logger.Fatalf("unsupported password hash algorithm %q", cfg.PasswordHashAlgorithm)
+    }
+    passwordHasher := &services.PasswordHasher{
+        Algorithm:  cfg.PasswordHashAlgorithm,
+        BcryptCost: cfg.BcryptCost,
+        Argon2: services.Argon2Params{
+            MemoryKiB: cfg.Argon2MemoryKiB,
+            Time:      cfg.Argon2Time,
+            Threads:   cfg.Argon2Threads,
+        },
+    }
 
     // --- Services ---
     userService := services.NewUserService(userRepo, cfg.JWTSecret, cfg.Logger)
+    tokenService := services.NewTokenService(refreshTokenRepo, userRepo, func(userID uint) (string, error) {
+        // Loaded per issue so refreshed tokens carry the current role and token version
+        user, err := userRepo.GetUserByID(userID)
+        if err != nil {
+            return "", err
+        }
+        return middleware.GenerateJWT(user, cfg)
+    }, cfg.AccessTokenTTL, cfg.RefreshTokenTTL, cfg.Logger)
     productService := services.NewProductService(productRepo, cfg.Cache, cfg.Logger)
-    orderService := services.NewOrderService(orderRepo, productRepo, cfg.QueueChan, cfg.Logger)
-    cartService := services.NewCartService(cartRepo, productRepo, cfg.QueueChan, cfg.Cache, cfg.Logger)
+    cartService := services.NewCartService(cartRepo, productRepo, couponRepo, cfg.QueueChan, cfg.Cache, cfg.Logger)
+    cartService.TaxCalculator = services.NewTableTaxCalculator(taxRateRepo, cfg.PricesIncludeTax)
+    shippingService := services.NewShippingService(shippingRepo, cfg.Logger)
+    cartService.ShippingService = shippingService
+    cartService.GuestCarts = services.NewRedisGuestCartStore(cfg.Cache)
+    cartService.GuestTokens = services.NewGuestCartTokens(cfg.GuestCartSecret)
+    cartService.GuestCartTTL = cfg.GuestCartTTL
+    if cfg.CartMode != "sync" && cfg.CartMode != "async" {
+        cfg.Logger.Fatalf("unsupported cart mode %q", cfg.CartMode)
+    }
+    cartService.SyncWrites = cfg.CartMode == "sync"
+    cartService.Operations = services.NewRedisCartOperationStore(cfg.Cache)
+    cartService.OperationTTL = cfg.CartOperationTTL
+    addressService := services.NewAddressService(addressRepo, cfg.Logger)
+    orderService := services.NewOrderService(orderRepo, addressRepo, cartService, cfg.QueueChan, cfg.Logger)
+    if cfg.PaymentProvider != "fake" {
+        cfg.Logger.Fatalf("unsupported payment provider %q", cfg.PaymentProvider)
+    }
+    paymentProvider := services.NewFakePaymentProvider(cfg.FakePaymentBehavior, cfg.FakePaymentDelay)
+    paymentService := services.NewPaymentService(paymentRepo, orderRepo, orderService.Lifecycle, paymentProvider, cfg.PaymentWebhookSecret, cfg.PaymentAutoCapture, cfg.Logger)
+    orderService.Payments = paymentService
+    // Runs here rather than in the worker, which has no payment provider
+    go worker.RunPaymentReleaseJob(orderService.RetryPaymentReleases, cfg.PaymentReleaseRetry)
+    returnService := services.NewReturnService(returnRepo, orderRepo, paymentService, cfg.QueueChan, cfg.Logger)
+    reviewService := services.NewReviewService(reviewRepo, productRepo, orderRepo, cfg.QueueChan, cfg.Logger)
+    wishlistService := services.NewWishlistService(wishlistRepo, productRepo, cartService, cfg.QueueChan, cfg.Logger)
+    productService.PriceDropNotifier = wishlistService
+    couponService := services.NewCouponService(couponRepo, cfg.Logger)
+    taxRateService := services.NewTaxRateService(taxRateRepo, cfg.Logger)
+    roleService := services.NewRoleService(roleRepo, userRepo, cfg.Logger)
+    roleService.AuthCache = middleware.NewAuthCache(cfg)
+    passwordService := services.NewPasswordService(userRepo, passwordPolicy, passwordHasher, cfg.Logger)
+    passwordService.Sessions = tokenService
+    passwordService.AuthCache = roleService.AuthCache
+    accountService := services.NewAccountService(userRepo, userTokenRepo, passwordService, mailer, cfg.AppBaseURL, cfg.EmailVerificationTTL, cfg.PasswordResetTTL, cfg.Logger)
+    accountService.AuthCache = roleService.AuthCache
+    loginGuard := services.NewLoginGuard(services.NewRedisLoginAttemptStore(cfg.Cache), services.LoginGuardPolicy{
+        MaxUserFailures: cfg.LoginMaxUserFailures,
+        MaxIPFailures:   cfg.LoginMaxIPFailures,
+        Window:          cfg.LoginFailureWindow,
+        LockoutDuration: cfg.LoginLockoutDuration,
+        BaseDelay:       cfg.LoginBaseDelay,
+        MaxDelay:        cfg.LoginMaxDelay,
+    }, cfg.Logger)
+    loginGuard.Notifier = accountService
+    loginGuard.Metrics = middleware.SecurityMetrics{}
+    accountService.Unlocker = loginGuard
+    mfaService := services.NewMFAService(mfaRepo, userRepo, roleRepo, services.NewRedisMFAChallengeStore(cfg.Cache), cfg.MFAIssuer, cfg.MFAChallengeTTL, cfg.Logger)
+    mfaService.Metrics = loginGuard.Metrics
+    oidcProviders := make([]services.OIDCProvider, len(cfg.OIDCProviders))
+    for i, p := range cfg.OIDCProviders {
+        oidcProviders[i] = services.OIDCProvider{
+            Name:         p.Name,
+            Issuer:       p.Issuer,
+            ClientID:     p.ClientID,
+            ClientSecret: p.ClientSecret,
+            RedirectURL:  p.RedirectURL,
+            Scopes:       p.Scopes,
+        }
+    }
+    apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo, roleRepo, cfg.Logger)
+    oidcService := services.NewOIDCService(oidcProviders, userRepo, identityRepo, services.NewRedisOIDCStateStore(cfg.Cache), cfg.OIDCStateTTL, cfg.Logger)
+    profileService := services.NewProfileService(userRepo, privacyRepo, accountService, passwordService, cfg.QueueChan, cfg.DataExportDir, cfg.DataExportTTL, cfg.Logger)
+    profileService.AuthCache = roleService.AuthCache
+    userAdminService := services.NewUserAdminService(userRepo, roleRepo, auditLogRepo, roleService, accountService, cfg.Logger)
+    userAdminService.Sessions = tokenService
+    userAdminService.AuthCache = roleService.AuthCache
+    userAdminService.Impersonation = func(user *models.User, impersonatorID uint) (string, error) {
+        return middleware.GenerateImpersonationJWT(user, impersonatorID, cfg)
+    }
+    userAdminService.ImpersonationTTL = cfg.ImpersonationTokenTTL
+    if err := roleService.EnsureDefaultRoles(); err != nil {
+        cfg.Logger.Fatalf("failed to create default roles: %v", err)
+    }
 
     // --- Handlers ---
     userHandler := handlers.NewUserHandler(userService)
+    userHandler.TokenService = tokenService
+    userHandler.AccountService = accountService
+    userHandler.Passwords = passwordService
+    userHandler.LoginGuard = loginGuard
+    userHandler.MFA = mfaService
+    userHandler.Profiles = profileService
+    userHandler.Carts = cartService
     productHandler := handlers.NewProductHandler(productService)
     orderHandler := handlers.NewOrderHandler(orderService)
     cartHandler := handlers.NewCartHandler(cartService)
+    reviewHandler := handlers.NewReviewHandler(reviewService)
+    wishlistHandler := handlers.NewWishlistHandler(wishlistService)
+    couponHandler := handlers.NewCouponHandler(couponService)
+    taxRateHandler := handlers.NewTaxRateHandler(taxRateService)
+    addressHandler := handlers.NewAddressHandler(addressService)
+    shippingHandler := handlers.NewShippingHandler(shippingService)
+    paymentHandler := handlers.NewPaymentHandler(paymentService)
+    returnHandler := handlers.NewReturnHandler(returnService)
+    roleHandler := handlers.NewRoleHandler(roleService)
+    mfaHandler := handlers.NewMFAHandler(mfaService, tokenService)
+    mfaHandler.Carts = cartService
+    oidcHandler := handlers.NewOIDCHandler(oidcService, mfaService, tokenService, cfg)
+    oidcHandler.Carts = cartService
+    apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+    userAdminHandler := handlers.NewUserAdminHandler(userAdminService)
+    abandonedCartHandler := handlers.NewAbandonedCartHandler(abandonedCartService)
 
     // --- Routes ---
     api := r.Group("/api/v1")
     routes.SetupUserRoutes(api, userHandler)
-    routes.SetupOrderRoutes(api, orderHandler)
-    routes.SetupCartRoutes(api, cartHandler)
+    routes.SetupOrderRoutes(api, orderHandler, cfg)
+    routes.SetupCartRoutes(api, cartHandler, cfg)
     routes.SetupProductRoutes(api, productHandler, cfg) // maybe pass just logger + cache instead of whole cfg
+    routes.SetupReviewRoutes(api, reviewHandler, cfg)
+    routes.SetupWishlistRoutes(api, wishlistHandler, cfg)
+    routes.SetupCouponRoutes(api, couponHandler, cfg)
+    routes.SetupTaxRoutes(api, taxRateHandler, cfg)
+    routes.SetupAddressRoutes(api, addressHandler, cfg)
+    routes.SetupShippingRoutes(api, shippingHandler, cfg)
+    routes.SetupPaymentRoutes(api, paymentHandler, cfg)
+    routes.SetupReturnRoutes(api, returnHandler, cfg)
+    routes.SetupRoleRoutes(api, roleHandler, cfg)
+    routes.SetupMFARoutes(api, mfaHandler, cfg)
+    routes.SetupOIDCRoutes(api, oidcHandler, cfg)
+    routes.SetupAPIKeyRoutes(api, apiKeyHandler, cfg)
+    routes.SetupUserAdminRoutes(api, userAdminHandler, cfg)
+    routes.SetupAbandonedCartRoutes(api, abandonedCartHandler, cfg)
 
     // --- Start server ---
     if err := r.Run(cfg.ServerPort); err != nil {
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// apiKeyTouchInterval limits last-used writes to one per key per interval
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyOrAuthMiddleware authenticates with an API key, sent as "X-API-Key: <key>"
+// or "Authorization: ApiKey <key>", and falls back to AuthMiddleware otherwise. The
+// key's owner becomes the request user, and RequirePermission further limits the
+// request to the key's scopes. Routes that manage the account itself use
+// AuthMiddleware alone so a key cannot be used to take the account over.
+func APIKeyOrAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+    auth := AuthMiddleware(cfg)
+    return func(c *gin.Context) {
+        key := c.GetHeader("X-API-Key")
+        if header := c.GetHeader("Authorization"); key == "" && strings.HasPrefix(header, "ApiKey ") {
+            key = strings.TrimSpace(strings.TrimPrefix(header, "ApiKey "))
+        }
+        if key == "" {
+            auth(c)
+            return
+        }
+        authenticateAPIKey(c, cfg, key)
+    }
+}
+
+func authenticateAPIKey(c *gin.Context, cfg *config.Config, plaintext string) {
+    if !strings.HasPrefix(plaintext, models.APIKeyPrefix) {
+        rejectAPIKey(c, "Invalid API key", "INVALID_API_KEY")
+        return
+    }
+    // Same SHA-256 hex digest the API key service stores
+    sum := sha256.Sum256([]byte(plaintext))
+    var key models.APIKey
+    err := cfg.DB.Where("key_hash = ?", hex.EncodeToString(sum[:])).First(&key).Error
+    if err == gorm.ErrRecordNotFound {
+        rejectAPIKey(c, "Invalid API key", "INVALID_API_KEY")
+        return
+    }
+    if err != nil {
+        err := utils.NewAPIError(http.StatusServiceUnavailable, "Unable to verify API key", "API_KEY_CHECK_FAILED")
+        c.Error(err)
+        utils.RespondWithError(c, http.StatusServiceUnavailable, "Unable to verify API key")
+        c.Abort()
+        return
+    }
+    now := time.Now()
+    if !key.Usable(now) {
+        cfg.Logger.WithFields(logrus.Fields{
+            "api_key_id": key.ID,
+            "prefix":     key.Prefix,
+            "error_code": "API_KEY_UNUSABLE",
+        }).Warn("Revoked or expired API key used")
+        rejectAPIKey(c, "API key is revoked or expired", "API_KEY_UNUSABLE")
+        return
+    }
+
+    user, err := loadAuthUser(c.Request.Context(), cfg, key.UserID)
+    if err != nil {
+        rejectAPIKey(c, "User not found", "USER_NOT_FOUND")
+        return
+    }
+    if user.SuspendedAt != nil {
+        rejectSuspended(c)
+        return
+    }
+
+    if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+        if err := cfg.DB.Model(&models.APIKey{}).Where("id = ?", key.ID).
+            UpdateColumns(map[string]interface{}{"last_used_at": now, "last_used_ip": c.ClientIP()}).Error; err != nil {
+            cfg.Logger.WithFields(logrus.Fields{
+                "api_key_id": key.ID,
+                "error":      err,
+                "error_code": "API_KEY_TOUCH_FAILED",
+            }).Warn("Failed to record API key use")
+        }
+    }
+
+    c.Set("user", *user)
+    c.Set("api_key", &key)
+    c.Next()
+}
+
+func rejectAPIKey(c *gin.Context, message, code string) {
+    err := utils.NewAPIError(http.StatusUnauthorized, message, code)
+    c.Error(err)
+    utils.RespondWithError(c, http.StatusUnauthorized, message)
+    c.Abort()
+}
@@ -10,17 +10,48 @@ import (
     "github.com/inquisitivefrog/ecommerce-app/config"
     "github.com/inquisitivefrog/ecommerce-app/models"
     "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/sirupsen/logrus"
 )
 
-func GenerateJWT(userID uint, cfg *config.Config) (string, error) {
-    if len(cfg.JWTSecret) < 32 {
+func GenerateJWT(user *models.User, cfg *config.Config) (string, error) {
+    ttl := cfg.AccessTokenTTL
+    if ttl <= 0 {
+        ttl = 15 * time.Minute
+    }
+    return signAccessToken(user, cfg, ttl, nil)
+}
+
+// GenerateImpersonationJWT issues an access token acting as user on behalf of an
+// admin. The "act" claim names the admin, so every request made with it is marked
+// as impersonated and attributed to them.
+func GenerateImpersonationJWT(user *models.User, impersonatorID uint, cfg *config.Config) (string, error) {
+    return signAccessToken(user, cfg, cfg.ImpersonationTokenTTL, jwt.MapClaims{
+        "act": map[string]interface{}{"user_id": impersonatorID},
+    })
+}
+
+func signAccessToken(user *models.User, cfg *config.Config, ttl time.Duration, extra jwt.MapClaims) (string, error) {
+    if cfg.JWTKeys == nil && len(cfg.JWTSecret) < 32 {
         return "", utils.NewAPIError(http.StatusInternalServerError, "JWT secret too short", "INVALID_JWT_SECRET")
     }
+    jti, err := newTokenID()
+    if err != nil {
+        return "", err
+    }
     claims := jwt.MapClaims{
-        "user_id": userID,
-        "exp":     time.Now().Add(time.Hour * 24).Unix(),
+        "user_id": user.ID,
+        "role":    user.Role,
+        "ver":     user.TokenVersion,
+        "jti":     jti,
+        "exp":     time.Now().Add(ttl).Unix(),
         "iat":     time.Now().Unix(),
     }
+    for name, value := range extra {
+        claims[name] = value
+    }
+    if cfg.JWTKeys != nil {
+        return signWithKeySet(cfg.JWTKeys, claims)
+    }
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
     return token.SignedString([]byte(cfg.JWTSecret))
 }
@@ -45,12 +76,7 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
             return
         }
 
-        token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-            if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-                return nil, jwt.ErrSignatureInvalid
-            }
-            return []byte(cfg.JWTSecret), nil
-        })
+        token, err := jwt.Parse(parts[1], tokenKeyFunc(cfg))
         if err != nil {
             err := utils.NewAPIError(http.StatusUnauthorized, "Invalid token", "INVALID_TOKEN")
             c.Error(err)
@@ -69,15 +95,67 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
                 return
             }
 
-            var user models.User
-            if err := cfg.DB.Where("id = ?", uint(userID)).First(&user).Error; err != nil {
+            jti, _ := claims["jti"].(string)
+            exp, _ := claims["exp"].(float64)
+            version, hasVersion := claims["ver"].(float64)
+            if jti == "" || !hasVersion {
+                err := utils.NewAPIError(http.StatusUnauthorized, "Invalid token claims", "INVALID_CLAIMS")
+                c.Error(err)
+                utils.RespondWithError(c, http.StatusUnauthorized, "Invalid token claims")
+                c.Abort()
+                return
+            }
+            revoked, err := IsTokenRevoked(c.Request.Context(), cfg.Cache, jti)
+            if err != nil {
+                // Fail closed: a token we cannot check may have been revoked
+                err := utils.NewAPIError(http.StatusServiceUnavailable, "Unable to verify token", "REVOCATION_CHECK_FAILED")
+                c.Error(err)
+                utils.RespondWithError(c, http.StatusServiceUnavailable, "Unable to verify token")
+                c.Abort()
+                return
+            }
+            if revoked {
+                err := utils.NewAPIError(http.StatusUnauthorized, "Token has been revoked", "TOKEN_REVOKED")
+                c.Error(err)
+                utils.RespondWithError(c, http.StatusUnauthorized, "Token has been revoked")
+                c.Abort()
+                return
+            }
+
+            user, err := loadAuthUser(c.Request.Context(), cfg, uint(userID))
+            if err != nil {
                 err := utils.NewAPIError(http.StatusUnauthorized, "User not found", "USER_NOT_FOUND")
                 c.Error(err)
                 utils.RespondWithError(c, http.StatusUnauthorized, "User not found")
                 c.Abort()
                 return
             }
-            c.Set("user", user)
+            // Password and role changes bump the version, retiring older tokens
+            if int(version) != user.TokenVersion {
+                err := utils.NewAPIError(http.StatusUnauthorized, "Token is no longer valid", "STALE_TOKEN")
+                c.Error(err)
+                utils.RespondWithError(c, http.StatusUnauthorized, "Token is no longer valid")
+                c.Abort()
+                return
+            }
+            if user.SuspendedAt != nil {
+                rejectSuspended(c)
+                return
+            }
+            c.Set("user", *user)
+            c.Set("jti", jti)
+            c.Set("token_exp", time.Unix(int64(exp), 0))
+            if act, ok := claims["act"].(map[string]interface{}); ok {
+                impersonatorID, _ := act["user_id"].(float64)
+                c.Set("impersonator_id", uint(impersonatorID))
+                cfg.Logger.WithFields(logrus.Fields{
+                    "impersonator_id": uint(impersonatorID),
+                    "user_id":         user.ID,
+                    "method":          c.Request.Method,
+                    "path":            c.Request.URL.Path,
+                    "jti":             jti,
+                }).Info("Impersonated request")
+            }
             c.Next()
         } else {
             err := utils.NewAPIError(http.StatusUnauthorized, "Invalid token", "INVALID_TOKEN")
@@ -88,25 +166,44 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
     }
 }
 
-func AdminMiddleware(cfg *config.Config) gin.HandlerFunc {
+// OptionalAuthMiddleware authenticates requests that carry an Authorization header
+// exactly as AuthMiddleware does and lets anonymous requests through without a user,
+// for routes that also serve guests
+func OptionalAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+    auth := AuthMiddleware(cfg)
     return func(c *gin.Context) {
-        user, exists := c.Get("user")
-        if !exists {
-            err := utils.NewAPIError(http.StatusUnauthorized, "User not authenticated", "NO_USER")
-            c.Error(err)
-            utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
-            c.Abort()
+        if c.GetHeader("Authorization") == "" {
+            c.Next()
             return
         }
+        auth(c)
+    }
+}
 
-        u, ok := user.(models.User)
-        if !ok || u.Role != "admin" {
-            err := utils.NewAPIError(http.StatusForbidden, "Admin access required", "FORBIDDEN")
+// ForbidImpersonation rejects requests made with an impersonation token. It guards
+// routes that manage the account itself, such as passwords, MFA and erasure, which an
+// admin acting as the user must not touch. It must run after AuthMiddleware.
+func ForbidImpersonation() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if _, impersonated := c.Get("impersonator_id"); impersonated {
+            err := utils.NewAPIError(http.StatusForbidden, "Not allowed while impersonating", "IMPERSONATION_FORBIDDEN")
             c.Error(err)
-            utils.RespondWithError(c, http.StatusForbidden, "Admin access required")
+            utils.RespondWithError(c, http.StatusForbidden, "Not allowed while impersonating")
             c.Abort()
             return
         }
         c.Next()
     }
 }
+
+func rejectSuspended(c *gin.Context) {
+    err := utils.NewAPIError(http.StatusForbidden, "Account is suspended", "ACCOUNT_SUSPENDED")
+    c.Error(err)
+    utils.RespondWithError(c, http.StatusForbidden, "Account is suspended")
+    c.Abort()
+}
+
+// AdminMiddleware guards the admin API; roles reach it through the admin:access permission
+func AdminMiddleware(cfg *config.Config) gin.HandlerFunc {
+    return RequirePermission(cfg, models.PermissionAdminAccess)
+}
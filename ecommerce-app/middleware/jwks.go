@@ -0,0 +1,55 @@
+package middleware
+
+import (
+    "crypto/ed25519"
+    "crypto/rsa"
+    "encoding/base64"
+    "math/big"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+)
+
+// JWK is the public half of a signing key in RFC 7517 form
+type JWK struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    Alg string `json:"alg"`
+    N   string `json:"n,omitempty"`
+    E   string `json:"e,omitempty"`
+    Crv string `json:"crv,omitempty"`
+    X   string `json:"x,omitempty"`
+}
+
+// JWKSHandler serves GET /.well-known/jwks.json so other services can verify our
+// tokens. The set is empty when tokens are HMAC-signed.
+func JWKSHandler(cfg *config.Config) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        keys := []JWK{}
+        if cfg.JWTKeys != nil {
+            for _, key := range cfg.JWTKeys.PublishedKeys(time.Now()) {
+                keys = append(keys, publicJWK(key))
+            }
+        }
+        c.Header("Cache-Control", "public, max-age=300")
+        c.JSON(http.StatusOK, gin.H{"keys": keys})
+    }
+}
+
+func publicJWK(key *config.SigningKey) JWK {
+    jwk := JWK{Kid: key.KID, Use: "sig", Alg: key.Algorithm}
+    switch pub := key.Public.(type) {
+    case *rsa.PublicKey:
+        jwk.Kty = "RSA"
+        jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+        jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+    case ed25519.PublicKey:
+        jwk.Kty = "OKP"
+        jwk.Crv = "Ed25519"
+        jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+    }
+    return jwk
+}
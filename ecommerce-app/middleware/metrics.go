@@ -0,0 +1,27 @@
+package middleware
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var securityEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+    Name: "security_events_total",
+    Help: "Authentication security events such as failed logins and lockouts.",
+}, []string{"event"})
+
+// PrometheusHandler serves GET /metrics
+func PrometheusHandler() gin.HandlerFunc {
+    return gin.WrapH(promhttp.Handler())
+}
+
+// SecurityMetrics exports security events as Prometheus counters. It satisfies
+// services.SecurityEventRecorder.
+type SecurityMetrics struct{}
+
+// RecordSecurityEvent counts one occurrence of event
+func (SecurityMetrics) RecordSecurityEvent(event string) {
+    securityEvents.WithLabelValues(event).Inc()
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/utils"
+    "github.com/redis/go-redis/v9"
+    "github.com/sirupsen/logrus"
+)
+
+const rolePermissionsCachePrefix = "role_permissions:"
+
+// RequirePermission allows the request only if the authenticated user's role grants
+// every listed permission and, for API key requests, the key has each as a scope. It
+// must run after AuthMiddleware or APIKeyOrAuthMiddleware.
+func RequirePermission(cfg *config.Config, permissions ...string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        user, exists := c.Get("user")
+        if !exists {
+            err := utils.NewAPIError(http.StatusUnauthorized, "User not authenticated", "NO_USER")
+            c.Error(err)
+            utils.RespondWithError(c, http.StatusUnauthorized, "User not authenticated")
+            c.Abort()
+            return
+        }
+        u, ok := user.(models.User)
+        if !ok {
+            err := utils.NewAPIError(http.StatusForbidden, "Insufficient permissions", "FORBIDDEN")
+            c.Error(err)
+            utils.RespondWithError(c, http.StatusForbidden, "Insufficient permissions")
+            c.Abort()
+            return
+        }
+
+        granted, err := rolePermissions(c.Request.Context(), cfg, u.Role)
+        if err != nil {
+            err := utils.NewAPIError(http.StatusServiceUnavailable, "Unable to check permissions", "PERMISSION_CHECK_FAILED")
+            c.Error(err)
+            utils.RespondWithError(c, http.StatusServiceUnavailable, "Unable to check permissions")
+            c.Abort()
+            return
+        }
+        key, viaAPIKey := c.Get("api_key")
+        for _, permission := range permissions {
+            if viaAPIKey && !key.(*models.APIKey).HasScope(permission) {
+                cfg.Logger.WithFields(logrus.Fields{
+                    "user_id":    u.ID,
+                    "api_key_id": key.(*models.APIKey).ID,
+                    "permission": permission,
+                    "error_code": "INSUFFICIENT_SCOPE",
+                }).Warn("API key scope denied")
+                err := utils.NewAPIError(http.StatusForbidden, "API key lacks the required scope", "INSUFFICIENT_SCOPE")
+                c.Error(err)
+                utils.RespondWithError(c, http.StatusForbidden, "API key lacks the required scope")
+                c.Abort()
+                return
+            }
+            if !granted[permission] {
+                cfg.Logger.WithFields(logrus.Fields{
+                    "user_id":    u.ID,
+                    "role":       u.Role,
+                    "permission": permission,
+                    "error_code": "FORBIDDEN",
+                }).Warn("Permission denied")
+                err := utils.NewAPIError(http.StatusForbidden, "Insufficient permissions", "FORBIDDEN")
+                c.Error(err)
+                utils.RespondWithError(c, http.StatusForbidden, "Insufficient permissions")
+                c.Abort()
+                return
+            }
+        }
+        c.Next()
+    }
+}
+
+// rolePermissions returns the permissions granted by a role, cached in Redis for
+// USER_CACHE_TTL. Unknown roles grant nothing.
+func rolePermissions(ctx context.Context, cfg *config.Config, roleName string) (map[string]bool, error) {
+    key := rolePermissionsCachePrefix + roleName
+    var permissions []string
+    cached := false
+    if cfg.UserCacheTTL > 0 {
+        if data, err := cfg.Cache.Get(ctx, key).Bytes(); err == nil {
+            cached = json.Unmarshal(data, &permissions) == nil
+        } else if err != redis.Nil {
+            cfg.Logger.WithFields(logrus.Fields{
+                "role":       roleName,
+                "error":      err,
+                "error_code": "PERMISSION_CACHE_READ_FAILED",
+            }).Warn("Permission cache unavailable; reading from database")
+        }
+    }
+
+    if !cached {
+        var roles []models.Role
+        if err := cfg.DB.Where("name = ?", roleName).Limit(1).Find(&roles).Error; err != nil {
+            return nil, err
+        }
+        permissions = []string{}
+        if len(roles) > 0 {
+            permissions = roles[0].Permissions
+        }
+        if cfg.UserCacheTTL > 0 {
+            if data, err := json.Marshal(permissions); err == nil {
+                cfg.Cache.Set(ctx, key, data, cfg.UserCacheTTL)
+            }
+        }
+    }
+
+    granted := make(map[string]bool, len(permissions))
+    for _, p := range permissions {
+        granted[p] = true
+    }
+    return granted, nil
+}
+
+// AuthCache invalidates the cached users and role permissions used by the auth
+// middleware. It satisfies services.AuthCache.
+type AuthCache struct {
+    Config *config.Config
+}
+
+// NewAuthCache creates a new AuthCache
+func NewAuthCache(cfg *config.Config) *AuthCache {
+    return &AuthCache{Config: cfg}
+}
+
+// InvalidateUser drops the cached user
+func (a *AuthCache) InvalidateUser(userID uint) error {
+    return InvalidateUserCache(context.Background(), a.Config, userID)
+}
+
+// InvalidateRole drops the cached permissions of a role
+func (a *AuthCache) InvalidateRole(role string) error {
+    return a.Config.Cache.Del(context.Background(), rolePermissionsCachePrefix+role).Err()
+}
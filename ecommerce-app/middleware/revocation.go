@@ -0,0 +1,39 @@
+package middleware
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+)
+
+const revokedTokenPrefix = "revoked_jti:"
+
+// RevokeToken adds an access token's jti to the revocation list until the token
+// would have expired on its own
+func RevokeToken(ctx context.Context, cache *redis.Client, jti string, expiresAt time.Time) error {
+    ttl := time.Until(expiresAt)
+    if ttl <= 0 {
+        return nil
+    }
+    return cache.Set(ctx, revokedTokenPrefix+jti, 1, ttl).Err()
+}
+
+// IsTokenRevoked reports whether the jti is on the revocation list
+func IsTokenRevoked(ctx context.Context, cache *redis.Client, jti string) (bool, error) {
+    n, err := cache.Exists(ctx, revokedTokenPrefix+jti).Result()
+    if err != nil {
+        return false, err
+    }
+    return n > 0, nil
+}
+
+func newTokenID() (string, error) {
+    buf := make([]byte, 16)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(buf), nil
+}
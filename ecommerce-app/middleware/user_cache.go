@@ -0,0 +1,60 @@
+package middleware
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    "github.com/inquisitivefrog/ecommerce-app/config"
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/redis/go-redis/v9"
+    "github.com/sirupsen/logrus"
+)
+
+const authUserCachePrefix = "auth_user:"
+
+// loadAuthUser returns the user behind a token. With USER_CACHE_TTL set the user is
+// served from Redis and Postgres is only consulted on a miss; the password hash is
+// never cached. A cache outage degrades to a database read rather than an error.
+func loadAuthUser(ctx context.Context, cfg *config.Config, userID uint) (*models.User, error) {
+    key := authUserCacheKey(userID)
+    if cfg.UserCacheTTL > 0 {
+        data, err := cfg.Cache.Get(ctx, key).Bytes()
+        if err == nil {
+            var user models.User
+            if err := json.Unmarshal(data, &user); err == nil {
+                return &user, nil
+            }
+        } else if err != redis.Nil {
+            cfg.Logger.WithFields(logrus.Fields{
+                "user_id":    userID,
+                "error":      err,
+                "error_code": "USER_CACHE_READ_FAILED",
+            }).Warn("User cache unavailable; reading from database")
+        }
+    }
+
+    var user models.User
+    if err := cfg.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+        return nil, err
+    }
+    user.Password = ""
+    user.Addresses = nil
+
+    if cfg.UserCacheTTL > 0 {
+        if data, err := json.Marshal(user); err == nil {
+            cfg.Cache.Set(ctx, key, data, cfg.UserCacheTTL)
+        }
+    }
+    return &user, nil
+}
+
+// InvalidateUserCache drops the cached user so the next request sees changes to
+// the role, token version or profile immediately instead of after USER_CACHE_TTL
+func InvalidateUserCache(ctx context.Context, cfg *config.Config, userID uint) error {
+    return cfg.Cache.Del(ctx, authUserCacheKey(userID)).Err()
+}
+
+func authUserCacheKey(userID uint) string {
+    return fmt.Sprintf("%s%d", authUserCachePrefix, userID)
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+    "time"
+)
+
+// Abandoned cart statuses. Only open carts are sent reminders; the others record how
+// the cart was closed.
+const (
+    AbandonedCartStatusOpen      = "open"
+    AbandonedCartStatusRecovered = "recovered" // the user checked out
+    AbandonedCartStatusResumed   = "resumed"   // the user changed the cart again
+    AbandonedCartStatusEmptied   = "emptied"   // the cart was emptied without an order
+    AbandonedCartStatusExpired   = "expired"   // every reminder went unanswered
+)
+
+// AbandonedCart records a cart left untouched past the abandonment period and the
+// reminders sent about it. CartUpdatedAt is the cart's last change when it was
+// detected, so a cart is only recorded once until it changes again. A user has at
+// most one open record.
+type AbandonedCart struct {
+    ID               uint       `gorm:"primaryKey" json:"ID"`
+    CreatedAt        time.Time  `json:"CreatedAt"`
+    UpdatedAt        time.Time  `json:"UpdatedAt"`
+    UserID           uint       `gorm:"not null;index;uniqueIndex:idx_abandoned_carts_open_user,where:status = 'open'" json:"user_id"`
+    Status           string     `gorm:"not null;default:'open';index" json:"status"`
+    CartUpdatedAt    time.Time  `gorm:"not null" json:"cart_updated_at"`
+    ItemCount        int        `gorm:"not null;default:0" json:"item_count"`
+    Subtotal         float64    `gorm:"not null;default:0" json:"subtotal"`
+    RemindersSent    int        `gorm:"not null;default:0" json:"reminders_sent"`
+    LastReminderAt   *time.Time `json:"last_reminder_at"`
+    ClosedAt         *time.Time `json:"closed_at"`
+    RecoveredOrderID *uint      `json:"recovered_order_id"`
+    RecoveredTotal   float64    `gorm:"not null;default:0" json:"recovered_total"`
+}
+
+// AbandonedCartStats summarises abandoned cart detection and recovery over a period
+type AbandonedCartStats struct {
+    Since                  time.Time `json:"since"`
+    Detected               int64     `json:"detected"`
+    Open                   int64     `json:"open"`
+    Reminded               int64     `json:"reminded"`
+    RemindersSent          int64     `json:"reminders_sent"`
+    Recovered              int64     `json:"recovered"`
+    RecoveredAfterReminder int64     `json:"recovered_after_reminder"`
+    Resumed                int64     `json:"resumed"`
+    Emptied                int64     `json:"emptied"`
+    Expired                int64     `json:"expired"`
+    RecoveredRevenue       float64   `json:"recovered_revenue"`
+    RecoveryRate           float64   `json:"recovery_rate"`            // recovered / detected
+    ReminderConversionRate float64   `json:"reminder_conversion_rate"` // recovered after reminder / reminded
+}
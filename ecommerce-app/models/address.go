@@ -0,0 +1,24 @@
+package models
+
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+type Address struct {
+    ID         uint           `gorm:"primaryKey" json:"ID"`
+    CreatedAt  time.Time      `json:"CreatedAt"`
+    UpdatedAt  time.Time      `json:"UpdatedAt"`
+    DeletedAt  gorm.DeletedAt `gorm:"index" json:"DeletedAt"`
+    UserID     uint           `gorm:"not null;index" json:"user_id"`
+    Name       string         `gorm:"not null" json:"name"`
+    Line1      string         `gorm:"not null" json:"line1"`
+    Line2      string         `json:"line2"`
+    City       string         `gorm:"not null" json:"city"`
+    Region     string         `json:"region"`
+    PostalCode string         `gorm:"not null" json:"postal_code"`
+    Country    string         `gorm:"not null" json:"country"` // ISO 3166-1 alpha-2
+    Phone      string         `json:"phone"`
+    IsDefault  bool           `gorm:"not null;default:false" json:"is_default"`
+}
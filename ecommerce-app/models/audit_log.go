@@ -0,0 +1,26 @@
+package models
+
+import (
+    "time"
+)
+
+// Audit log actions
+const (
+    AuditUserRoleChanged      = "user.role_changed"
+    AuditUserSuspended        = "user.suspended"
+    AuditUserReactivated      = "user.reactivated"
+    AuditPasswordResetForced  = "user.password_reset_forced"
+    AuditImpersonationStarted = "user.impersonation_started"
+)
+
+// AuditLog records an administrative action taken on a user account
+type AuditLog struct {
+    ID           uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt    time.Time `gorm:"index" json:"CreatedAt"`
+    ActorID      uint      `gorm:"not null;index" json:"actor_id"`
+    Action       string    `gorm:"not null;index" json:"action"`
+    TargetUserID uint      `gorm:"not null;index" json:"target_user_id"`
+    Reason       string    `json:"reason,omitempty"`
+    Details      string    `gorm:"type:text" json:"details,omitempty"`
+    IP           string    `json:"ip,omitempty"`
+}
@@ -6,6 +6,14 @@ import (
     "gorm.io/gorm"
 )
 
+// Cart warning codes, set on a line when its product has changed since it was added
+const (
+    CartWarningPriceChanged      = "price_changed"
+    CartWarningOutOfStock        = "out_of_stock"
+    CartWarningInsufficientStock = "insufficient_stock"
+    CartWarningProductRemoved    = "product_removed"
+)
+
 type Cart struct {
     ID        uint           `gorm:"primaryKey" json:"ID"`
     CreatedAt time.Time      `json:"CreatedAt"`
@@ -15,4 +23,19 @@ type Cart struct {
     ProductID uint           `json:"product_id"`
     Quantity  int            `json:"quantity"`
     Product   Product        `gorm:"foreignKey:ProductID" json:"product"`
+
+    // PriceAtAdd is the product's price when the line was added, or when the user last
+    // acknowledged a price change. It is 0 on lines added before prices were recorded.
+    PriceAtAdd float64 `gorm:"not null;default:0" json:"price_at_add"`
+    // Warnings are worked out each time the cart is read and never stored
+    Warnings []CartWarning `gorm:"-" json:"warnings,omitempty"`
+}
+
+// CartWarning describes how a line's product has changed since it was added
+type CartWarning struct {
+    Code          string  `json:"code"`
+    Message       string  `json:"message"`
+    PreviousPrice float64 `json:"previous_price,omitempty"`
+    CurrentPrice  float64 `json:"current_price,omitempty"`
+    Available     int     `json:"available,omitempty"`
 }
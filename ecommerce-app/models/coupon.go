@@ -0,0 +1,58 @@
+package models
+
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+// Coupon types
+const (
+    CouponTypePercentage   = "percentage"
+    CouponTypeFixedAmount  = "fixed_amount"
+    CouponTypeFreeShipping = "free_shipping"
+    CouponTypeBuyXGetY     = "buy_x_get_y"
+)
+
+// Coupon is a discount code. Value is a percentage (0-100] for percentage coupons
+// and a currency amount for fixed_amount coupons. Buy-X-get-Y coupons give
+// GetQuantity free units of a line for every BuyQuantity+GetQuantity units.
+// Empty ProductIDs and Categories mean the coupon applies to the whole cart.
+type Coupon struct {
+    ID                uint           `gorm:"primaryKey" json:"ID"`
+    CreatedAt         time.Time      `json:"CreatedAt"`
+    UpdatedAt         time.Time      `json:"UpdatedAt"`
+    DeletedAt         gorm.DeletedAt `gorm:"index" json:"DeletedAt"`
+    Code              string         `gorm:"uniqueIndex;not null" json:"code"`
+    Type              string         `gorm:"not null" json:"type"`
+    Value             float64        `json:"value"`
+    BuyQuantity       int            `json:"buy_quantity"`
+    GetQuantity       int            `json:"get_quantity"`
+    StartsAt          *time.Time     `json:"starts_at"`
+    EndsAt            *time.Time     `json:"ends_at"`
+    UsageLimit        int            `json:"usage_limit"`          // 0 = unlimited
+    UsageLimitPerUser int            `json:"usage_limit_per_user"` // 0 = unlimited
+    UsageCount        int            `gorm:"not null;default:0" json:"usage_count"`
+    MinCartValue      float64        `json:"min_cart_value"`
+    ProductIDs        []uint         `gorm:"serializer:json" json:"product_ids"`
+    Categories        []string       `gorm:"serializer:json" json:"categories"`
+    Stackable         bool           `gorm:"not null;default:false" json:"stackable"`
+}
+
+// CartCoupon is a coupon code applied to a user's cart
+type CartCoupon struct {
+    ID        uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time `json:"CreatedAt"`
+    UserID    uint      `gorm:"not null;uniqueIndex:idx_cart_coupon" json:"user_id"`
+    CouponID  uint      `gorm:"not null;uniqueIndex:idx_cart_coupon" json:"coupon_id"`
+    Coupon    Coupon    `gorm:"foreignKey:CouponID" json:"coupon"`
+}
+
+// CouponRedemption records a coupon used by a user on an order
+type CouponRedemption struct {
+    ID        uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time `json:"CreatedAt"`
+    CouponID  uint      `gorm:"not null;index" json:"coupon_id"`
+    UserID    uint      `gorm:"not null;index" json:"user_id"`
+    OrderID   uint      `gorm:"index" json:"order_id"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+    "time"
+)
+
+// Data export statuses
+const (
+    DataExportStatusPending    = "pending"
+    DataExportStatusProcessing = "processing"
+    DataExportStatusReady      = "ready"
+    DataExportStatusFailed     = "failed"
+    DataExportStatusExpired    = "expired"
+)
+
+// DataExport is a user's request for a copy of their personal data. The worker
+// writes the archive to FileName and it can be downloaded until ExpiresAt.
+type DataExport struct {
+    ID          uint       `gorm:"primaryKey" json:"ID"`
+    CreatedAt   time.Time  `json:"CreatedAt"`
+    UpdatedAt   time.Time  `json:"UpdatedAt"`
+    UserID      uint       `gorm:"not null;index" json:"user_id"`
+    Status      string     `gorm:"not null;default:'pending';index" json:"status"`
+    FileName    string     `json:"-"`
+    Error       string     `json:"error,omitempty"`
+    CompletedAt *time.Time `json:"completed_at"`
+    ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// UserDataArchive is the content of a data export
+type UserDataArchive struct {
+    ExportedAt time.Time       `json:"exported_at"`
+    Profile    UserDataProfile `json:"profile"`
+    Addresses  []Address       `json:"addresses"`
+    Carts      []Cart          `json:"carts"`
+    Wishlists  []Wishlist      `json:"wishlists"`
+    Orders     []Order         `json:"orders"`
+    Reviews    []Review        `json:"reviews"`
+}
+
+// UserDataProfile is the account record as it appears in an export; credentials and
+// internal counters are left out
+type UserDataProfile struct {
+    ID              uint       `json:"id"`
+    Username        string     `json:"username"`
+    Email           string     `json:"email"`
+    EmailVerifiedAt *time.Time `json:"email_verified_at"`
+    Role            string     `json:"role"`
+    CreatedAt       time.Time  `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+    "time"
+)
+
+// UserTOTP is a user's TOTP authenticator. It only protects logins once ConfirmedAt
+// is set; an unconfirmed row is an enrollment in progress.
+type UserTOTP struct {
+    ID        uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time `json:"CreatedAt"`
+    UpdatedAt time.Time `json:"UpdatedAt"`
+    UserID    uint      `gorm:"uniqueIndex;not null" json:"user_id"`
+    Secret    string    `gorm:"not null" json:"-"` // base32, as shown to the authenticator app
+    // LastUsedStep is the time step of the last accepted code, so a code cannot be
+    // replayed within its validity window
+    LastUsedStep int64      `gorm:"not null;default:0" json:"-"`
+    ConfirmedAt  *time.Time `gorm:"type:timestamptz" json:"confirmed_at"`
+}
+
+// MFARecoveryCode is a single-use code that stands in for a TOTP code when the
+// authenticator is lost. Only its SHA-256 hash is stored.
+type MFARecoveryCode struct {
+    ID        uint       `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time  `json:"CreatedAt"`
+    UserID    uint       `gorm:"not null;index" json:"user_id"`
+    CodeHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+    UsedAt    *time.Time `json:"used_at"`
+}
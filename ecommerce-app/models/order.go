@@ -0,0 +1,87 @@
+package models
+
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+// Order statuses
+const (
+    OrderStatusPending   = "pending"
+    OrderStatusPaid      = "paid"
+    OrderStatusPicking   = "picking"
+    OrderStatusShipped   = "shipped"
+    OrderStatusDelivered = "delivered"
+    OrderStatusCancelled = "cancelled"
+    OrderStatusRefunded  = "refunded"
+)
+
+type Order struct {
+    ID               uint           `gorm:"primaryKey" json:"ID"`
+    CreatedAt        time.Time      `json:"CreatedAt"`
+    UpdatedAt        time.Time      `json:"UpdatedAt"`
+    DeletedAt        gorm.DeletedAt `gorm:"index" json:"DeletedAt"`
+    UserID           uint           `gorm:"not null;index" json:"user_id"`
+    Status           string         `gorm:"not null;default:'pending';index" json:"status"`
+    Subtotal         float64        `gorm:"not null;default:0" json:"subtotal"`
+    DiscountTotal    float64        `gorm:"not null;default:0" json:"discount_total"`
+    TaxTotal         float64        `gorm:"not null;default:0" json:"tax_total"`
+    PricesIncludeTax bool           `gorm:"not null;default:false" json:"prices_include_tax"`
+    Total            float64        `gorm:"not null" json:"total"`
+    TaxCountry       string         `json:"tax_country"`
+    TaxRegion        string         `json:"tax_region"`
+    TaxPostalCode    string         `json:"tax_postal_code"`
+    ShippingMethod   string         `json:"shipping_method"`
+    ShippingTotal    float64        `gorm:"not null;default:0" json:"shipping_total"`
+    ShipName         string         `json:"ship_name"`
+    ShipLine1        string         `json:"ship_line1"`
+    ShipLine2        string         `json:"ship_line2"`
+    ShipCity         string         `json:"ship_city"`
+    ShipRegion       string         `json:"ship_region"`
+    ShipPostalCode   string         `json:"ship_postal_code"`
+    ShipCountry      string         `json:"ship_country"`
+    ShipPhone        string         `json:"ship_phone"`
+    Items            []OrderItem    `gorm:"foreignKey:OrderID" json:"items"`
+    TaxLines         []OrderTaxLine `gorm:"foreignKey:OrderID" json:"tax_lines"`
+
+    Transitions []OrderStatusTransition `gorm:"foreignKey:OrderID" json:"transitions,omitempty"`
+}
+
+type OrderItem struct {
+    ID        uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time `json:"CreatedAt"`
+    OrderID   uint      `gorm:"not null;index" json:"order_id"`
+    ProductID uint      `gorm:"not null;index" json:"product_id"`
+    Quantity  int       `gorm:"not null" json:"quantity"`
+    Price     float64   `gorm:"not null" json:"price"`
+}
+
+type OrderTaxLine struct {
+    ID            uint    `gorm:"primaryKey" json:"ID"`
+    OrderID       uint    `gorm:"not null;index" json:"order_id"`
+    Name          string  `gorm:"not null" json:"name"`
+    Rate          float64 `gorm:"not null" json:"rate"`
+    TaxableAmount float64 `gorm:"not null" json:"taxable_amount"`
+    Amount        float64 `gorm:"not null" json:"amount"`
+}
+
+// Order transition actors
+const (
+    OrderActorUser   = "user"
+    OrderActorAdmin  = "admin"
+    OrderActorSystem = "system"
+)
+
+// OrderStatusTransition records one status change of an order and who made it.
+// The first transition of every order has an empty FromStatus.
+type OrderStatusTransition struct {
+    ID         uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt  time.Time `json:"CreatedAt"`
+    OrderID    uint      `gorm:"not null;index" json:"order_id"`
+    FromStatus string    `json:"from_status"`
+    ToStatus   string    `gorm:"not null" json:"to_status"`
+    Actor      string    `gorm:"not null" json:"actor"`
+    ActorID    uint      `json:"actor_id,omitempty"`
+    Reason     string    `json:"reason,omitempty"`
+}
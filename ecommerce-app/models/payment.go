@@ -0,0 +1,43 @@
+package models
+
+import (
+    "time"
+)
+
+// Payment statuses
+const (
+    PaymentStatusPending           = "pending"
+    PaymentStatusAuthorized        = "authorized"
+    PaymentStatusCaptured          = "captured"
+    PaymentStatusPartiallyRefunded = "partially_refunded"
+    PaymentStatusRefunded          = "refunded"
+    PaymentStatusVoided            = "voided"
+    PaymentStatusFailed            = "failed"
+)
+
+// Payment is one attempt to pay for an order. Reference is our idempotency key sent
+// to the provider; ProviderRef is the provider's identifier for the charge. An order
+// has at most one payment that has not failed or been voided.
+type Payment struct {
+    ID             uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt      time.Time `json:"CreatedAt"`
+    UpdatedAt      time.Time `json:"UpdatedAt"`
+    OrderID        uint      `gorm:"not null;index;uniqueIndex:idx_payments_open_order,where:status <> 'failed' AND status <> 'voided'" json:"order_id"`
+    Provider       string    `gorm:"not null" json:"provider"`
+    Reference      string    `gorm:"uniqueIndex;not null" json:"reference"`
+    ProviderRef    string    `gorm:"index" json:"provider_ref"`
+    Status         string    `gorm:"not null;default:'pending';index" json:"status"`
+    Amount         float64   `gorm:"not null" json:"amount"`
+    CapturedAmount float64   `gorm:"not null;default:0" json:"captured_amount"`
+    RefundedAmount float64   `gorm:"not null;default:0" json:"refunded_amount"`
+    FailureReason  string    `json:"failure_reason,omitempty"`
+}
+
+// PaymentWebhookEvent records provider webhook deliveries so retries are only applied once
+type PaymentWebhookEvent struct {
+    ID        uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time `json:"CreatedAt"`
+    EventID   string    `gorm:"uniqueIndex;not null" json:"event_id"`
+    Type      string    `gorm:"not null" json:"type"`
+    Reference string    `gorm:"index" json:"reference"`
+}
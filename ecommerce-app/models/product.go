@@ -4,8 +4,16 @@ import "gorm.io/gorm"
 
 type Product struct {
 	gorm.Model
-	Name        string  `json:"name" gorm:"not null"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price" gorm:"not null"`
-	Stock       int     `json:"stock" gorm:"not null"`
+	Name          string  `json:"name" gorm:"not null"`
+	Description   string  `json:"description"`
+	Category      string  `json:"category" gorm:"index"`
+	Price         float64 `json:"price" gorm:"not null"`
+	Stock         int     `json:"stock" gorm:"not null"`
+	TaxClass      string  `json:"tax_class" gorm:"not null;default:'standard'"`
+	WeightKg      float64 `json:"weight_kg" gorm:"not null;default:0"`
+	LengthCm      float64 `json:"length_cm" gorm:"not null;default:0"`
+	WidthCm       float64 `json:"width_cm" gorm:"not null;default:0"`
+	HeightCm      float64 `json:"height_cm" gorm:"not null;default:0"`
+	AverageRating float64 `json:"average_rating" gorm:"not null;default:0"`
+	RatingCount   int     `json:"rating_count" gorm:"not null;default:0"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+    "time"
+)
+
+// RefreshToken is a server-side record of an issued refresh token. Only the SHA-256
+// hash of the token is stored. Tokens rotate on every use; all tokens descended from
+// one login share a FamilyID so a reused token can revoke the whole chain.
+type RefreshToken struct {
+    ID        uint       `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time  `json:"CreatedAt"`
+    UserID    uint       `gorm:"not null;index" json:"user_id"`
+    FamilyID  string     `gorm:"not null;index" json:"family_id"`
+    TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+    ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+    UsedAt    *time.Time `json:"used_at"`
+    RevokedAt *time.Time `gorm:"index" json:"revoked_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+    "time"
+)
+
+// Return request statuses
+const (
+    ReturnStatusRequested = "requested"
+    ReturnStatusApproved  = "approved"
+    ReturnStatusRejected  = "rejected"
+    ReturnStatusReceived  = "received"
+    ReturnStatusRefunded  = "refunded"
+)
+
+// ReturnRequest is a customer's request to return lines of a delivered order (an RMA).
+// RefundAmount is set when the return is approved.
+type ReturnRequest struct {
+    ID           uint         `gorm:"primaryKey" json:"ID"`
+    CreatedAt    time.Time    `json:"CreatedAt"`
+    UpdatedAt    time.Time    `json:"UpdatedAt"`
+    OrderID      uint         `gorm:"not null;index" json:"order_id"`
+    UserID       uint         `gorm:"not null;index" json:"user_id"`
+    Status       string       `gorm:"not null;default:'requested';index" json:"status"`
+    RefundAmount float64      `gorm:"not null;default:0" json:"refund_amount"`
+    AdminNote    string       `json:"admin_note,omitempty"`
+    Items        []ReturnItem `gorm:"foreignKey:ReturnRequestID" json:"items"`
+}
+
+type ReturnItem struct {
+    ID              uint   `gorm:"primaryKey" json:"ID"`
+    ReturnRequestID uint   `gorm:"not null;index" json:"return_request_id"`
+    OrderItemID     uint   `gorm:"not null;index" json:"order_item_id"`
+    ProductID       uint   `gorm:"not null" json:"product_id"`
+    Quantity        int    `gorm:"not null" json:"quantity"`
+    Reason          string `gorm:"not null" json:"reason"`
+}
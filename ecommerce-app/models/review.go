@@ -0,0 +1,26 @@
+package models
+
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+// Review moderation statuses
+const (
+    ReviewStatusPending  = "pending"
+    ReviewStatusApproved = "approved"
+    ReviewStatusRejected = "rejected"
+)
+
+type Review struct {
+    ID        uint           `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time      `json:"CreatedAt"`
+    UpdatedAt time.Time      `json:"UpdatedAt"`
+    DeletedAt gorm.DeletedAt `gorm:"index" json:"DeletedAt"`
+    UserID    uint           `gorm:"not null;uniqueIndex:idx_review_user_product" json:"user_id"`
+    ProductID uint           `gorm:"not null;index;uniqueIndex:idx_review_user_product" json:"product_id"`
+    Rating    int            `gorm:"not null" json:"rating"`
+    Body      string         `gorm:"type:text" json:"body"`
+    Status    string         `gorm:"not null;default:'pending';index" json:"status"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+    "time"
+)
+
+// Permissions understood by RequirePermission. Roles grant a subset of these.
+const (
+    PermissionAdminAccess   = "admin:access"
+    PermissionProductsWrite = "products:write"
+    PermissionOrdersManage  = "orders:manage"
+    PermissionOrdersRefund  = "orders:refund"
+    PermissionUsersManage   = "users:manage"
+    PermissionAPIKeysManage = "api_keys:manage"
+)
+
+// AllPermissions is the permission catalog; the built-in admin role holds all of it
+var AllPermissions = []string{
+    PermissionAdminAccess,
+    PermissionProductsWrite,
+    PermissionOrdersManage,
+    PermissionOrdersRefund,
+    PermissionUsersManage,
+    PermissionAPIKeysManage,
+}
+
+// Built-in roles, created at startup and never deleted
+const (
+    RoleAdmin = "admin"
+    RoleUser  = "user"
+)
+
+// Role is a named set of permissions. User.Role holds the role name.
+type Role struct {
+    ID          uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt   time.Time `json:"CreatedAt"`
+    UpdatedAt   time.Time `json:"UpdatedAt"`
+    Name        string    `gorm:"uniqueIndex;not null" json:"name"`
+    Description string    `json:"description"`
+    Permissions []string  `gorm:"serializer:json" json:"permissions"`
+}
+
+// HasPermission reports whether the role grants permission
+func (r *Role) HasPermission(permission string) bool {
+    for _, p := range r.Permissions {
+        if p == permission {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+// Shipping method rate types
+const (
+    ShippingRateFlat        = "flat"
+    ShippingRateWeightBased = "weight_based"
+)
+
+// ShippingMethod is a way of shipping an order. Flat methods charge FlatRate; weight
+// based methods charge the lightest tier whose MaxWeightKg covers the parcel. Orders
+// at or above FreeOverAmount ship free when it is set. Empty Countries means worldwide.
+type ShippingMethod struct {
+    ID             uint               `gorm:"primaryKey" json:"ID"`
+    CreatedAt      time.Time          `json:"CreatedAt"`
+    UpdatedAt      time.Time          `json:"UpdatedAt"`
+    DeletedAt      gorm.DeletedAt     `gorm:"index" json:"DeletedAt"`
+    Code           string             `gorm:"uniqueIndex;not null" json:"code"`
+    Name           string             `gorm:"not null" json:"name"`
+    RateType       string             `gorm:"not null" json:"rate_type"`
+    FlatRate       float64            `json:"flat_rate"`
+    FreeOverAmount float64            `json:"free_over_amount"` // 0 = never free
+    Countries      []string           `gorm:"serializer:json" json:"countries"`
+    Active         bool               `gorm:"not null" json:"active"` // the admin API defaults it to true
+    RateTiers      []ShippingRateTier `gorm:"foreignKey:ShippingMethodID" json:"rate_tiers"`
+}
+
+type ShippingRateTier struct {
+    ID               uint    `gorm:"primaryKey" json:"ID"`
+    ShippingMethodID uint    `gorm:"not null;index" json:"shipping_method_id"`
+    MaxWeightKg      float64 `gorm:"not null" json:"max_weight_kg"`
+    Price            float64 `gorm:"not null" json:"price"`
+}
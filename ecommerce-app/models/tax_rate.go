@@ -0,0 +1,29 @@
+package models
+
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+// Product tax classes
+const (
+    TaxClassStandard = "standard"
+    TaxClassReduced  = "reduced"
+    TaxClassExempt   = "exempt"
+)
+
+// TaxRate is a row in the tax table. Empty Region and PostalCodePrefix match any
+// region or postal code in the country; the most specific matching row wins.
+type TaxRate struct {
+    ID               uint           `gorm:"primaryKey" json:"ID"`
+    CreatedAt        time.Time      `json:"CreatedAt"`
+    UpdatedAt        time.Time      `json:"UpdatedAt"`
+    DeletedAt        gorm.DeletedAt `gorm:"index" json:"DeletedAt"`
+    Country          string         `gorm:"not null;index" json:"country"`
+    Region           string         `json:"region"`
+    PostalCodePrefix string         `json:"postal_code_prefix"`
+    TaxClass         string         `gorm:"not null;default:'standard'" json:"tax_class"`
+    Name             string         `gorm:"not null" json:"name"`
+    Rate             float64        `gorm:"not null" json:"rate"` // fraction, e.g. 0.0825
+}
@@ -12,5 +12,18 @@ type User struct {
     Username  string     `gorm:"unique;not null"`
     Password  string     `gorm:"not null"`
     Email     string     `gorm:"unique;not null"`
-    Role      string     `gorm:"not null;default:'user'"`
+    // EmailVerifiedAt is nil until the user follows the verification link
+    EmailVerifiedAt *time.Time `gorm:"type:timestamptz"`
+    // PendingEmail is the address a requested email change will switch to once the
+    // link mailed there is followed
+    PendingEmail string `gorm:"not null;default:''"`
+    Role         string `gorm:"not null;default:'user'"`
+    // TokenVersion is embedded in access tokens; bumping it invalidates every token
+    // issued before the bump
+    TokenVersion int `gorm:"not null;default:0"`
+    // SuspendedAt is set while an admin has suspended the account; suspended users
+    // cannot log in or use existing tokens
+    SuspendedAt     *time.Time `gorm:"type:timestamptz"`
+    SuspendedReason string
+    Addresses       []Address `gorm:"foreignKey:UserID"`
 }
@@ -0,0 +1,16 @@
+package models
+
+import (
+    "time"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect provider.
+// Subject is the provider's stable user ID; the email is kept for display only.
+type UserIdentity struct {
+    ID        uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time `json:"CreatedAt"`
+    UserID    uint      `gorm:"not null;index" json:"user_id"`
+    Provider  string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+    Subject   string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"-"`
+    Email     string    `json:"email"`
+}
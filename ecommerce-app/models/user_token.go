@@ -0,0 +1,25 @@
+package models
+
+import (
+    "time"
+)
+
+// User token purposes
+const (
+    UserTokenEmailVerification = "email_verification"
+    UserTokenPasswordReset     = "password_reset"
+    UserTokenAccountUnlock     = "account_unlock"
+    UserTokenEmailChange       = "email_change"
+)
+
+// UserToken is a single-use, expiring token mailed to a user. Only its SHA-256 hash
+// is stored.
+type UserToken struct {
+    ID        uint       `gorm:"primaryKey" json:"ID"`
+    CreatedAt time.Time  `json:"CreatedAt"`
+    UserID    uint       `gorm:"not null;index" json:"user_id"`
+    Purpose   string     `gorm:"not null;index" json:"purpose"`
+    TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+    ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+    UsedAt    *time.Time `json:"used_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+type Wishlist struct {
+    ID         uint           `gorm:"primaryKey" json:"ID"`
+    CreatedAt  time.Time      `json:"CreatedAt"`
+    UpdatedAt  time.Time      `json:"UpdatedAt"`
+    DeletedAt  gorm.DeletedAt `gorm:"index" json:"DeletedAt"`
+    UserID     uint           `gorm:"not null;index" json:"user_id"`
+    Name       string         `gorm:"not null" json:"name"`
+    ShareToken *string        `gorm:"uniqueIndex" json:"share_token,omitempty"`
+    Items      []WishlistItem `gorm:"foreignKey:WishlistID" json:"items"`
+}
+
+type WishlistItem struct {
+    ID         uint      `gorm:"primaryKey" json:"ID"`
+    CreatedAt  time.Time `json:"CreatedAt"`
+    WishlistID uint      `gorm:"not null;uniqueIndex:idx_wishlist_product" json:"wishlist_id"`
+    ProductID  uint      `gorm:"not null;index;uniqueIndex:idx_wishlist_product" json:"product_id"`
+    Product    Product   `gorm:"foreignKey:ProductID" json:"product"`
+}
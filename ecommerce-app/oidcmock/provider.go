@@ -0,0 +1,214 @@
+// Package oidcmock is a minimal OpenID Connect provider for local development and
+// tests. It signs in whoever it is asked to, so it must never be enabled in
+// production.
+package oidcmock
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "math/big"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/golang-jwt/jwt/v4"
+)
+
+const (
+    keyID       = "oidcmock"
+    codeTTL     = time.Minute
+    idTokenTTL  = 5 * time.Minute
+    defaultUser = "dev@example.com"
+)
+
+// Provider serves discovery, authorize, token and JWKS endpoints. The authorize
+// endpoint approves immediately, signing in the email given as login_hint.
+type Provider struct {
+    // Issuer is the URL the provider is reached at, including any path prefix
+    Issuer string
+
+    key   *rsa.PrivateKey
+    mux   *http.ServeMux
+    mu    sync.Mutex
+    codes map[string]authorization
+}
+
+// authorization is a pending authorization code
+type authorization struct {
+    clientID      string
+    redirectURI   string
+    nonce         string
+    challenge     string
+    email         string
+    emailVerified bool
+    expiresAt     time.Time
+}
+
+// New creates a Provider with a freshly generated signing key
+func New(issuer string) (*Provider, error) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        return nil, err
+    }
+    p := &Provider{
+        Issuer: strings.TrimRight(issuer, "/"),
+        key:    key,
+        mux:    http.NewServeMux(),
+        codes:  map[string]authorization{},
+    }
+    p.mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+    p.mux.HandleFunc("/authorize", p.authorize)
+    p.mux.HandleFunc("/token", p.token)
+    p.mux.HandleFunc("/jwks", p.jwks)
+    return p, nil
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    p.mux.ServeHTTP(w, r)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "issuer":                                p.Issuer,
+        "authorization_endpoint":                p.Issuer + "/authorize",
+        "token_endpoint":                        p.Issuer + "/token",
+        "jwks_uri":                              p.Issuer + "/jwks",
+        "response_types_supported":              []string{"code"},
+        "subject_types_supported":               []string{"public"},
+        "id_token_signing_alg_values_supported": []string{"RS256"},
+        "code_challenge_methods_supported":      []string{"S256"},
+    })
+}
+
+// authorize handles the authorization request. login_hint picks the user; a hint of
+// the form "unverified:<email>" reports the email as unverified.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    redirectURI := query.Get("redirect_uri")
+    target, err := url.Parse(redirectURI)
+    if err != nil || redirectURI == "" {
+        http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+        return
+    }
+    if query.Get("response_type") != "code" || query.Get("client_id") == "" ||
+        query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+        http.Error(w, "code flow with client_id and an S256 code_challenge is required", http.StatusBadRequest)
+        return
+    }
+
+    email, verified := defaultUser, true
+    if hint := query.Get("login_hint"); hint != "" {
+        email = hint
+        if rest := strings.TrimPrefix(hint, "unverified:"); rest != hint {
+            email, verified = rest, false
+        }
+    }
+    code := randomString()
+    p.mu.Lock()
+    p.codes[code] = authorization{
+        clientID:      query.Get("client_id"),
+        redirectURI:   redirectURI,
+        nonce:         query.Get("nonce"),
+        challenge:     query.Get("code_challenge"),
+        email:         email,
+        emailVerified: verified,
+        expiresAt:     time.Now().Add(codeTTL),
+    }
+    p.mu.Unlock()
+
+    params := target.Query()
+    params.Set("code", code)
+    params.Set("state", query.Get("state"))
+    target.RawQuery = params.Encode()
+    http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+        tokenError(w, "unsupported_grant_type")
+        return
+    }
+    code := r.PostForm.Get("code")
+    p.mu.Lock()
+    auth, ok := p.codes[code]
+    delete(p.codes, code)
+    p.mu.Unlock()
+
+    verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+    switch {
+    case !ok, time.Now().After(auth.expiresAt),
+        r.PostForm.Get("client_id") != auth.clientID,
+        r.PostForm.Get("redirect_uri") != auth.redirectURI,
+        base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge:
+        tokenError(w, "invalid_grant")
+        return
+    }
+
+    now := time.Now()
+    claims := jwt.MapClaims{
+        "iss":            p.Issuer,
+        "sub":            "mock|" + strings.ToLower(auth.email),
+        "aud":            auth.clientID,
+        "iat":            now.Unix(),
+        "exp":            now.Add(idTokenTTL).Unix(),
+        "email":          auth.email,
+        "email_verified": auth.emailVerified,
+        "name":           strings.SplitN(auth.email, "@", 2)[0],
+    }
+    if auth.nonce != "" {
+        claims["nonce"] = auth.nonce
+    }
+    idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+    idToken.Header["kid"] = keyID
+    signed, err := idToken.SignedString(p.key)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "access_token": randomString(),
+        "token_type":   "Bearer",
+        "expires_in":   int(idTokenTTL.Seconds()),
+        "id_token":     signed,
+    })
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+    pub := p.key.PublicKey
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "keys": []map[string]string{{
+            "kty": "RSA",
+            "kid": keyID,
+            "use": "sig",
+            "alg": "RS256",
+            "n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+            "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+        }},
+    })
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+    writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+    buf := make([]byte, 24)
+    rand.Read(buf)
+    return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,146 @@
+package repositories
+
+import (
+    "errors"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+var (
+    // ErrAbandonedCartOpen is returned by CreateAbandonedCart when the user already has
+    // an open record
+    ErrAbandonedCartOpen = errors.New("user already has an open abandoned cart")
+    // ErrAbandonedCartUnavailable is returned by UpdateOpenAbandonedCart when the record
+    // is no longer open or another run is following it up
+    ErrAbandonedCartUnavailable = errors.New("abandoned cart is closed or locked")
+)
+
+// AbandonedCartRepository defines the interface for abandoned cart data operations
+type AbandonedCartRepository interface {
+    FindAbandonedCarts(cutoff time.Time, limit int) ([]models.AbandonedCart, error)
+    CreateAbandonedCart(abandoned *models.AbandonedCart) error
+    GetOpenAbandonedCarts(limit int) ([]models.AbandonedCart, error)
+    UpdateOpenAbandonedCart(id uint, update func(abandoned *models.AbandonedCart) (bool, error)) error
+    GetFirstOrderSince(userID uint, since time.Time) (*models.Order, error)
+    GetAbandonedCartStats(since time.Time) (*models.AbandonedCartStats, error)
+}
+
+// abandonedCartRepository implements AbandonedCartRepository
+type abandonedCartRepository struct {
+    db *gorm.DB
+}
+
+// NewAbandonedCartRepository creates a new AbandonedCartRepository
+func NewAbandonedCartRepository(db *gorm.DB) AbandonedCartRepository {
+    return &abandonedCartRepository{db: db}
+}
+
+// FindAbandonedCarts returns unsaved records for the carts of active users that have
+// not changed since cutoff, oldest first. Carts that already have an open record, or
+// were recorded and have not changed since, are skipped.
+func (r *abandonedCartRepository) FindAbandonedCarts(cutoff time.Time, limit int) ([]models.AbandonedCart, error) {
+    var candidates []models.AbandonedCart
+    err := r.db.Model(&models.Cart{}).
+        Select("carts.user_id, MAX(carts.updated_at) AS cart_updated_at, SUM(carts.quantity) AS item_count, SUM(carts.quantity * products.price) AS subtotal").
+        Joins("JOIN products ON products.id = carts.product_id AND products.deleted_at IS NULL").
+        Joins("JOIN users ON users.id = carts.user_id AND users.deleted_at IS NULL AND users.suspended_at IS NULL").
+        Group("carts.user_id").
+        Having("MAX(carts.updated_at) < ?", cutoff).
+        Having(`NOT EXISTS (SELECT 1 FROM abandoned_carts a WHERE a.user_id = carts.user_id
+            AND (a.status = ? OR a.cart_updated_at >= MAX(carts.updated_at)))`, models.AbandonedCartStatusOpen).
+        Order("cart_updated_at").
+        Limit(limit).
+        Scan(&candidates).Error
+    return candidates, err
+}
+
+// CreateAbandonedCart stores a new open record; the open record index on the user makes
+// concurrent runs that detect the same cart fail with ErrAbandonedCartOpen
+func (r *abandonedCartRepository) CreateAbandonedCart(abandoned *models.AbandonedCart) error {
+    result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(abandoned)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return ErrAbandonedCartOpen
+    }
+    return nil
+}
+
+// GetOpenAbandonedCarts returns the open records that have waited longest since their
+// last reminder, or since detection when none has been sent
+func (r *abandonedCartRepository) GetOpenAbandonedCarts(limit int) ([]models.AbandonedCart, error) {
+    var records []models.AbandonedCart
+    err := r.db.Where("status = ?", models.AbandonedCartStatusOpen).
+        Order("COALESCE(last_reminder_at, created_at)").
+        Limit(limit).
+        Find(&records).Error
+    return records, err
+}
+
+// UpdateOpenAbandonedCart locks the open record with FOR UPDATE SKIP LOCKED, passes it
+// to update and saves it when update reports a change, all in one transaction, so
+// concurrent runs never follow up the same record
+func (r *abandonedCartRepository) UpdateOpenAbandonedCart(id uint, update func(abandoned *models.AbandonedCart) (bool, error)) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        var abandoned models.AbandonedCart
+        err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+            Where("id = ? AND status = ?", id, models.AbandonedCartStatusOpen).
+            First(&abandoned).Error
+        if err == gorm.ErrRecordNotFound {
+            return ErrAbandonedCartUnavailable
+        }
+        if err != nil {
+            return err
+        }
+        changed, err := update(&abandoned)
+        if err != nil || !changed {
+            return err
+        }
+        return tx.Save(&abandoned).Error
+    })
+}
+
+// GetFirstOrderSince returns the user's first order placed at or after since
+func (r *abandonedCartRepository) GetFirstOrderSince(userID uint, since time.Time) (*models.Order, error) {
+    var order models.Order
+    err := r.db.Where("user_id = ? AND created_at >= ?", userID, since).
+        Order("created_at").
+        First(&order).Error
+    if err != nil {
+        return nil, err
+    }
+    return &order, nil
+}
+
+// GetAbandonedCartStats counts the carts detected since the given time by outcome.
+// Rates are left for the caller to work out.
+func (r *abandonedCartRepository) GetAbandonedCartStats(since time.Time) (*models.AbandonedCartStats, error) {
+    stats := models.AbandonedCartStats{Since: since}
+    err := r.db.Model(&models.AbandonedCart{}).
+        Select(`COUNT(*) AS detected,
+            COUNT(*) FILTER (WHERE status = ?) AS open,
+            COUNT(*) FILTER (WHERE reminders_sent > 0) AS reminded,
+            COALESCE(SUM(reminders_sent), 0) AS reminders_sent,
+            COUNT(*) FILTER (WHERE status = ?) AS recovered,
+            COUNT(*) FILTER (WHERE status = ? AND reminders_sent > 0) AS recovered_after_reminder,
+            COUNT(*) FILTER (WHERE status = ?) AS resumed,
+            COUNT(*) FILTER (WHERE status = ?) AS emptied,
+            COUNT(*) FILTER (WHERE status = ?) AS expired,
+            COALESCE(SUM(recovered_total), 0) AS recovered_revenue`,
+            models.AbandonedCartStatusOpen,
+            models.AbandonedCartStatusRecovered,
+            models.AbandonedCartStatusRecovered,
+            models.AbandonedCartStatusResumed,
+            models.AbandonedCartStatusEmptied,
+            models.AbandonedCartStatusExpired).
+        Where("created_at >= ?", since).
+        Scan(&stats).Error
+    if err != nil {
+        return nil, err
+    }
+    return &stats, nil
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// AddressRepository defines the interface for address book data operations
+type AddressRepository interface {
+    CreateAddress(address *models.Address) error
+    GetAddressesByUserID(userID uint) ([]models.Address, error)
+    GetAddressByID(id uint) (*models.Address, error)
+    UpdateAddress(address *models.Address) error
+    DeleteAddress(id uint) error
+    SetDefaultAddress(userID, id uint) error
+}
+
+// addressRepository implements AddressRepository
+type addressRepository struct {
+    db *gorm.DB
+}
+
+// NewAddressRepository creates a new AddressRepository
+func NewAddressRepository(db *gorm.DB) AddressRepository {
+    return &addressRepository{db: db}
+}
+
+func (r *addressRepository) CreateAddress(address *models.Address) error {
+    return r.db.Create(address).Error
+}
+
+func (r *addressRepository) GetAddressesByUserID(userID uint) ([]models.Address, error) {
+    var addresses []models.Address
+    err := r.db.Where("user_id = ?", userID).Order("is_default DESC, created_at ASC").Find(&addresses).Error
+    return addresses, err
+}
+
+func (r *addressRepository) GetAddressByID(id uint) (*models.Address, error) {
+    var address models.Address
+    if err := r.db.First(&address, id).Error; err != nil {
+        return nil, err
+    }
+    return &address, nil
+}
+
+func (r *addressRepository) UpdateAddress(address *models.Address) error {
+    return r.db.Save(address).Error
+}
+
+func (r *addressRepository) DeleteAddress(id uint) error {
+    return r.db.Delete(&models.Address{}, id).Error
+}
+
+// SetDefaultAddress makes the address the user's only default address
+func (r *addressRepository) SetDefaultAddress(userID, id uint) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        err := tx.Model(&models.Address{}).
+            Where("user_id = ? AND id <> ?", userID, id).
+            Update("is_default", false).Error
+        if err != nil {
+            return err
+        }
+        return tx.Model(&models.Address{}).
+            Where("user_id = ? AND id = ?", userID, id).
+            Update("is_default", true).Error
+    })
+}
@@ -0,0 +1,52 @@
+package repositories
+
+import (
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// APIKeyRepository defines the interface for API key data operations
+type APIKeyRepository interface {
+    CreateAPIKey(key *models.APIKey) error
+    GetAPIKeys() ([]models.APIKey, error)
+    GetAPIKeyByID(id uint) (*models.APIKey, error)
+    RevokeAPIKey(id uint) (bool, error)
+}
+
+// apiKeyRepository implements APIKeyRepository
+type apiKeyRepository struct {
+    db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+    return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) CreateAPIKey(key *models.APIKey) error {
+    return r.db.Create(key).Error
+}
+
+func (r *apiKeyRepository) GetAPIKeys() ([]models.APIKey, error) {
+    var keys []models.APIKey
+    err := r.db.Order("created_at DESC").Find(&keys).Error
+    return keys, err
+}
+
+func (r *apiKeyRepository) GetAPIKeyByID(id uint) (*models.APIKey, error) {
+    var key models.APIKey
+    if err := r.db.First(&key, id).Error; err != nil {
+        return nil, err
+    }
+    return &key, nil
+}
+
+// RevokeAPIKey marks the key revoked, reporting false when it already was
+func (r *apiKeyRepository) RevokeAPIKey(id uint) (bool, error) {
+    result := r.db.Model(&models.APIKey{}).
+        Where("id = ? AND revoked_at IS NULL", id).
+        Update("revoked_at", time.Now())
+    return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,42 @@
+package repositories
+
+import (
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// AuditLogRepository defines the interface for audit log data operations. Entries are
+// only ever appended.
+type AuditLogRepository interface {
+    CreateAuditLog(entry *models.AuditLog) error
+    GetAuditLogsByTarget(userID uint, page, limit int) ([]models.AuditLog, int64, error)
+}
+
+// auditLogRepository implements AuditLogRepository
+type auditLogRepository struct {
+    db *gorm.DB
+}
+
+// NewAuditLogRepository creates a new AuditLogRepository
+func NewAuditLogRepository(db *gorm.DB) AuditLogRepository {
+    return &auditLogRepository{db: db}
+}
+
+func (r *auditLogRepository) CreateAuditLog(entry *models.AuditLog) error {
+    return r.db.Create(entry).Error
+}
+
+// GetAuditLogsByTarget returns the actions taken on a user, newest first
+func (r *auditLogRepository) GetAuditLogsByTarget(userID uint, page, limit int) ([]models.AuditLog, int64, error) {
+    query := r.db.Model(&models.AuditLog{}).Where("target_user_id = ?", userID)
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+    var entries []models.AuditLog
+    err := query.Order("created_at DESC, id DESC").
+        Offset((page - 1) * limit).
+        Limit(limit).
+        Find(&entries).Error
+    return entries, total, err
+}
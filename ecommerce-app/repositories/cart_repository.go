@@ -1,17 +1,27 @@
 package repositories
 
 import (
+    "errors"
+
     "github.com/inquisitivefrog/ecommerce-app/models"
     "gorm.io/gorm"
+    "gorm.io/gorm/clause"
 )
 
+// ErrCartQuantityExceedsStock is returned by AddItemQuantity when the line would hold
+// more than the product's stock
+var ErrCartQuantityExceedsStock = errors.New("cart quantity exceeds stock")
+
 // CartRepository interface defines methods for cart database operations
 type CartRepository interface {
     AddItem(cartItem *models.Cart) error
+    AddItemQuantity(userID, productID uint, quantity int) (*models.Cart, error)
+    AddItemQuantityUpToStock(userID, productID uint, quantity int) (*models.Cart, error)
     GetCartByUserID(userID uint) ([]models.Cart, error)
-    GetCartItemByID(id uint) (*models.Cart, error)
-    UpdateItem(cartItem *models.Cart) error
-    DeleteItem(id uint) error
+    GetCartItemByID(userID, id uint) (*models.Cart, error)
+    UpdateItem(userID uint, cartItem *models.Cart) error
+    RepriceItem(userID, id uint, price float64) error
+    DeleteItem(userID, id uint) error
 }
 
 // cartRepository struct implements CartRepository
@@ -29,6 +39,68 @@ func (r *cartRepository) AddItem(cartItem *models.Cart) error {
     return r.DB.Create(cartItem).Error
 }
 
+// AddItemQuantity adds quantity to the user's line for a product in a single
+// transaction, creating the line when there is none and folding duplicate lines into
+// one. The product row is locked, so concurrent adds cannot together exceed its stock.
+// A new line records the product's current price; an existing line keeps its own.
+func (r *cartRepository) AddItemQuantity(userID, productID uint, quantity int) (*models.Cart, error) {
+    return r.addItemQuantity(userID, productID, quantity, false)
+}
+
+// AddItemQuantityUpToStock adds quantity like AddItemQuantity, but lowers the line to the
+// product's stock instead of failing. It fails with ErrCartQuantityExceedsStock only
+// when the product is sold out.
+func (r *cartRepository) AddItemQuantityUpToStock(userID, productID uint, quantity int) (*models.Cart, error) {
+    return r.addItemQuantity(userID, productID, quantity, true)
+}
+
+func (r *cartRepository) addItemQuantity(userID, productID uint, quantity int, capToStock bool) (*models.Cart, error) {
+    var line models.Cart
+    err := r.DB.Transaction(func(tx *gorm.DB) error {
+        var product models.Product
+        if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+            return err
+        }
+        var lines []models.Cart
+        if err := tx.Where("user_id = ? AND product_id = ?", userID, productID).Order("id").Find(&lines).Error; err != nil {
+            return err
+        }
+        total := quantity
+        for _, existing := range lines {
+            total += existing.Quantity
+        }
+        if total > product.Stock {
+            if !capToStock || product.Stock <= 0 {
+                return ErrCartQuantityExceedsStock
+            }
+            total = product.Stock
+        }
+        if len(lines) == 0 {
+            line = models.Cart{UserID: userID, ProductID: productID, Quantity: total, PriceAtAdd: product.Price}
+            if err := tx.Create(&line).Error; err != nil {
+                return err
+            }
+        } else {
+            line = lines[0]
+            line.Quantity = total
+            if err := tx.Model(&line).Update("quantity", total).Error; err != nil {
+                return err
+            }
+            for _, duplicate := range lines[1:] {
+                if err := tx.Delete(&models.Cart{}, duplicate.ID).Error; err != nil {
+                    return err
+                }
+            }
+        }
+        line.Product = product
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &line, nil
+}
+
 // GetCartByUserID retrieves a user's cart
 func (r *cartRepository) GetCartByUserID(userID uint) ([]models.Cart, error) {
     var cartItems []models.Cart
@@ -36,19 +108,51 @@ func (r *cartRepository) GetCartByUserID(userID uint) ([]models.Cart, error) {
     return cartItems, err
 }
 
-// GetCartItemByID retrieves a specific cart item
-func (r *cartRepository) GetCartItemByID(id uint) (*models.Cart, error) {
+// GetCartItemByID retrieves a specific item from a user's cart. Items in other users'
+// carts are not found.
+func (r *cartRepository) GetCartItemByID(userID, id uint) (*models.Cart, error) {
     var cartItem models.Cart
-    err := r.DB.Preload("Product").First(&cartItem, id).Error
+    err := r.DB.Preload("Product").Where("user_id = ?", userID).First(&cartItem, id).Error
     return &cartItem, err
 }
 
-// UpdateItem updates a cart item
-func (r *cartRepository) UpdateItem(cartItem *models.Cart) error {
-    return r.DB.Save(cartItem).Error
+// UpdateItem saves the quantity of an item in a user's cart
+func (r *cartRepository) UpdateItem(userID uint, cartItem *models.Cart) error {
+    result := r.DB.Model(&models.Cart{}).
+        Where("id = ? AND user_id = ?", cartItem.ID, userID).
+        Update("quantity", cartItem.Quantity)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return nil
+}
+
+// RepriceItem sets the price recorded for an item in a user's cart, once the user has
+// accepted the product's current price
+func (r *cartRepository) RepriceItem(userID, id uint, price float64) error {
+    result := r.DB.Model(&models.Cart{}).
+        Where("id = ? AND user_id = ?", id, userID).
+        Update("price_at_add", price)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return nil
 }
 
-// DeleteItem deletes a cart item
-func (r *cartRepository) DeleteItem(id uint) error {
-    return r.DB.Delete(&models.Cart{}, id).Error
+// DeleteItem deletes an item from a user's cart
+func (r *cartRepository) DeleteItem(userID, id uint) error {
+    result := r.DB.Where("user_id = ?", userID).Delete(&models.Cart{}, id)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return nil
 }
@@ -0,0 +1,60 @@
+package repositories_test
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/driver/postgres"
+    "gorm.io/gorm"
+)
+
+// statement is the SQL and arguments of a statement built by a dry run database
+type statement struct {
+    SQL  string
+    Vars []interface{}
+}
+
+// newDryRunDB returns a database that builds statements without running them and
+// records each one
+func newDryRunDB(t *testing.T) (*gorm.DB, *[]statement) {
+    db, err := gorm.Open(postgres.Open("host=localhost dbname=test"), &gorm.Config{
+        DryRun:                 true,
+        DisableAutomaticPing:   true,
+        SkipDefaultTransaction: true,
+    })
+    if !assert.NoError(t, err) {
+        t.FailNow()
+    }
+    var statements []statement
+    record := func(db *gorm.DB) {
+        statements = append(statements, statement{SQL: db.Statement.SQL.String(), Vars: db.Statement.Vars})
+    }
+    db.Callback().Query().After("gorm:query").Register("test:record", record)
+    db.Callback().Update().After("gorm:update").Register("test:record", record)
+    db.Callback().Delete().After("gorm:delete").Register("test:record", record)
+    return db, &statements
+}
+
+func TestCartRepository_CartItemQueriesAreScopedToUser(t *testing.T) {
+    db, statements := newDryRunDB(t)
+    repo := repositories.NewCartRepository(db)
+
+    repo.GetCartItemByID(1, 2)
+    repo.UpdateItem(1, &models.Cart{ID: 2, Quantity: 5})
+    repo.RepriceItem(1, 2, 19.99)
+    repo.DeleteItem(1, 2)
+
+    // Test every statement on a single line filters on both the line and its owner, so
+    // another user's line is never read or changed
+    if assert.Len(t, *statements, 4) {
+        for _, statement := range *statements {
+            assert.True(t, strings.Contains(statement.SQL, "user_id = "), statement.SQL)
+            assert.True(t, strings.Contains(statement.SQL, `"carts"."id" = `) || strings.Contains(statement.SQL, "(id = "), statement.SQL)
+            assert.Contains(t, statement.Vars, uint(1))
+            assert.Contains(t, statement.Vars, uint(2))
+        }
+    }
+}
@@ -0,0 +1,141 @@
+package repositories
+
+import (
+    "errors"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrCouponLimitReached is returned when the global or per-user usage limit is exhausted
+var ErrCouponLimitReached = errors.New("coupon usage limit reached")
+
+// CouponRepository defines the interface for coupon data operations
+type CouponRepository interface {
+    CreateCoupon(coupon *models.Coupon) error
+    GetCoupons() ([]models.Coupon, error)
+    GetCouponByID(id uint) (*models.Coupon, error)
+    GetCouponByCode(code string) (*models.Coupon, error)
+    UpdateCoupon(coupon *models.Coupon) error
+    DeleteCoupon(id uint) error
+    GetCartCoupons(userID uint) ([]models.CartCoupon, error)
+    AddCartCoupon(cartCoupon *models.CartCoupon) error
+    RemoveCartCoupon(userID, couponID uint) (bool, error)
+    ClearCartCoupons(userID uint) error
+    CountRedemptionsByUser(couponID, userID uint) (int64, error)
+}
+
+// couponRepository implements CouponRepository
+type couponRepository struct {
+    db *gorm.DB
+}
+
+// NewCouponRepository creates a new CouponRepository
+func NewCouponRepository(db *gorm.DB) CouponRepository {
+    return &couponRepository{db: db}
+}
+
+func (r *couponRepository) CreateCoupon(coupon *models.Coupon) error {
+    return r.db.Create(coupon).Error
+}
+
+func (r *couponRepository) GetCoupons() ([]models.Coupon, error) {
+    var coupons []models.Coupon
+    err := r.db.Order("created_at DESC").Find(&coupons).Error
+    return coupons, err
+}
+
+func (r *couponRepository) GetCouponByID(id uint) (*models.Coupon, error) {
+    var coupon models.Coupon
+    if err := r.db.First(&coupon, id).Error; err != nil {
+        return nil, err
+    }
+    return &coupon, nil
+}
+
+func (r *couponRepository) GetCouponByCode(code string) (*models.Coupon, error) {
+    var coupon models.Coupon
+    if err := r.db.Where("code = ?", code).First(&coupon).Error; err != nil {
+        return nil, err
+    }
+    return &coupon, nil
+}
+
+func (r *couponRepository) UpdateCoupon(coupon *models.Coupon) error {
+    return r.db.Save(coupon).Error
+}
+
+func (r *couponRepository) DeleteCoupon(id uint) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("coupon_id = ?", id).Delete(&models.CartCoupon{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&models.Coupon{}, id).Error
+    })
+}
+
+func (r *couponRepository) GetCartCoupons(userID uint) ([]models.CartCoupon, error) {
+    var cartCoupons []models.CartCoupon
+    err := r.db.Where("user_id = ?", userID).Preload("Coupon").Order("created_at ASC").Find(&cartCoupons).Error
+    return cartCoupons, err
+}
+
+func (r *couponRepository) AddCartCoupon(cartCoupon *models.CartCoupon) error {
+    return r.db.Where("user_id = ? AND coupon_id = ?", cartCoupon.UserID, cartCoupon.CouponID).
+        FirstOrCreate(cartCoupon).Error
+}
+
+func (r *couponRepository) RemoveCartCoupon(userID, couponID uint) (bool, error) {
+    result := r.db.Where("user_id = ? AND coupon_id = ?", userID, couponID).Delete(&models.CartCoupon{})
+    return result.RowsAffected > 0, result.Error
+}
+
+func (r *couponRepository) ClearCartCoupons(userID uint) error {
+    return r.db.Where("user_id = ?", userID).Delete(&models.CartCoupon{}).Error
+}
+
+func (r *couponRepository) CountRedemptionsByUser(couponID, userID uint) (int64, error) {
+    var count int64
+    err := r.db.Model(&models.CouponRedemption{}).
+        Where("coupon_id = ? AND user_id = ?", couponID, userID).
+        Count(&count).Error
+    return count, err
+}
+
+// redeemCoupon atomically increments the coupon's usage count, respecting its global
+// and per-user usage limits, and records the redemption. It must run inside a
+// transaction; the coupon row stays locked until it ends, so concurrent checkouts by the
+// same user count each other's redemptions.
+func redeemCoupon(tx *gorm.DB, redemption *models.CouponRedemption) error {
+    var coupon models.Coupon
+    err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, redemption.CouponID).Error
+    if err == gorm.ErrRecordNotFound {
+        return ErrCouponLimitReached
+    }
+    if err != nil {
+        return err
+    }
+    if coupon.UsageLimitPerUser > 0 {
+        var used int64
+        err := tx.Model(&models.CouponRedemption{}).
+            Where("coupon_id = ? AND user_id = ?", redemption.CouponID, redemption.UserID).
+            Count(&used).Error
+        if err != nil {
+            return err
+        }
+        if used >= int64(coupon.UsageLimitPerUser) {
+            return ErrCouponLimitReached
+        }
+    }
+    result := tx.Model(&models.Coupon{}).
+        Where("id = ? AND (usage_limit = 0 OR usage_count < usage_limit)", redemption.CouponID).
+        UpdateColumn("usage_count", gorm.Expr("usage_count + 1"))
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return ErrCouponLimitReached
+    }
+    return tx.Create(redemption).Error
+}
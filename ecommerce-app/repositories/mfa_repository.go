@@ -0,0 +1,113 @@
+package repositories
+
+import (
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// MFARepository defines the interface for TOTP enrollment and recovery code data
+// operations
+type MFARepository interface {
+    GetTOTP(userID uint) (*models.UserTOTP, error)
+    SaveTOTP(totp *models.UserTOTP) error
+    ConfirmTOTP(userID uint, step int64) error
+    UseTOTPStep(userID uint, step int64) (bool, error)
+    DeleteTOTP(userID uint) error
+    ReplaceRecoveryCodes(userID uint, hashes []string) error
+    UseRecoveryCode(userID uint, hash string) (bool, error)
+    CountRecoveryCodes(userID uint) (int64, error)
+}
+
+// mfaRepository implements MFARepository
+type mfaRepository struct {
+    db *gorm.DB
+}
+
+// NewMFARepository creates a new MFARepository
+func NewMFARepository(db *gorm.DB) MFARepository {
+    return &mfaRepository{db: db}
+}
+
+func (r *mfaRepository) GetTOTP(userID uint) (*models.UserTOTP, error) {
+    var totp models.UserTOTP
+    if err := r.db.Where("user_id = ?", userID).First(&totp).Error; err != nil {
+        return nil, err
+    }
+    return &totp, nil
+}
+
+// SaveTOTP starts an enrollment, replacing any unconfirmed one for the user
+func (r *mfaRepository) SaveTOTP(totp *models.UserTOTP) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_id = ? AND confirmed_at IS NULL", totp.UserID).Delete(&models.UserTOTP{}).Error; err != nil {
+            return err
+        }
+        return tx.Create(totp).Error
+    })
+}
+
+// ConfirmTOTP activates the user's pending enrollment, recording the step of the code
+// that confirmed it
+func (r *mfaRepository) ConfirmTOTP(userID uint, step int64) error {
+    result := r.db.Model(&models.UserTOTP{}).
+        Where("user_id = ? AND confirmed_at IS NULL", userID).
+        Updates(map[string]interface{}{"confirmed_at": time.Now(), "last_used_step": step})
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return nil
+}
+
+// UseTOTPStep records step as used, reporting false when it or a later step already was
+func (r *mfaRepository) UseTOTPStep(userID uint, step int64) (bool, error) {
+    result := r.db.Model(&models.UserTOTP{}).
+        Where("user_id = ? AND last_used_step < ?", userID, step).
+        UpdateColumn("last_used_step", step)
+    return result.RowsAffected > 0, result.Error
+}
+
+// DeleteTOTP removes the user's authenticator and recovery codes
+func (r *mfaRepository) DeleteTOTP(userID uint) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+            return err
+        }
+        return tx.Where("user_id = ?", userID).Delete(&models.UserTOTP{}).Error
+    })
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for a new set
+func (r *mfaRepository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+            return err
+        }
+        codes := make([]models.MFARecoveryCode, len(hashes))
+        for i, hash := range hashes {
+            codes[i] = models.MFARecoveryCode{UserID: userID, CodeHash: hash}
+        }
+        return tx.Create(&codes).Error
+    })
+}
+
+// UseRecoveryCode marks the matching unused code used, reporting false when there is none
+func (r *mfaRepository) UseRecoveryCode(userID uint, hash string) (bool, error) {
+    result := r.db.Model(&models.MFARecoveryCode{}).
+        Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+        Update("used_at", time.Now())
+    return result.RowsAffected > 0, result.Error
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left
+func (r *mfaRepository) CountRecoveryCodes(userID uint) (int64, error) {
+    var count int64
+    err := r.db.Model(&models.MFARecoveryCode{}).
+        Where("user_id = ? AND used_at IS NULL", userID).
+        Count(&count).Error
+    return count, err
+}
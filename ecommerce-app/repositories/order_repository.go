@@ -0,0 +1,167 @@
+package repositories
+
+import (
+    "errors"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// ErrOutOfStock is returned by PlaceOrder when a product no longer has enough stock
+var ErrOutOfStock = errors.New("insufficient stock")
+
+// ErrOrderStatusChanged is returned by TransitionOrderStatus when the order is no
+// longer in the expected status
+var ErrOrderStatusChanged = errors.New("order status changed concurrently")
+
+// purchasedStatuses are the order statuses that count as a completed purchase
+var purchasedStatuses = []string{
+    models.OrderStatusPaid,
+    models.OrderStatusPicking,
+    models.OrderStatusShipped,
+    models.OrderStatusDelivered,
+}
+
+// OrderRepository defines the interface for order data operations
+type OrderRepository interface {
+    PlaceOrder(order *models.Order, couponIDs []uint) error
+    GetOrderByID(id uint) (*models.Order, error)
+    GetOrdersByUserID(userID uint) ([]models.Order, error)
+    HasPurchasedProduct(userID, productID uint) (bool, error)
+    ListOrders(status string, page, limit int) ([]models.Order, int64, error)
+    TransitionOrderStatus(transition *models.OrderStatusTransition, restock bool) error
+}
+
+// orderRepository implements OrderRepository
+type orderRepository struct {
+    db *gorm.DB
+}
+
+// NewOrderRepository creates a new OrderRepository
+func NewOrderRepository(db *gorm.DB) OrderRepository {
+    return &orderRepository{db: db}
+}
+
+// PlaceOrder creates the order from the user's cart in a single transaction: stock is
+// decremented, the order with its items and tax lines is stored, coupons are redeemed
+// and the cart and its coupons are cleared
+func (r *orderRepository) PlaceOrder(order *models.Order, couponIDs []uint) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        for _, item := range order.Items {
+            result := tx.Model(&models.Product{}).
+                Where("id = ? AND stock >= ? AND deleted_at IS NULL", item.ProductID, item.Quantity).
+                UpdateColumn("stock", gorm.Expr("stock - ?", item.Quantity))
+            if result.Error != nil {
+                return result.Error
+            }
+            if result.RowsAffected == 0 {
+                return ErrOutOfStock
+            }
+        }
+        if err := tx.Create(order).Error; err != nil {
+            return err
+        }
+        for _, couponID := range couponIDs {
+            err := redeemCoupon(tx, &models.CouponRedemption{
+                CouponID: couponID,
+                UserID:   order.UserID,
+                OrderID:  order.ID,
+            })
+            if err != nil {
+                return err
+            }
+        }
+        if err := tx.Where("user_id = ?", order.UserID).Delete(&models.Cart{}).Error; err != nil {
+            return err
+        }
+        return tx.Where("user_id = ?", order.UserID).Delete(&models.CartCoupon{}).Error
+    })
+}
+
+func (r *orderRepository) GetOrderByID(id uint) (*models.Order, error) {
+    var order models.Order
+    err := r.db.Preload("Items").
+        Preload("TaxLines").
+        Preload("Transitions", func(db *gorm.DB) *gorm.DB {
+            return db.Order("created_at ASC, id ASC")
+        }).
+        First(&order, id).Error
+    if err != nil {
+        return nil, err
+    }
+    return &order, nil
+}
+
+func (r *orderRepository) GetOrdersByUserID(userID uint) ([]models.Order, error) {
+    var orders []models.Order
+    err := r.db.Where("user_id = ?", userID).
+        Preload("Items").
+        Preload("TaxLines").
+        Order("created_at DESC").
+        Find(&orders).Error
+    return orders, err
+}
+
+// HasPurchasedProduct reports whether the user has a paid order containing the product
+func (r *orderRepository) HasPurchasedProduct(userID, productID uint) (bool, error) {
+    var count int64
+    err := r.db.Model(&models.OrderItem{}).
+        Joins("JOIN orders ON orders.id = order_items.order_id").
+        Where("orders.user_id = ? AND order_items.product_id = ?", userID, productID).
+        Where("orders.status IN ?", purchasedStatuses).
+        Where("orders.deleted_at IS NULL").
+        Count(&count).Error
+    return count > 0, err
+}
+
+// ListOrders returns orders for the admin view, newest first, optionally filtered by status
+func (r *orderRepository) ListOrders(status string, page, limit int) ([]models.Order, int64, error) {
+    query := r.db.Model(&models.Order{})
+    if status != "" {
+        query = query.Where("status = ?", status)
+    }
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+    var orders []models.Order
+    err := query.Preload("Items").
+        Order("created_at DESC").
+        Offset((page - 1) * limit).
+        Limit(limit).
+        Find(&orders).Error
+    return orders, total, err
+}
+
+// TransitionOrderStatus moves the order from transition.FromStatus to transition.ToStatus
+// and records the transition in one transaction. The update is guarded on the current
+// status so concurrent transitions cannot both apply. With restock set, the order's
+// items are returned to stock.
+func (r *orderRepository) TransitionOrderStatus(transition *models.OrderStatusTransition, restock bool) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        result := tx.Model(&models.Order{}).
+            Where("id = ? AND status = ?", transition.OrderID, transition.FromStatus).
+            Update("status", transition.ToStatus)
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return ErrOrderStatusChanged
+        }
+        if restock {
+            var items []models.OrderItem
+            if err := tx.Where("order_id = ?", transition.OrderID).Find(&items).Error; err != nil {
+                return err
+            }
+            for _, item := range items {
+                err := tx.Model(&models.Product{}).
+                    Where("id = ?", item.ProductID).
+                    UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error
+                if err != nil {
+                    return err
+                }
+            }
+        }
+        return tx.Create(transition).Error
+    })
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+    "errors"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrPaymentStatusChanged is returned by UpdatePayment when the payment no longer has
+// the status and refunded amount it was read with
+var ErrPaymentStatusChanged = errors.New("payment status changed concurrently")
+
+// ErrOpenPaymentExists is returned by CreatePayment when the order already has a
+// payment that has not failed or been voided
+var ErrOpenPaymentExists = errors.New("order already has an open payment")
+
+// PaymentRepository defines the interface for payment data operations
+type PaymentRepository interface {
+    CreatePayment(payment *models.Payment) error
+    GetPaymentByID(id uint) (*models.Payment, error)
+    GetPaymentByReference(reference string) (*models.Payment, error)
+    GetPaymentsByOrderID(orderID uint) ([]models.Payment, error)
+    GetOrdersAwaitingRelease(limit int) ([]uint, error)
+    UpdatePayment(payment *models.Payment, fromStatus string, fromRefunded float64) error
+    RecordWebhookEvent(event *models.PaymentWebhookEvent) (bool, error)
+    ForgetWebhookEvent(eventID string) error
+}
+
+// paymentRepository implements PaymentRepository
+type paymentRepository struct {
+    db *gorm.DB
+}
+
+// NewPaymentRepository creates a new PaymentRepository
+func NewPaymentRepository(db *gorm.DB) PaymentRepository {
+    return &paymentRepository{db: db}
+}
+
+// CreatePayment stores a new payment; the open payment index on the order makes
+// concurrent attempts to pay the same order fail with ErrOpenPaymentExists
+func (r *paymentRepository) CreatePayment(payment *models.Payment) error {
+    result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(payment)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return ErrOpenPaymentExists
+    }
+    return nil
+}
+
+func (r *paymentRepository) GetPaymentByID(id uint) (*models.Payment, error) {
+    var payment models.Payment
+    if err := r.db.First(&payment, id).Error; err != nil {
+        return nil, err
+    }
+    return &payment, nil
+}
+
+func (r *paymentRepository) GetPaymentByReference(reference string) (*models.Payment, error) {
+    var payment models.Payment
+    if err := r.db.Where("reference = ?", reference).First(&payment).Error; err != nil {
+        return nil, err
+    }
+    return &payment, nil
+}
+
+func (r *paymentRepository) GetPaymentsByOrderID(orderID uint) ([]models.Payment, error) {
+    var payments []models.Payment
+    err := r.db.Where("order_id = ?", orderID).Order("created_at ASC").Find(&payments).Error
+    return payments, err
+}
+
+// GetOrdersAwaitingRelease lists cancelled orders that still hold authorized or
+// captured funds
+func (r *paymentRepository) GetOrdersAwaitingRelease(limit int) ([]uint, error) {
+    var orderIDs []uint
+    err := r.db.Model(&models.Payment{}).
+        Joins("JOIN orders ON orders.id = payments.order_id").
+        Where("orders.status = ? AND payments.status IN ?", models.OrderStatusCancelled, []string{
+            models.PaymentStatusAuthorized, models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded,
+        }).
+        Distinct().
+        Order("payments.order_id").
+        Limit(limit).
+        Pluck("payments.order_id", &orderIDs).Error
+    return orderIDs, err
+}
+
+// UpdatePayment stores the payment's status and amounts only if the stored payment still
+// has fromStatus and fromRefunded, so concurrent requests cannot both move it on
+func (r *paymentRepository) UpdatePayment(payment *models.Payment, fromStatus string, fromRefunded float64) error {
+    result := r.db.Model(&models.Payment{}).
+        Where("id = ? AND status = ? AND refunded_amount = ?", payment.ID, fromStatus, fromRefunded).
+        Updates(map[string]interface{}{
+            "status":          payment.Status,
+            "provider_ref":    payment.ProviderRef,
+            "captured_amount": payment.CapturedAmount,
+            "refunded_amount": payment.RefundedAmount,
+            "failure_reason":  payment.FailureReason,
+        })
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return ErrPaymentStatusChanged
+    }
+    return nil
+}
+
+// RecordWebhookEvent stores a webhook delivery and reports whether it was new; a
+// redelivered event ID returns false
+func (r *paymentRepository) RecordWebhookEvent(event *models.PaymentWebhookEvent) (bool, error) {
+    result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+    if result.Error != nil {
+        return false, result.Error
+    }
+    return result.RowsAffected > 0, nil
+}
+
+// ForgetWebhookEvent removes a recorded delivery whose update could not be applied, so
+// the provider's redelivery is applied instead of ignored
+func (r *paymentRepository) ForgetWebhookEvent(eventID string) error {
+    return r.db.Where("event_id = ?", eventID).Delete(&models.PaymentWebhookEvent{}).Error
+}
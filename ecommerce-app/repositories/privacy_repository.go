@@ -0,0 +1,189 @@
+package repositories
+
+import (
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// PrivacyRepository defines the interface for data export and erasure operations,
+// which read or change a user's rows across every table holding personal data
+type PrivacyRepository interface {
+    CreateDataExport(export *models.DataExport) error
+    GetDataExport(id uint) (*models.DataExport, error)
+    GetDataExportsByUser(userID uint) ([]models.DataExport, error)
+    UpdateDataExport(export *models.DataExport) error
+    ExpireDataExports(before time.Time) ([]models.DataExport, error)
+    CollectUserData(userID uint) (*models.UserDataArchive, error)
+    EraseUser(userID uint, username, email, password string) ([]uint, error)
+}
+
+// privacyRepository implements PrivacyRepository
+type privacyRepository struct {
+    db *gorm.DB
+}
+
+// NewPrivacyRepository creates a new PrivacyRepository
+func NewPrivacyRepository(db *gorm.DB) PrivacyRepository {
+    return &privacyRepository{db: db}
+}
+
+func (r *privacyRepository) CreateDataExport(export *models.DataExport) error {
+    return r.db.Create(export).Error
+}
+
+func (r *privacyRepository) GetDataExport(id uint) (*models.DataExport, error) {
+    var export models.DataExport
+    if err := r.db.First(&export, id).Error; err != nil {
+        return nil, err
+    }
+    return &export, nil
+}
+
+func (r *privacyRepository) GetDataExportsByUser(userID uint) ([]models.DataExport, error) {
+    var exports []models.DataExport
+    err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&exports).Error
+    return exports, err
+}
+
+func (r *privacyRepository) UpdateDataExport(export *models.DataExport) error {
+    return r.db.Save(export).Error
+}
+
+// ExpireDataExports marks ready exports that expired before the given time and
+// returns them so their files can be removed
+func (r *privacyRepository) ExpireDataExports(before time.Time) ([]models.DataExport, error) {
+    var exports []models.DataExport
+    err := r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("status = ? AND expires_at < ?", models.DataExportStatusReady, before).
+            Find(&exports).Error; err != nil {
+            return err
+        }
+        if len(exports) == 0 {
+            return nil
+        }
+        ids := make([]uint, len(exports))
+        for i, export := range exports {
+            ids[i] = export.ID
+        }
+        return tx.Model(&models.DataExport{}).Where("id IN ?", ids).
+            Update("status", models.DataExportStatusExpired).Error
+    })
+    return exports, err
+}
+
+// CollectUserData loads everything stored about a user for an export
+func (r *privacyRepository) CollectUserData(userID uint) (*models.UserDataArchive, error) {
+    var user models.User
+    if err := r.db.First(&user, userID).Error; err != nil {
+        return nil, err
+    }
+    archive := &models.UserDataArchive{
+        Profile: models.UserDataProfile{
+            ID:              user.ID,
+            Username:        user.Username,
+            Email:           user.Email,
+            EmailVerifiedAt: user.EmailVerifiedAt,
+            Role:            user.Role,
+            CreatedAt:       user.CreatedAt,
+        },
+    }
+    if err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&archive.Addresses).Error; err != nil {
+        return nil, err
+    }
+    if err := r.db.Where("user_id = ?", userID).Preload("Product").Order("created_at ASC").Find(&archive.Carts).Error; err != nil {
+        return nil, err
+    }
+    if err := r.db.Where("user_id = ?", userID).Preload("Items").Order("created_at ASC").Find(&archive.Wishlists).Error; err != nil {
+        return nil, err
+    }
+    if err := r.db.Where("user_id = ?", userID).Preload("Items").Preload("TaxLines").Preload("Transitions").
+        Order("created_at ASC").Find(&archive.Orders).Error; err != nil {
+        return nil, err
+    }
+    if err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&archive.Reviews).Error; err != nil {
+        return nil, err
+    }
+    return archive, nil
+}
+
+// EraseUser removes a user's personal data in one transaction. The account row is
+// kept with the given placeholder credentials so orders still reference a user, and
+// the orders keep their totals and tax location but lose the recipient's name, street
+// and phone. It returns the products whose reviews were deleted, whose ratings need
+// recalculating.
+func (r *privacyRepository) EraseUser(userID uint, username, email, password string) ([]uint, error) {
+    var productIDs []uint
+    err := r.db.Transaction(func(tx *gorm.DB) error {
+        now := time.Now()
+        result := tx.Model(&models.User{}).Where("id = ? AND deleted_at IS NULL", userID).Updates(map[string]interface{}{
+            "username":          username,
+            "email":             email,
+            "password":          password,
+            "pending_email":     "",
+            "email_verified_at": nil,
+            "deleted_at":        now,
+            "token_version":     gorm.Expr("token_version + 1"),
+        })
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return gorm.ErrRecordNotFound
+        }
+
+        if err := tx.Model(&models.Review{}).Unscoped().Where("user_id = ?", userID).
+            Distinct().Pluck("product_id", &productIDs).Error; err != nil {
+            return err
+        }
+        var wishlistIDs []uint
+        if err := tx.Model(&models.Wishlist{}).Unscoped().Where("user_id = ?", userID).
+            Pluck("id", &wishlistIDs).Error; err != nil {
+            return err
+        }
+        if len(wishlistIDs) > 0 {
+            if err := tx.Where("wishlist_id IN ?", wishlistIDs).Delete(&models.WishlistItem{}).Error; err != nil {
+                return err
+            }
+        }
+        // Soft-deleted rows still hold the data, so these deletes are permanent
+        for _, model := range []interface{}{
+            &models.Address{},
+            &models.Cart{},
+            &models.Wishlist{},
+            &models.Review{},
+        } {
+            if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+                return err
+            }
+        }
+        for _, model := range []interface{}{
+            &models.UserIdentity{},
+            &models.UserTOTP{},
+            &models.MFARecoveryCode{},
+            &models.UserToken{},
+            &models.DataExport{},
+            &models.AbandonedCart{},
+        } {
+            if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+                return err
+            }
+        }
+        if err := tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+            Update("revoked_at", now).Error; err != nil {
+            return err
+        }
+        if err := tx.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+            Update("revoked_at", now).Error; err != nil {
+            return err
+        }
+        return tx.Model(&models.Order{}).Unscoped().Where("user_id = ?", userID).Updates(map[string]interface{}{
+            "ship_name":  "",
+            "ship_line1": "",
+            "ship_line2": "",
+            "ship_phone": "",
+        }).Error
+    })
+    return productIDs, err
+}
@@ -1,12 +1,16 @@
 package repositories
 
 import (
+    "errors"
     "fmt"
 
     "github.com/inquisitivefrog/ecommerce-app/models"
     "gorm.io/gorm"
 )
 
+// ErrStockWouldGoNegative is returned by AdjustStock when a decrement exceeds the stock on hand
+var ErrStockWouldGoNegative = errors.New("stock adjustment would make stock negative")
+
 // ProductRepository defines the interface for product data operations
 type ProductRepository interface {
     CreateProduct(product *models.Product) error
@@ -15,6 +19,8 @@ type ProductRepository interface {
     SearchProducts(query string, page, limit int) ([]models.Product, error)
     UpdateProduct(product *models.Product) error
     DeleteProduct(id uint) error
+    UpdateRating(id uint, average float64, count int) error
+    AdjustStock(id uint, delta int) error
 }
 
 // productRepository implements ProductRepository
@@ -68,3 +74,29 @@ func (r *productRepository) UpdateProduct(product *models.Product) error {
 func (r *productRepository) DeleteProduct(id uint) error {
     return r.db.Delete(&models.Product{}, id).Error
 }
+
+// UpdateRating stores the aggregated review rating without touching other columns
+func (r *productRepository) UpdateRating(id uint, average float64, count int) error {
+    return r.db.Model(&models.Product{}).Where("id = ?", id).Updates(map[string]interface{}{
+        "average_rating": average,
+        "rating_count":   count,
+    }).Error
+}
+
+// AdjustStock adds delta (which may be negative) to the product's stock in a single
+// guarded update, so concurrent adjustments never drive stock below zero
+func (r *productRepository) AdjustStock(id uint, delta int) error {
+    result := r.db.Model(&models.Product{}).
+        Where("id = ? AND stock + ? >= 0", id, delta).
+        UpdateColumn("stock", gorm.Expr("stock + ?", delta))
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        if _, err := r.GetProductByID(id); err != nil {
+            return err
+        }
+        return ErrStockWouldGoNegative
+    }
+    return nil
+}
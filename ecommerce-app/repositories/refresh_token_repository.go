@@ -0,0 +1,60 @@
+package repositories
+
+import (
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// RefreshTokenRepository defines the interface for refresh token data operations
+type RefreshTokenRepository interface {
+    CreateRefreshToken(token *models.RefreshToken) error
+    GetRefreshTokenByHash(hash string) (*models.RefreshToken, error)
+    MarkRefreshTokenUsed(id uint) (bool, error)
+    RevokeFamily(familyID string) error
+    RevokeAllForUser(userID uint) error
+}
+
+// refreshTokenRepository implements RefreshTokenRepository
+type refreshTokenRepository struct {
+    db *gorm.DB
+}
+
+// NewRefreshTokenRepository creates a new RefreshTokenRepository
+func NewRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
+    return &refreshTokenRepository{db: db}
+}
+
+func (r *refreshTokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+    return r.db.Create(token).Error
+}
+
+func (r *refreshTokenRepository) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+    var token models.RefreshToken
+    if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+        return nil, err
+    }
+    return &token, nil
+}
+
+// MarkRefreshTokenUsed consumes the token, reporting false when it had already been
+// used so two concurrent refreshes cannot both rotate it
+func (r *refreshTokenRepository) MarkRefreshTokenUsed(id uint) (bool, error) {
+    result := r.db.Model(&models.RefreshToken{}).
+        Where("id = ? AND used_at IS NULL", id).
+        Update("used_at", time.Now())
+    return result.RowsAffected > 0, result.Error
+}
+
+func (r *refreshTokenRepository) RevokeFamily(familyID string) error {
+    return r.db.Model(&models.RefreshToken{}).
+        Where("family_id = ? AND revoked_at IS NULL", familyID).
+        Update("revoked_at", time.Now()).Error
+}
+
+func (r *refreshTokenRepository) RevokeAllForUser(userID uint) error {
+    return r.db.Model(&models.RefreshToken{}).
+        Where("user_id = ? AND revoked_at IS NULL", userID).
+        Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,168 @@
+package repositories
+
+import (
+    "errors"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrReturnStatusChanged is returned when a return is no longer in the status an
+// update expected
+var ErrReturnStatusChanged = errors.New("return status changed concurrently")
+
+// ErrReturnQuantityExceeded is returned by CreateReturn when the order's returns would
+// claim more of an item than was ordered
+var ErrReturnQuantityExceeded = errors.New("return quantity exceeds the quantity ordered")
+
+// ReturnRepository defines the interface for return request data operations
+type ReturnRepository interface {
+    CreateReturn(request *models.ReturnRequest) error
+    GetReturnByID(id uint) (*models.ReturnRequest, error)
+    GetReturnsByUserID(userID uint) ([]models.ReturnRequest, error)
+    ListReturns(status string, page, limit int) ([]models.ReturnRequest, int64, error)
+    UpdateReturn(request *models.ReturnRequest, fromStatus string) error
+    ReceiveReturn(request *models.ReturnRequest) error
+}
+
+// returnRepository implements ReturnRepository
+type returnRepository struct {
+    db *gorm.DB
+}
+
+// NewReturnRepository creates a new ReturnRepository
+func NewReturnRepository(db *gorm.DB) ReturnRepository {
+    return &returnRepository{db: db}
+}
+
+// CreateReturn stores a return after checking, with the order row locked, that the
+// order's returns do not claim more of any item than was ordered, so concurrent
+// requests cannot both return the same units
+func (r *returnRepository) CreateReturn(request *models.ReturnRequest) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        var order models.Order
+        err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+            Select("id").
+            First(&order, request.OrderID).Error
+        if err != nil {
+            return err
+        }
+        var items []models.OrderItem
+        if err := tx.Where("order_id = ?", request.OrderID).Find(&items).Error; err != nil {
+            return err
+        }
+        returned, err := returnedQuantities(tx, request.OrderID)
+        if err != nil {
+            return err
+        }
+        for _, item := range request.Items {
+            returned[item.OrderItemID] += item.Quantity
+        }
+        for _, item := range items {
+            if returned[item.ID] > item.Quantity {
+                return ErrReturnQuantityExceeded
+            }
+        }
+        return tx.Create(request).Error
+    })
+}
+
+func (r *returnRepository) GetReturnByID(id uint) (*models.ReturnRequest, error) {
+    var request models.ReturnRequest
+    if err := r.db.Preload("Items").First(&request, id).Error; err != nil {
+        return nil, err
+    }
+    return &request, nil
+}
+
+func (r *returnRepository) GetReturnsByUserID(userID uint) ([]models.ReturnRequest, error) {
+    var requests []models.ReturnRequest
+    err := r.db.Where("user_id = ?", userID).
+        Preload("Items").
+        Order("created_at DESC").
+        Find(&requests).Error
+    return requests, err
+}
+
+func (r *returnRepository) ListReturns(status string, page, limit int) ([]models.ReturnRequest, int64, error) {
+    query := r.db.Model(&models.ReturnRequest{})
+    if status != "" {
+        query = query.Where("status = ?", status)
+    }
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+    var requests []models.ReturnRequest
+    err := query.Preload("Items").
+        Order("created_at ASC").
+        Offset((page - 1) * limit).
+        Limit(limit).
+        Find(&requests).Error
+    return requests, total, err
+}
+
+// UpdateReturn stores the return's status, refund amount and note only if it is still
+// in fromStatus, so concurrent requests cannot both move it on
+func (r *returnRepository) UpdateReturn(request *models.ReturnRequest, fromStatus string) error {
+    return updateReturn(r.db, request, fromStatus)
+}
+
+// ReceiveReturn moves an approved return to received and puts its items back in stock
+// in one transaction, so a return is never restocked twice. A product that no longer
+// exists fails the whole transaction with gorm.ErrRecordNotFound.
+func (r *returnRepository) ReceiveReturn(request *models.ReturnRequest) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := updateReturn(tx, request, models.ReturnStatusApproved); err != nil {
+            return err
+        }
+        products := NewProductRepository(tx)
+        for _, item := range request.Items {
+            if err := products.AdjustStock(item.ProductID, item.Quantity); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+func updateReturn(db *gorm.DB, request *models.ReturnRequest, fromStatus string) error {
+    result := db.Model(&models.ReturnRequest{}).
+        Where("id = ? AND status = ?", request.ID, fromStatus).
+        Updates(map[string]interface{}{
+            "status":        request.Status,
+            "refund_amount": request.RefundAmount,
+            "admin_note":    request.AdminNote,
+        })
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return ErrReturnStatusChanged
+    }
+    return nil
+}
+
+// returnedQuantities sums, per order item, the quantities already claimed by
+// returns of the order that were not rejected
+func returnedQuantities(db *gorm.DB, orderID uint) (map[uint]int, error) {
+    var rows []struct {
+        OrderItemID uint
+        Quantity    int
+    }
+    err := db.Model(&models.ReturnItem{}).
+        Select("return_items.order_item_id, SUM(return_items.quantity) AS quantity").
+        Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id").
+        Where("return_requests.order_id = ? AND return_requests.status <> ?", orderID, models.ReturnStatusRejected).
+        Group("return_items.order_item_id").
+        Scan(&rows).Error
+    if err != nil {
+        return nil, err
+    }
+    quantities := make(map[uint]int, len(rows))
+    for _, row := range rows {
+        quantities[row.OrderItemID] = row.Quantity
+    }
+    return quantities, nil
+}
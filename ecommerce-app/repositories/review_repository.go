@@ -0,0 +1,119 @@
+package repositories
+
+import (
+    "fmt"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// reviewSortOrders maps the supported sort keys to ORDER BY clauses
+var reviewSortOrders = map[string]string{
+    "newest":      "created_at DESC",
+    "oldest":      "created_at ASC",
+    "rating_desc": "rating DESC, created_at DESC",
+    "rating_asc":  "rating ASC, created_at DESC",
+}
+
+// IsValidReviewSort reports whether sort is a supported review sort key
+func IsValidReviewSort(sort string) bool {
+    _, ok := reviewSortOrders[sort]
+    return ok
+}
+
+// ReviewRepository defines the interface for review data operations
+type ReviewRepository interface {
+    CreateReview(review *models.Review) error
+    GetReviewByID(id uint) (*models.Review, error)
+    GetReviewByUserAndProduct(userID, productID uint) (*models.Review, error)
+    ListReviewsByProduct(productID uint, status, sort string, page, limit int) ([]models.Review, int64, error)
+    ListReviewsByStatus(status string, page, limit int) ([]models.Review, int64, error)
+    UpdateReview(review *models.Review) error
+    GetRatingStats(productID uint) (float64, int, error)
+}
+
+// reviewRepository implements ReviewRepository
+type reviewRepository struct {
+    db *gorm.DB
+}
+
+// NewReviewRepository creates a new ReviewRepository
+func NewReviewRepository(db *gorm.DB) ReviewRepository {
+    return &reviewRepository{db: db}
+}
+
+func (r *reviewRepository) CreateReview(review *models.Review) error {
+    return r.db.Create(review).Error
+}
+
+func (r *reviewRepository) GetReviewByID(id uint) (*models.Review, error) {
+    var review models.Review
+    if err := r.db.First(&review, id).Error; err != nil {
+        return nil, err
+    }
+    return &review, nil
+}
+
+func (r *reviewRepository) GetReviewByUserAndProduct(userID, productID uint) (*models.Review, error) {
+    var review models.Review
+    err := r.db.Where("user_id = ? AND product_id = ?", userID, productID).First(&review).Error
+    if err != nil {
+        return nil, err
+    }
+    return &review, nil
+}
+
+func (r *reviewRepository) ListReviewsByProduct(productID uint, status, sort string, page, limit int) ([]models.Review, int64, error) {
+    order, ok := reviewSortOrders[sort]
+    if !ok {
+        order = reviewSortOrders["newest"]
+    }
+    var reviews []models.Review
+    var total int64
+    query := r.db.Model(&models.Review{}).Where("product_id = ? AND status = ?", productID, status)
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count reviews: %w", err)
+    }
+    err := query.Order(order).
+        Offset((page - 1) * limit).
+        Limit(limit).
+        Find(&reviews).Error
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to list reviews: %w", err)
+    }
+    return reviews, total, nil
+}
+
+func (r *reviewRepository) ListReviewsByStatus(status string, page, limit int) ([]models.Review, int64, error) {
+    var reviews []models.Review
+    var total int64
+    query := r.db.Model(&models.Review{}).Where("status = ?", status)
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count reviews: %w", err)
+    }
+    err := query.Order("created_at ASC").
+        Offset((page - 1) * limit).
+        Limit(limit).
+        Find(&reviews).Error
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to list reviews: %w", err)
+    }
+    return reviews, total, nil
+}
+
+func (r *reviewRepository) UpdateReview(review *models.Review) error {
+    return r.db.Save(review).Error
+}
+
+// GetRatingStats returns the average rating and count of approved reviews for a product
+func (r *reviewRepository) GetRatingStats(productID uint) (float64, int, error) {
+    var stats struct {
+        Average float64
+        Count   int
+    }
+    err := r.db.Model(&models.Review{}).
+        Select("COALESCE(AVG(rating), 0) AS average, COUNT(*) AS count").
+        Where("product_id = ? AND status = ?", productID, models.ReviewStatusApproved).
+        Scan(&stats).Error
+    return stats.Average, stats.Count, err
+}
@@ -0,0 +1,58 @@
+package repositories
+
+import (
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// RoleRepository defines the interface for role data operations
+type RoleRepository interface {
+    CreateRole(role *models.Role) error
+    GetRoles() ([]models.Role, error)
+    GetRoleByName(name string) (*models.Role, error)
+    UpdateRole(role *models.Role) error
+    DeleteRole(id uint) error
+    CountUsersWithRole(name string) (int64, error)
+}
+
+// roleRepository implements RoleRepository
+type roleRepository struct {
+    db *gorm.DB
+}
+
+// NewRoleRepository creates a new RoleRepository
+func NewRoleRepository(db *gorm.DB) RoleRepository {
+    return &roleRepository{db: db}
+}
+
+func (r *roleRepository) CreateRole(role *models.Role) error {
+    return r.db.Create(role).Error
+}
+
+func (r *roleRepository) GetRoles() ([]models.Role, error) {
+    var roles []models.Role
+    err := r.db.Order("name ASC").Find(&roles).Error
+    return roles, err
+}
+
+func (r *roleRepository) GetRoleByName(name string) (*models.Role, error) {
+    var role models.Role
+    if err := r.db.Where("name = ?", name).First(&role).Error; err != nil {
+        return nil, err
+    }
+    return &role, nil
+}
+
+func (r *roleRepository) UpdateRole(role *models.Role) error {
+    return r.db.Save(role).Error
+}
+
+func (r *roleRepository) DeleteRole(id uint) error {
+    return r.db.Delete(&models.Role{}, id).Error
+}
+
+func (r *roleRepository) CountUsersWithRole(name string) (int64, error) {
+    var count int64
+    err := r.db.Model(&models.User{}).Where("role = ?", name).Count(&count).Error
+    return count, err
+}
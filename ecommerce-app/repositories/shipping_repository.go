@@ -0,0 +1,88 @@
+package repositories
+
+import (
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// ShippingRepository defines the interface for shipping method data operations
+type ShippingRepository interface {
+    CreateShippingMethod(method *models.ShippingMethod) error
+    GetShippingMethods(activeOnly bool) ([]models.ShippingMethod, error)
+    GetShippingMethodByID(id uint) (*models.ShippingMethod, error)
+    GetShippingMethodByCode(code string) (*models.ShippingMethod, error)
+    UpdateShippingMethod(method *models.ShippingMethod) error
+    DeleteShippingMethod(id uint) error
+}
+
+// shippingRepository implements ShippingRepository
+type shippingRepository struct {
+    db *gorm.DB
+}
+
+// NewShippingRepository creates a new ShippingRepository
+func NewShippingRepository(db *gorm.DB) ShippingRepository {
+    return &shippingRepository{db: db}
+}
+
+func (r *shippingRepository) CreateShippingMethod(method *models.ShippingMethod) error {
+    return r.db.Create(method).Error
+}
+
+func (r *shippingRepository) GetShippingMethods(activeOnly bool) ([]models.ShippingMethod, error) {
+    var methods []models.ShippingMethod
+    query := r.db.Preload("RateTiers", func(db *gorm.DB) *gorm.DB {
+        return db.Order("max_weight_kg ASC")
+    })
+    if activeOnly {
+        query = query.Where("active = ?", true)
+    }
+    err := query.Order("id ASC").Find(&methods).Error
+    return methods, err
+}
+
+func (r *shippingRepository) GetShippingMethodByID(id uint) (*models.ShippingMethod, error) {
+    var method models.ShippingMethod
+    err := r.db.Preload("RateTiers", func(db *gorm.DB) *gorm.DB {
+        return db.Order("max_weight_kg ASC")
+    }).First(&method, id).Error
+    if err != nil {
+        return nil, err
+    }
+    return &method, nil
+}
+
+func (r *shippingRepository) GetShippingMethodByCode(code string) (*models.ShippingMethod, error) {
+    var method models.ShippingMethod
+    err := r.db.Preload("RateTiers", func(db *gorm.DB) *gorm.DB {
+        return db.Order("max_weight_kg ASC")
+    }).Where("code = ?", code).First(&method).Error
+    if err != nil {
+        return nil, err
+    }
+    return &method, nil
+}
+
+// UpdateShippingMethod saves the method and replaces its rate tiers
+func (r *shippingRepository) UpdateShippingMethod(method *models.ShippingMethod) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("shipping_method_id = ?", method.ID).Delete(&models.ShippingRateTier{}).Error; err != nil {
+            return err
+        }
+        for i := range method.RateTiers {
+            method.RateTiers[i].ID = 0
+            method.RateTiers[i].ShippingMethodID = method.ID
+        }
+        if err := tx.Omit("RateTiers").Save(method).Error; err != nil {
+            return err
+        }
+        if len(method.RateTiers) == 0 {
+            return nil
+        }
+        return tx.Create(&method.RateTiers).Error
+    })
+}
+
+func (r *shippingRepository) DeleteShippingMethod(id uint) error {
+    return r.db.Delete(&models.ShippingMethod{}, id).Error
+}
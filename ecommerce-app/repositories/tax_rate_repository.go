@@ -0,0 +1,45 @@
+package repositories
+
+import (
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// TaxRateRepository defines the interface for tax rate data operations
+type TaxRateRepository interface {
+    CreateTaxRate(rate *models.TaxRate) error
+    GetTaxRates() ([]models.TaxRate, error)
+    GetTaxRatesByCountry(country string) ([]models.TaxRate, error)
+    DeleteTaxRate(id uint) (bool, error)
+}
+
+// taxRateRepository implements TaxRateRepository
+type taxRateRepository struct {
+    db *gorm.DB
+}
+
+// NewTaxRateRepository creates a new TaxRateRepository
+func NewTaxRateRepository(db *gorm.DB) TaxRateRepository {
+    return &taxRateRepository{db: db}
+}
+
+func (r *taxRateRepository) CreateTaxRate(rate *models.TaxRate) error {
+    return r.db.Create(rate).Error
+}
+
+func (r *taxRateRepository) GetTaxRates() ([]models.TaxRate, error) {
+    var rates []models.TaxRate
+    err := r.db.Order("country, region, postal_code_prefix, tax_class").Find(&rates).Error
+    return rates, err
+}
+
+func (r *taxRateRepository) GetTaxRatesByCountry(country string) ([]models.TaxRate, error) {
+    var rates []models.TaxRate
+    err := r.db.Where("country = ?", country).Find(&rates).Error
+    return rates, err
+}
+
+func (r *taxRateRepository) DeleteTaxRate(id uint) (bool, error) {
+    result := r.db.Delete(&models.TaxRate{}, id)
+    return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// UserIdentityRepository defines the interface for external login identity data
+// operations
+type UserIdentityRepository interface {
+    CreateIdentity(identity *models.UserIdentity) error
+    GetIdentity(provider, subject string) (*models.UserIdentity, error)
+    GetIdentitiesByUser(userID uint) ([]models.UserIdentity, error)
+    DeleteIdentity(userID uint, provider string) error
+}
+
+// userIdentityRepository implements UserIdentityRepository
+type userIdentityRepository struct {
+    db *gorm.DB
+}
+
+// NewUserIdentityRepository creates a new UserIdentityRepository
+func NewUserIdentityRepository(db *gorm.DB) UserIdentityRepository {
+    return &userIdentityRepository{db: db}
+}
+
+func (r *userIdentityRepository) CreateIdentity(identity *models.UserIdentity) error {
+    return r.db.Create(identity).Error
+}
+
+func (r *userIdentityRepository) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+    var identity models.UserIdentity
+    if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+        return nil, err
+    }
+    return &identity, nil
+}
+
+func (r *userIdentityRepository) GetIdentitiesByUser(userID uint) ([]models.UserIdentity, error) {
+    var identities []models.UserIdentity
+    err := r.db.Where("user_id = ?", userID).Order("provider ASC").Find(&identities).Error
+    return identities, err
+}
+
+func (r *userIdentityRepository) DeleteIdentity(userID uint, provider string) error {
+    result := r.db.Where("user_id = ? AND provider = ?", userID, provider).Delete(&models.UserIdentity{})
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return nil
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+    "strings"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// UserRepository defines the interface for user data operations. Every method that
+// changes a user's password or role also bumps token_version in the same statement,
+// so access tokens issued before the change stop verifying.
+type UserRepository interface {
+    CreateUser(user *models.User) error
+    GetUserByID(id uint) (*models.User, error)
+    GetUserByEmail(email string) (*models.User, error)
+    GetUserByUsername(username string) (*models.User, error)
+    MarkEmailVerified(id uint) error
+    UpdateUsername(id uint, username string) error
+    SetPendingEmail(id uint, email string) error
+    ConfirmEmailChange(id uint, email string) (bool, error)
+    UpdatePassword(id uint, hash string) error
+    ReplacePasswordHash(id uint, oldHash, newHash string) error
+    UpdateUserRole(id uint, role string) error
+    BumpTokenVersion(id uint) error
+    ListUsers(search, role string, page, limit int) ([]models.User, int64, error)
+    SuspendUser(id uint, reason string) error
+    ReactivateUser(id uint) error
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// userRepository implements UserRepository
+type userRepository struct {
+    db *gorm.DB
+}
+
+// NewUserRepository creates a new UserRepository
+func NewUserRepository(db *gorm.DB) UserRepository {
+    return &userRepository{db: db}
+}
+
+func (r *userRepository) CreateUser(user *models.User) error {
+    return r.db.Create(user).Error
+}
+
+func (r *userRepository) GetUserByID(id uint) (*models.User, error) {
+    var user models.User
+    if err := r.db.First(&user, id).Error; err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+func (r *userRepository) GetUserByEmail(email string) (*models.User, error) {
+    var user models.User
+    if err := r.db.Where("LOWER(email) = LOWER(?)", email).First(&user).Error; err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+func (r *userRepository) GetUserByUsername(username string) (*models.User, error) {
+    var user models.User
+    if err := r.db.Where("LOWER(username) = LOWER(?)", username).First(&user).Error; err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+func (r *userRepository) MarkEmailVerified(id uint) error {
+    return r.db.Model(&models.User{}).
+        Where("id = ? AND email_verified_at IS NULL", id).
+        Update("email_verified_at", time.Now()).Error
+}
+
+func (r *userRepository) UpdateUsername(id uint, username string) error {
+    return r.db.Model(&models.User{}).Where("id = ?", id).Update("username", username).Error
+}
+
+func (r *userRepository) SetPendingEmail(id uint, email string) error {
+    return r.db.Model(&models.User{}).Where("id = ?", id).Update("pending_email", email).Error
+}
+
+// ConfirmEmailChange switches the address to email, verified, provided it is still
+// the pending one. It reports false if a later request replaced or cleared it.
+func (r *userRepository) ConfirmEmailChange(id uint, email string) (bool, error) {
+    result := r.db.Model(&models.User{}).
+        Where("id = ? AND pending_email = ? AND pending_email <> ''", id, email).
+        Updates(map[string]interface{}{
+            "email":             email,
+            "pending_email":     "",
+            "email_verified_at": time.Now(),
+        })
+    return result.RowsAffected > 0, result.Error
+}
+
+func (r *userRepository) UpdatePassword(id uint, hash string) error {
+    return r.updateAndBump(id, map[string]interface{}{"password": hash})
+}
+
+// ReplacePasswordHash upgrades the hash of an unchanged password. It leaves the token
+// version alone and does nothing if the password changed since oldHash was read.
+func (r *userRepository) ReplacePasswordHash(id uint, oldHash, newHash string) error {
+    return r.db.Model(&models.User{}).
+        Where("id = ? AND password = ?", id, oldHash).
+        UpdateColumn("password", newHash).Error
+}
+
+func (r *userRepository) UpdateUserRole(id uint, role string) error {
+    return r.updateAndBump(id, map[string]interface{}{"role": role})
+}
+
+// BumpTokenVersion invalidates all of the user's outstanding access tokens
+func (r *userRepository) BumpTokenVersion(id uint) error {
+    return r.updateAndBump(id, map[string]interface{}{})
+}
+
+// ListUsers returns users for the admin view, oldest first. search matches part of the
+// username or email, case-insensitively; role, when set, must match exactly.
+func (r *userRepository) ListUsers(search, role string, page, limit int) ([]models.User, int64, error) {
+    query := r.db.Model(&models.User{})
+    if search != "" {
+        // Wildcards in the search text match literally
+        pattern := "%" + likeEscaper.Replace(search) + "%"
+        query = query.Where("username ILIKE ? OR email ILIKE ?", pattern, pattern)
+    }
+    if role != "" {
+        query = query.Where("role = ?", role)
+    }
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+    var users []models.User
+    err := query.Order("id ASC").
+        Offset((page - 1) * limit).
+        Limit(limit).
+        Find(&users).Error
+    return users, total, err
+}
+
+// SuspendUser blocks the account and retires its tokens
+func (r *userRepository) SuspendUser(id uint, reason string) error {
+    return r.updateAndBump(id, map[string]interface{}{
+        "suspended_at":     time.Now(),
+        "suspended_reason": reason,
+    })
+}
+
+func (r *userRepository) ReactivateUser(id uint) error {
+    return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+        "suspended_at":     nil,
+        "suspended_reason": "",
+    }).Error
+}
+
+// updateAndBump applies a security-relevant change and retires older tokens atomically
+func (r *userRepository) updateAndBump(id uint, columns map[string]interface{}) error {
+    columns["token_version"] = gorm.Expr("token_version + 1")
+    result := r.db.Model(&models.User{}).Where("id = ?", id).Updates(columns)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return nil
+}
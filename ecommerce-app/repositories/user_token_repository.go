@@ -0,0 +1,54 @@
+package repositories
+
+import (
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// UserTokenRepository defines the interface for mailed user token data operations
+type UserTokenRepository interface {
+    CreateUserToken(token *models.UserToken) error
+    GetUserToken(purpose, hash string) (*models.UserToken, error)
+    ConsumeUserToken(id uint) (bool, error)
+    InvalidateUserTokens(userID uint, purpose string) error
+}
+
+// userTokenRepository implements UserTokenRepository
+type userTokenRepository struct {
+    db *gorm.DB
+}
+
+// NewUserTokenRepository creates a new UserTokenRepository
+func NewUserTokenRepository(db *gorm.DB) UserTokenRepository {
+    return &userTokenRepository{db: db}
+}
+
+func (r *userTokenRepository) CreateUserToken(token *models.UserToken) error {
+    return r.db.Create(token).Error
+}
+
+func (r *userTokenRepository) GetUserToken(purpose, hash string) (*models.UserToken, error) {
+    var token models.UserToken
+    if err := r.db.Where("purpose = ? AND token_hash = ?", purpose, hash).First(&token).Error; err != nil {
+        return nil, err
+    }
+    return &token, nil
+}
+
+// ConsumeUserToken marks the token used, reporting false when it already was
+func (r *userTokenRepository) ConsumeUserToken(id uint) (bool, error) {
+    result := r.db.Model(&models.UserToken{}).
+        Where("id = ? AND used_at IS NULL", id).
+        Update("used_at", time.Now())
+    return result.RowsAffected > 0, result.Error
+}
+
+// InvalidateUserTokens retires the user's unused tokens for a purpose so only the
+// most recently mailed one works
+func (r *userTokenRepository) InvalidateUserTokens(userID uint, purpose string) error {
+    return r.db.Model(&models.UserToken{}).
+        Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+        Update("used_at", time.Now()).Error
+}
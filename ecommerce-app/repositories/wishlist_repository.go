@@ -0,0 +1,91 @@
+package repositories
+
+import (
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "gorm.io/gorm"
+)
+
+// WishlistRepository defines the interface for wishlist data operations
+type WishlistRepository interface {
+    CreateWishlist(wishlist *models.Wishlist) error
+    GetWishlistsByUserID(userID uint) ([]models.Wishlist, error)
+    GetWishlistByID(id uint) (*models.Wishlist, error)
+    GetWishlistByShareToken(token string) (*models.Wishlist, error)
+    UpdateWishlist(wishlist *models.Wishlist) error
+    DeleteWishlist(id uint) error
+    AddItem(item *models.WishlistItem) error
+    RemoveItem(wishlistID, productID uint) (bool, error)
+    GetUserIDsWatchingProduct(productID uint) ([]uint, error)
+}
+
+// wishlistRepository implements WishlistRepository
+type wishlistRepository struct {
+    db *gorm.DB
+}
+
+// NewWishlistRepository creates a new WishlistRepository
+func NewWishlistRepository(db *gorm.DB) WishlistRepository {
+    return &wishlistRepository{db: db}
+}
+
+func (r *wishlistRepository) CreateWishlist(wishlist *models.Wishlist) error {
+    return r.db.Create(wishlist).Error
+}
+
+func (r *wishlistRepository) GetWishlistsByUserID(userID uint) ([]models.Wishlist, error) {
+    var wishlists []models.Wishlist
+    err := r.db.Where("user_id = ?", userID).Preload("Items.Product").Order("created_at ASC").Find(&wishlists).Error
+    return wishlists, err
+}
+
+func (r *wishlistRepository) GetWishlistByID(id uint) (*models.Wishlist, error) {
+    var wishlist models.Wishlist
+    if err := r.db.Preload("Items.Product").First(&wishlist, id).Error; err != nil {
+        return nil, err
+    }
+    return &wishlist, nil
+}
+
+func (r *wishlistRepository) GetWishlistByShareToken(token string) (*models.Wishlist, error) {
+    var wishlist models.Wishlist
+    if err := r.db.Where("share_token = ?", token).Preload("Items.Product").First(&wishlist).Error; err != nil {
+        return nil, err
+    }
+    return &wishlist, nil
+}
+
+func (r *wishlistRepository) UpdateWishlist(wishlist *models.Wishlist) error {
+    return r.db.Omit("Items").Save(wishlist).Error
+}
+
+func (r *wishlistRepository) DeleteWishlist(id uint) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("wishlist_id = ?", id).Delete(&models.WishlistItem{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&models.Wishlist{}, id).Error
+    })
+}
+
+// AddItem adds a product to a wishlist, ignoring products that are already on it
+func (r *wishlistRepository) AddItem(item *models.WishlistItem) error {
+    return r.db.Where("wishlist_id = ? AND product_id = ?", item.WishlistID, item.ProductID).
+        FirstOrCreate(item).Error
+}
+
+// RemoveItem removes a product from a wishlist and reports whether it was present
+func (r *wishlistRepository) RemoveItem(wishlistID, productID uint) (bool, error) {
+    result := r.db.Where("wishlist_id = ? AND product_id = ?", wishlistID, productID).Delete(&models.WishlistItem{})
+    return result.RowsAffected > 0, result.Error
+}
+
+// GetUserIDsWatchingProduct returns the distinct owners of wishlists containing the product
+func (r *wishlistRepository) GetUserIDsWatchingProduct(productID uint) ([]uint, error) {
+    var userIDs []uint
+    err := r.db.Model(&models.WishlistItem{}).
+        Joins("JOIN wishlists ON wishlists.id = wishlist_items.wishlist_id").
+        Where("wishlist_items.product_id = ? AND wishlists.deleted_at IS NULL", productID).
+        Distinct().
+        Pluck("wishlists.user_id", &userIDs).Error
+    return userIDs, err
+}
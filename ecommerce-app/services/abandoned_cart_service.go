@@ -0,0 +1,284 @@
+package services
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// Abandoned cart error types
+var (
+    ErrDetectAbandonedCartsFailed = errors.New("failed to detect abandoned carts")
+    ErrFetchAbandonedCartsFailed  = errors.New("failed to fetch abandoned carts")
+)
+
+// AbandonedCartEventsQueue receives an AbandonedCartEvent when a cart is detected as
+// abandoned, when a reminder is sent and when the cart is closed
+const AbandonedCartEventsQueue = "abandoned_cart_events"
+
+// Abandoned cart event types; closing events use the record's new status
+const (
+    AbandonedCartEventDetected = "detected"
+    AbandonedCartEventReminded = "reminded"
+)
+
+// AbandonedCartEvent is published to AbandonedCartEventsQueue
+type AbandonedCartEvent struct {
+    AbandonedCartID uint      `json:"abandoned_cart_id"`
+    UserID          uint      `json:"user_id"`
+    Type            string    `json:"type"`
+    ItemCount       int       `json:"item_count"`
+    Subtotal        float64   `json:"subtotal"`
+    RemindersSent   int       `json:"reminders_sent"`
+    OrderID         uint      `json:"order_id,omitempty"`
+    OrderTotal      float64   `json:"order_total,omitempty"`
+    OccurredAt      time.Time `json:"occurred_at"`
+}
+
+// AbandonedCartPolicy controls when carts count as abandoned and how often their
+// owners are reminded
+type AbandonedCartPolicy struct {
+    After            time.Duration // how long a cart must sit untouched
+    ReminderInterval time.Duration // wait between reminders, and after the last one before giving up
+    MaxReminders     int
+    BatchSize        int // carts detected, and open carts followed up, per run
+}
+
+// AbandonedCartService finds carts left untouched, reminds their owners by email and
+// tracks whether they come back to check out
+type AbandonedCartService struct {
+    Repo     repositories.AbandonedCartRepository
+    CartRepo repositories.CartRepository
+    UserRepo repositories.UserRepository
+    Mailer   Mailer
+    RabbitMQ *amqp091.Channel
+    BaseURL  string
+    Policy   AbandonedCartPolicy
+    Logger   *logrus.Logger
+}
+
+// NewAbandonedCartService creates a new AbandonedCartService. baseURL is the storefront
+// address reminder links point at.
+func NewAbandonedCartService(repo repositories.AbandonedCartRepository, cartRepo repositories.CartRepository, userRepo repositories.UserRepository, mailer Mailer, rabbitMQ *amqp091.Channel, baseURL string, policy AbandonedCartPolicy, logger *logrus.Logger) *AbandonedCartService {
+    return &AbandonedCartService{
+        Repo:     repo,
+        CartRepo: cartRepo,
+        UserRepo: userRepo,
+        Mailer:   mailer,
+        RabbitMQ: rabbitMQ,
+        BaseURL:  baseURL,
+        Policy:   policy,
+        Logger:   logger,
+    }
+}
+
+// ProcessAbandonedCarts is the scheduled job: it records newly abandoned carts, then
+// follows up every open one. Carts whose owner has checked out are marked recovered,
+// carts changed or emptied since detection are closed, and the rest get a reminder
+// when one is due. Once every reminder has gone unanswered the cart expires.
+func (s *AbandonedCartService) ProcessAbandonedCarts() error {
+    now := time.Now()
+    candidates, err := s.Repo.FindAbandonedCarts(now.Add(-s.Policy.After), s.Policy.BatchSize)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "DETECT_ABANDONED_CARTS_FAILED",
+        }).Error("Failed to detect abandoned carts")
+        return errors.Wrap(ErrDetectAbandonedCartsFailed, err.Error())
+    }
+    for i := range candidates {
+        record := &candidates[i]
+        record.Status = models.AbandonedCartStatusOpen
+        if err := s.Repo.CreateAbandonedCart(record); err != nil {
+            if err == repositories.ErrAbandonedCartOpen {
+                continue // another run recorded it first
+            }
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    record.UserID,
+                "error":      err,
+                "error_code": "CREATE_ABANDONED_CART_FAILED",
+            }).Error("Failed to record abandoned cart")
+            continue
+        }
+        s.publish(record, AbandonedCartEventDetected, now)
+    }
+
+    records, err := s.Repo.GetOpenAbandonedCarts(s.Policy.BatchSize)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "FETCH_ABANDONED_CARTS_FAILED",
+        }).Error("Failed to fetch open abandoned carts")
+        return errors.Wrap(ErrFetchAbandonedCartsFailed, err.Error())
+    }
+    outcomes := make(map[string]int)
+    for i := range records {
+        var outcome string
+        err := s.Repo.UpdateOpenAbandonedCart(records[i].ID, func(record *models.AbandonedCart) (bool, error) {
+            var err error
+            outcome, err = s.followUp(record, now)
+            records[i] = *record
+            return outcome != "", err
+        })
+        if err == repositories.ErrAbandonedCartUnavailable {
+            continue // closed or being followed up by another run
+        }
+        if err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "abandoned_cart_id": records[i].ID,
+                "user_id":           records[i].UserID,
+                "error":             err,
+                "error_code":        "FOLLOW_UP_ABANDONED_CART_FAILED",
+            }).Error("Failed to follow up abandoned cart")
+            continue
+        }
+        if outcome != "" {
+            outcomes[outcome]++
+            s.publish(&records[i], outcome, now)
+        }
+    }
+
+    if len(candidates) > 0 || len(outcomes) > 0 {
+        s.Logger.WithFields(logrus.Fields{
+            "detected":  len(candidates),
+            "reminded":  outcomes[AbandonedCartEventReminded],
+            "recovered": outcomes[models.AbandonedCartStatusRecovered],
+            "resumed":   outcomes[models.AbandonedCartStatusResumed],
+            "emptied":   outcomes[models.AbandonedCartStatusEmptied],
+            "expired":   outcomes[models.AbandonedCartStatusExpired],
+        }).Info("Processed abandoned carts")
+    }
+    return nil
+}
+
+// GetStats reports how abandoned carts detected since the given time turned out
+func (s *AbandonedCartService) GetStats(since time.Time) (*models.AbandonedCartStats, error) {
+    stats, err := s.Repo.GetAbandonedCartStats(since)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "FETCH_ABANDONED_CART_STATS_FAILED",
+        }).Error("Failed to fetch abandoned cart stats")
+        return nil, errors.Wrap(ErrFetchAbandonedCartsFailed, err.Error())
+    }
+    if stats.Detected > 0 {
+        stats.RecoveryRate = float64(stats.Recovered) / float64(stats.Detected)
+    }
+    if stats.Reminded > 0 {
+        stats.ReminderConversionRate = float64(stats.RecoveredAfterReminder) / float64(stats.Reminded)
+    }
+    return stats, nil
+}
+
+// followUp moves one locked open record on and returns what happened to it: a closing
+// status, AbandonedCartEventReminded, or "" when nothing is due yet. The caller saves
+// the record and publishes the outcome.
+func (s *AbandonedCartService) followUp(record *models.AbandonedCart, now time.Time) (string, error) {
+    // Checking out clears the cart, so orders are looked for before anything else
+    order, err := s.Repo.GetFirstOrderSince(record.UserID, record.CreatedAt)
+    if err == nil {
+        record.RecoveredOrderID = &order.ID
+        record.RecoveredTotal = order.Total
+        return closeAbandonedCart(record, models.AbandonedCartStatusRecovered, now), nil
+    }
+    if err != gorm.ErrRecordNotFound {
+        return "", err
+    }
+
+    cartItems, err := s.CartRepo.GetCartByUserID(record.UserID)
+    if err != nil {
+        return "", err
+    }
+    if len(cartItems) == 0 {
+        return closeAbandonedCart(record, models.AbandonedCartStatusEmptied, now), nil
+    }
+    itemCount := 0
+    for _, item := range cartItems {
+        if item.UpdatedAt.After(record.CartUpdatedAt) {
+            return closeAbandonedCart(record, models.AbandonedCartStatusResumed, now), nil
+        }
+        if item.Product.ID != 0 {
+            itemCount += item.Quantity
+        }
+    }
+    // Removing a line leaves no newer timestamp behind, so the count detected is
+    // compared too. Subtotals are not, since they move with product prices.
+    if itemCount != record.ItemCount {
+        return closeAbandonedCart(record, models.AbandonedCartStatusResumed, now), nil
+    }
+
+    if record.LastReminderAt != nil && now.Sub(*record.LastReminderAt) < s.Policy.ReminderInterval {
+        return "", nil
+    }
+    if record.RemindersSent >= s.Policy.MaxReminders {
+        return closeAbandonedCart(record, models.AbandonedCartStatusExpired, now), nil
+    }
+    user, err := s.UserRepo.GetUserByID(record.UserID)
+    if err == gorm.ErrRecordNotFound || (err == nil && (user.DeletedAt != nil || user.SuspendedAt != nil)) {
+        return closeAbandonedCart(record, models.AbandonedCartStatusExpired, now), nil
+    }
+    if err != nil {
+        return "", err
+    }
+
+    if err := s.Mailer.Send(s.reminderEmail(user, record, cartItems)); err != nil {
+        return "", err
+    }
+    record.RemindersSent++
+    record.LastReminderAt = &now
+    return AbandonedCartEventReminded, nil
+}
+
+func closeAbandonedCart(record *models.AbandonedCart, status string, now time.Time) string {
+    record.Status = status
+    record.ClosedAt = &now
+    return status
+}
+
+func (s *AbandonedCartService) reminderEmail(user *models.User, record *models.AbandonedCart, cartItems []models.Cart) Email {
+    var lines strings.Builder
+    subtotal := 0.0
+    for _, item := range cartItems {
+        fmt.Fprintf(&lines, "  %d x %s\n", item.Quantity, item.Product.Name)
+        subtotal += float64(item.Quantity) * item.Product.Price
+    }
+    return Email{
+        To:      user.Email,
+        Subject: "You left something in your cart",
+        Body: fmt.Sprintf("Hi %s,\n\nYour cart is still waiting for you:\n\n%s\nSubtotal: %.2f\n\nPick up where you left off here:\n\n%s\n",
+            user.Username, lines.String(), subtotal, fmt.Sprintf("%s/cart?recover=%d", s.BaseURL, record.ID)),
+    }
+}
+
+// publish announces a change to an abandoned cart; the change is already stored, so a
+// failed publish is logged rather than undone
+func (s *AbandonedCartService) publish(record *models.AbandonedCart, eventType string, now time.Time) {
+    event := AbandonedCartEvent{
+        AbandonedCartID: record.ID,
+        UserID:          record.UserID,
+        Type:            eventType,
+        ItemCount:       record.ItemCount,
+        Subtotal:        record.Subtotal,
+        RemindersSent:   record.RemindersSent,
+        OrderTotal:      record.RecoveredTotal,
+        OccurredAt:      now,
+    }
+    if record.RecoveredOrderID != nil {
+        event.OrderID = *record.RecoveredOrderID
+    }
+    if err := publishJSON(s.RabbitMQ, AbandonedCartEventsQueue, event); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "abandoned_cart_id": record.ID,
+            "type":              eventType,
+            "error":             err,
+            "error_code":        "PUBLISH_FAILED",
+        }).Warn("Failed to publish abandoned cart event")
+    }
+}
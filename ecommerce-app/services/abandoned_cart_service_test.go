@@ -0,0 +1,315 @@
+package services_test
+
+import (
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubAbandonedCartRepository keeps abandoned cart records in memory. Candidates stand
+// in for the carts the detection query would find.
+type stubAbandonedCartRepository struct {
+    candidates []models.AbandonedCart
+    records    []models.AbandonedCart
+    orders     []models.Order
+    stats      models.AbandonedCartStats
+    locked     map[uint]bool // records another run is following up
+}
+
+func (r *stubAbandonedCartRepository) FindAbandonedCarts(cutoff time.Time, limit int) ([]models.AbandonedCart, error) {
+    var found []models.AbandonedCart
+    for _, candidate := range r.candidates {
+        if !candidate.CartUpdatedAt.Before(cutoff) {
+            continue
+        }
+        recorded := false
+        for _, record := range r.records {
+            if record.UserID == candidate.UserID && (record.Status == models.AbandonedCartStatusOpen || !record.CartUpdatedAt.Before(candidate.CartUpdatedAt)) {
+                recorded = true
+            }
+        }
+        if !recorded && len(found) < limit {
+            found = append(found, candidate)
+        }
+    }
+    return found, nil
+}
+
+func (r *stubAbandonedCartRepository) CreateAbandonedCart(abandoned *models.AbandonedCart) error {
+    for _, record := range r.records {
+        if record.UserID == abandoned.UserID && record.Status == models.AbandonedCartStatusOpen {
+            return repositories.ErrAbandonedCartOpen
+        }
+    }
+    abandoned.ID = uint(len(r.records) + 1)
+    abandoned.CreatedAt = time.Now()
+    r.records = append(r.records, *abandoned)
+    return nil
+}
+
+func (r *stubAbandonedCartRepository) GetOpenAbandonedCarts(limit int) ([]models.AbandonedCart, error) {
+    var open []models.AbandonedCart
+    for _, record := range r.records {
+        if record.Status == models.AbandonedCartStatusOpen && len(open) < limit {
+            open = append(open, record)
+        }
+    }
+    return open, nil
+}
+
+func (r *stubAbandonedCartRepository) UpdateOpenAbandonedCart(id uint, update func(abandoned *models.AbandonedCart) (bool, error)) error {
+    for i := range r.records {
+        if r.records[i].ID != id || r.records[i].Status != models.AbandonedCartStatusOpen || r.locked[id] {
+            continue
+        }
+        abandoned := r.records[i]
+        changed, err := update(&abandoned)
+        if err != nil || !changed {
+            return err
+        }
+        r.records[i] = abandoned
+        return nil
+    }
+    return repositories.ErrAbandonedCartUnavailable
+}
+
+func (r *stubAbandonedCartRepository) GetFirstOrderSince(userID uint, since time.Time) (*models.Order, error) {
+    for _, order := range r.orders {
+        if order.UserID == userID && !order.CreatedAt.Before(since) {
+            return &order, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubAbandonedCartRepository) GetAbandonedCartStats(since time.Time) (*models.AbandonedCartStats, error) {
+    stats := r.stats
+    stats.Since = since
+    return &stats, nil
+}
+
+func TestAbandonedCartService_Reminders(t *testing.T) {
+    cartUpdatedAt := time.Now().Add(-25 * time.Hour)
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    repo := &stubAbandonedCartRepository{candidates: []models.AbandonedCart{
+        {UserID: 1, CartUpdatedAt: cartUpdatedAt, ItemCount: 2, Subtotal: 40},
+    }}
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, Product: shirt, UpdatedAt: cartUpdatedAt},
+    }}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    service := services.NewAbandonedCartService(repo, cartRepo, users, mailer, nil, "https://shop.example.com", services.AbandonedCartPolicy{
+        After:            24 * time.Hour,
+        ReminderInterval: 48 * time.Hour,
+        MaxReminders:     2,
+        BatchSize:        10,
+    }, newTestLogger())
+
+    // Test a cart untouched past the period is recorded and reminded at once
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    if assert.Len(t, repo.records, 1) && assert.Len(t, mailer.sent, 1) {
+        assert.Equal(t, models.AbandonedCartStatusOpen, repo.records[0].Status)
+        assert.Equal(t, 1, repo.records[0].RemindersSent)
+        assert.Equal(t, "ann@example.com", mailer.sent[0].To)
+        assert.Contains(t, mailer.sent[0].Body, "2 x Shirt")
+        assert.Contains(t, mailer.sent[0].Body, "https://shop.example.com/cart?recover=1")
+    }
+
+    // Test the cart is not recorded twice and reminders wait for the interval
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Len(t, repo.records, 1)
+    assert.Len(t, mailer.sent, 1)
+
+    earlier := time.Now().Add(-49 * time.Hour)
+    repo.records[0].LastReminderAt = &earlier
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Len(t, mailer.sent, 2)
+    assert.Equal(t, 2, repo.records[0].RemindersSent)
+
+    // Test the cart expires once the last reminder goes unanswered
+    repo.records[0].LastReminderAt = &earlier
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Len(t, mailer.sent, 2)
+    assert.Equal(t, models.AbandonedCartStatusExpired, repo.records[0].Status)
+    assert.NotNil(t, repo.records[0].ClosedAt)
+}
+
+func TestAbandonedCartService_RecentCartIsNotAbandoned(t *testing.T) {
+    cartUpdatedAt := time.Now().Add(-time.Hour)
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    repo := &stubAbandonedCartRepository{candidates: []models.AbandonedCart{
+        {UserID: 1, CartUpdatedAt: cartUpdatedAt, ItemCount: 2, Subtotal: 40},
+    }}
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, Product: shirt, UpdatedAt: cartUpdatedAt},
+    }}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    service := services.NewAbandonedCartService(repo, cartRepo, users, mailer, nil, "https://shop.example.com", services.AbandonedCartPolicy{
+        After:            24 * time.Hour,
+        ReminderInterval: 48 * time.Hour,
+        MaxReminders:     2,
+        BatchSize:        10,
+    }, newTestLogger())
+
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Empty(t, repo.records)
+    assert.Empty(t, mailer.sent)
+}
+
+func TestAbandonedCartService_StopsAfterCheckout(t *testing.T) {
+    cartUpdatedAt := time.Now().Add(-25 * time.Hour)
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    repo := &stubAbandonedCartRepository{candidates: []models.AbandonedCart{
+        {UserID: 1, CartUpdatedAt: cartUpdatedAt, ItemCount: 2, Subtotal: 40},
+    }}
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, Product: shirt, UpdatedAt: cartUpdatedAt},
+    }}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    service := services.NewAbandonedCartService(repo, cartRepo, users, mailer, nil, "https://shop.example.com", services.AbandonedCartPolicy{
+        After:            24 * time.Hour,
+        ReminderInterval: 48 * time.Hour,
+        MaxReminders:     2,
+        BatchSize:        10,
+    }, newTestLogger())
+    assert.NoError(t, service.ProcessAbandonedCarts())
+
+    // Test an order placed after detection recovers the cart without another reminder
+    earlier := time.Now().Add(-49 * time.Hour)
+    repo.records[0].LastReminderAt = &earlier
+    repo.orders = []models.Order{{ID: 7, UserID: 1, Total: 43.5, CreatedAt: time.Now()}}
+    cartRepo.cartItems = nil
+    assert.NoError(t, service.ProcessAbandonedCarts())
+
+    assert.Len(t, mailer.sent, 1)
+    assert.Equal(t, models.AbandonedCartStatusRecovered, repo.records[0].Status)
+    if assert.NotNil(t, repo.records[0].RecoveredOrderID) {
+        assert.Equal(t, uint(7), *repo.records[0].RecoveredOrderID)
+    }
+    assert.Equal(t, 43.5, repo.records[0].RecoveredTotal)
+}
+
+func TestAbandonedCartService_ClosesChangedCarts(t *testing.T) {
+    cartUpdatedAt := time.Now().Add(-25 * time.Hour)
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    repo := &stubAbandonedCartRepository{candidates: []models.AbandonedCart{
+        {UserID: 1, CartUpdatedAt: cartUpdatedAt, ItemCount: 2, Subtotal: 40},
+    }}
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, Product: shirt, UpdatedAt: cartUpdatedAt},
+    }}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    service := services.NewAbandonedCartService(repo, cartRepo, users, mailer, nil, "https://shop.example.com", services.AbandonedCartPolicy{
+        After:            24 * time.Hour,
+        ReminderInterval: 48 * time.Hour,
+        MaxReminders:     2,
+        BatchSize:        10,
+    }, newTestLogger())
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    earlier := time.Now().Add(-49 * time.Hour)
+    repo.records[0].LastReminderAt = &earlier
+
+    // Test a cart changed since detection is closed as resumed
+    cartRepo.cartItems[0].UpdatedAt = time.Now()
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Equal(t, models.AbandonedCartStatusResumed, repo.records[0].Status)
+
+    // Test a cart with a line removed since detection is closed as resumed
+    repo.records[0].Status = models.AbandonedCartStatusOpen
+    repo.records[0].ItemCount = 3
+    cartRepo.cartItems[0].UpdatedAt = cartUpdatedAt
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Equal(t, models.AbandonedCartStatusResumed, repo.records[0].Status)
+
+    // Test a cart emptied without an order is closed as emptied
+    repo.records[0].Status = models.AbandonedCartStatusOpen
+    cartRepo.cartItems = nil
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Equal(t, models.AbandonedCartStatusEmptied, repo.records[0].Status)
+    assert.Len(t, mailer.sent, 1)
+}
+
+func TestAbandonedCartService_SkipsLockedCarts(t *testing.T) {
+    cartUpdatedAt := time.Now().Add(-25 * time.Hour)
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    repo := &stubAbandonedCartRepository{
+        records: []models.AbandonedCart{
+            {ID: 1, UserID: 1, Status: models.AbandonedCartStatusOpen, CartUpdatedAt: cartUpdatedAt, ItemCount: 2, Subtotal: 40, CreatedAt: cartUpdatedAt},
+        },
+        locked: map[uint]bool{1: true},
+    }
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, Product: shirt, UpdatedAt: cartUpdatedAt},
+    }}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    service := services.NewAbandonedCartService(repo, cartRepo, users, mailer, nil, "https://shop.example.com", services.AbandonedCartPolicy{
+        After:            24 * time.Hour,
+        ReminderInterval: 48 * time.Hour,
+        MaxReminders:     2,
+        BatchSize:        10,
+    }, newTestLogger())
+
+    // Test a record another run is following up is left to that run
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Empty(t, mailer.sent)
+    assert.Equal(t, 0, repo.records[0].RemindersSent)
+
+    delete(repo.locked, 1)
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Len(t, mailer.sent, 1)
+    assert.Equal(t, 1, repo.records[0].RemindersSent)
+}
+
+func TestAbandonedCartService_SkipsSuspendedUsers(t *testing.T) {
+    cartUpdatedAt := time.Now().Add(-25 * time.Hour)
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    repo := &stubAbandonedCartRepository{candidates: []models.AbandonedCart{
+        {UserID: 1, CartUpdatedAt: cartUpdatedAt, ItemCount: 2, Subtotal: 40},
+    }}
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, Product: shirt, UpdatedAt: cartUpdatedAt},
+    }}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    service := services.NewAbandonedCartService(repo, cartRepo, users, mailer, nil, "https://shop.example.com", services.AbandonedCartPolicy{
+        After:            24 * time.Hour,
+        ReminderInterval: 48 * time.Hour,
+        MaxReminders:     2,
+        BatchSize:        10,
+    }, newTestLogger())
+    suspendedAt := time.Now()
+    users.users[0].SuspendedAt = &suspendedAt
+
+    assert.NoError(t, service.ProcessAbandonedCarts())
+    assert.Empty(t, mailer.sent)
+    if assert.Len(t, repo.records, 1) {
+        assert.Equal(t, models.AbandonedCartStatusExpired, repo.records[0].Status)
+    }
+}
+
+func TestAbandonedCartService_GetStats(t *testing.T) {
+    repo := &stubAbandonedCartRepository{}
+    service := services.NewAbandonedCartService(repo, &stubCartRepository{}, &stubUserRepository{}, &stubMailer{}, nil, "https://shop.example.com", services.AbandonedCartPolicy{After: 24 * time.Hour}, newTestLogger())
+    repo.stats = models.AbandonedCartStats{Detected: 10, Reminded: 8, Recovered: 4, RecoveredAfterReminder: 2, RecoveredRevenue: 120}
+
+    stats, err := service.GetStats(time.Now().AddDate(0, 0, -30))
+    assert.NoError(t, err)
+    assert.Equal(t, 0.4, stats.RecoveryRate)
+    assert.Equal(t, 0.25, stats.ReminderConversionRate)
+
+    // Test rates stay zero when nothing was detected
+    repo.stats = models.AbandonedCartStats{}
+    stats, _ = service.GetStats(time.Now())
+    assert.Zero(t, stats.RecoveryRate)
+    assert.Zero(t, stats.ReminderConversionRate)
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+    "fmt"
+    "net/mail"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// Account error types
+var (
+    ErrInvalidUserToken     = errors.New("invalid or expired token")
+    ErrEmailAlreadyVerified = errors.New("email already verified")
+    ErrEmailNotVerified     = errors.New("email address not verified")
+    ErrSendEmailFailed      = errors.New("failed to send email")
+    ErrInvalidEmail         = errors.New("invalid email address")
+    ErrEmailUnchanged       = errors.New("new email address matches the current one")
+    ErrEmailInUse           = errors.New("email address is already in use")
+)
+
+// AccountUnlocker lifts a login lockout. LoginGuard implements it.
+type AccountUnlocker interface {
+    Unlock(username string) error
+}
+
+// AccountService runs the mailed-token flows: email verification, email change,
+// password reset and account unlock
+type AccountService struct {
+    UserRepo        repositories.UserRepository
+    UserTokenRepo   repositories.UserTokenRepository
+    Passwords       *PasswordService
+    Mailer          Mailer
+    AuthCache       AuthCache       // optional
+    Unlocker        AccountUnlocker // optional
+    BaseURL         string
+    VerificationTTL time.Duration
+    ResetTTL        time.Duration
+    Logger          *logrus.Logger
+}
+
+// NewAccountService creates a new AccountService. baseURL is the storefront address
+// mailed links point at.
+func NewAccountService(userRepo repositories.UserRepository, userTokenRepo repositories.UserTokenRepository, passwords *PasswordService, mailer Mailer, baseURL string, verificationTTL, resetTTL time.Duration, logger *logrus.Logger) *AccountService {
+    return &AccountService{
+        UserRepo:        userRepo,
+        UserTokenRepo:   userTokenRepo,
+        Passwords:       passwords,
+        Mailer:          mailer,
+        BaseURL:         strings.TrimRight(baseURL, "/"),
+        VerificationTTL: verificationTTL,
+        ResetTTL:        resetTTL,
+        Logger:          logger,
+    }
+}
+
+// SendVerificationEmail mails the user a fresh verification link, retiring older ones
+func (s *AccountService) SendVerificationEmail(userID uint) error {
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    if user.EmailVerifiedAt != nil {
+        return ErrEmailAlreadyVerified
+    }
+    token, err := s.issueToken(user.ID, models.UserTokenEmailVerification, s.VerificationTTL)
+    if err != nil {
+        return err
+    }
+    return s.send(user, Email{
+        To:      user.Email,
+        Subject: "Verify your email address",
+        Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n",
+            user.Username, s.link("/verify-email", token), s.VerificationTTL),
+    })
+}
+
+// ResendVerificationEmail sends a new link to an unverified address. It reports
+// success for unknown or verified addresses so it cannot be used to probe accounts.
+func (s *AccountService) ResendVerificationEmail(email string) error {
+    user, err := s.UserRepo.GetUserByEmail(strings.TrimSpace(email))
+    if err != nil || user.EmailVerifiedAt != nil {
+        return nil
+    }
+    return s.SendVerificationEmail(user.ID)
+}
+
+// VerifyEmail consumes a verification token and marks the address verified
+func (s *AccountService) VerifyEmail(token string) error {
+    record, err := s.consumeToken(models.UserTokenEmailVerification, token)
+    if err != nil {
+        return err
+    }
+    if err := s.UserRepo.MarkEmailVerified(record.UserID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    record.UserID,
+            "error":      err,
+            "error_code": "VERIFY_EMAIL_FAILED",
+        }).Error("Failed to mark email verified")
+        return err
+    }
+    invalidateCachedUser(s.AuthCache, s.Logger, record.UserID)
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": record.UserID,
+    }).Info("Email verified")
+    return nil
+}
+
+// RequestPasswordReset mails a reset link. Unknown addresses are ignored silently.
+func (s *AccountService) RequestPasswordReset(email string) error {
+    user, err := s.UserRepo.GetUserByEmail(strings.TrimSpace(email))
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error_code": "RESET_UNKNOWN_EMAIL",
+        }).Info("Password reset requested for unknown email")
+        return nil
+    }
+    token, err := s.issueToken(user.ID, models.UserTokenPasswordReset, s.ResetTTL)
+    if err != nil {
+        return err
+    }
+    return s.send(user, Email{
+        To:      user.Email,
+        Subject: "Reset your password",
+        Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. If it was you, open this link:\n\n%s\n\nThe link expires in %s. If you did not ask for a reset you can ignore this email.\n",
+            user.Username, s.link("/reset-password", token), s.ResetTTL),
+    })
+}
+
+// ResetPassword consumes a reset token, sets the new password and signs the user out
+// everywhere. Following the mailed link also proves the address, so it is verified.
+// A password rejected by the policy leaves the token usable for another attempt.
+func (s *AccountService) ResetPassword(token, newPassword string) error {
+    record, err := s.validToken(models.UserTokenPasswordReset, token)
+    if err != nil {
+        return err
+    }
+    user, err := s.UserRepo.GetUserByID(record.UserID)
+    if err != nil {
+        return ErrInvalidUserToken
+    }
+    hash, err := s.Passwords.PreparePassword(newPassword, user.Username, user.Email)
+    if err != nil {
+        return err
+    }
+    if err := s.consume(record); err != nil {
+        return err
+    }
+    if err := s.Passwords.SetPassword(record.UserID, hash); err != nil {
+        return err
+    }
+    if err := s.UserRepo.MarkEmailVerified(record.UserID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    record.UserID,
+            "error":      err,
+            "error_code": "VERIFY_EMAIL_FAILED",
+        }).Warn("Failed to mark email verified after reset")
+    }
+    invalidateCachedUser(s.AuthCache, s.Logger, record.UserID)
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": record.UserID,
+    }).Info("Password reset")
+    return nil
+}
+
+// RequestEmailChange records newEmail as the user's pending address and mails a
+// confirmation link to it. The current address stays in use until the link is followed.
+func (s *AccountService) RequestEmailChange(userID uint, newEmail string) error {
+    newEmail = strings.TrimSpace(newEmail)
+    if parsed, err := mail.ParseAddress(newEmail); err != nil || parsed.Address != newEmail {
+        return ErrInvalidEmail
+    }
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    if strings.EqualFold(user.Email, newEmail) {
+        return ErrEmailUnchanged
+    }
+    if _, err := s.UserRepo.GetUserByEmail(newEmail); err == nil {
+        return ErrEmailInUse
+    }
+    if err := s.UserRepo.SetPendingEmail(user.ID, newEmail); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "error":      err,
+            "error_code": "SET_PENDING_EMAIL_FAILED",
+        }).Error("Failed to store pending email")
+        return err
+    }
+    token, err := s.issueToken(user.ID, models.UserTokenEmailChange, s.VerificationTTL)
+    if err != nil {
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": user.ID,
+    }).Info("Email change requested")
+    return s.send(user, Email{
+        To:      newEmail,
+        Subject: "Confirm your new email address",
+        Body: fmt.Sprintf("Hi %s,\n\nConfirm that you want to use this address for your account by opening this link:\n\n%s\n\nThe link expires in %s. Until then your account keeps using its current address.\n",
+            user.Username, s.link("/confirm-email-change", token), s.VerificationTTL),
+    })
+}
+
+// ConfirmEmailChange consumes an email change token and switches the account to the
+// pending address, which the link proved. The previous address is told about it.
+func (s *AccountService) ConfirmEmailChange(token string) error {
+    record, err := s.consumeToken(models.UserTokenEmailChange, token)
+    if err != nil {
+        return err
+    }
+    user, err := s.UserRepo.GetUserByID(record.UserID)
+    if err != nil || user.PendingEmail == "" {
+        return ErrInvalidUserToken
+    }
+    if existing, err := s.UserRepo.GetUserByEmail(user.PendingEmail); err == nil && existing.ID != user.ID {
+        return ErrEmailInUse
+    }
+    changed, err := s.UserRepo.ConfirmEmailChange(user.ID, user.PendingEmail)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "error":      err,
+            "error_code": "CONFIRM_EMAIL_CHANGE_FAILED",
+        }).Error("Failed to change email")
+        return err
+    }
+    if !changed {
+        return ErrInvalidUserToken
+    }
+    invalidateCachedUser(s.AuthCache, s.Logger, user.ID)
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": user.ID,
+    }).Info("Email changed")
+
+    // The change already happened, so a failed notice is only logged
+    _ = s.send(user, Email{
+        To:      user.Email,
+        Subject: "Your email address was changed",
+        Body: fmt.Sprintf("Hi %s,\n\nThe email address on your account was changed to %s. If you did not make this change, contact support right away.\n",
+            user.Username, user.PendingEmail),
+    })
+    return nil
+}
+
+// NotifyLockout mails the owner of a locked account a link that unlocks it early.
+// Usernames without an account are ignored.
+func (s *AccountService) NotifyLockout(username string) error {
+    user, err := s.UserRepo.GetUserByUsername(strings.TrimSpace(username))
+    if err != nil {
+        return nil
+    }
+    token, err := s.issueToken(user.ID, models.UserTokenAccountUnlock, s.ResetTTL)
+    if err != nil {
+        return err
+    }
+    return s.send(user, Email{
+        To:      user.Email,
+        Subject: "Your account has been locked",
+        Body: fmt.Sprintf("Hi %s,\n\nWe locked your account after several failed sign-in attempts. It unlocks by itself shortly, or you can unlock it now:\n\n%s\n\nIf these attempts were not you, consider changing your password.\n",
+            user.Username, s.link("/unlock-account", token)),
+    })
+}
+
+// UnlockAccount consumes an unlock token and lifts the lockout
+func (s *AccountService) UnlockAccount(token string) error {
+    record, err := s.consumeToken(models.UserTokenAccountUnlock, token)
+    if err != nil {
+        return err
+    }
+    user, err := s.UserRepo.GetUserByID(record.UserID)
+    if err != nil {
+        return ErrInvalidUserToken
+    }
+    if s.Unlocker != nil {
+        if err := s.Unlocker.Unlock(user.Username); err != nil {
+            return err
+        }
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": user.ID,
+    }).Info("Account unlocked by email link")
+    return nil
+}
+
+func (s *AccountService) issueToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+    if err := s.UserTokenRepo.InvalidateUserTokens(userID, purpose); err != nil {
+        return "", err
+    }
+    token, hash, err := newOpaqueToken()
+    if err != nil {
+        return "", err
+    }
+    record := &models.UserToken{
+        UserID:    userID,
+        Purpose:   purpose,
+        TokenHash: hash,
+        ExpiresAt: time.Now().Add(ttl),
+    }
+    if err := s.UserTokenRepo.CreateUserToken(record); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "purpose":    purpose,
+            "error":      err,
+            "error_code": "CREATE_USER_TOKEN_FAILED",
+        }).Error("Failed to store user token")
+        return "", err
+    }
+    return token, nil
+}
+
+// consumeToken validates a mailed token and marks it used; each token works once
+func (s *AccountService) consumeToken(purpose, token string) (*models.UserToken, error) {
+    record, err := s.validToken(purpose, token)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.consume(record); err != nil {
+        return nil, err
+    }
+    return record, nil
+}
+
+// validToken looks up an unused, unexpired token without consuming it
+func (s *AccountService) validToken(purpose, token string) (*models.UserToken, error) {
+    record, err := s.UserTokenRepo.GetUserToken(purpose, hashToken(token))
+    if err != nil {
+        return nil, ErrInvalidUserToken
+    }
+    if record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+        return nil, ErrInvalidUserToken
+    }
+    return record, nil
+}
+
+func (s *AccountService) consume(record *models.UserToken) error {
+    consumed, err := s.UserTokenRepo.ConsumeUserToken(record.ID)
+    if err != nil {
+        return err
+    }
+    if !consumed {
+        return ErrInvalidUserToken
+    }
+    return nil
+}
+
+func (s *AccountService) send(user *models.User, email Email) error {
+    if err := s.Mailer.Send(email); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "subject":    email.Subject,
+            "error":      err,
+            "error_code": "SEND_EMAIL_FAILED",
+        }).Error("Failed to send email")
+        return errors.Wrap(ErrSendEmailFailed, err.Error())
+    }
+    return nil
+}
+
+func (s *AccountService) link(path, token string) string {
+    return s.BaseURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,154 @@
+package services_test
+
+import (
+    "regexp"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubUserTokenRepository keeps mailed tokens in memory
+type stubUserTokenRepository struct {
+    tokens []models.UserToken
+}
+
+func (r *stubUserTokenRepository) CreateUserToken(token *models.UserToken) error {
+    token.ID = uint(len(r.tokens) + 1)
+    r.tokens = append(r.tokens, *token)
+    return nil
+}
+
+func (r *stubUserTokenRepository) GetUserToken(purpose, hash string) (*models.UserToken, error) {
+    for i := range r.tokens {
+        if r.tokens[i].Purpose == purpose && r.tokens[i].TokenHash == hash {
+            token := r.tokens[i]
+            return &token, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubUserTokenRepository) ConsumeUserToken(id uint) (bool, error) {
+    for i := range r.tokens {
+        if r.tokens[i].ID == id && r.tokens[i].UsedAt == nil {
+            now := time.Now()
+            r.tokens[i].UsedAt = &now
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+func (r *stubUserTokenRepository) InvalidateUserTokens(userID uint, purpose string) error {
+    for i := range r.tokens {
+        if r.tokens[i].UserID == userID && r.tokens[i].Purpose == purpose && r.tokens[i].UsedAt == nil {
+            now := time.Now()
+            r.tokens[i].UsedAt = &now
+        }
+    }
+    return nil
+}
+
+// stubMailer records sent email
+type stubMailer struct {
+    sent []services.Email
+}
+
+func (m *stubMailer) Send(email services.Email) error {
+    m.sent = append(m.sent, email)
+    return nil
+}
+
+// stubSessionRevoker records users signed out everywhere
+type stubSessionRevoker struct {
+    revoked []uint
+}
+
+func (r *stubSessionRevoker) RevokeAll(userID uint) error {
+    r.revoked = append(r.revoked, userID)
+    return nil
+}
+
+var mailedTokenPattern = regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`)
+
+func mailedToken(t *testing.T, email services.Email) string {
+    match := mailedTokenPattern.FindStringSubmatch(email.Body)
+    if !assert.Len(t, match, 2, "email has no token link") {
+        t.FailNow()
+    }
+    return match[1]
+}
+
+func TestAccountService_VerifyEmail(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    service := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, mailer, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+
+    assert.NoError(t, service.SendVerificationEmail(1))
+    assert.Len(t, mailer.sent, 1)
+    assert.Equal(t, "ann@example.com", mailer.sent[0].To)
+    assert.Contains(t, mailer.sent[0].Body, "https://shop.example/verify-email?token=")
+
+    // Test resending retires the first link
+    assert.NoError(t, service.ResendVerificationEmail("ANN@example.com"))
+    first, second := mailedToken(t, mailer.sent[0]), mailedToken(t, mailer.sent[1])
+    assert.Equal(t, services.ErrInvalidUserToken, service.VerifyEmail(first))
+
+    assert.NoError(t, service.VerifyEmail(second))
+    assert.NotNil(t, userRepo.users[0].EmailVerifiedAt)
+
+    // Test tokens are single use and verified users get no more links
+    assert.Equal(t, services.ErrInvalidUserToken, service.VerifyEmail(second))
+    assert.Equal(t, services.ErrEmailAlreadyVerified, service.SendVerificationEmail(1))
+    assert.NoError(t, service.ResendVerificationEmail("ann@example.com"))
+    assert.Len(t, mailer.sent, 2)
+}
+
+func TestAccountService_ResetPassword(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com", Password: "old-hash"}}}
+    mailer := &stubMailer{}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    sessions := &stubSessionRevoker{}
+    passwords.Sessions = sessions
+    service := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, mailer, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+
+    // Test unknown addresses are accepted without sending anything
+    assert.NoError(t, service.RequestPasswordReset("nobody@example.com"))
+    assert.Empty(t, mailer.sent)
+
+    assert.NoError(t, service.RequestPasswordReset("ann@example.com"))
+    token := mailedToken(t, mailer.sent[0])
+
+    // Test verification tokens cannot be used for resets
+    assert.Equal(t, services.ErrInvalidUserToken, service.VerifyEmail(token))
+
+    // Test a password rejected by the policy leaves the token usable
+    assert.Equal(t, services.ErrWeakPassword, errors.Cause(service.ResetPassword(token, "short")))
+
+    assert.NoError(t, service.ResetPassword(token, "n3w-Passw0rd"))
+    user := userRepo.users[0]
+    assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"))
+    assert.Equal(t, 1, user.TokenVersion)
+    assert.NotNil(t, user.EmailVerifiedAt)
+    assert.Equal(t, []uint{1}, sessions.revoked)
+
+    assert.Equal(t, services.ErrInvalidUserToken, service.ResetPassword(token, "another-Passw0rd"))
+}
+
+func TestAccountService_ResetPasswordExpired(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    service := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, mailer, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    service.ResetTTL = -time.Minute
+
+    assert.NoError(t, service.RequestPasswordReset("ann@example.com"))
+    assert.Equal(t, services.ErrInvalidUserToken, service.ResetPassword(mailedToken(t, mailer.sent[0]), "n3w-Passw0rd"))
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+    "regexp"
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// Address error types
+var (
+    ErrInvalidAddress       = errors.New("invalid address data")
+    ErrAddressNotFound      = errors.New("address not found")
+    ErrCreateAddressFailed  = errors.New("failed to create address")
+    ErrUpdateAddressFailed  = errors.New("failed to update address")
+    ErrFetchAddressesFailed = errors.New("failed to fetch addresses")
+)
+
+var (
+    countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+    // postalCodePatterns holds the postal code formats we check strictly; other
+    // countries only get the generic pattern
+    postalCodePatterns = map[string]*regexp.Regexp{
+        "US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+        "CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+        "GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+        "DE": regexp.MustCompile(`^\d{5}$`),
+    }
+    genericPostalCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,9}$`)
+
+    // regionRequired lists countries whose addresses need a state or province code
+    regionRequired = map[string]bool{"US": true, "CA": true}
+)
+
+// ValidateAddress normalizes an address in place and checks that it is deliverable
+func ValidateAddress(address *models.Address) error {
+    address.Name = strings.TrimSpace(address.Name)
+    address.Line1 = strings.TrimSpace(address.Line1)
+    address.Line2 = strings.TrimSpace(address.Line2)
+    address.City = strings.TrimSpace(address.City)
+    address.Region = strings.ToUpper(strings.TrimSpace(address.Region))
+    address.PostalCode = strings.ToUpper(strings.TrimSpace(address.PostalCode))
+    address.Country = strings.ToUpper(strings.TrimSpace(address.Country))
+    address.Phone = strings.TrimSpace(address.Phone)
+
+    if address.Name == "" || address.Line1 == "" || address.City == "" || address.PostalCode == "" {
+        return errors.Wrap(ErrInvalidAddress, "name, line1, city and postal_code are required")
+    }
+    if !countryCodePattern.MatchString(address.Country) {
+        return errors.Wrap(ErrInvalidAddress, "country must be an ISO 3166-1 alpha-2 code")
+    }
+    pattern, ok := postalCodePatterns[address.Country]
+    if !ok {
+        pattern = genericPostalCodePattern
+    }
+    if !pattern.MatchString(address.PostalCode) {
+        return errors.Wrap(ErrInvalidAddress, "postal_code is not valid for "+address.Country)
+    }
+    if regionRequired[address.Country] && !countryCodePattern.MatchString(address.Region) {
+        return errors.Wrap(ErrInvalidAddress, "region must be a 2-letter code for "+address.Country)
+    }
+    return nil
+}
+
+// AddressService manages users' address books
+type AddressService struct {
+    AddressRepo repositories.AddressRepository
+    Logger      *logrus.Logger
+}
+
+// NewAddressService creates a new AddressService
+func NewAddressService(addressRepo repositories.AddressRepository, logger *logrus.Logger) *AddressService {
+    return &AddressService{
+        AddressRepo: addressRepo,
+        Logger:      logger,
+    }
+}
+
+// CreateAddress validates and stores a new address; a user's first address becomes the default
+func (s *AddressService) CreateAddress(userID uint, address *models.Address) error {
+    if err := ValidateAddress(address); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "INVALID_ADDRESS",
+        }).Warn("Invalid address data")
+        return err
+    }
+    existing, err := s.AddressRepo.GetAddressesByUserID(userID)
+    if err != nil {
+        return errors.Wrap(ErrFetchAddressesFailed, err.Error())
+    }
+    address.ID = 0
+    address.UserID = userID
+    makeDefault := address.IsDefault || len(existing) == 0
+    address.IsDefault = false
+    if err := s.AddressRepo.CreateAddress(address); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "CREATE_ADDRESS_FAILED",
+        }).Error("Failed to create address")
+        return errors.Wrap(ErrCreateAddressFailed, err.Error())
+    }
+    if makeDefault {
+        if err := s.AddressRepo.SetDefaultAddress(userID, address.ID); err != nil {
+            return errors.Wrap(ErrUpdateAddressFailed, err.Error())
+        }
+        address.IsDefault = true
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":    userID,
+        "address_id": address.ID,
+    }).Info("Created address")
+    return nil
+}
+
+// GetAddresses returns the user's address book, default first
+func (s *AddressService) GetAddresses(userID uint) ([]models.Address, error) {
+    addresses, err := s.AddressRepo.GetAddressesByUserID(userID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "FETCH_ADDRESSES_FAILED",
+        }).Error("Failed to fetch addresses")
+        return nil, errors.Wrap(ErrFetchAddressesFailed, err.Error())
+    }
+    return addresses, nil
+}
+
+// GetAddress returns one of the user's addresses; other users' addresses are reported as not found
+func (s *AddressService) GetAddress(userID, id uint) (*models.Address, error) {
+    address, err := s.AddressRepo.GetAddressByID(id)
+    if err != nil {
+        return nil, errors.Wrap(ErrAddressNotFound, err.Error())
+    }
+    if address.UserID != userID {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "address_id": id,
+            "error_code": "ADDRESS_NOT_FOUND",
+        }).Warn("Address belongs to another user")
+        return nil, ErrAddressNotFound
+    }
+    return address, nil
+}
+
+// UpdateAddress replaces the fields of one of the user's addresses
+func (s *AddressService) UpdateAddress(userID, id uint, input *models.Address) (*models.Address, error) {
+    address, err := s.GetAddress(userID, id)
+    if err != nil {
+        return nil, err
+    }
+    if err := ValidateAddress(input); err != nil {
+        return nil, err
+    }
+    address.Name = input.Name
+    address.Line1 = input.Line1
+    address.Line2 = input.Line2
+    address.City = input.City
+    address.Region = input.Region
+    address.PostalCode = input.PostalCode
+    address.Country = input.Country
+    address.Phone = input.Phone
+    if err := s.AddressRepo.UpdateAddress(address); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "address_id": id,
+            "error":      err,
+            "error_code": "UPDATE_ADDRESS_FAILED",
+        }).Error("Failed to update address")
+        return nil, errors.Wrap(ErrUpdateAddressFailed, err.Error())
+    }
+    if input.IsDefault && !address.IsDefault {
+        if err := s.AddressRepo.SetDefaultAddress(userID, id); err != nil {
+            return nil, errors.Wrap(ErrUpdateAddressFailed, err.Error())
+        }
+        address.IsDefault = true
+    }
+    return address, nil
+}
+
+// SetDefaultAddress makes one of the user's addresses the default
+func (s *AddressService) SetDefaultAddress(userID, id uint) error {
+    if _, err := s.GetAddress(userID, id); err != nil {
+        return err
+    }
+    if err := s.AddressRepo.SetDefaultAddress(userID, id); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "address_id": id,
+            "error":      err,
+            "error_code": "UPDATE_ADDRESS_FAILED",
+        }).Error("Failed to set default address")
+        return errors.Wrap(ErrUpdateAddressFailed, err.Error())
+    }
+    return nil
+}
+
+// DeleteAddress removes one of the user's addresses
+func (s *AddressService) DeleteAddress(userID, id uint) error {
+    if _, err := s.GetAddress(userID, id); err != nil {
+        return err
+    }
+    if err := s.AddressRepo.DeleteAddress(id); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "address_id": id,
+            "error":      err,
+            "error_code": "DELETE_ADDRESS_FAILED",
+        }).Error("Failed to delete address")
+        return errors.Wrap(ErrUpdateAddressFailed, err.Error())
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":    userID,
+        "address_id": id,
+    }).Info("Deleted address")
+    return nil
+}
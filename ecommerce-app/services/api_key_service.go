@@ -0,0 +1,170 @@
+package services
+
+import (
+    "encoding/base64"
+    "strings"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// API key error types
+var (
+    ErrInvalidAPIKey        = errors.New("invalid API key")
+    ErrAPIKeyNotFound       = errors.New("API key not found")
+    ErrAPIKeyAlreadyRevoked = errors.New("API key already revoked")
+    ErrAPIKeyBeyondIssuer   = errors.New("API key would grant more than the issuer's role")
+)
+
+// APIKeyInput is what an admin supplies when issuing a key
+type APIKeyInput struct {
+    Name      string     `json:"name"`
+    UserID    uint       `json:"user_id"` // account the key acts as; defaults to the issuer
+    Scopes    []string   `json:"scopes"`
+    ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKeyService issues, lists and revokes API keys. The key itself is only returned
+// once, at creation.
+type APIKeyService struct {
+    APIKeyRepo repositories.APIKeyRepository
+    UserRepo   repositories.UserRepository
+    RoleRepo   repositories.RoleRepository
+    Logger     *logrus.Logger
+}
+
+// NewAPIKeyService creates a new APIKeyService
+func NewAPIKeyService(apiKeyRepo repositories.APIKeyRepository, userRepo repositories.UserRepository, roleRepo repositories.RoleRepository, logger *logrus.Logger) *APIKeyService {
+    return &APIKeyService{
+        APIKeyRepo: apiKeyRepo,
+        UserRepo:   userRepo,
+        RoleRepo:   roleRepo,
+        Logger:     logger,
+    }
+}
+
+// CreateAPIKey issues a key and returns it with its plaintext value. Issuers can only
+// grant scopes their own role holds, and only issue keys for users whose role grants
+// nothing beyond theirs.
+func (s *APIKeyService) CreateAPIKey(issuerID uint, input *APIKeyInput) (*models.APIKey, string, error) {
+    name := strings.TrimSpace(input.Name)
+    if name == "" {
+        return nil, "", errors.Wrap(ErrInvalidAPIKey, "name is required")
+    }
+    scopes, err := normalizePermissions(input.Scopes)
+    if err != nil {
+        return nil, "", errors.Wrap(ErrInvalidAPIKey, err.Error())
+    }
+    if len(scopes) == 0 {
+        return nil, "", errors.Wrap(ErrInvalidAPIKey, "at least one scope is required")
+    }
+    if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+        return nil, "", errors.Wrap(ErrInvalidAPIKey, "expires_at must be in the future")
+    }
+    issuer, err := s.UserRepo.GetUserByID(issuerID)
+    if err != nil {
+        return nil, "", errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    issuerRole, err := rolePermissions(s.RoleRepo, issuer.Role)
+    if err != nil {
+        return nil, "", err
+    }
+    if missing := missingPermissions(issuerRole, scopes); len(missing) > 0 {
+        s.denyAPIKey(issuerID, issuerID, missing)
+        return nil, "", errors.Wrap(ErrAPIKeyBeyondIssuer, "scopes not held by the issuer: "+strings.Join(missing, ", "))
+    }
+    userID := input.UserID
+    if userID == 0 {
+        userID = issuerID
+    }
+    if userID != issuerID {
+        user, err := s.UserRepo.GetUserByID(userID)
+        if err != nil {
+            return nil, "", errors.Wrap(ErrUserNotFound, err.Error())
+        }
+        userRole, err := rolePermissions(s.RoleRepo, user.Role)
+        if err != nil {
+            return nil, "", err
+        }
+        if missing := missingPermissions(issuerRole, userRole.Permissions); len(missing) > 0 {
+            s.denyAPIKey(issuerID, userID, missing)
+            return nil, "", errors.Wrap(ErrAPIKeyBeyondIssuer, "the user's role grants permissions the issuer lacks: "+strings.Join(missing, ", "))
+        }
+    }
+
+    id, err := randomHex(4)
+    if err != nil {
+        return nil, "", err
+    }
+    secret, err := randomBytes(32)
+    if err != nil {
+        return nil, "", err
+    }
+    prefix := models.APIKeyPrefix + id
+    plaintext := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+    key := &models.APIKey{
+        Name:      name,
+        UserID:    userID,
+        CreatedBy: issuerID,
+        Prefix:    prefix,
+        KeyHash:   hashToken(plaintext),
+        Scopes:    scopes,
+        ExpiresAt: input.ExpiresAt,
+    }
+    if err := s.APIKeyRepo.CreateAPIKey(key); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "issuer_id":  issuerID,
+            "error":      err,
+            "error_code": "CREATE_API_KEY_FAILED",
+        }).Error("Failed to create API key")
+        return nil, "", err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "api_key_id": key.ID,
+        "prefix":     key.Prefix,
+        "user_id":    userID,
+        "issuer_id":  issuerID,
+        "scopes":     scopes,
+    }).Info("API key issued")
+    return key, plaintext, nil
+}
+
+func (s *APIKeyService) denyAPIKey(issuerID, userID uint, missing []string) {
+    s.Logger.WithFields(logrus.Fields{
+        "issuer_id":  issuerID,
+        "user_id":    userID,
+        "missing":    missing,
+        "error_code": "API_KEY_BEYOND_ISSUER",
+    }).Warn("Rejected API key beyond the issuer's permissions")
+}
+
+// GetAPIKeys lists every key, newest first
+func (s *APIKeyService) GetAPIKeys() ([]models.APIKey, error) {
+    return s.APIKeyRepo.GetAPIKeys()
+}
+
+// RevokeAPIKey disables a key immediately
+func (s *APIKeyService) RevokeAPIKey(id, revokedBy uint) error {
+    if _, err := s.APIKeyRepo.GetAPIKeyByID(id); err != nil {
+        if err == gorm.ErrRecordNotFound {
+            return ErrAPIKeyNotFound
+        }
+        return err
+    }
+    revoked, err := s.APIKeyRepo.RevokeAPIKey(id)
+    if err != nil {
+        return err
+    }
+    if !revoked {
+        return ErrAPIKeyAlreadyRevoked
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "api_key_id": id,
+        "revoked_by": revokedBy,
+    }).Info("API key revoked")
+    return nil
+}
@@ -0,0 +1,184 @@
+package services_test
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubAPIKeyRepository keeps API keys in memory
+type stubAPIKeyRepository struct {
+    keys []models.APIKey
+}
+
+func (r *stubAPIKeyRepository) CreateAPIKey(key *models.APIKey) error {
+    key.ID = uint(len(r.keys) + 1)
+    r.keys = append(r.keys, *key)
+    return nil
+}
+
+func (r *stubAPIKeyRepository) GetAPIKeys() ([]models.APIKey, error) {
+    return r.keys, nil
+}
+
+func (r *stubAPIKeyRepository) GetAPIKeyByID(id uint) (*models.APIKey, error) {
+    for i := range r.keys {
+        if r.keys[i].ID == id {
+            key := r.keys[i]
+            return &key, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubAPIKeyRepository) RevokeAPIKey(id uint) (bool, error) {
+    for i := range r.keys {
+        if r.keys[i].ID == id && r.keys[i].RevokedAt == nil {
+            now := time.Now()
+            r.keys[i].RevokedAt = &now
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+func TestAPIKeyService_CreateAPIKey(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "admin", Role: models.RoleAdmin},
+        {ID: 2, Username: "erp", Role: "integration"},
+        {ID: 3, Username: "catalog", Role: "catalog"},
+    }}
+    roleRepo := &stubRoleRepository{roles: []models.Role{
+        {ID: 1, Name: models.RoleAdmin, Permissions: models.AllPermissions},
+        {ID: 2, Name: "integration", Permissions: []string{models.PermissionProductsWrite}},
+        {ID: 3, Name: "catalog", Permissions: []string{models.PermissionAdminAccess, models.PermissionAPIKeysManage, models.PermissionProductsWrite}},
+    }}
+    repo := &stubAPIKeyRepository{}
+    service := services.NewAPIKeyService(repo, userRepo, roleRepo, newTestLogger())
+    expires := time.Now().Add(24 * time.Hour)
+
+    key, plaintext, err := service.CreateAPIKey(1, &services.APIKeyInput{
+        Name:      " ERP sync ",
+        UserID:    2,
+        Scopes:    []string{models.PermissionProductsWrite, models.PermissionProductsWrite},
+        ExpiresAt: &expires,
+    })
+    assert.NoError(t, err)
+    assert.Equal(t, "ERP sync", key.Name)
+    assert.Equal(t, uint(2), key.UserID)
+    assert.Equal(t, uint(1), key.CreatedBy)
+    assert.Equal(t, []string{models.PermissionProductsWrite}, key.Scopes)
+
+    // Test only the hash is stored and the prefix identifies the key
+    assert.True(t, strings.HasPrefix(plaintext, key.Prefix+"_"))
+    assert.Regexp(t, `^ek_[0-9a-f]{8}$`, key.Prefix)
+    sum := sha256.Sum256([]byte(plaintext))
+    assert.Equal(t, hex.EncodeToString(sum[:]), repo.keys[0].KeyHash)
+    assert.NotContains(t, repo.keys[0].KeyHash, plaintext)
+
+    // Test the key acts as its issuer by default
+    key, _, err = service.CreateAPIKey(1, &services.APIKeyInput{Name: "own", Scopes: []string{models.PermissionOrdersManage}})
+    assert.NoError(t, err)
+    assert.Equal(t, uint(1), key.UserID)
+}
+
+func TestAPIKeyService_CreateAPIKeyValidation(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "admin", Role: models.RoleAdmin},
+        {ID: 2, Username: "erp", Role: "integration"},
+        {ID: 3, Username: "catalog", Role: "catalog"},
+    }}
+    roleRepo := &stubRoleRepository{roles: []models.Role{
+        {ID: 1, Name: models.RoleAdmin, Permissions: models.AllPermissions},
+        {ID: 2, Name: "integration", Permissions: []string{models.PermissionProductsWrite}},
+        {ID: 3, Name: "catalog", Permissions: []string{models.PermissionAdminAccess, models.PermissionAPIKeysManage, models.PermissionProductsWrite}},
+    }}
+    repo := &stubAPIKeyRepository{}
+    service := services.NewAPIKeyService(repo, userRepo, roleRepo, newTestLogger())
+    past := time.Now().Add(-time.Minute)
+
+    for name, input := range map[string]*services.APIKeyInput{
+        "missing name":    {Scopes: []string{models.PermissionProductsWrite}},
+        "no scopes":       {Name: "erp"},
+        "unknown scope":   {Name: "erp", Scopes: []string{"products:delete"}},
+        "blank scope":     {Name: "erp", Scopes: []string{" "}},
+        "already expired": {Name: "erp", Scopes: []string{models.PermissionProductsWrite}, ExpiresAt: &past},
+    } {
+        _, _, err := service.CreateAPIKey(1, input)
+        assert.Equal(t, services.ErrInvalidAPIKey, errors.Cause(err), name)
+    }
+    _, _, err := service.CreateAPIKey(1, &services.APIKeyInput{Name: "erp", UserID: 9, Scopes: []string{models.PermissionProductsWrite}})
+    assert.Equal(t, services.ErrUserNotFound, errors.Cause(err))
+    assert.Empty(t, repo.keys)
+}
+
+func TestAPIKeyService_CreateAPIKeyEscalation(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "admin", Role: models.RoleAdmin},
+        {ID: 2, Username: "erp", Role: "integration"},
+        {ID: 3, Username: "catalog", Role: "catalog"},
+    }}
+    roleRepo := &stubRoleRepository{roles: []models.Role{
+        {ID: 1, Name: models.RoleAdmin, Permissions: models.AllPermissions},
+        {ID: 2, Name: "integration", Permissions: []string{models.PermissionProductsWrite}},
+        {ID: 3, Name: "catalog", Permissions: []string{models.PermissionAdminAccess, models.PermissionAPIKeysManage, models.PermissionProductsWrite}},
+    }}
+    repo := &stubAPIKeyRepository{}
+    service := services.NewAPIKeyService(repo, userRepo, roleRepo, newTestLogger())
+
+    // Test an issuer cannot grant scopes their role lacks
+    _, _, err := service.CreateAPIKey(3, &services.APIKeyInput{Name: "refunds", Scopes: []string{models.PermissionOrdersRefund}})
+    assert.Equal(t, services.ErrAPIKeyBeyondIssuer, errors.Cause(err))
+
+    // Test an issuer cannot act as a user with a broader role
+    _, _, err = service.CreateAPIKey(3, &services.APIKeyInput{Name: "as admin", UserID: 1, Scopes: []string{models.PermissionProductsWrite}})
+    assert.Equal(t, services.ErrAPIKeyBeyondIssuer, errors.Cause(err))
+    assert.Empty(t, repo.keys)
+
+    // Test keys within the issuer's role are issued, for themselves or a narrower user
+    _, _, err = service.CreateAPIKey(3, &services.APIKeyInput{Name: "own", Scopes: []string{models.PermissionProductsWrite}})
+    assert.NoError(t, err)
+    key, _, err := service.CreateAPIKey(3, &services.APIKeyInput{Name: "erp", UserID: 2, Scopes: []string{models.PermissionProductsWrite}})
+    assert.NoError(t, err)
+    assert.Equal(t, uint(2), key.UserID)
+}
+
+func TestAPIKeyService_RevokeAPIKey(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "admin", Role: models.RoleAdmin},
+        {ID: 2, Username: "erp", Role: "integration"},
+        {ID: 3, Username: "catalog", Role: "catalog"},
+    }}
+    roleRepo := &stubRoleRepository{roles: []models.Role{
+        {ID: 1, Name: models.RoleAdmin, Permissions: models.AllPermissions},
+        {ID: 2, Name: "integration", Permissions: []string{models.PermissionProductsWrite}},
+        {ID: 3, Name: "catalog", Permissions: []string{models.PermissionAdminAccess, models.PermissionAPIKeysManage, models.PermissionProductsWrite}},
+    }}
+    repo := &stubAPIKeyRepository{}
+    service := services.NewAPIKeyService(repo, userRepo, roleRepo, newTestLogger())
+    key, _, _ := service.CreateAPIKey(1, &services.APIKeyInput{Name: "erp", Scopes: []string{models.PermissionProductsWrite}})
+    assert.True(t, repo.keys[0].Usable(time.Now()))
+
+    assert.NoError(t, service.RevokeAPIKey(key.ID, 1))
+    assert.False(t, repo.keys[0].Usable(time.Now()))
+    assert.Equal(t, services.ErrAPIKeyAlreadyRevoked, service.RevokeAPIKey(key.ID, 1))
+    assert.Equal(t, services.ErrAPIKeyNotFound, service.RevokeAPIKey(99, 1))
+}
+
+func TestAPIKey_Usable(t *testing.T) {
+    now := time.Now()
+    expires := now.Add(time.Hour)
+    key := models.APIKey{ExpiresAt: &expires, Scopes: []string{models.PermissionProductsWrite}}
+    assert.True(t, key.Usable(now))
+    assert.False(t, key.Usable(expires))
+    assert.True(t, key.HasScope(models.PermissionProductsWrite))
+    assert.False(t, key.HasScope(models.PermissionAdminAccess))
+}
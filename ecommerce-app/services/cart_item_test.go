@@ -0,0 +1,79 @@
+package services_test
+
+import (
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+func TestCartService_CartItemOwnership(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, Product: shirt},
+        {ID: 2, UserID: 2, ProductID: 1, Quantity: 1, Product: shirt},
+    }}
+    service := services.NewCartService(cartRepo, newStubProductRepository(shirt), &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+
+    item, err := service.GetCartItemByID(1, 1)
+    assert.NoError(t, err)
+    assert.Equal(t, 2, item.Quantity)
+
+    // Test another user's line is reported as not found, not forbidden
+    _, err = service.GetCartItemByID(1, 2)
+    assert.Equal(t, services.ErrCartItemNotFound, errors.Cause(err))
+    assert.Equal(t, services.ErrCartItemNotFound, errors.Cause(service.UpdateCartItem(1, 2, 5)))
+    assert.Equal(t, services.ErrCartItemNotFound, errors.Cause(service.DeleteCartItem(1, 2)))
+
+    // Test the other user's line is unchanged
+    other, err := cartRepo.GetCartItemByID(2, 2)
+    assert.NoError(t, err)
+    assert.Equal(t, 1, other.Quantity)
+    assert.Len(t, cartRepo.cartItems, 2)
+}
+
+func TestCartService_UpdateAndDeleteOwnCartItem(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, Product: shirt},
+        {ID: 2, UserID: 2, ProductID: 1, Quantity: 1, Product: shirt},
+    }}
+    service := services.NewCartService(cartRepo, newStubProductRepository(shirt), &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+
+    assert.Equal(t, services.ErrInvalidQuantity, service.UpdateCartItem(1, 1, 0))
+    assert.Equal(t, services.ErrInsufficientStock, service.UpdateCartItem(1, 1, 11))
+    assert.NoError(t, service.UpdateCartItem(1, 1, 4))
+    item, _ := service.GetCartItemByID(1, 1)
+    assert.Equal(t, 4, item.Quantity)
+
+    assert.NoError(t, service.DeleteCartItem(1, 1))
+    _, err := service.GetCartItemByID(1, 1)
+    assert.Equal(t, services.ErrCartItemNotFound, errors.Cause(err))
+    assert.Equal(t, services.ErrCartItemNotFound, errors.Cause(service.DeleteCartItem(1, 1)))
+    if assert.Len(t, cartRepo.cartItems, 1) {
+        assert.Equal(t, uint(2), cartRepo.cartItems[0].UserID)
+    }
+}
+
+// unavailableCartRepository fails every cart item lookup as if the database were down
+type unavailableCartRepository struct {
+    *stubCartRepository
+}
+
+func (m *unavailableCartRepository) GetCartItemByID(userID, id uint) (*models.Cart, error) {
+    return nil, errors.New("connection refused")
+}
+
+func TestCartService_CartItemLookupFailure(t *testing.T) {
+    cartRepo := &unavailableCartRepository{&stubCartRepository{}}
+    service := services.NewCartService(cartRepo, newStubProductRepository(), &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+
+    // Test a failed lookup is not reported as a missing item
+    _, err := service.GetCartItemByID(1, 1)
+    assert.Equal(t, services.ErrFetchCartFailed, errors.Cause(err))
+    assert.Equal(t, services.ErrFetchCartFailed, errors.Cause(service.UpdateCartItem(1, 1, 2)))
+    assert.Equal(t, services.ErrFetchCartFailed, errors.Cause(service.DeleteCartItem(1, 1)))
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+    "context"
+    "encoding/json"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/redis/go-redis/v9"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// ErrCartOperationNotFound is returned for unknown, expired or other users' operations
+var ErrCartOperationNotFound = errors.New("cart operation not found")
+
+// Cart operation statuses
+const (
+    CartOperationPending   = "pending"
+    CartOperationSucceeded = "succeeded"
+    CartOperationFailed    = "failed"
+)
+
+// CartEventsQueue receives a CartEvent whenever an item is added to a cart
+const CartEventsQueue = "cart_events"
+
+// CartOperation tracks an add to cart queued for the worker, so clients can poll for
+// the outcome instead of guessing when the item will appear
+type CartOperation struct {
+    ID          string     `json:"id"`
+    UserID      uint       `json:"-"`
+    ProductID   uint       `json:"product_id"`
+    Quantity    int        `json:"quantity"`
+    Status      string     `json:"status"`
+    Error       string     `json:"error,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// CartAddResult is the outcome of AddToCart: the updated line when the cart is
+// written synchronously, or the queued operation otherwise
+type CartAddResult struct {
+    Item      *models.Cart
+    Operation *CartOperation
+}
+
+// CartEvent is published to CartEventsQueue once an item has been added to a cart
+type CartEvent struct {
+    UserID       uint      `json:"user_id"`
+    ProductID    uint      `json:"product_id"`
+    Quantity     int       `json:"quantity"`
+    LineQuantity int       `json:"line_quantity"`
+    OccurredAt   time.Time `json:"occurred_at"`
+}
+
+// CartOperationStore keeps cart operations until they expire
+type CartOperationStore interface {
+    Save(operation *CartOperation, ttl time.Duration) error
+    Get(id string) (*CartOperation, error) // nil when unknown or expired
+}
+
+// GetCartOperation returns one of the user's cart operations
+func (s *CartService) GetCartOperation(userID uint, id string) (*CartOperation, error) {
+    if s.Operations == nil {
+        return nil, ErrCartOperationNotFound
+    }
+    operation, err := s.Operations.Get(id)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "operation_id": id,
+            "error":        err,
+            "error_code":   "FETCH_CART_OPERATION_FAILED",
+        }).Error("Failed to fetch cart operation")
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+    if operation == nil || operation.UserID != userID {
+        return nil, ErrCartOperationNotFound
+    }
+    return operation, nil
+}
+
+// CompleteCartOperation records the worker's outcome for a queued add to cart. err is
+// nil on success.
+func (s *CartService) CompleteCartOperation(id string, err error) {
+    if s.Operations == nil || id == "" {
+        return
+    }
+    operation, getErr := s.Operations.Get(id)
+    if getErr != nil || operation == nil {
+        return
+    }
+    s.finishCartOperation(operation, err)
+}
+
+// startCartOperation records a pending operation for an add about to be queued. The
+// add still goes ahead if the operation cannot be stored; it just cannot be polled.
+func (s *CartService) startCartOperation(userID, productID uint, quantity int) *CartOperation {
+    if s.Operations == nil {
+        return nil
+    }
+    id, err := randomHex(16)
+    if err != nil {
+        return nil
+    }
+    operation := &CartOperation{
+        ID:        id,
+        UserID:    userID,
+        ProductID: productID,
+        Quantity:  quantity,
+        Status:    CartOperationPending,
+        CreatedAt: time.Now(),
+    }
+    if err := s.Operations.Save(operation, s.OperationTTL); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "SAVE_CART_OPERATION_FAILED",
+        }).Warn("Failed to record cart operation")
+        return nil
+    }
+    return operation
+}
+
+func (s *CartService) finishCartOperation(operation *CartOperation, err error) {
+    now := time.Now()
+    operation.CompletedAt = &now
+    operation.Status = CartOperationSucceeded
+    if err != nil {
+        operation.Status = CartOperationFailed
+        operation.Error = cartOperationError(err).Error()
+    }
+    if err := s.Operations.Save(operation, s.OperationTTL); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "operation_id": operation.ID,
+            "error":        err,
+            "error_code":   "SAVE_CART_OPERATION_FAILED",
+        }).Warn("Failed to record cart operation outcome")
+    }
+}
+
+// cartOperationError turns repository and publishing errors into the errors the API
+// reports for a direct add to cart
+func cartOperationError(err error) error {
+    switch errors.Cause(err) {
+    case repositories.ErrCartQuantityExceedsStock:
+        return ErrInsufficientStock
+    case gorm.ErrRecordNotFound:
+        return ErrProductNotFound
+    case ErrPublishFailed, ErrMarshalFailed:
+        return ErrPublishFailed
+    default:
+        return ErrUpdateCartFailed
+    }
+}
+
+// RedisCartOperationStore keeps cart operations as JSON values that expire on their own
+type RedisCartOperationStore struct {
+    Client *redis.Client
+}
+
+// NewRedisCartOperationStore creates a new RedisCartOperationStore
+func NewRedisCartOperationStore(client *redis.Client) *RedisCartOperationStore {
+    return &RedisCartOperationStore{Client: client}
+}
+
+func (s *RedisCartOperationStore) Save(operation *CartOperation, ttl time.Duration) error {
+    // UserID is hidden from API responses, so it is stored alongside the operation
+    data, err := json.Marshal(storedCartOperation{CartOperation: operation, UserID: operation.UserID})
+    if err != nil {
+        return err
+    }
+    return s.Client.Set(context.Background(), cartOperationKey(operation.ID), data, ttl).Err()
+}
+
+func (s *RedisCartOperationStore) Get(id string) (*CartOperation, error) {
+    data, err := s.Client.Get(context.Background(), cartOperationKey(id)).Bytes()
+    if err == redis.Nil {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    stored := storedCartOperation{CartOperation: &CartOperation{}}
+    if err := json.Unmarshal(data, &stored); err != nil {
+        return nil, err
+    }
+    stored.CartOperation.UserID = stored.UserID
+    return stored.CartOperation, nil
+}
+
+type storedCartOperation struct {
+    *CartOperation
+    UserID uint `json:"user_id"`
+}
+
+func cartOperationKey(id string) string { return "cart_operation:" + id }
@@ -0,0 +1,122 @@
+package services_test
+
+import (
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubCartOperationStore keeps cart operations in memory
+type stubCartOperationStore struct {
+    operations map[string]services.CartOperation
+}
+
+func (s *stubCartOperationStore) Save(operation *services.CartOperation, ttl time.Duration) error {
+    s.operations[operation.ID] = *operation
+    return nil
+}
+
+func (s *stubCartOperationStore) Get(id string) (*services.CartOperation, error) {
+    operation, ok := s.operations[id]
+    if !ok {
+        return nil, nil
+    }
+    return &operation, nil
+}
+
+func TestCartService_AddToCartSync(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5}
+    products := newStubProductRepository(shirt)
+    cartRepo := &stubCartRepository{products: products}
+    store := &stubCartOperationStore{operations: make(map[string]services.CartOperation)}
+    service := services.NewCartService(cartRepo, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    service.Operations = store
+    service.OperationTTL = time.Hour
+    service.SyncWrites = true
+
+    result, err := service.AddToCart(1, 1, 2)
+    assert.NoError(t, err)
+    if assert.NotNil(t, result.Item) {
+        assert.Equal(t, 2, result.Item.Quantity)
+        assert.Equal(t, "Shirt", result.Item.Product.Name)
+    }
+    assert.Nil(t, result.Operation)
+
+    // Test repeated adds land on one line and are visible at once
+    result, err = service.AddToCart(1, 1, 3)
+    assert.NoError(t, err)
+    assert.Equal(t, 5, result.Item.Quantity)
+    items, _ := cartRepo.GetCartByUserID(1)
+    if assert.Len(t, items, 1) {
+        assert.Equal(t, 5, items[0].Quantity)
+    }
+
+    // Test the line cannot grow past the stock on hand
+    _, err = service.AddToCart(1, 1, 1)
+    assert.Equal(t, services.ErrInsufficientStock, err)
+    _, err = service.AddToCart(1, 99, 1)
+    assert.Equal(t, services.ErrProductNotFound, errors.Cause(err))
+    assert.Empty(t, store.operations)
+}
+
+func TestCartService_AddToCartAsyncOperation(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5}
+    products := newStubProductRepository(shirt)
+    cartRepo := &stubCartRepository{products: products}
+    store := &stubCartOperationStore{operations: make(map[string]services.CartOperation)}
+    service := services.NewCartService(cartRepo, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    service.Operations = store
+    service.OperationTTL = time.Hour
+
+    // Test an add that cannot be queued is recorded as a failed operation
+    _, err := service.AddToCart(1, 1, 2)
+    assert.Equal(t, services.ErrPublishFailed, errors.Cause(err))
+    assert.Empty(t, cartRepo.cartItems)
+    if assert.Len(t, store.operations, 1) {
+        for _, operation := range store.operations {
+            assert.Equal(t, uint(1), operation.UserID)
+            assert.Equal(t, services.CartOperationFailed, operation.Status)
+            assert.Equal(t, services.ErrPublishFailed.Error(), operation.Error)
+        }
+    }
+}
+
+func TestCartService_GetCartOperation(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5}
+    products := newStubProductRepository(shirt)
+    cartRepo := &stubCartRepository{products: products}
+    store := &stubCartOperationStore{operations: make(map[string]services.CartOperation)}
+    service := services.NewCartService(cartRepo, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    service.Operations = store
+    service.OperationTTL = time.Hour
+    store.operations["op-1"] = services.CartOperation{ID: "op-1", UserID: 1, ProductID: 1, Quantity: 2, Status: services.CartOperationPending}
+    store.operations["op-2"] = services.CartOperation{ID: "op-2", UserID: 1, ProductID: 1, Quantity: 9, Status: services.CartOperationPending}
+
+    operation, err := service.GetCartOperation(1, "op-1")
+    assert.NoError(t, err)
+    assert.Equal(t, services.CartOperationPending, operation.Status)
+
+    // Test operations are private to their user
+    _, err = service.GetCartOperation(2, "op-1")
+    assert.Equal(t, services.ErrCartOperationNotFound, err)
+    _, err = service.GetCartOperation(1, "missing")
+    assert.Equal(t, services.ErrCartOperationNotFound, err)
+
+    service.CompleteCartOperation("op-1", nil)
+    service.CompleteCartOperation("op-2", repositories.ErrCartQuantityExceedsStock)
+    service.CompleteCartOperation("missing", nil)
+
+    operation, _ = service.GetCartOperation(1, "op-1")
+    assert.Equal(t, services.CartOperationSucceeded, operation.Status)
+    assert.NotNil(t, operation.CompletedAt)
+    operation, _ = service.GetCartOperation(1, "op-2")
+    assert.Equal(t, services.CartOperationFailed, operation.Status)
+    assert.Equal(t, services.ErrInsufficientStock.Error(), operation.Error)
+    assert.Len(t, store.operations, 2)
+}
@@ -4,6 +4,7 @@ import (
     "context"
     "encoding/json"
     "strconv"
+    "strings"
     "time"
 
     "github.com/inquisitivefrog/ecommerce-app/models"
@@ -12,6 +13,7 @@ import (
     "github.com/rabbitmq/amqp091-go"
     "github.com/redis/go-redis/v9"
     "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
 )
 
 // Custom error types
@@ -33,22 +35,89 @@ var (
 type CartService struct {
     CartRepo    repositories.CartRepository
     ProductRepo repositories.ProductRepository
+    CouponRepo  repositories.CouponRepository
     RabbitMQ    *amqp091.Channel
     RedisClient *redis.Client
     Logger      *logrus.Logger
+
+    SyncWrites   bool               // write adds directly instead of through the cart worker
+    Operations   CartOperationStore // optional; tracks queued adds for polling
+    OperationTTL time.Duration
+
+    TaxCalculator   TaxCalculator    // optional; without it summaries carry no tax
+    ShippingService *ShippingService // optional; without it summaries carry no shipping
+
+    GuestCarts   GuestCartStore   // optional; without it only logged-in users have carts
+    GuestTokens  *GuestCartTokens // signs the tokens that identify guest carts
+    GuestCartTTL time.Duration
 }
 
-func NewCartService(cartRepo repositories.CartRepository, productRepo repositories.ProductRepository, rabbitMQ *amqp091.Channel, redisClient *redis.Client, logger *logrus.Logger) *CartService {
+func NewCartService(cartRepo repositories.CartRepository, productRepo repositories.ProductRepository, couponRepo repositories.CouponRepository, rabbitMQ *amqp091.Channel, redisClient *redis.Client, logger *logrus.Logger) *CartService {
     return &CartService{
         CartRepo:    cartRepo,
         ProductRepo: productRepo,
+        CouponRepo:  couponRepo,
         RabbitMQ:    rabbitMQ,
         RedisClient: redisClient,
         Logger:      logger,
     }
 }
 
-func (s *CartService) AddToCart(userID uint, productID uint, quantity int) error {
+// AddToCart adds quantity of a product to the user's cart. With SyncWrites the line is
+// written before AddToCart returns and a CartEvent is queued for side effects;
+// otherwise the add is queued for the cart worker and tracked as a CartOperation.
+func (s *CartService) AddToCart(userID uint, productID uint, quantity int) (*CartAddResult, error) {
+    if err := s.checkAdd(productID, quantity); err != nil {
+        return nil, err
+    }
+    if s.SyncWrites {
+        return s.addToCartNow(userID, productID, quantity)
+    }
+
+    operation := s.startCartOperation(userID, productID, quantity)
+    message := struct {
+        UserID      uint   `json:"user_id"`
+        ProductID   uint   `json:"product_id"`
+        Quantity    int    `json:"quantity"`
+        OperationID string `json:"operation_id,omitempty"`
+    }{
+        UserID:    userID,
+        ProductID: productID,
+        Quantity:  quantity,
+    }
+    if operation != nil {
+        message.OperationID = operation.ID
+    }
+    if err := publishJSON(s.RabbitMQ, "cart_queue", message); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "PUBLISH_FAILED",
+        }).Error("Failed to publish to RabbitMQ")
+        if operation != nil {
+            s.finishCartOperation(operation, err)
+        }
+        return nil, err
+    }
+
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":    userID,
+        "product_id": productID,
+        "quantity":   quantity,
+    }).Info("Published add to cart message to RabbitMQ")
+    return &CartAddResult{Operation: operation}, nil
+}
+
+// AddToCartNow adds to the user's cart as AddToCart does with SyncWrites, whatever the
+// cart mode, for callers that may only go on once the line is written
+func (s *CartService) AddToCartNow(userID uint, productID uint, quantity int) (*CartAddResult, error) {
+    if err := s.checkAdd(productID, quantity); err != nil {
+        return nil, err
+    }
+    return s.addToCartNow(userID, productID, quantity)
+}
+
+// checkAdd rejects adds of unknown products, more than is in stock or no quantity
+func (s *CartService) checkAdd(productID uint, quantity int) error {
     product, err := s.ProductRepo.GetProductByID(productID)
     if err != nil {
         s.Logger.WithFields(logrus.Fields{
@@ -74,52 +143,50 @@ func (s *CartService) AddToCart(userID uint, productID uint, quantity int) error
         }).Warn("Invalid quantity")
         return ErrInvalidQuantity
     }
+    return nil
+}
 
-    message := struct {
-        UserID    uint `json:"user_id"`
-        ProductID uint `json:"product_id"`
-        Quantity  int  `json:"quantity"`
-    }{
-        UserID:    userID,
-        ProductID: productID,
-        Quantity:  quantity,
-    }
-    body, err := json.Marshal(message)
-    if err != nil {
-        s.Logger.WithFields(logrus.Fields{
-            "error":      err,
-            "error_code": "MARSHAL_FAILED",
-        }).Error("Failed to marshal RabbitMQ message")
-        return errors.Wrap(ErrMarshalFailed, err.Error())
-    }
-
-    err = s.RabbitMQ.PublishWithContext(
-        context.Background(),
-        "",
-        "cart_queue",
-        false,
-        false,
-        amqp091.Publishing{
-            ContentType: "application/json",
-            Body:        body,
-        },
-    )
+// addToCartNow writes the line in a single transaction so the next read sees it
+func (s *CartService) addToCartNow(userID, productID uint, quantity int) (*CartAddResult, error) {
+    cartItem, err := s.CartRepo.AddItemQuantity(userID, productID, quantity)
     if err != nil {
+        err = cartOperationError(err)
+        if err == ErrUpdateCartFailed {
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    userID,
+                "product_id": productID,
+                "error_code": "UPDATE_CART_FAILED",
+            }).Error("Failed to add item to cart")
+        }
+        return nil, err
+    }
+    s.invalidateCache(userID)
+
+    event := CartEvent{
+        UserID:       userID,
+        ProductID:    productID,
+        Quantity:     quantity,
+        LineQuantity: cartItem.Quantity,
+        OccurredAt:   time.Now(),
+    }
+    if err := publishJSON(s.RabbitMQ, CartEventsQueue, event); err != nil {
         s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
             "error":      err,
             "error_code": "PUBLISH_FAILED",
-        }).Error("Failed to publish to RabbitMQ")
-        return errors.Wrap(ErrPublishFailed, err.Error())
+        }).Warn("Failed to publish cart event")
     }
 
     s.Logger.WithFields(logrus.Fields{
         "user_id":    userID,
         "product_id": productID,
-        "quantity":   quantity,
-    }).Info("Published add to cart message to RabbitMQ")
-    return nil
+        "quantity":   cartItem.Quantity,
+    }).Info("Added item to cart")
+    return &CartAddResult{Item: cartItem}, nil
 }
 
+// GetCart returns the user's cart. Lines are checked against their products' current
+// price and stock on every read, cached or not, and carry warnings for any change.
 func (s *CartService) GetCart(userID uint) ([]models.Cart, error) {
     cacheKey := "cart:" + strconv.FormatUint(uint64(userID), 10)
     cached, err := s.RedisClient.Get(context.Background(), cacheKey).Result()
@@ -130,7 +197,7 @@ func (s *CartService) GetCart(userID uint) ([]models.Cart, error) {
                 "user_id": userID,
                 "count":   len(cartItems),
             }).Info("Fetched cart from cache")
-            return cartItems, nil
+            return s.revalidatedCart(userID, cartItems)
         }
         s.Logger.WithFields(logrus.Fields{
             "user_id":    userID,
@@ -166,31 +233,64 @@ func (s *CartService) GetCart(userID uint) ([]models.Cart, error) {
         "user_id": userID,
         "count":   len(cartItems),
     }).Info("Fetched cart")
-    return cartItems, nil
+    return s.revalidatedCart(userID, cartItems)
 }
 
-func (s *CartService) GetCartItemByID(id uint) (*models.Cart, error) {
-    cartItem, err := s.CartRepo.GetCartItemByID(id)
+func (s *CartService) revalidatedCart(userID uint, cartItems []models.Cart) ([]models.Cart, error) {
+    changed, err := s.revalidateCart(cartItems)
     if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "FETCH_CART_FAILED",
+        }).Error("Failed to revalidate cart")
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+    if changed > 0 {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id": userID,
+            "changed": changed,
+        }).Info("Cart lines changed since they were added")
+    }
+    return cartItems, nil
+}
+
+// GetCartItemByID returns an item from the user's cart. Items in other users' carts
+// are reported as not found.
+func (s *CartService) GetCartItemByID(userID, id uint) (*models.Cart, error) {
+    return s.getCartItem(userID, id)
+}
+
+// getCartItem loads an item from the user's cart. Only a missing item is reported as
+// ErrCartItemNotFound; other failures are fetch errors.
+func (s *CartService) getCartItem(userID, id uint) (*models.Cart, error) {
+    cartItem, err := s.CartRepo.GetCartItemByID(userID, id)
+    if err == gorm.ErrRecordNotFound {
         s.Logger.WithFields(logrus.Fields{
             "cart_id":    id,
+            "user_id":    userID,
             "error":      err,
             "error_code": "CART_ITEM_NOT_FOUND",
         }).Warn("Cart item not found")
         return nil, errors.Wrap(ErrCartItemNotFound, err.Error())
     }
-    return cartItem, nil
-}
-
-func (s *CartService) UpdateCartItem(id uint, quantity int) error {
-    cartItem, err := s.CartRepo.GetCartItemByID(id)
     if err != nil {
         s.Logger.WithFields(logrus.Fields{
             "cart_id":    id,
+            "user_id":    userID,
             "error":      err,
-            "error_code": "CART_ITEM_NOT_FOUND",
-        }).Warn("Cart item not found")
-        return errors.Wrap(ErrCartItemNotFound, err.Error())
+            "error_code": "FETCH_CART_ITEM_FAILED",
+        }).Error("Failed to fetch cart item")
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+    return cartItem, nil
+}
+
+// UpdateCartItem sets the quantity of an item in the user's cart
+func (s *CartService) UpdateCartItem(userID, id uint, quantity int) error {
+    cartItem, err := s.getCartItem(userID, id)
+    if err != nil {
+        return err
     }
     if quantity <= 0 {
         s.Logger.WithFields(logrus.Fields{
@@ -218,7 +318,7 @@ func (s *CartService) UpdateCartItem(id uint, quantity int) error {
         return ErrInsufficientStock
     }
     cartItem.Quantity = quantity
-    if err := s.CartRepo.UpdateItem(cartItem); err != nil {
+    if err := s.CartRepo.UpdateItem(userID, cartItem); err != nil {
         s.Logger.WithFields(logrus.Fields{
             "cart_id":    id,
             "error":      err,
@@ -244,17 +344,13 @@ func (s *CartService) UpdateCartItem(id uint, quantity int) error {
     return nil
 }
 
-func (s *CartService) DeleteCartItem(id uint) error {
-    cartItem, err := s.CartRepo.GetCartItemByID(id)
+// DeleteCartItem removes an item from the user's cart
+func (s *CartService) DeleteCartItem(userID, id uint) error {
+    cartItem, err := s.getCartItem(userID, id)
     if err != nil {
-        s.Logger.WithFields(logrus.Fields{
-            "cart_id":    id,
-            "error":      err,
-            "error_code": "CART_ITEM_NOT_FOUND",
-        }).Warn("Cart item not found")
-        return errors.Wrap(ErrCartItemNotFound, err.Error())
+        return err
     }
-    if err := s.CartRepo.DeleteItem(id); err != nil {
+    if err := s.CartRepo.DeleteItem(userID, id); err != nil {
         s.Logger.WithFields(logrus.Fields{
             "cart_id":    id,
             "error":      err,
@@ -278,3 +374,178 @@ func (s *CartService) DeleteCartItem(id uint) error {
     }).Info("Deleted cart item")
     return nil
 }
+
+// GetCartSummary returns the cart with subtotal, coupon discount lines, tax lines,
+// shipping quotes and total. Tax and shipping are only calculated when an address is
+// given; the chosen shipping method's price is added to the total.
+func (s *CartService) GetCartSummary(userID uint, address *TaxAddress, shippingMethod string) (*CartSummary, error) {
+    cartItems, err := s.GetCart(userID)
+    if err != nil {
+        return nil, err
+    }
+    coupons, err := s.appliedCoupons(userID)
+    if err != nil {
+        return nil, err
+    }
+    return s.summarize(cartItems, coupons, address, shippingMethod, logrus.Fields{"user_id": userID})
+}
+
+// summarize prices cart items for GetCartSummary and GetGuestCartSummary. fields
+// identify the cart in log entries.
+func (s *CartService) summarize(cartItems []models.Cart, coupons []models.Coupon, address *TaxAddress, shippingMethod string, fields logrus.Fields) (*CartSummary, error) {
+    summary := SummarizeCart(cartItems, coupons, time.Now())
+    if address == nil {
+        if shippingMethod != "" {
+            return nil, ErrShippingAddressRequired
+        }
+    } else {
+        if err := applyTax(summary, s.TaxCalculator, *address); err != nil {
+            s.Logger.WithFields(fields).WithFields(logrus.Fields{
+                "country":    address.Country,
+                "error":      err,
+                "error_code": "TAX_CALCULATION_FAILED",
+            }).Warn("Failed to calculate tax")
+            return nil, err
+        }
+        if err := applyShipping(summary, s.ShippingService, address.Country, shippingMethod); err != nil {
+            return nil, err
+        }
+    }
+    s.Logger.WithFields(fields).WithFields(logrus.Fields{
+        "subtotal":       summary.Subtotal,
+        "discount_total": summary.DiscountTotal,
+        "tax_total":      summary.TaxTotal,
+        "shipping_total": summary.ShippingTotal,
+        "total":          summary.Total,
+    }).Info("Calculated cart summary")
+    return summary, nil
+}
+
+// ApplyCoupon validates a coupon code against the user's cart and attaches it
+func (s *CartService) ApplyCoupon(userID uint, code string) (*CartSummary, error) {
+    code = strings.ToUpper(strings.TrimSpace(code))
+    coupon, err := s.CouponRepo.GetCouponByCode(code)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "code":       code,
+            "error":      err,
+            "error_code": "COUPON_NOT_FOUND",
+        }).Warn("Coupon not found")
+        return nil, errors.Wrap(ErrCouponNotFound, err.Error())
+    }
+    cartItems, err := s.GetCart(userID)
+    if err != nil {
+        return nil, err
+    }
+    if err := CheckCouponApplicable(coupon, cartItems, time.Now()); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "code":       code,
+            "error":      err,
+            "error_code": "COUPON_NOT_APPLICABLE",
+        }).Warn("Coupon not applicable")
+        return nil, err
+    }
+    if err := s.checkCouponUsage(coupon, userID); err != nil {
+        return nil, err
+    }
+    applied, err := s.appliedCoupons(userID)
+    if err != nil {
+        return nil, err
+    }
+    if err := CheckCouponStacking(coupon, applied); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "code":       code,
+            "error_code": "COUPON_NOT_STACKABLE",
+        }).Warn("Coupon cannot be stacked")
+        return nil, err
+    }
+    if err := s.CouponRepo.AddCartCoupon(&models.CartCoupon{UserID: userID, CouponID: coupon.ID}); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "code":       code,
+            "error":      err,
+            "error_code": "UPDATE_CART_FAILED",
+        }).Error("Failed to apply coupon")
+        return nil, errors.Wrap(ErrUpdateCartFailed, err.Error())
+    }
+
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": userID,
+        "code":    code,
+    }).Info("Applied coupon to cart")
+    return SummarizeCart(cartItems, append(applied, *coupon), time.Now()), nil
+}
+
+// RemoveCoupon detaches a coupon code from the user's cart
+func (s *CartService) RemoveCoupon(userID uint, code string) error {
+    code = strings.ToUpper(strings.TrimSpace(code))
+    coupon, err := s.CouponRepo.GetCouponByCode(code)
+    if err != nil {
+        return errors.Wrap(ErrCouponNotFound, err.Error())
+    }
+    removed, err := s.CouponRepo.RemoveCartCoupon(userID, coupon.ID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "code":       code,
+            "error":      err,
+            "error_code": "UPDATE_CART_FAILED",
+        }).Error("Failed to remove coupon")
+        return errors.Wrap(ErrUpdateCartFailed, err.Error())
+    }
+    if !removed {
+        return ErrCouponNotFound
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": userID,
+        "code":    code,
+    }).Info("Removed coupon from cart")
+    return nil
+}
+
+func (s *CartService) appliedCoupons(userID uint) ([]models.Coupon, error) {
+    cartCoupons, err := s.CouponRepo.GetCartCoupons(userID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "FETCH_CART_FAILED",
+        }).Error("Failed to fetch cart coupons")
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+    coupons := make([]models.Coupon, 0, len(cartCoupons))
+    for _, cartCoupon := range cartCoupons {
+        coupons = append(coupons, cartCoupon.Coupon)
+    }
+    return coupons, nil
+}
+
+func (s *CartService) checkCouponUsage(coupon *models.Coupon, userID uint) error {
+    if coupon.UsageLimit > 0 && coupon.UsageCount >= coupon.UsageLimit {
+        return ErrCouponUsageLimit
+    }
+    if coupon.UsageLimitPerUser > 0 {
+        used, err := s.CouponRepo.CountRedemptionsByUser(coupon.ID, userID)
+        if err != nil {
+            return errors.Wrap(ErrFetchCartFailed, err.Error())
+        }
+        if used >= int64(coupon.UsageLimitPerUser) {
+            return ErrCouponUserLimit
+        }
+    }
+    return nil
+}
+
+func (s *CartService) invalidateCache(userID uint) {
+    cacheKey := "cart:" + strconv.FormatUint(uint64(userID), 10)
+    if err := s.RedisClient.Del(context.Background(), cacheKey).Err(); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "CACHE_INVALIDATE",
+        }).Warn("Failed to invalidate cache")
+    }
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+    "fmt"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// ErrCartChanged is returned by checkout while cart lines carry warnings the user has
+// not acknowledged
+var ErrCartChanged = errors.New("cart has changed since items were added; review and acknowledge the changes")
+
+// revalidateCart reloads each line's product and sets the line's warnings: the price
+// differs from the one recorded when it was added, the stock no longer covers the
+// quantity, or the product has been deleted. It returns how many lines have warnings.
+func (s *CartService) revalidateCart(cartItems []models.Cart) (int, error) {
+    changed := 0
+    for i := range cartItems {
+        line := &cartItems[i]
+        line.Warnings = nil
+        product, err := s.ProductRepo.GetProductByID(line.ProductID)
+        if err == gorm.ErrRecordNotFound {
+            line.Warnings = append(line.Warnings, models.CartWarning{
+                Code:    models.CartWarningProductRemoved,
+                Message: "This product is no longer sold",
+            })
+            changed++
+            continue
+        }
+        if err != nil {
+            return 0, err
+        }
+        line.Product = *product
+
+        if line.PriceAtAdd > 0 && product.Price != line.PriceAtAdd {
+            line.Warnings = append(line.Warnings, models.CartWarning{
+                Code:          models.CartWarningPriceChanged,
+                Message:       fmt.Sprintf("The price has changed from %.2f to %.2f", line.PriceAtAdd, product.Price),
+                PreviousPrice: line.PriceAtAdd,
+                CurrentPrice:  product.Price,
+            })
+        }
+        if product.Stock <= 0 {
+            line.Warnings = append(line.Warnings, models.CartWarning{
+                Code:    models.CartWarningOutOfStock,
+                Message: "This product is out of stock",
+            })
+        } else if product.Stock < line.Quantity {
+            line.Warnings = append(line.Warnings, models.CartWarning{
+                Code:      models.CartWarningInsufficientStock,
+                Message:   fmt.Sprintf("Only %d left in stock", product.Stock),
+                Available: product.Stock,
+            })
+        }
+        if len(line.Warnings) > 0 {
+            changed++
+        }
+    }
+    return changed, nil
+}
+
+// AcknowledgeCartChanges accepts every change flagged on the user's cart so checkout
+// can go ahead: lines for deleted or sold out products are removed, quantities are
+// lowered to the stock on hand and changed prices are recorded as the lines' prices.
+// It returns the updated cart.
+func (s *CartService) AcknowledgeCartChanges(userID uint) ([]models.Cart, error) {
+    cartItems, err := s.CartRepo.GetCartByUserID(userID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "FETCH_CART_FAILED",
+        }).Error("Failed to fetch cart")
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+    if _, err := s.revalidateCart(cartItems); err != nil {
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+
+    acknowledged := 0
+    for _, line := range cartItems {
+        if len(line.Warnings) == 0 {
+            continue
+        }
+        if err := s.acknowledgeLine(userID, line); err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    userID,
+                "cart_id":    line.ID,
+                "error":      err,
+                "error_code": "UPDATE_CART_FAILED",
+            }).Error("Failed to acknowledge cart change")
+            s.invalidateCache(userID)
+            return nil, errors.Wrap(ErrUpdateCartFailed, err.Error())
+        }
+        acknowledged++
+    }
+    s.invalidateCache(userID)
+
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": userID,
+        "lines":   acknowledged,
+    }).Info("Acknowledged cart changes")
+    return s.GetCart(userID)
+}
+
+func (s *CartService) acknowledgeLine(userID uint, line models.Cart) error {
+    for _, warning := range line.Warnings {
+        switch warning.Code {
+        case models.CartWarningProductRemoved, models.CartWarningOutOfStock:
+            return s.CartRepo.DeleteItem(userID, line.ID)
+        }
+    }
+    for _, warning := range line.Warnings {
+        switch warning.Code {
+        case models.CartWarningInsufficientStock:
+            line.Quantity = warning.Available
+            if err := s.CartRepo.UpdateItem(userID, &line); err != nil {
+                return err
+            }
+        case models.CartWarningPriceChanged:
+            if err := s.CartRepo.RepriceItem(userID, line.ID, warning.CurrentPrice); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,123 @@
+package services_test
+
+import (
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+func warningCodes(line models.Cart) []string {
+    var codes []string
+    for _, warning := range line.Warnings {
+        codes = append(codes, warning.Code)
+    }
+    return codes
+}
+
+func TestCartService_GetCartRevalidatesLines(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    hat := models.Product{Model: gorm.Model{ID: 2}, Name: "Hat", Price: 15, Stock: 5}
+    scarf := models.Product{Model: gorm.Model{ID: 3}, Name: "Scarf", Price: 10, Stock: 5}
+    products := newStubProductRepository(shirt, hat, scarf)
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, PriceAtAdd: 20, Product: shirt},
+        {ID: 2, UserID: 1, ProductID: 2, Quantity: 3, PriceAtAdd: 15, Product: hat},
+        {ID: 3, UserID: 1, ProductID: 3, Quantity: 1, PriceAtAdd: 10, Product: scarf},
+    }}
+    cartService := services.NewCartService(cartRepo, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+
+    cartItems, err := cartService.GetCart(1)
+    assert.NoError(t, err)
+    for _, line := range cartItems {
+        assert.Empty(t, line.Warnings)
+    }
+
+    // Test price changes, stock shortfalls and deleted products are flagged per line
+    products.products[1].Price = 25
+    products.products[2].Stock = 1
+    products.DeleteProduct(3)
+    cartItems, err = cartService.GetCart(1)
+    assert.NoError(t, err)
+    if assert.Len(t, cartItems, 3) {
+        assert.Equal(t, []string{models.CartWarningPriceChanged}, warningCodes(cartItems[0]))
+        assert.Equal(t, 20.0, cartItems[0].Warnings[0].PreviousPrice)
+        assert.Equal(t, 25.0, cartItems[0].Warnings[0].CurrentPrice)
+        assert.Equal(t, 25.0, cartItems[0].Product.Price)
+        assert.Equal(t, []string{models.CartWarningInsufficientStock}, warningCodes(cartItems[1]))
+        assert.Equal(t, 1, cartItems[1].Warnings[0].Available)
+        assert.Equal(t, []string{models.CartWarningProductRemoved}, warningCodes(cartItems[2]))
+    }
+
+    // Test sold out products and lines without a recorded price
+    products.products[2].Stock = 0
+    products.products[1].Price = 30
+    cartRepo.cartItems[0].PriceAtAdd = 0
+    cartItems, _ = cartService.GetCart(1)
+    assert.Empty(t, cartItems[0].Warnings)
+    assert.Equal(t, []string{models.CartWarningOutOfStock}, warningCodes(cartItems[1]))
+}
+
+func TestCartService_CheckoutRequiresAcknowledgedChanges(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 10}
+    hat := models.Product{Model: gorm.Model{ID: 2}, Name: "Hat", Price: 15, Stock: 5}
+    scarf := models.Product{Model: gorm.Model{ID: 3}, Name: "Scarf", Price: 10, Stock: 5}
+    products := newStubProductRepository(shirt, hat, scarf)
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2, PriceAtAdd: 20, Product: shirt},
+        {ID: 2, UserID: 1, ProductID: 2, Quantity: 3, PriceAtAdd: 15, Product: hat},
+        {ID: 3, UserID: 1, ProductID: 3, Quantity: 1, PriceAtAdd: 10, Product: scarf},
+    }}
+    cartService := services.NewCartService(cartRepo, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    addressRepo := &stubAddressRepository{addresses: []models.Address{
+        {ID: 1, UserID: 1, Name: "Ada", Line1: "1 Main St", City: "New York", Region: "NY", PostalCode: "10001", Country: "US", IsDefault: true},
+    }}
+    orderService := services.NewOrderService(&stubOrderRepository{}, addressRepo, cartService, nil, newTestLogger())
+    products.products[1].Price = 25
+    products.products[2].Stock = 1
+    products.DeleteProduct(3)
+
+    _, err := orderService.Checkout(1, 0, "")
+    assert.Equal(t, services.ErrCartChanged, err)
+
+    // Test acknowledging accepts the new price, trims the quantity and drops the gone product
+    cartItems, err := cartService.AcknowledgeCartChanges(1)
+    assert.NoError(t, err)
+    if assert.Len(t, cartItems, 2) {
+        assert.Equal(t, 25.0, cartItems[0].PriceAtAdd)
+        assert.Equal(t, 1, cartItems[1].Quantity)
+        for _, line := range cartItems {
+            assert.Empty(t, line.Warnings)
+        }
+    }
+    assert.Len(t, cartRepo.cartItems, 2)
+
+    order, err := orderService.Checkout(1, 0, "")
+    assert.NoError(t, err)
+    assert.Equal(t, 65.0, order.Subtotal)
+
+    // Test a price that changes again after acknowledging blocks checkout again
+    cartRepo.cartItems = []models.Cart{{ID: 4, UserID: 1, ProductID: 1, Quantity: 1, PriceAtAdd: 25}}
+    products.products[1].Price = 22
+    _, err = orderService.Checkout(1, 0, "")
+    assert.Equal(t, services.ErrCartChanged, err)
+}
+
+func TestCartService_AddToCartRecordsPrice(t *testing.T) {
+    products := newStubProductRepository(models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5})
+    service := services.NewCartService(&stubCartRepository{products: products}, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    service.SyncWrites = true
+
+    result, err := service.AddToCart(1, 1, 1)
+    assert.NoError(t, err)
+    assert.Equal(t, 20.0, result.Item.PriceAtAdd)
+
+    // Test adding more keeps the price recorded when the line was first added
+    products.products[1].Price = 18
+    result, err = service.AddToCart(1, 1, 1)
+    assert.NoError(t, err)
+    assert.Equal(t, 20.0, result.Item.PriceAtAdd)
+    assert.Equal(t, 2, result.Item.Quantity)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// CouponService handles coupon administration and redemption
+type CouponService struct {
+    CouponRepo repositories.CouponRepository
+    Logger     *logrus.Logger
+}
+
+// NewCouponService creates a new CouponService
+func NewCouponService(couponRepo repositories.CouponRepository, logger *logrus.Logger) *CouponService {
+    return &CouponService{
+        CouponRepo: couponRepo,
+        Logger:     logger,
+    }
+}
+
+// CreateCoupon validates and stores a new coupon; codes are stored upper-case
+func (s *CouponService) CreateCoupon(coupon *models.Coupon) error {
+    coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+    coupon.UsageCount = 0
+    if err := ValidateCouponDefinition(coupon); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "code":       coupon.Code,
+            "error":      err,
+            "error_code": "INVALID_COUPON",
+        }).Warn("Invalid coupon data")
+        return err
+    }
+    if err := s.CouponRepo.CreateCoupon(coupon); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "code":       coupon.Code,
+            "error":      err,
+            "error_code": "CREATE_COUPON_FAILED",
+        }).Error("Failed to create coupon")
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "coupon_id": coupon.ID,
+        "code":      coupon.Code,
+    }).Info("Created coupon")
+    return nil
+}
+
+// GetCoupons retrieves all coupons
+func (s *CouponService) GetCoupons() ([]models.Coupon, error) {
+    return s.CouponRepo.GetCoupons()
+}
+
+// GetCouponByID retrieves a coupon by ID
+func (s *CouponService) GetCouponByID(id uint) (*models.Coupon, error) {
+    coupon, err := s.CouponRepo.GetCouponByID(id)
+    if err != nil {
+        return nil, errors.Wrap(ErrCouponNotFound, err.Error())
+    }
+    return coupon, nil
+}
+
+// UpdateCoupon replaces a coupon's definition, keeping its usage count
+func (s *CouponService) UpdateCoupon(coupon *models.Coupon) error {
+    existing, err := s.CouponRepo.GetCouponByID(coupon.ID)
+    if err != nil {
+        return errors.Wrap(ErrCouponNotFound, err.Error())
+    }
+    coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+    coupon.CreatedAt = existing.CreatedAt
+    coupon.UsageCount = existing.UsageCount
+    if err := ValidateCouponDefinition(coupon); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "coupon_id":  coupon.ID,
+            "error":      err,
+            "error_code": "INVALID_COUPON",
+        }).Warn("Invalid coupon data")
+        return err
+    }
+    if err := s.CouponRepo.UpdateCoupon(coupon); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "coupon_id":  coupon.ID,
+            "error":      err,
+            "error_code": "UPDATE_COUPON_FAILED",
+        }).Error("Failed to update coupon")
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "coupon_id": coupon.ID,
+    }).Info("Updated coupon")
+    return nil
+}
+
+// DeleteCoupon deletes a coupon and detaches it from all carts
+func (s *CouponService) DeleteCoupon(id uint) error {
+    if _, err := s.CouponRepo.GetCouponByID(id); err != nil {
+        return errors.Wrap(ErrCouponNotFound, err.Error())
+    }
+    if err := s.CouponRepo.DeleteCoupon(id); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "coupon_id":  id,
+            "error":      err,
+            "error_code": "DELETE_COUPON_FAILED",
+        }).Error("Failed to delete coupon")
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "coupon_id": id,
+    }).Info("Deleted coupon")
+    return nil
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/redis/go-redis/v9"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// Guest cart error types
+var (
+    ErrInvalidGuestCart   = errors.New("invalid guest cart token")
+    ErrGuestCartFull      = errors.New("guest cart has too many lines")
+    ErrGuestCartsDisabled = errors.New("guest carts are not configured")
+)
+
+// maxGuestCartLines caps anonymous carts, which anyone can create
+const maxGuestCartLines = 50
+
+// GuestCartStore keeps anonymous carts as quantities keyed by product ID
+type GuestCartStore interface {
+    Items(cartID string) (map[uint]int, error)
+    SetItem(cartID string, productID uint, quantity int, ttl time.Duration) error
+    RemoveItem(cartID string, productID uint) (bool, error)
+    Delete(cartID string) error
+}
+
+// GuestCartTokens issues and checks guest cart tokens: a random cart ID and its HMAC,
+// so clients cannot guess or forge another shopper's cart
+type GuestCartTokens struct {
+    Secret []byte
+}
+
+// NewGuestCartTokens creates a new GuestCartTokens
+func NewGuestCartTokens(secret string) *GuestCartTokens {
+    return &GuestCartTokens{Secret: []byte(secret)}
+}
+
+// New returns a token for a fresh cart and the cart's ID
+func (t *GuestCartTokens) New() (string, string, error) {
+    cartID, err := randomHex(16)
+    if err != nil {
+        return "", "", err
+    }
+    return cartID + "." + t.sign(cartID), cartID, nil
+}
+
+// Verify returns the cart ID of a token issued by New
+func (t *GuestCartTokens) Verify(token string) (string, error) {
+    cartID, signature, ok := strings.Cut(token, ".")
+    if !ok || cartID == "" || !hmac.Equal([]byte(signature), []byte(t.sign(cartID))) {
+        return "", ErrInvalidGuestCart
+    }
+    return cartID, nil
+}
+
+func (t *GuestCartTokens) sign(cartID string) string {
+    mac := hmac.New(sha256.New, t.Secret)
+    mac.Write([]byte("guest_cart:" + cartID))
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewGuestCart issues a token for an empty guest cart. Nothing is stored until the
+// first item is added.
+func (s *CartService) NewGuestCart() (string, string, error) {
+    if s.GuestCarts == nil || s.GuestTokens == nil {
+        return "", "", ErrGuestCartsDisabled
+    }
+    return s.GuestTokens.New()
+}
+
+// GuestCartID checks a guest cart token and returns the cart ID it names
+func (s *CartService) GuestCartID(token string) (string, error) {
+    if s.GuestCarts == nil || s.GuestTokens == nil {
+        return "", ErrGuestCartsDisabled
+    }
+    return s.GuestTokens.Verify(token)
+}
+
+// AddToGuestCart adds quantity of a product to a guest cart, applying the same stock
+// and quantity rules as AddToCart. Repeated adds raise the line's quantity.
+func (s *CartService) AddToGuestCart(cartID string, productID uint, quantity int) error {
+    if quantity <= 0 {
+        return ErrInvalidQuantity
+    }
+    items, err := s.guestItems(cartID)
+    if err != nil {
+        return err
+    }
+    if _, ok := items[productID]; !ok && len(items) >= maxGuestCartLines {
+        return ErrGuestCartFull
+    }
+    return s.setGuestItem(cartID, productID, items[productID]+quantity)
+}
+
+// GetGuestCart returns a guest cart's lines with their products. Guest lines have no
+// row of their own, so each line's ID is its product ID. Products that no longer exist
+// are dropped from the cart; any other lookup failure fails the read and keeps the line.
+func (s *CartService) GetGuestCart(cartID string) ([]models.Cart, error) {
+    items, err := s.guestItems(cartID)
+    if err != nil {
+        return nil, err
+    }
+    productIDs := make([]uint, 0, len(items))
+    for productID := range items {
+        productIDs = append(productIDs, productID)
+    }
+    sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
+
+    cartItems := make([]models.Cart, 0, len(productIDs))
+    for _, productID := range productIDs {
+        product, err := s.ProductRepo.GetProductByID(productID)
+        if err == gorm.ErrRecordNotFound {
+            s.GuestCarts.RemoveItem(cartID, productID)
+            continue
+        }
+        if err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "product_id": productID,
+                "error":      err,
+                "error_code": "FETCH_CART_FAILED",
+            }).Error("Failed to fetch guest cart product")
+            return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+        }
+        cartItems = append(cartItems, models.Cart{
+            ID:        productID,
+            ProductID: productID,
+            Quantity:  items[productID],
+            Product:   *product,
+        })
+    }
+    return cartItems, nil
+}
+
+// GetGuestCartItem returns a single guest cart line
+func (s *CartService) GetGuestCartItem(cartID string, productID uint) (*models.Cart, error) {
+    cartItems, err := s.GetGuestCart(cartID)
+    if err != nil {
+        return nil, err
+    }
+    for i := range cartItems {
+        if cartItems[i].ProductID == productID {
+            return &cartItems[i], nil
+        }
+    }
+    return nil, ErrCartItemNotFound
+}
+
+// UpdateGuestCartItem sets the quantity of a line already in a guest cart
+func (s *CartService) UpdateGuestCartItem(cartID string, productID uint, quantity int) error {
+    items, err := s.guestItems(cartID)
+    if err != nil {
+        return err
+    }
+    if _, ok := items[productID]; !ok {
+        return ErrCartItemNotFound
+    }
+    if quantity <= 0 {
+        return ErrInvalidQuantity
+    }
+    return s.setGuestItem(cartID, productID, quantity)
+}
+
+// DeleteGuestCartItem removes a line from a guest cart
+func (s *CartService) DeleteGuestCartItem(cartID string, productID uint) error {
+    if s.GuestCarts == nil {
+        return ErrGuestCartsDisabled
+    }
+    removed, err := s.GuestCarts.RemoveItem(cartID, productID)
+    if err != nil {
+        return errors.Wrap(ErrDeleteCartFailed, err.Error())
+    }
+    if !removed {
+        return ErrCartItemNotFound
+    }
+    return nil
+}
+
+// GetGuestCartSummary is GetCartSummary for a guest cart. Coupons need an account, so
+// guest summaries never carry discounts.
+func (s *CartService) GetGuestCartSummary(cartID string, address *TaxAddress, shippingMethod string) (*CartSummary, error) {
+    cartItems, err := s.GetGuestCart(cartID)
+    if err != nil {
+        return nil, err
+    }
+    return s.summarize(cartItems, nil, address, shippingMethod, logrus.Fields{"guest_cart": true})
+}
+
+// MergeGuestCart moves a guest cart into the user's cart after they log in or
+// register. Each line goes through CartRepo.AddItemQuantityUpToStock, so quantities for
+// a product already in the user's cart are added together, duplicate lines are folded
+// into one, and the line is capped at the stock on hand. Lines for products that are
+// gone or sold out are dropped. Every guest line is removed as soon as it is merged, so
+// a merge that fails part-way can be retried without adding lines twice; the guest cart
+// is deleted afterwards.
+func (s *CartService) MergeGuestCart(cartID string, userID uint) error {
+    items, err := s.guestItems(cartID)
+    if err != nil {
+        return err
+    }
+    if len(items) == 0 {
+        return nil
+    }
+
+    // Merging in product order locks products in the same order as any concurrent merge
+    productIDs := make([]uint, 0, len(items))
+    for productID := range items {
+        productIDs = append(productIDs, productID)
+    }
+    sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
+    merged := 0
+    for _, productID := range productIDs {
+        _, err := s.CartRepo.AddItemQuantityUpToStock(userID, productID, items[productID])
+        switch err {
+        case nil:
+            merged++
+        case gorm.ErrRecordNotFound, repositories.ErrCartQuantityExceedsStock:
+            // The product is gone or sold out
+        default:
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    userID,
+                "product_id": productID,
+                "error":      err,
+                "error_code": "MERGE_CART_FAILED",
+            }).Error("Failed to merge guest cart line")
+            s.invalidateCache(userID)
+            return errors.Wrap(ErrUpdateCartFailed, err.Error())
+        }
+        if _, err := s.GuestCarts.RemoveItem(cartID, productID); err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    userID,
+                "product_id": productID,
+                "error":      err,
+                "error_code": "MERGE_CART_FAILED",
+            }).Error("Failed to remove merged guest cart line")
+            s.invalidateCache(userID)
+            return errors.Wrap(ErrUpdateCartFailed, err.Error())
+        }
+    }
+
+    if err := s.GuestCarts.Delete(cartID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "DELETE_GUEST_CART_FAILED",
+        }).Warn("Failed to delete merged guest cart")
+    }
+    s.invalidateCache(userID)
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": userID,
+        "lines":   merged,
+        "dropped": len(items) - merged,
+    }).Info("Merged guest cart")
+    return nil
+}
+
+func (s *CartService) guestItems(cartID string) (map[uint]int, error) {
+    if s.GuestCarts == nil {
+        return nil, ErrGuestCartsDisabled
+    }
+    items, err := s.GuestCarts.Items(cartID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "FETCH_CART_FAILED",
+        }).Error("Failed to fetch guest cart")
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+    return items, nil
+}
+
+func (s *CartService) setGuestItem(cartID string, productID uint, quantity int) error {
+    product, err := s.ProductRepo.GetProductByID(productID)
+    if err != nil {
+        return errors.Wrap(ErrProductNotFound, err.Error())
+    }
+    if product.Stock < quantity {
+        return ErrInsufficientStock
+    }
+    if err := s.GuestCarts.SetItem(cartID, productID, quantity, s.GuestCartTTL); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "product_id": productID,
+            "error":      err,
+            "error_code": "UPDATE_CART_FAILED",
+        }).Error("Failed to update guest cart")
+        return errors.Wrap(ErrUpdateCartFailed, err.Error())
+    }
+    return nil
+}
+
+// RedisGuestCartStore keeps guest carts in Redis hashes of product ID to quantity.
+// Every write pushes the expiry back, so carts in use do not lapse.
+type RedisGuestCartStore struct {
+    Client *redis.Client
+}
+
+// NewRedisGuestCartStore creates a new RedisGuestCartStore
+func NewRedisGuestCartStore(client *redis.Client) *RedisGuestCartStore {
+    return &RedisGuestCartStore{Client: client}
+}
+
+func (s *RedisGuestCartStore) Items(cartID string) (map[uint]int, error) {
+    values, err := s.Client.HGetAll(context.Background(), guestCartKey(cartID)).Result()
+    if err != nil {
+        return nil, err
+    }
+    items := make(map[uint]int, len(values))
+    for field, value := range values {
+        productID, err := strconv.ParseUint(field, 10, 32)
+        if err != nil {
+            continue
+        }
+        quantity, err := strconv.Atoi(value)
+        if err != nil || quantity <= 0 {
+            continue
+        }
+        items[uint(productID)] = quantity
+    }
+    return items, nil
+}
+
+func (s *RedisGuestCartStore) SetItem(cartID string, productID uint, quantity int, ttl time.Duration) error {
+    ctx := context.Background()
+    pipe := s.Client.TxPipeline()
+    pipe.HSet(ctx, guestCartKey(cartID), strconv.FormatUint(uint64(productID), 10), quantity)
+    pipe.Expire(ctx, guestCartKey(cartID), ttl)
+    _, err := pipe.Exec(ctx)
+    return err
+}
+
+func (s *RedisGuestCartStore) RemoveItem(cartID string, productID uint) (bool, error) {
+    removed, err := s.Client.HDel(context.Background(), guestCartKey(cartID), strconv.FormatUint(uint64(productID), 10)).Result()
+    return removed > 0, err
+}
+
+func (s *RedisGuestCartStore) Delete(cartID string) error {
+    return s.Client.Del(context.Background(), guestCartKey(cartID)).Err()
+}
+
+func guestCartKey(cartID string) string { return "guest_cart:" + cartID }
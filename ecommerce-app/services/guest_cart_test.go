@@ -0,0 +1,211 @@
+package services_test
+
+import (
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubGuestCartStore keeps guest carts in memory
+type stubGuestCartStore struct {
+    carts map[string]map[uint]int
+    ttl   time.Duration
+}
+
+func (s *stubGuestCartStore) Items(cartID string) (map[uint]int, error) {
+    items := make(map[uint]int)
+    for productID, quantity := range s.carts[cartID] {
+        items[productID] = quantity
+    }
+    return items, nil
+}
+
+func (s *stubGuestCartStore) SetItem(cartID string, productID uint, quantity int, ttl time.Duration) error {
+    if s.carts[cartID] == nil {
+        s.carts[cartID] = make(map[uint]int)
+    }
+    s.carts[cartID][productID] = quantity
+    s.ttl = ttl
+    return nil
+}
+
+func (s *stubGuestCartStore) RemoveItem(cartID string, productID uint) (bool, error) {
+    _, ok := s.carts[cartID][productID]
+    delete(s.carts[cartID], productID)
+    return ok, nil
+}
+
+func (s *stubGuestCartStore) Delete(cartID string) error {
+    delete(s.carts, cartID)
+    return nil
+}
+
+func TestGuestCartTokens(t *testing.T) {
+    tokens := services.NewGuestCartTokens("guest-cart-secret")
+    token, cartID, err := tokens.New()
+    assert.NoError(t, err)
+
+    verified, err := tokens.Verify(token)
+    assert.NoError(t, err)
+    assert.Equal(t, cartID, verified)
+
+    // Test tokens cannot be forged or moved to another secret
+    _, err = tokens.Verify(cartID + ".forged")
+    assert.Equal(t, services.ErrInvalidGuestCart, err)
+    _, err = tokens.Verify(cartID)
+    assert.Equal(t, services.ErrInvalidGuestCart, err)
+    _, err = services.NewGuestCartTokens("other-secret").Verify(token)
+    assert.Equal(t, services.ErrInvalidGuestCart, err)
+}
+
+func TestCartService_GuestCart(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5}
+    hat := models.Product{Model: gorm.Model{ID: 2}, Name: "Hat", Price: 15, Stock: 1}
+    products := newStubProductRepository(shirt, hat)
+    store := &stubGuestCartStore{carts: make(map[string]map[uint]int)}
+    service := services.NewCartService(&stubCartRepository{products: products}, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    service.GuestCarts = store
+    service.GuestTokens = services.NewGuestCartTokens("guest-cart-secret")
+    service.GuestCartTTL = 24 * time.Hour
+    _, cartID, err := service.NewGuestCart()
+    assert.NoError(t, err)
+
+    // Test guests get the same quantity and stock rules as users
+    assert.Equal(t, services.ErrInvalidQuantity, service.AddToGuestCart(cartID, 1, 0))
+    assert.Equal(t, services.ErrProductNotFound, errors.Cause(service.AddToGuestCart(cartID, 99, 1)))
+    assert.NoError(t, service.AddToGuestCart(cartID, 1, 2))
+    assert.NoError(t, service.AddToGuestCart(cartID, 1, 3))
+    assert.Equal(t, services.ErrInsufficientStock, service.AddToGuestCart(cartID, 1, 1))
+    assert.NoError(t, service.AddToGuestCart(cartID, 2, 1))
+    assert.Equal(t, 24*time.Hour, store.ttl)
+
+    cartItems, err := service.GetGuestCart(cartID)
+    assert.NoError(t, err)
+    if assert.Len(t, cartItems, 2) {
+        assert.Equal(t, uint(1), cartItems[0].ID)
+        assert.Equal(t, 5, cartItems[0].Quantity)
+        assert.Equal(t, "Shirt", cartItems[0].Product.Name)
+        assert.Equal(t, uint(2), cartItems[1].ProductID)
+    }
+
+    summary, err := service.GetGuestCartSummary(cartID, nil, "")
+    assert.NoError(t, err)
+    assert.Equal(t, 115.0, summary.Subtotal)
+
+    assert.NoError(t, service.UpdateGuestCartItem(cartID, 1, 2))
+    assert.Equal(t, services.ErrInsufficientStock, service.UpdateGuestCartItem(cartID, 2, 2))
+    assert.Equal(t, services.ErrCartItemNotFound, service.UpdateGuestCartItem(cartID, 3, 1))
+    assert.NoError(t, service.DeleteGuestCartItem(cartID, 2))
+    assert.Equal(t, services.ErrCartItemNotFound, service.DeleteGuestCartItem(cartID, 2))
+
+    item, err := service.GetGuestCartItem(cartID, 1)
+    assert.NoError(t, err)
+    assert.Equal(t, 2, item.Quantity)
+
+    // Test guest carts are separate from each other
+    _, otherID, _ := service.NewGuestCart()
+    cartItems, _ = service.GetGuestCart(otherID)
+    assert.Empty(t, cartItems)
+}
+
+// unavailableProductRepository fails every product lookup as a database outage would
+type unavailableProductRepository struct {
+    *stubProductRepository
+}
+
+func (m unavailableProductRepository) GetProductByID(id uint) (*models.Product, error) {
+    return nil, errors.New("connection refused")
+}
+
+func TestCartService_GuestCartKeepsLinesOnLookupFailure(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5}
+    products := newStubProductRepository(shirt)
+    store := &stubGuestCartStore{carts: make(map[string]map[uint]int)}
+    service := services.NewCartService(&stubCartRepository{products: products}, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    service.GuestCarts = store
+    service.GuestTokens = services.NewGuestCartTokens("guest-cart-secret")
+    service.GuestCartTTL = 24 * time.Hour
+    _, cartID, _ := service.NewGuestCart()
+    assert.NoError(t, service.AddToGuestCart(cartID, 1, 2))
+
+    // Test an outage fails the read without emptying the cart
+    service.ProductRepo = unavailableProductRepository{products}
+    _, err := service.GetGuestCart(cartID)
+    assert.Equal(t, services.ErrFetchCartFailed, errors.Cause(err))
+    assert.Equal(t, 2, store.carts[cartID][1])
+
+    // Test deleted products are still dropped
+    service.ProductRepo = products
+    products.DeleteProduct(1)
+    cartItems, err := service.GetGuestCart(cartID)
+    assert.NoError(t, err)
+    assert.Empty(t, cartItems)
+    assert.Empty(t, store.carts[cartID])
+}
+
+func TestCartService_MergeGuestCart(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5}
+    hat := models.Product{Model: gorm.Model{ID: 2}, Name: "Hat", Price: 15, Stock: 3}
+    scarf := models.Product{Model: gorm.Model{ID: 3}, Name: "Scarf", Price: 10, Stock: 0}
+    products := newStubProductRepository(shirt, hat, scarf)
+    cartRepo := &stubCartRepository{products: products, cartItems: []models.Cart{
+        {ID: 1, UserID: 1, ProductID: 1, Quantity: 2},
+        {ID: 2, UserID: 1, ProductID: 1, Quantity: 1},
+        {ID: 3, UserID: 2, ProductID: 1, Quantity: 1},
+    }}
+    store := &stubGuestCartStore{carts: make(map[string]map[uint]int)}
+    service := services.NewCartService(cartRepo, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    service.GuestCarts = store
+    store.carts["guest"] = map[uint]int{1: 4, 2: 2, 3: 1, 99: 1}
+
+    assert.NoError(t, service.MergeGuestCart("guest", 1))
+
+    userItems, _ := cartRepo.GetCartByUserID(1)
+    quantities := make(map[uint]int)
+    for _, item := range userItems {
+        quantities[item.ProductID] += item.Quantity
+    }
+    // Test duplicate lines are folded into one and capped at the stock on hand
+    assert.Len(t, userItems, 2)
+    assert.Equal(t, map[uint]int{1: 5, 2: 2}, quantities)
+    // Test other users' carts are untouched and the guest cart is gone
+    otherItems, _ := cartRepo.GetCartByUserID(2)
+    assert.Equal(t, 1, otherItems[0].Quantity)
+    assert.NotContains(t, store.carts, "guest")
+
+    // Test merging an empty or already merged cart is a no-op
+    assert.NoError(t, service.MergeGuestCart("guest", 1))
+    userItems, _ = cartRepo.GetCartByUserID(1)
+    assert.Len(t, userItems, 2)
+}
+
+func TestCartService_MergeGuestCartRetry(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5}
+    hat := models.Product{Model: gorm.Model{ID: 2}, Name: "Hat", Price: 15, Stock: 3}
+    products := newStubProductRepository(shirt, hat)
+    cartRepo := &stubCartRepository{products: products, cartItems: []models.Cart{{ID: 1, UserID: 1, ProductID: 1, Quantity: 1}}}
+    store := &stubGuestCartStore{carts: make(map[string]map[uint]int)}
+    service := services.NewCartService(cartRepo, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    service.GuestCarts = store
+    store.carts["guest"] = map[uint]int{1: 2, 2: 2}
+
+    // Test a merge that fails part-way keeps only the lines it did not merge
+    cartRepo.failProduct = 2
+    assert.Equal(t, services.ErrUpdateCartFailed, errors.Cause(service.MergeGuestCart("guest", 1)))
+    assert.Equal(t, map[uint]int{2: 2}, store.carts["guest"])
+    assert.Len(t, cartRepo.cartItems, 1)
+
+    // Test retrying adds each guest line once
+    assert.NoError(t, service.MergeGuestCart("guest", 1))
+    quantities := make(map[uint]int)
+    for _, item := range cartRepo.cartItems {
+        quantities[item.ProductID] += item.Quantity
+    }
+    assert.Equal(t, map[uint]int{1: 3, 2: 2}, quantities)
+    assert.NotContains(t, store.carts, "guest")
+}
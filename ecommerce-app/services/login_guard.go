@@ -0,0 +1,268 @@
+package services
+
+import (
+    "context"
+    "strings"
+    "time"
+
+    "github.com/pkg/errors"
+    "github.com/redis/go-redis/v9"
+    "github.com/sirupsen/logrus"
+)
+
+// Login guard error types
+var (
+    ErrAccountLocked  = errors.New("account temporarily locked after too many failed logins")
+    ErrLoginThrottled = errors.New("too many login attempts; try again later")
+)
+
+// Security events reported by the login guard
+const (
+    SecurityEventLoginFailed     = "login_failed"
+    SecurityEventLoginSucceeded  = "login_succeeded"
+    SecurityEventLoginThrottled  = "login_throttled"
+    SecurityEventAccountLocked   = "account_locked"
+    SecurityEventAccountUnlocked = "account_unlocked"
+)
+
+// LoginAttemptStore holds the short-lived counters and locks used by LoginGuard
+type LoginAttemptStore interface {
+    // Increment adds one to key, starting a window-long expiry on first use
+    Increment(key string, window time.Duration) (int64, error)
+    // Mark sets key for ttl
+    Mark(key string, ttl time.Duration) error
+    // TTL returns how long key has left, or 0 when it is not set
+    TTL(key string) (time.Duration, error)
+    Delete(keys ...string) error
+}
+
+// LockoutNotifier tells a user their account was locked. AccountService implements it.
+type LockoutNotifier interface {
+    NotifyLockout(username string) error
+}
+
+// SecurityEventRecorder counts security events for metrics
+type SecurityEventRecorder interface {
+    RecordSecurityEvent(event string)
+}
+
+// LoginGuardPolicy configures throttling. Each failure makes the next attempt for the
+// same username or IP wait BaseDelay, doubling per failure up to MaxDelay.
+type LoginGuardPolicy struct {
+    MaxUserFailures int           // failures in Window that lock the username
+    MaxIPFailures   int           // failures in Window that block the IP
+    Window          time.Duration // how long failures are remembered
+    LockoutDuration time.Duration
+    BaseDelay       time.Duration
+    MaxDelay        time.Duration
+}
+
+// LoginGuard protects login against brute-force and credential-stuffing attempts.
+// Counters live in the store, so limits hold across application instances. When the
+// store is unavailable the guard fails open and logs, rather than blocking all logins.
+type LoginGuard struct {
+    Store    LoginAttemptStore
+    Policy   LoginGuardPolicy
+    Notifier LockoutNotifier       // optional
+    Metrics  SecurityEventRecorder // optional
+    Logger   *logrus.Logger
+}
+
+// NewLoginGuard creates a new LoginGuard
+func NewLoginGuard(store LoginAttemptStore, policy LoginGuardPolicy, logger *logrus.Logger) *LoginGuard {
+    return &LoginGuard{
+        Store:  store,
+        Policy: policy,
+        Logger: logger,
+    }
+}
+
+// Check reports whether a login attempt may proceed. When it may not, the returned
+// duration is how long the client should wait.
+func (g *LoginGuard) Check(username, ip string) (time.Duration, error) {
+    user := normalizeUsername(username)
+    if wait := g.ttl(lockKey(user)); wait > 0 {
+        g.record(SecurityEventLoginThrottled, logrus.Fields{"username": user, "ip": ip, "reason": "locked"})
+        return wait, ErrAccountLocked
+    }
+    for _, key := range []string{waitKey("user", user), waitKey("ip", ip), blockKey(ip)} {
+        if wait := g.ttl(key); wait > 0 {
+            g.record(SecurityEventLoginThrottled, logrus.Fields{"username": user, "ip": ip, "reason": key})
+            return wait, ErrLoginThrottled
+        }
+    }
+    return 0, nil
+}
+
+// RecordFailure counts a failed login for the username and IP, delaying the next
+// attempt and locking the username once it reaches the limit. Unknown usernames are
+// counted too so responses do not reveal which accounts exist.
+func (g *LoginGuard) RecordFailure(username, ip string) {
+    user := normalizeUsername(username)
+    userFailures := g.increment(failKey("user", user))
+    ipFailures := g.increment(failKey("ip", ip))
+    g.record(SecurityEventLoginFailed, logrus.Fields{
+        "username":      user,
+        "ip":            ip,
+        "user_failures": userFailures,
+        "ip_failures":   ipFailures,
+    })
+
+    g.mark(waitKey("user", user), g.delay(userFailures))
+    g.mark(waitKey("ip", ip), g.delay(ipFailures))
+    if g.Policy.MaxIPFailures > 0 && ipFailures >= int64(g.Policy.MaxIPFailures) {
+        g.mark(blockKey(ip), g.Policy.Window)
+    }
+
+    if g.Policy.MaxUserFailures > 0 && userFailures >= int64(g.Policy.MaxUserFailures) {
+        g.mark(lockKey(user), g.Policy.LockoutDuration)
+        g.clear(failKey("user", user))
+        g.record(SecurityEventAccountLocked, logrus.Fields{"username": user, "ip": ip})
+        if g.Notifier != nil {
+            if err := g.Notifier.NotifyLockout(username); err != nil {
+                g.Logger.WithFields(logrus.Fields{
+                    "username":   user,
+                    "error":      err,
+                    "error_code": "LOCKOUT_NOTIFY_FAILED",
+                }).Warn("Failed to send account unlock email")
+            }
+        }
+    }
+}
+
+// RecordSuccess resets the username's failure count. The IP count is kept so one
+// valid account cannot be used to reset limits while stuffing others.
+func (g *LoginGuard) RecordSuccess(username, ip string) {
+    user := normalizeUsername(username)
+    g.clear(failKey("user", user), waitKey("user", user))
+    g.record(SecurityEventLoginSucceeded, logrus.Fields{"username": user, "ip": ip})
+}
+
+// Unlock lifts a lockout early, as when the user follows the unlock email
+func (g *LoginGuard) Unlock(username string) error {
+    user := normalizeUsername(username)
+    if err := g.Store.Delete(lockKey(user), failKey("user", user), waitKey("user", user)); err != nil {
+        return err
+    }
+    g.record(SecurityEventAccountUnlocked, logrus.Fields{"username": user})
+    return nil
+}
+
+// delay is the wait imposed after the nth consecutive failure
+func (g *LoginGuard) delay(failures int64) time.Duration {
+    if failures <= 0 || g.Policy.BaseDelay <= 0 {
+        return 0
+    }
+    delay := g.Policy.BaseDelay
+    for i := int64(1); i < failures && delay < g.Policy.MaxDelay; i++ {
+        delay *= 2
+    }
+    if g.Policy.MaxDelay > 0 && delay > g.Policy.MaxDelay {
+        delay = g.Policy.MaxDelay
+    }
+    return delay
+}
+
+func (g *LoginGuard) record(event string, fields logrus.Fields) {
+    fields["security_event"] = event
+    entry := g.Logger.WithFields(fields)
+    switch event {
+    case SecurityEventLoginSucceeded, SecurityEventAccountUnlocked:
+        entry.Info("Security event")
+    default:
+        entry.Warn("Security event")
+    }
+    if g.Metrics != nil {
+        g.Metrics.RecordSecurityEvent(event)
+    }
+}
+
+func (g *LoginGuard) ttl(key string) time.Duration {
+    wait, err := g.Store.TTL(key)
+    if err != nil {
+        g.storeFailed(err)
+        return 0
+    }
+    return wait
+}
+
+func (g *LoginGuard) increment(key string) int64 {
+    n, err := g.Store.Increment(key, g.Policy.Window)
+    if err != nil {
+        g.storeFailed(err)
+    }
+    return n
+}
+
+func (g *LoginGuard) mark(key string, ttl time.Duration) {
+    if ttl <= 0 {
+        return
+    }
+    if err := g.Store.Mark(key, ttl); err != nil {
+        g.storeFailed(err)
+    }
+}
+
+func (g *LoginGuard) clear(keys ...string) {
+    if err := g.Store.Delete(keys...); err != nil {
+        g.storeFailed(err)
+    }
+}
+
+func (g *LoginGuard) storeFailed(err error) {
+    g.Logger.WithFields(logrus.Fields{
+        "error":      err,
+        "error_code": "LOGIN_GUARD_STORE_FAILED",
+    }).Error("Login attempt store unavailable; not throttling")
+}
+
+func normalizeUsername(username string) string {
+    return strings.ToLower(strings.TrimSpace(username))
+}
+
+func failKey(scope, id string) string { return "login_fail:" + scope + ":" + id }
+func waitKey(scope, id string) string { return "login_wait:" + scope + ":" + id }
+func lockKey(user string) string      { return "login_lock:user:" + user }
+func blockKey(ip string) string       { return "login_block:ip:" + ip }
+
+// RedisLoginAttemptStore keeps login attempt state in Redis
+type RedisLoginAttemptStore struct {
+    Client *redis.Client
+}
+
+// NewRedisLoginAttemptStore creates a new RedisLoginAttemptStore
+func NewRedisLoginAttemptStore(client *redis.Client) *RedisLoginAttemptStore {
+    return &RedisLoginAttemptStore{Client: client}
+}
+
+// Increment adds one to key; the expiry is only set by the first failure so the
+// window is not extended by every attempt
+func (s *RedisLoginAttemptStore) Increment(key string, window time.Duration) (int64, error) {
+    ctx := context.Background()
+    pipe := s.Client.TxPipeline()
+    incr := pipe.Incr(ctx, key)
+    pipe.ExpireNX(ctx, key, window)
+    if _, err := pipe.Exec(ctx); err != nil {
+        return 0, err
+    }
+    return incr.Val(), nil
+}
+
+func (s *RedisLoginAttemptStore) Mark(key string, ttl time.Duration) error {
+    return s.Client.Set(context.Background(), key, 1, ttl).Err()
+}
+
+func (s *RedisLoginAttemptStore) TTL(key string) (time.Duration, error) {
+    ttl, err := s.Client.PTTL(context.Background(), key).Result()
+    if err != nil {
+        return 0, err
+    }
+    if ttl < 0 {
+        return 0, nil
+    }
+    return ttl, nil
+}
+
+func (s *RedisLoginAttemptStore) Delete(keys ...string) error {
+    return s.Client.Del(context.Background(), keys...).Err()
+}
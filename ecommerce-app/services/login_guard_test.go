@@ -0,0 +1,215 @@
+package services_test
+
+import (
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/stretchr/testify/assert"
+)
+
+// stubLoginAttemptStore keeps counters in memory with real expiry times
+type stubLoginAttemptStore struct {
+    counts  map[string]int64
+    expires map[string]time.Time
+    down    bool
+}
+
+func newStubLoginAttemptStore() *stubLoginAttemptStore {
+    return &stubLoginAttemptStore{counts: map[string]int64{}, expires: map[string]time.Time{}}
+}
+
+func (s *stubLoginAttemptStore) Increment(key string, window time.Duration) (int64, error) {
+    if s.down {
+        return 0, errors.New("store down")
+    }
+    if _, ok := s.expires[key]; !ok {
+        s.expires[key] = time.Now().Add(window)
+    }
+    s.counts[key]++
+    return s.counts[key], nil
+}
+
+func (s *stubLoginAttemptStore) Mark(key string, ttl time.Duration) error {
+    if s.down {
+        return errors.New("store down")
+    }
+    s.counts[key] = 1
+    s.expires[key] = time.Now().Add(ttl)
+    return nil
+}
+
+func (s *stubLoginAttemptStore) TTL(key string) (time.Duration, error) {
+    if s.down {
+        return 0, errors.New("store down")
+    }
+    expires, ok := s.expires[key]
+    if !ok || time.Now().After(expires) {
+        return 0, nil
+    }
+    return time.Until(expires), nil
+}
+
+func (s *stubLoginAttemptStore) Delete(keys ...string) error {
+    for _, key := range keys {
+        delete(s.counts, key)
+        delete(s.expires, key)
+    }
+    return nil
+}
+
+// expireWaits makes every wait elapse, as if the client had respected Retry-After
+func (s *stubLoginAttemptStore) expireWaits() {
+    for key := range s.expires {
+        if strings.HasPrefix(key, "login_wait:") {
+            delete(s.expires, key)
+        }
+    }
+}
+
+// stubLockoutNotifier records locked usernames
+type stubLockoutNotifier struct {
+    locked []string
+}
+
+func (n *stubLockoutNotifier) NotifyLockout(username string) error {
+    n.locked = append(n.locked, username)
+    return nil
+}
+
+// stubSecurityMetrics counts recorded events
+type stubSecurityMetrics map[string]int
+
+func (m stubSecurityMetrics) RecordSecurityEvent(event string) {
+    m[event]++
+}
+
+// testLoginGuardPolicy locks a username after 3 failures and an IP after 5
+var testLoginGuardPolicy = services.LoginGuardPolicy{
+    MaxUserFailures: 3,
+    MaxIPFailures:   5,
+    Window:          15 * time.Minute,
+    LockoutDuration: 15 * time.Minute,
+    BaseDelay:       time.Second,
+    MaxDelay:        4 * time.Second,
+}
+
+func TestLoginGuard_ProgressiveDelayAndLockout(t *testing.T) {
+    store := newStubLoginAttemptStore()
+    guard := services.NewLoginGuard(store, testLoginGuardPolicy, newTestLogger())
+    notifier := &stubLockoutNotifier{}
+    metrics := stubSecurityMetrics{}
+    guard.Notifier = notifier
+    guard.Metrics = metrics
+
+    _, err := guard.Check("Ann", "10.0.0.1")
+    assert.NoError(t, err)
+
+    // Test each failure delays the next attempt, doubling the wait
+    guard.RecordFailure("Ann", "10.0.0.1")
+    wait, err := guard.Check("ann", "10.0.0.2")
+    assert.Equal(t, services.ErrLoginThrottled, err)
+    assert.InDelta(t, time.Second.Seconds(), wait.Seconds(), 0.1)
+
+    store.expireWaits()
+    guard.RecordFailure("ann", "10.0.0.1")
+    wait, _ = guard.Check("ann", "10.0.0.2")
+    assert.InDelta(t, (2 * time.Second).Seconds(), wait.Seconds(), 0.1)
+
+    // Test reaching the limit locks the username and mails its owner
+    store.expireWaits()
+    guard.RecordFailure("ann", "10.0.0.1")
+    store.expireWaits()
+    wait, err = guard.Check("ann", "10.0.0.9")
+    assert.Equal(t, services.ErrAccountLocked, err)
+    assert.InDelta(t, (15 * time.Minute).Seconds(), wait.Seconds(), 1)
+    assert.Equal(t, []string{"ann"}, notifier.locked)
+    assert.Equal(t, 3, metrics[services.SecurityEventLoginFailed])
+    assert.Equal(t, 1, metrics[services.SecurityEventAccountLocked])
+
+    // Test other usernames from another IP are unaffected
+    _, err = guard.Check("bob", "10.0.0.9")
+    assert.NoError(t, err)
+
+    assert.NoError(t, guard.Unlock("ANN"))
+    _, err = guard.Check("ann", "10.0.0.9")
+    assert.NoError(t, err)
+}
+
+func TestLoginGuard_BlocksIPAcrossUsernames(t *testing.T) {
+    store := newStubLoginAttemptStore()
+    guard := services.NewLoginGuard(store, testLoginGuardPolicy, newTestLogger())
+    notifier := &stubLockoutNotifier{}
+    guard.Notifier = notifier
+
+    for _, username := range []string{"a", "b", "c", "d", "e"} {
+        guard.RecordFailure(username, "10.0.0.1")
+        store.expireWaits()
+    }
+    _, err := guard.Check("f", "10.0.0.1")
+    assert.Equal(t, services.ErrLoginThrottled, err)
+    _, err = guard.Check("f", "10.0.0.2")
+    assert.NoError(t, err)
+    assert.Empty(t, notifier.locked)
+}
+
+func TestLoginGuard_SuccessResetsUserFailures(t *testing.T) {
+    store := newStubLoginAttemptStore()
+    guard := services.NewLoginGuard(store, testLoginGuardPolicy, newTestLogger())
+    notifier := &stubLockoutNotifier{}
+    guard.Notifier = notifier
+
+    guard.RecordFailure("ann", "10.0.0.1")
+    guard.RecordFailure("ann", "10.0.0.1")
+    guard.RecordSuccess("ann", "10.0.0.1")
+    store.expireWaits()
+    guard.RecordFailure("ann", "10.0.0.1")
+    store.expireWaits()
+
+    _, err := guard.Check("ann", "10.0.0.1")
+    assert.NoError(t, err)
+    assert.Empty(t, notifier.locked)
+}
+
+func TestLoginGuard_FailsOpenWhenStoreIsDown(t *testing.T) {
+    store := newStubLoginAttemptStore()
+    guard := services.NewLoginGuard(store, testLoginGuardPolicy, newTestLogger())
+    store.down = true
+
+    guard.RecordFailure("ann", "10.0.0.1")
+    _, err := guard.Check("ann", "10.0.0.1")
+    assert.NoError(t, err)
+}
+
+func TestAccountService_UnlockAccount(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    mailer := &stubMailer{}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    service := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, mailer, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    store := newStubLoginAttemptStore()
+    guard := services.NewLoginGuard(store, testLoginGuardPolicy, newTestLogger())
+    guard.Notifier = service
+    service.Unlocker = guard
+
+    for i := 0; i < 3; i++ {
+        guard.RecordFailure("ann", "10.0.0.1")
+        store.expireWaits()
+    }
+    _, err := guard.Check("ann", "10.0.0.1")
+    assert.Equal(t, services.ErrAccountLocked, err)
+    assert.Len(t, mailer.sent, 1)
+    assert.Contains(t, mailer.sent[0].Body, "https://shop.example/unlock-account?token=")
+
+    token := mailedToken(t, mailer.sent[0])
+    assert.NoError(t, service.UnlockAccount(token))
+    _, err = guard.Check("ann", "10.0.0.1")
+    assert.NoError(t, err)
+    assert.Equal(t, services.ErrInvalidUserToken, service.UnlockAccount(token))
+
+    // Test lockouts of usernames without an account send nothing
+    assert.NoError(t, service.NotifyLockout("nobody"))
+    assert.Len(t, mailer.sent, 1)
+}
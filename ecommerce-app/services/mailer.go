@@ -0,0 +1,106 @@
+package services
+
+import (
+    "fmt"
+    "net"
+    "net/smtp"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/sirupsen/logrus"
+)
+
+// Email is a plain-text message sent to one recipient
+type Email struct {
+    To      string
+    Subject string
+    Body    string
+}
+
+// Mailer delivers transactional email
+type Mailer interface {
+    Send(email Email) error
+}
+
+// SMTPMailer sends email through an SMTP relay, authenticating when a username is set
+type SMTPMailer struct {
+    Host     string
+    Port     int
+    Username string
+    Password string
+    From     string
+}
+
+// NewSMTPMailer creates a new SMTPMailer
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+    return &SMTPMailer{
+        Host:     host,
+        Port:     port,
+        Username: username,
+        Password: password,
+        From:     from,
+    }
+}
+
+// Send delivers the email
+func (m *SMTPMailer) Send(email Email) error {
+    var auth smtp.Auth
+    if m.Username != "" {
+        auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+    }
+    addr := net.JoinHostPort(m.Host, fmt.Sprint(m.Port))
+    return smtp.SendMail(addr, auth, m.From, []string{email.To}, formatEmail(m.From, email))
+}
+
+// LogMailer is the development mailer. It logs each message and, when Dir is set,
+// also writes it to Dir as an .eml file that mail clients can open.
+type LogMailer struct {
+    From   string
+    Dir    string
+    Logger *logrus.Logger
+}
+
+// NewLogMailer creates a new LogMailer
+func NewLogMailer(from, dir string, logger *logrus.Logger) *LogMailer {
+    return &LogMailer{From: from, Dir: dir, Logger: logger}
+}
+
+// Send records the email instead of delivering it
+func (m *LogMailer) Send(email Email) error {
+    m.Logger.WithFields(logrus.Fields{
+        "to":      email.To,
+        "subject": email.Subject,
+        "body":    email.Body,
+    }).Info("Email sent to log mailer")
+    if m.Dir == "" {
+        return nil
+    }
+    if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+        return err
+    }
+    name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFileName(email.To))
+    return os.WriteFile(filepath.Join(m.Dir, name), formatEmail(m.From, email), 0o644)
+}
+
+func formatEmail(from string, email Email) []byte {
+    var b strings.Builder
+    fmt.Fprintf(&b, "From: %s\r\n", from)
+    fmt.Fprintf(&b, "To: %s\r\n", email.To)
+    fmt.Fprintf(&b, "Subject: %s\r\n", email.Subject)
+    fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    b.WriteString("MIME-Version: 1.0\r\n")
+    b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+    b.WriteString(strings.ReplaceAll(email.Body, "\n", "\r\n"))
+    return []byte(b.String())
+}
+
+func sanitizeFileName(s string) string {
+    return strings.Map(func(r rune) rune {
+        if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+            return r
+        }
+        return '_'
+    }, s)
+}
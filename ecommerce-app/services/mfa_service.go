@@ -0,0 +1,481 @@
+package services
+
+import (
+    "context"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/redis/go-redis/v9"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// MFA error types
+var (
+    ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+    ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+    ErrMFAEnrollmentNeeded = errors.New("start two-factor enrollment first")
+    ErrMFARequired         = errors.New("two-factor authentication is required for this account")
+    ErrInvalidMFACode      = errors.New("invalid two-factor code")
+    ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor challenge")
+)
+
+// Security events reported by the MFA service
+const (
+    SecurityEventMFAFailed    = "mfa_failed"
+    SecurityEventMFASucceeded = "mfa_succeeded"
+)
+
+const (
+    recoveryCodeCount = 10
+    // maxChallengeFailures wrong codes end a challenge, sending the user back to the
+    // password step and so through the login guard again
+    maxChallengeFailures = 5
+)
+
+// MFAChallengeStore holds pending login challenges, keyed by the hash of the
+// challenge token
+type MFAChallengeStore interface {
+    Create(id string, userID uint, ttl time.Duration) error
+    // Get returns the challenge's user, or 0 when it does not exist
+    Get(id string) (uint, error)
+    // Fail counts a wrong code against the challenge
+    Fail(id string) (int64, error)
+    // Delete removes the challenge, reporting false when it was already gone
+    Delete(id string) (bool, error)
+}
+
+// MFAChallenge is handed out by Login in place of tokens when a second factor is due
+type MFAChallenge struct {
+    Token              string `json:"mfa_token"`
+    ExpiresIn          int    `json:"expires_in"`
+    EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+// TOTPEnrollment is what the user needs to add the account to an authenticator app
+type TOTPEnrollment struct {
+    Secret string `json:"secret"`
+    URI    string `json:"otpauth_uri"`
+}
+
+// MFAStatus describes a user's two-factor setup
+type MFAStatus struct {
+    Enabled                bool  `json:"enabled"`
+    Required               bool  `json:"required"`
+    RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// MFAService manages TOTP enrollment and the second step of login. Users whose role
+// grants admin access must enroll before they can complete a login.
+type MFAService struct {
+    MFARepo      repositories.MFARepository
+    UserRepo     repositories.UserRepository
+    RoleRepo     repositories.RoleRepository
+    Challenges   MFAChallengeStore
+    Metrics      SecurityEventRecorder // optional
+    Issuer       string
+    ChallengeTTL time.Duration
+    Logger       *logrus.Logger
+}
+
+// NewMFAService creates a new MFAService. issuer is the name authenticator apps show
+// next to the code.
+func NewMFAService(mfaRepo repositories.MFARepository, userRepo repositories.UserRepository, roleRepo repositories.RoleRepository, challenges MFAChallengeStore, issuer string, challengeTTL time.Duration, logger *logrus.Logger) *MFAService {
+    return &MFAService{
+        MFARepo:      mfaRepo,
+        UserRepo:     userRepo,
+        RoleRepo:     roleRepo,
+        Challenges:   challenges,
+        Issuer:       issuer,
+        ChallengeTTL: challengeTTL,
+        Logger:       logger,
+    }
+}
+
+// Required reports whether the user's role makes two-factor authentication mandatory
+func (s *MFAService) Required(user *models.User) (bool, error) {
+    role, err := s.RoleRepo.GetRoleByName(user.Role)
+    if err == gorm.ErrRecordNotFound {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return role.HasPermission(models.PermissionAdminAccess), nil
+}
+
+// Status returns the user's two-factor setup
+func (s *MFAService) Status(userID uint) (*MFAStatus, error) {
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return nil, errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    required, err := s.Required(user)
+    if err != nil {
+        return nil, err
+    }
+    status := &MFAStatus{Required: required}
+    _, err = s.confirmedTOTP(userID)
+    switch errors.Cause(err) {
+    case nil:
+        status.Enabled = true
+        status.RecoveryCodesRemaining, err = s.MFARepo.CountRecoveryCodes(userID)
+        if err != nil {
+            return nil, err
+        }
+    case ErrMFANotEnabled:
+    default:
+        return nil, err
+    }
+    return status, nil
+}
+
+// BeginLogin is called once the password checks out. It returns nil when the user
+// needs no second factor, otherwise a challenge to be exchanged through
+// CompleteLogin for a session.
+func (s *MFAService) BeginLogin(user *models.User) (*MFAChallenge, error) {
+    _, err := s.confirmedTOTP(user.ID)
+    enrolled := err == nil
+    if err != nil && errors.Cause(err) != ErrMFANotEnabled {
+        return nil, err
+    }
+    required := false
+    if !enrolled {
+        if required, err = s.Required(user); err != nil {
+            return nil, err
+        }
+        if !required {
+            return nil, nil
+        }
+    }
+
+    token, hash, err := newOpaqueToken()
+    if err != nil {
+        return nil, err
+    }
+    if err := s.Challenges.Create(hash, user.ID, s.ChallengeTTL); err != nil {
+        return nil, err
+    }
+    return &MFAChallenge{
+        Token:              token,
+        ExpiresIn:          int(s.ChallengeTTL.Seconds()),
+        EnrollmentRequired: required,
+    }, nil
+}
+
+// EnrollForChallenge starts enrollment for a user whose login is waiting on a
+// mandatory enrollment. The challenge stays valid for CompleteLogin.
+func (s *MFAService) EnrollForChallenge(challengeToken string) (*TOTPEnrollment, error) {
+    userID, err := s.Challenges.Get(hashToken(challengeToken))
+    if err != nil {
+        return nil, err
+    }
+    if userID == 0 {
+        return nil, ErrInvalidMFAChallenge
+    }
+    return s.StartEnrollment(userID)
+}
+
+// CompleteLogin exchanges a challenge and a TOTP or recovery code for the user ID to
+// issue tokens to. A challenge from a mandatory enrollment is completed by the first
+// code of the new authenticator, which also returns the user's recovery codes.
+func (s *MFAService) CompleteLogin(challengeToken, code, recoveryCode string) (uint, []string, error) {
+    id := hashToken(challengeToken)
+    userID, err := s.Challenges.Get(id)
+    if err != nil {
+        return 0, nil, err
+    }
+    if userID == 0 {
+        return 0, nil, ErrInvalidMFAChallenge
+    }
+
+    var recoveryCodes []string
+    totp, err := s.MFARepo.GetTOTP(userID)
+    switch {
+    case err == gorm.ErrRecordNotFound:
+        err = ErrMFAEnrollmentNeeded
+    case err != nil:
+    case totp.ConfirmedAt == nil:
+        recoveryCodes, err = s.ConfirmEnrollment(userID, code)
+    default:
+        err = s.verify(totp, code, recoveryCode)
+    }
+    if err != nil {
+        if errors.Cause(err) == ErrInvalidMFACode {
+            s.challengeFailed(id, userID)
+        }
+        return 0, nil, err
+    }
+
+    // Deleting is what spends the challenge, so two concurrent uses cannot both win
+    deleted, err := s.Challenges.Delete(id)
+    if err != nil {
+        return 0, nil, err
+    }
+    if !deleted {
+        return 0, nil, ErrInvalidMFAChallenge
+    }
+    s.record(SecurityEventMFASucceeded, logrus.Fields{"user_id": userID})
+    return userID, recoveryCodes, nil
+}
+
+// StartEnrollment generates a new secret for the user. It replaces any earlier
+// unconfirmed enrollment and is refused once an authenticator is confirmed.
+func (s *MFAService) StartEnrollment(userID uint) (*TOTPEnrollment, error) {
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return nil, errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    if _, err := s.confirmedTOTP(userID); err == nil {
+        return nil, ErrMFAAlreadyEnabled
+    } else if errors.Cause(err) != ErrMFANotEnabled {
+        return nil, err
+    }
+
+    secret, err := GenerateTOTPSecret()
+    if err != nil {
+        return nil, err
+    }
+    if err := s.MFARepo.SaveTOTP(&models.UserTOTP{UserID: userID, Secret: secret}); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "SAVE_TOTP_FAILED",
+        }).Error("Failed to save TOTP enrollment")
+        return nil, err
+    }
+    return &TOTPEnrollment{
+        Secret: secret,
+        URI:    TOTPURI(s.Issuer, user.Email, secret),
+    }, nil
+}
+
+// ConfirmEnrollment activates the pending authenticator once the user proves it
+// works, and returns a fresh set of recovery codes. They are only ever shown here and
+// by RegenerateRecoveryCodes.
+func (s *MFAService) ConfirmEnrollment(userID uint, code string) ([]string, error) {
+    totp, err := s.MFARepo.GetTOTP(userID)
+    if err == gorm.ErrRecordNotFound {
+        return nil, ErrMFAEnrollmentNeeded
+    }
+    if err != nil {
+        return nil, err
+    }
+    if totp.ConfirmedAt != nil {
+        return nil, ErrMFAAlreadyEnabled
+    }
+    step, ok := verifyTOTP(totp.Secret, normalizeMFACode(code), time.Now())
+    if !ok {
+        s.record(SecurityEventMFAFailed, logrus.Fields{"user_id": userID})
+        return nil, ErrInvalidMFACode
+    }
+    if err := s.MFARepo.ConfirmTOTP(userID, step); err != nil {
+        return nil, err
+    }
+    codes, err := s.replaceRecoveryCodes(userID)
+    if err != nil {
+        return nil, err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": userID,
+    }).Info("Two-factor authentication enabled")
+    return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a current
+// TOTP or recovery code
+func (s *MFAService) RegenerateRecoveryCodes(userID uint, code, recoveryCode string) ([]string, error) {
+    totp, err := s.confirmedTOTP(userID)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.verify(totp, code, recoveryCode); err != nil {
+        return nil, err
+    }
+    return s.replaceRecoveryCodes(userID)
+}
+
+// Disable removes the user's authenticator after checking a current TOTP or recovery
+// code. Users whose role requires two-factor authentication cannot disable it.
+func (s *MFAService) Disable(userID uint, code, recoveryCode string) error {
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    required, err := s.Required(user)
+    if err != nil {
+        return err
+    }
+    if required {
+        return ErrMFARequired
+    }
+    totp, err := s.confirmedTOTP(userID)
+    if err != nil {
+        return err
+    }
+    if err := s.verify(totp, code, recoveryCode); err != nil {
+        return err
+    }
+    if err := s.MFARepo.DeleteTOTP(userID); err != nil {
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": userID,
+    }).Info("Two-factor authentication disabled")
+    return nil
+}
+
+// verify accepts either a TOTP code, once per time step, or an unused recovery code
+func (s *MFAService) verify(totp *models.UserTOTP, code, recoveryCode string) error {
+    if recoveryCode != "" {
+        used, err := s.MFARepo.UseRecoveryCode(totp.UserID, hashToken(normalizeRecoveryCode(recoveryCode)))
+        if err != nil {
+            return err
+        }
+        if !used {
+            s.record(SecurityEventMFAFailed, logrus.Fields{"user_id": totp.UserID})
+            return ErrInvalidMFACode
+        }
+        s.Logger.WithFields(logrus.Fields{
+            "user_id": totp.UserID,
+        }).Warn("Recovery code used")
+        return nil
+    }
+
+    step, ok := verifyTOTP(totp.Secret, normalizeMFACode(code), time.Now())
+    if ok {
+        fresh, err := s.MFARepo.UseTOTPStep(totp.UserID, step)
+        if err != nil {
+            return err
+        }
+        ok = fresh
+    }
+    if !ok {
+        s.record(SecurityEventMFAFailed, logrus.Fields{"user_id": totp.UserID})
+        return ErrInvalidMFACode
+    }
+    return nil
+}
+
+func (s *MFAService) confirmedTOTP(userID uint) (*models.UserTOTP, error) {
+    totp, err := s.MFARepo.GetTOTP(userID)
+    if err == gorm.ErrRecordNotFound {
+        return nil, ErrMFANotEnabled
+    }
+    if err != nil {
+        return nil, err
+    }
+    if totp.ConfirmedAt == nil {
+        return nil, ErrMFANotEnabled
+    }
+    return totp, nil
+}
+
+func (s *MFAService) replaceRecoveryCodes(userID uint) ([]string, error) {
+    codes := make([]string, recoveryCodeCount)
+    hashes := make([]string, recoveryCodeCount)
+    for i := range codes {
+        raw, err := randomBytes(6)
+        if err != nil {
+            return nil, err
+        }
+        code := strings.ToLower(totpEncoding.EncodeToString(raw))[:10]
+        codes[i] = code[:5] + "-" + code[5:]
+        hashes[i] = hashToken(code)
+    }
+    if err := s.MFARepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+        return nil, err
+    }
+    return codes, nil
+}
+
+func (s *MFAService) challengeFailed(id string, userID uint) {
+    failures, err := s.Challenges.Fail(id)
+    if err != nil || failures < maxChallengeFailures {
+        return
+    }
+    s.Challenges.Delete(id)
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":    userID,
+        "error_code": "MFA_CHALLENGE_EXHAUSTED",
+    }).Warn("Two-factor challenge ended after too many wrong codes")
+}
+
+func (s *MFAService) record(event string, fields logrus.Fields) {
+    if s.Metrics != nil {
+        s.Metrics.RecordSecurityEvent(event)
+    }
+    if event == SecurityEventMFAFailed {
+        s.Logger.WithFields(fields).Warn("Invalid two-factor code")
+    }
+}
+
+func normalizeMFACode(code string) string {
+    return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
+
+// normalizeRecoveryCode accepts codes with or without the dash and in either case
+func normalizeRecoveryCode(code string) string {
+    code = strings.ToLower(strings.TrimSpace(code))
+    return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// RedisMFAChallengeStore keeps login challenges in Redis hashes that expire on their own
+type RedisMFAChallengeStore struct {
+    Client *redis.Client
+}
+
+// NewRedisMFAChallengeStore creates a new RedisMFAChallengeStore
+func NewRedisMFAChallengeStore(client *redis.Client) *RedisMFAChallengeStore {
+    return &RedisMFAChallengeStore{Client: client}
+}
+
+func (s *RedisMFAChallengeStore) Create(id string, userID uint, ttl time.Duration) error {
+    ctx := context.Background()
+    pipe := s.Client.TxPipeline()
+    pipe.HSet(ctx, mfaChallengeKey(id), "user_id", userID, "failures", 0)
+    pipe.Expire(ctx, mfaChallengeKey(id), ttl)
+    _, err := pipe.Exec(ctx)
+    return err
+}
+
+func (s *RedisMFAChallengeStore) Get(id string) (uint, error) {
+    value, err := s.Client.HGet(context.Background(), mfaChallengeKey(id), "user_id").Result()
+    if err == redis.Nil {
+        return 0, nil
+    }
+    if err != nil {
+        return 0, err
+    }
+    userID, err := strconv.ParseUint(value, 10, 64)
+    if err != nil {
+        return 0, nil
+    }
+    return uint(userID), nil
+}
+
+// Fail increments the failure count. Should the challenge expire in between, the
+// recreated hash lacks a user_id (so Get ignores it) and is deleted.
+func (s *RedisMFAChallengeStore) Fail(id string) (int64, error) {
+    ctx := context.Background()
+    failures, err := s.Client.HIncrBy(ctx, mfaChallengeKey(id), "failures", 1).Result()
+    if err != nil {
+        return 0, err
+    }
+    if s.Client.HExists(ctx, mfaChallengeKey(id), "user_id").Val() {
+        return failures, nil
+    }
+    s.Client.Del(ctx, mfaChallengeKey(id))
+    return maxChallengeFailures, nil
+}
+
+func (s *RedisMFAChallengeStore) Delete(id string) (bool, error) {
+    deleted, err := s.Client.Del(context.Background(), mfaChallengeKey(id)).Result()
+    return deleted > 0, err
+}
+
+func mfaChallengeKey(id string) string { return "mfa_challenge:" + id }
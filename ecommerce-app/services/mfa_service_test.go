@@ -0,0 +1,260 @@
+package services_test
+
+import (
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubMFARepository keeps authenticators and recovery codes in memory
+type stubMFARepository struct {
+    totps map[uint]*models.UserTOTP
+    codes map[uint]map[string]bool // hash -> used
+}
+
+func newStubMFARepository() *stubMFARepository {
+    return &stubMFARepository{totps: map[uint]*models.UserTOTP{}, codes: map[uint]map[string]bool{}}
+}
+
+func (r *stubMFARepository) GetTOTP(userID uint) (*models.UserTOTP, error) {
+    totp, ok := r.totps[userID]
+    if !ok {
+        return nil, gorm.ErrRecordNotFound
+    }
+    found := *totp
+    return &found, nil
+}
+
+func (r *stubMFARepository) SaveTOTP(totp *models.UserTOTP) error {
+    r.totps[totp.UserID] = totp
+    return nil
+}
+
+func (r *stubMFARepository) ConfirmTOTP(userID uint, step int64) error {
+    totp, ok := r.totps[userID]
+    if !ok || totp.ConfirmedAt != nil {
+        return gorm.ErrRecordNotFound
+    }
+    now := time.Now()
+    totp.ConfirmedAt = &now
+    totp.LastUsedStep = step
+    return nil
+}
+
+func (r *stubMFARepository) UseTOTPStep(userID uint, step int64) (bool, error) {
+    totp, ok := r.totps[userID]
+    if !ok || totp.LastUsedStep >= step {
+        return false, nil
+    }
+    totp.LastUsedStep = step
+    return true, nil
+}
+
+func (r *stubMFARepository) DeleteTOTP(userID uint) error {
+    delete(r.totps, userID)
+    delete(r.codes, userID)
+    return nil
+}
+
+func (r *stubMFARepository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+    r.codes[userID] = map[string]bool{}
+    for _, hash := range hashes {
+        r.codes[userID][hash] = false
+    }
+    return nil
+}
+
+func (r *stubMFARepository) UseRecoveryCode(userID uint, hash string) (bool, error) {
+    used, ok := r.codes[userID][hash]
+    if !ok || used {
+        return false, nil
+    }
+    r.codes[userID][hash] = true
+    return true, nil
+}
+
+func (r *stubMFARepository) CountRecoveryCodes(userID uint) (int64, error) {
+    var count int64
+    for _, used := range r.codes[userID] {
+        if !used {
+            count++
+        }
+    }
+    return count, nil
+}
+
+// stubMFAChallengeStore keeps challenges in memory
+type stubMFAChallengeStore struct {
+    users    map[string]uint
+    failures map[string]int64
+}
+
+func (s *stubMFAChallengeStore) Create(id string, userID uint, ttl time.Duration) error {
+    s.users[id] = userID
+    return nil
+}
+
+func (s *stubMFAChallengeStore) Get(id string) (uint, error) {
+    return s.users[id], nil
+}
+
+func (s *stubMFAChallengeStore) Fail(id string) (int64, error) {
+    s.failures[id]++
+    return s.failures[id], nil
+}
+
+func (s *stubMFAChallengeStore) Delete(id string) (bool, error) {
+    _, ok := s.users[id]
+    delete(s.users, id)
+    return ok, nil
+}
+
+// currentCode returns the authenticator app's code for the user's secret
+func currentCode(t *testing.T, repo *stubMFARepository, userID uint, offset time.Duration) string {
+    code, err := services.TOTPCode(repo.totps[userID].Secret, time.Now().Add(offset))
+    assert.NoError(t, err)
+    return code
+}
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+    // The RFC's SHA-1 seed is the ASCII string "12345678901234567890"
+    secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+    for unix, want := range map[int64]string{
+        59:         "287082",
+        1111111109: "081804",
+        1234567890: "005924",
+        2000000000: "279037",
+    } {
+        code, err := services.TOTPCode(secret, time.Unix(unix, 0))
+        assert.NoError(t, err)
+        assert.Equal(t, want, code, "time %d", unix)
+    }
+}
+
+func TestTOTPURI(t *testing.T) {
+    uri := services.TOTPURI("Shop", "ann@example.com", "JBSWY3DPEHPK3PXP")
+    assert.Equal(t, "otpauth://totp/Shop:ann@example.com?algorithm=SHA1&digits=6&issuer=Shop&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
+
+func TestMFAService_EnrollmentAndRecoveryCodes(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com", Role: models.RoleUser}}}
+    roleRepo := &stubRoleRepository{users: userRepo, roles: []models.Role{
+        {ID: 1, Name: models.RoleAdmin, Permissions: models.AllPermissions},
+        {ID: 2, Name: models.RoleUser},
+    }}
+    repo := newStubMFARepository()
+    service := services.NewMFAService(repo, userRepo, roleRepo, &stubMFAChallengeStore{users: map[string]uint{}, failures: map[string]int64{}}, "Shop", 5*time.Minute, newTestLogger())
+
+    enrollment, err := service.StartEnrollment(1)
+    assert.NoError(t, err)
+    assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+    // Test an unconfirmed enrollment does not enable MFA
+    status, _ := service.Status(1)
+    assert.False(t, status.Enabled)
+    _, err = service.ConfirmEnrollment(1, "000000")
+    assert.Equal(t, services.ErrInvalidMFACode, err)
+
+    codes, err := service.ConfirmEnrollment(1, currentCode(t, repo, 1, 0))
+    assert.NoError(t, err)
+    assert.Len(t, codes, 10)
+    status, _ = service.Status(1)
+    assert.Equal(t, &services.MFAStatus{Enabled: true, RecoveryCodesRemaining: 10}, status)
+
+    _, err = service.StartEnrollment(1)
+    assert.Equal(t, services.ErrMFAAlreadyEnabled, err)
+
+    // Test recovery codes are single use and accepted in any case
+    _, err = service.RegenerateRecoveryCodes(1, "", "nope")
+    assert.Equal(t, services.ErrInvalidMFACode, err)
+    assert.NoError(t, service.Disable(1, "", codes[0]))
+    status, _ = service.Status(1)
+    assert.False(t, status.Enabled)
+}
+
+func TestMFAService_LoginChallenge(t *testing.T) {
+    user := models.User{ID: 1, Username: "ann", Email: "ann@example.com", Role: models.RoleUser}
+    userRepo := &stubUserRepository{users: []models.User{user}}
+    roleRepo := &stubRoleRepository{users: userRepo, roles: []models.Role{
+        {ID: 1, Name: models.RoleAdmin, Permissions: models.AllPermissions},
+        {ID: 2, Name: models.RoleUser},
+    }}
+    repo := newStubMFARepository()
+    challenges := &stubMFAChallengeStore{users: map[string]uint{}, failures: map[string]int64{}}
+    service := services.NewMFAService(repo, userRepo, roleRepo, challenges, "Shop", 5*time.Minute, newTestLogger())
+
+    // Test users without MFA log in with just a password
+    challenge, err := service.BeginLogin(&user)
+    assert.NoError(t, err)
+    assert.Nil(t, challenge)
+
+    service.StartEnrollment(1)
+    recoveryCodes, _ := service.ConfirmEnrollment(1, currentCode(t, repo, 1, -services.TOTPPeriod))
+
+    challenge, err = service.BeginLogin(&user)
+    assert.NoError(t, err)
+    assert.False(t, challenge.EnrollmentRequired)
+
+    // Test the code used to confirm enrollment cannot be replayed
+    _, _, err = service.CompleteLogin(challenge.Token, currentCode(t, repo, 1, -services.TOTPPeriod), "")
+    assert.Equal(t, services.ErrInvalidMFACode, err)
+
+    userID, codes, err := service.CompleteLogin(challenge.Token, currentCode(t, repo, 1, 0), "")
+    assert.NoError(t, err)
+    assert.Equal(t, uint(1), userID)
+    assert.Nil(t, codes)
+
+    // Test a challenge is single use
+    _, _, err = service.CompleteLogin(challenge.Token, recoveryCodes[0], "")
+    assert.Equal(t, services.ErrInvalidMFAChallenge, err)
+
+    challenge, _ = service.BeginLogin(&user)
+    userID, _, err = service.CompleteLogin(challenge.Token, "", recoveryCodes[0])
+    assert.NoError(t, err)
+    assert.Equal(t, uint(1), userID)
+
+    // Test repeated wrong codes end the challenge
+    challenge, _ = service.BeginLogin(&user)
+    for i := 0; i < 5; i++ {
+        _, _, err = service.CompleteLogin(challenge.Token, "000000", recoveryCodes[0])
+        assert.Equal(t, services.ErrInvalidMFACode, err)
+    }
+    assert.Empty(t, challenges.users)
+    _, _, err = service.CompleteLogin(challenge.Token, currentCode(t, repo, 1, services.TOTPPeriod), "")
+    assert.Equal(t, services.ErrInvalidMFAChallenge, err)
+}
+
+func TestMFAService_MandatoryForAdmins(t *testing.T) {
+    admin := models.User{ID: 1, Username: "root", Email: "root@example.com", Role: models.RoleAdmin}
+    userRepo := &stubUserRepository{users: []models.User{admin}}
+    roleRepo := &stubRoleRepository{users: userRepo, roles: []models.Role{
+        {ID: 1, Name: models.RoleAdmin, Permissions: models.AllPermissions},
+        {ID: 2, Name: models.RoleUser},
+    }}
+    repo := newStubMFARepository()
+    service := services.NewMFAService(repo, userRepo, roleRepo, &stubMFAChallengeStore{users: map[string]uint{}, failures: map[string]int64{}}, "Shop", 5*time.Minute, newTestLogger())
+
+    challenge, err := service.BeginLogin(&admin)
+    assert.NoError(t, err)
+    assert.True(t, challenge.EnrollmentRequired)
+
+    _, _, err = service.CompleteLogin(challenge.Token, "123456", "")
+    assert.Equal(t, services.ErrMFAEnrollmentNeeded, err)
+
+    enrollment, err := service.EnrollForChallenge(challenge.Token)
+    assert.NoError(t, err)
+    assert.NotEmpty(t, enrollment.Secret)
+
+    userID, codes, err := service.CompleteLogin(challenge.Token, currentCode(t, repo, 1, 0), "")
+    assert.NoError(t, err)
+    assert.Equal(t, uint(1), userID)
+    assert.Len(t, codes, 10)
+
+    status, _ := service.Status(1)
+    assert.True(t, status.Required)
+    assert.Equal(t, services.ErrMFARequired, service.Disable(1, "", codes[0]))
+}
@@ -0,0 +1,234 @@
+package services_test
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/oidcmock"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubUserIdentityRepository keeps identities in memory
+type stubUserIdentityRepository struct {
+    identities []models.UserIdentity
+}
+
+func (r *stubUserIdentityRepository) CreateIdentity(identity *models.UserIdentity) error {
+    identity.ID = uint(len(r.identities) + 1)
+    r.identities = append(r.identities, *identity)
+    return nil
+}
+
+func (r *stubUserIdentityRepository) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+    for _, identity := range r.identities {
+        if identity.Provider == provider && identity.Subject == subject {
+            return &identity, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubUserIdentityRepository) GetIdentitiesByUser(userID uint) ([]models.UserIdentity, error) {
+    var identities []models.UserIdentity
+    for _, identity := range r.identities {
+        if identity.UserID == userID {
+            identities = append(identities, identity)
+        }
+    }
+    return identities, nil
+}
+
+func (r *stubUserIdentityRepository) DeleteIdentity(userID uint, provider string) error {
+    for i, identity := range r.identities {
+        if identity.UserID == userID && identity.Provider == provider {
+            r.identities = append(r.identities[:i], r.identities[i+1:]...)
+            return nil
+        }
+    }
+    return gorm.ErrRecordNotFound
+}
+
+// stubOIDCStateStore keeps login states in memory
+type stubOIDCStateStore map[string]*services.OIDCLoginState
+
+func (s stubOIDCStateStore) Save(state string, login *services.OIDCLoginState, ttl time.Duration) error {
+    s[state] = login
+    return nil
+}
+
+func (s stubOIDCStateStore) Take(state string) (*services.OIDCLoginState, error) {
+    login := s[state]
+    delete(s, state)
+    return login, nil
+}
+
+// startOIDCProvider serves a mock OpenID provider until the test ends
+func startOIDCProvider(t *testing.T) *httptest.Server {
+    provider, err := oidcmock.New("")
+    assert.NoError(t, err)
+    server := httptest.NewServer(provider)
+    t.Cleanup(server.Close)
+    provider.Issuer = server.URL
+    return server
+}
+
+// authorize plays the browser: it follows the authorization URL to the provider and
+// returns the code and state the provider redirects back with
+func authorize(t *testing.T, authorizationURL, loginHint string) (string, string) {
+    client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+        return http.ErrUseLastResponse
+    }}
+    resp, err := client.Get(authorizationURL + "&login_hint=" + url.QueryEscape(loginHint))
+    assert.NoError(t, err)
+    resp.Body.Close()
+    assert.Equal(t, http.StatusFound, resp.StatusCode)
+    location, err := url.Parse(resp.Header.Get("Location"))
+    assert.NoError(t, err)
+    assert.Equal(t, "shop.example", location.Host)
+    return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func oidcLogin(t *testing.T, service *services.OIDCService, linkUserID uint, loginHint string) (*models.User, bool, error) {
+    ctx := context.Background()
+    authorizationURL, err := service.AuthorizationURL(ctx, "mock", linkUserID)
+    assert.NoError(t, err)
+    code, state := authorize(t, authorizationURL, loginHint)
+    return service.HandleCallback(ctx, "mock", code, state)
+}
+
+func TestOIDCService_FirstLoginCreatesUser(t *testing.T) {
+    server := startOIDCProvider(t)
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "other@example.com"}}}
+    identityRepo := &stubUserIdentityRepository{}
+    service := services.NewOIDCService([]services.OIDCProvider{{
+        Name:        "mock",
+        Issuer:      server.URL,
+        ClientID:    "shop",
+        RedirectURL: "https://shop.example/api/v1/auth/oidc/mock/callback",
+    }}, userRepo, identityRepo, stubOIDCStateStore{}, 10*time.Minute, newTestLogger())
+
+    authorizationURL, err := service.AuthorizationURL(context.Background(), "mock", 0)
+    assert.NoError(t, err)
+    query, _ := url.Parse(authorizationURL)
+    assert.Equal(t, "S256", query.Query().Get("code_challenge_method"))
+    assert.Equal(t, "openid email profile", query.Query().Get("scope"))
+
+    user, linked, err := oidcLogin(t, service, 0, "Ann@example.com")
+    assert.NoError(t, err)
+    assert.False(t, linked)
+    assert.Equal(t, "Ann@example.com", user.Email)
+    assert.Equal(t, services.UnusablePassword, user.Password)
+    assert.NotNil(t, user.EmailVerifiedAt)
+    // Test the username avoids the existing "ann"
+    assert.Regexp(t, `^ann-[0-9a-f]{6}$`, user.Username)
+    assert.Len(t, userRepo.users, 2)
+    assert.Len(t, identityRepo.identities, 1)
+
+    // Test a second login finds the same account through the identity
+    again, _, err := oidcLogin(t, service, 0, "ann@example.com")
+    assert.NoError(t, err)
+    assert.Equal(t, user.ID, again.ID)
+    assert.Len(t, userRepo.users, 2)
+}
+
+func TestOIDCService_LinksExistingAccountByVerifiedEmail(t *testing.T) {
+    server := startOIDCProvider(t)
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    identityRepo := &stubUserIdentityRepository{}
+    service := services.NewOIDCService([]services.OIDCProvider{{
+        Name:        "mock",
+        Issuer:      server.URL,
+        ClientID:    "shop",
+        RedirectURL: "https://shop.example/api/v1/auth/oidc/mock/callback",
+    }}, userRepo, identityRepo, stubOIDCStateStore{}, 10*time.Minute, newTestLogger())
+
+    // Test an account whose email was never verified is not linked
+    _, _, err := oidcLogin(t, service, 0, "ann@example.com")
+    assert.Equal(t, services.ErrOIDCAccountExists, err)
+    assert.Empty(t, identityRepo.identities)
+
+    // Test an unverified provider email cannot take over the account
+    verifiedAt := time.Now()
+    userRepo.users[0].EmailVerifiedAt = &verifiedAt
+    _, _, err = oidcLogin(t, service, 0, "unverified:ann@example.com")
+    assert.Equal(t, services.ErrOIDCAccountExists, err)
+    assert.Empty(t, identityRepo.identities)
+
+    user, _, err := oidcLogin(t, service, 0, "ann@example.com")
+    assert.NoError(t, err)
+    assert.Equal(t, uint(1), user.ID)
+    assert.Equal(t, uint(1), identityRepo.identities[0].UserID)
+}
+
+func TestOIDCService_RejectsReplayedOrForeignState(t *testing.T) {
+    server := startOIDCProvider(t)
+    service := services.NewOIDCService([]services.OIDCProvider{{
+        Name:        "mock",
+        Issuer:      server.URL,
+        ClientID:    "shop",
+        RedirectURL: "https://shop.example/api/v1/auth/oidc/mock/callback",
+    }}, &stubUserRepository{}, &stubUserIdentityRepository{}, stubOIDCStateStore{}, 10*time.Minute, newTestLogger())
+    ctx := context.Background()
+
+    authorizationURL, err := service.AuthorizationURL(ctx, "mock", 0)
+    assert.NoError(t, err)
+    code, state := authorize(t, authorizationURL, "ann@example.com")
+
+    _, _, err = service.HandleCallback(ctx, "other", code, state)
+    assert.Equal(t, services.ErrUnknownOIDCProvider, err)
+    _, _, err = service.HandleCallback(ctx, "mock", code, "forged")
+    assert.Equal(t, services.ErrInvalidOIDCState, err)
+
+    _, _, err = service.HandleCallback(ctx, "mock", code, state)
+    assert.NoError(t, err)
+    _, _, err = service.HandleCallback(ctx, "mock", code, state)
+    assert.Equal(t, services.ErrInvalidOIDCState, err)
+
+    // Test a code cannot be redeemed under another login's PKCE verifier
+    authorizationURL, _ = service.AuthorizationURL(ctx, "mock", 0)
+    _, otherState := authorize(t, authorizationURL, "ann@example.com")
+    _, _, err = service.HandleCallback(ctx, "mock", code, otherState)
+    assert.Equal(t, services.ErrOIDCExchangeFailed, errors.Cause(err))
+}
+
+func TestOIDCService_LinkAndUnlink(t *testing.T) {
+    verifiedAt := time.Now()
+    server := startOIDCProvider(t)
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "ann", Email: "ann@example.com", Password: "hash"},
+        {ID: 2, Username: "bob", Email: "bob@example.com", Password: services.UnusablePassword, EmailVerifiedAt: &verifiedAt},
+    }}
+    identityRepo := &stubUserIdentityRepository{}
+    service := services.NewOIDCService([]services.OIDCProvider{{
+        Name:        "mock",
+        Issuer:      server.URL,
+        ClientID:    "shop",
+        RedirectURL: "https://shop.example/api/v1/auth/oidc/mock/callback",
+    }}, userRepo, identityRepo, stubOIDCStateStore{}, 10*time.Minute, newTestLogger())
+
+    // Test a logged-in user can link a provider account with a different email
+    user, linked, err := oidcLogin(t, service, 1, "ann.personal@example.com")
+    assert.NoError(t, err)
+    assert.True(t, linked)
+    assert.Equal(t, uint(1), user.ID)
+    assert.Len(t, userRepo.users, 2)
+
+    _, _, err = oidcLogin(t, service, 2, "ann.personal@example.com")
+    assert.Equal(t, services.ErrIdentityInUse, err)
+
+    _, _, err = oidcLogin(t, service, 0, "bob@example.com")
+    assert.NoError(t, err)
+    assert.Equal(t, services.ErrLastLoginMethod, service.Unlink(2, "mock"))
+
+    assert.NoError(t, service.Unlink(1, "mock"))
+    assert.Equal(t, services.ErrIdentityNotFound, service.Unlink(1, "mock"))
+    assert.Len(t, identityRepo.identities, 1)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+// Order lifecycle error types
+var (
+    ErrInvalidOrderTransition = errors.New("invalid order status transition")
+    ErrOrderStatusChanged     = errors.New("order status changed concurrently")
+    ErrTransitionOrderFailed  = errors.New("failed to update order status")
+)
+
+// OrderEventsQueue receives an OrderEvent for every order status transition
+const OrderEventsQueue = "order_events"
+
+// orderTransitions is the order lifecycle: each status maps to the statuses it may move to
+var orderTransitions = map[string][]string{
+    models.OrderStatusPending:   {models.OrderStatusPaid, models.OrderStatusCancelled},
+    models.OrderStatusPaid:      {models.OrderStatusPicking, models.OrderStatusCancelled, models.OrderStatusRefunded},
+    models.OrderStatusPicking:   {models.OrderStatusShipped, models.OrderStatusCancelled},
+    models.OrderStatusShipped:   {models.OrderStatusDelivered},
+    models.OrderStatusDelivered: {models.OrderStatusRefunded},
+    models.OrderStatusCancelled: {models.OrderStatusRefunded},
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another
+func CanTransitionOrder(from, to string) bool {
+    for _, next := range orderTransitions[from] {
+        if next == to {
+            return true
+        }
+    }
+    return false
+}
+
+// IsValidOrderStatus reports whether status is part of the order lifecycle
+func IsValidOrderStatus(status string) bool {
+    switch status {
+    case models.OrderStatusPending, models.OrderStatusPaid, models.OrderStatusPicking, models.OrderStatusShipped,
+        models.OrderStatusDelivered, models.OrderStatusCancelled, models.OrderStatusRefunded:
+        return true
+    }
+    return false
+}
+
+// OrderActor identifies who changed an order's status
+type OrderActor struct {
+    Type string
+    ID   uint
+}
+
+// SystemActor is used for transitions made by the application itself, e.g. payment capture
+func SystemActor() OrderActor {
+    return OrderActor{Type: models.OrderActorSystem}
+}
+
+// OrderEvent is published to OrderEventsQueue on every order status transition
+type OrderEvent struct {
+    OrderID    uint      `json:"order_id"`
+    UserID     uint      `json:"user_id"`
+    FromStatus string    `json:"from_status"`
+    ToStatus   string    `json:"to_status"`
+    Actor      string    `json:"actor"`
+    ActorID    uint      `json:"actor_id,omitempty"`
+    Reason     string    `json:"reason,omitempty"`
+    Total      float64   `json:"total"`
+    OccurredAt time.Time `json:"occurred_at"`
+}
+
+// OrderLifecycle is the only place order statuses change. It enforces the allowed
+// transitions, records each one and publishes an OrderEvent.
+type OrderLifecycle struct {
+    OrderRepo repositories.OrderRepository
+    RabbitMQ  *amqp091.Channel
+    Logger    *logrus.Logger
+}
+
+// NewOrderLifecycle creates a new OrderLifecycle
+func NewOrderLifecycle(orderRepo repositories.OrderRepository, rabbitMQ *amqp091.Channel, logger *logrus.Logger) *OrderLifecycle {
+    return &OrderLifecycle{
+        OrderRepo: orderRepo,
+        RabbitMQ:  rabbitMQ,
+        Logger:    logger,
+    }
+}
+
+// Transition moves the order to a new status. Cancelling an order returns its items to stock.
+func (l *OrderLifecycle) Transition(orderID uint, to string, actor OrderActor, reason string) (*models.Order, error) {
+    order, err := l.OrderRepo.GetOrderByID(orderID)
+    if err != nil {
+        return nil, errors.Wrap(ErrOrderNotFound, err.Error())
+    }
+    from := order.Status
+    if !CanTransitionOrder(from, to) {
+        l.Logger.WithFields(logrus.Fields{
+            "order_id":   orderID,
+            "from":       from,
+            "to":         to,
+            "error_code": "INVALID_ORDER_TRANSITION",
+        }).Warn("Rejected order status transition")
+        return nil, errors.Wrap(ErrInvalidOrderTransition, from+" -> "+to)
+    }
+
+    transition := &models.OrderStatusTransition{
+        OrderID:    orderID,
+        FromStatus: from,
+        ToStatus:   to,
+        Actor:      actor.Type,
+        ActorID:    actor.ID,
+        Reason:     reason,
+    }
+    restock := to == models.OrderStatusCancelled
+    if err := l.OrderRepo.TransitionOrderStatus(transition, restock); err != nil {
+        if err == repositories.ErrOrderStatusChanged {
+            return nil, ErrOrderStatusChanged
+        }
+        l.Logger.WithFields(logrus.Fields{
+            "order_id":   orderID,
+            "to":         to,
+            "error":      err,
+            "error_code": "TRANSITION_ORDER_FAILED",
+        }).Error("Failed to update order status")
+        return nil, errors.Wrap(ErrTransitionOrderFailed, err.Error())
+    }
+    order.Status = to
+    order.Transitions = append(order.Transitions, *transition)
+
+    l.Logger.WithFields(logrus.Fields{
+        "order_id": orderID,
+        "from":     from,
+        "to":       to,
+        "actor":    actor.Type,
+        "actor_id": actor.ID,
+    }).Info("Order status changed")
+
+    // The transition is committed; a failed publish is logged rather than undone
+    event := OrderEvent{
+        OrderID:    orderID,
+        UserID:     order.UserID,
+        FromStatus: from,
+        ToStatus:   to,
+        Actor:      actor.Type,
+        ActorID:    actor.ID,
+        Reason:     reason,
+        Total:      order.Total,
+        OccurredAt: transition.CreatedAt,
+    }
+    if event.OccurredAt.IsZero() {
+        event.OccurredAt = time.Now()
+    }
+    if err := publishJSON(l.RabbitMQ, OrderEventsQueue, event); err != nil {
+        l.Logger.WithFields(logrus.Fields{
+            "order_id":   orderID,
+            "error":      err,
+            "error_code": "PUBLISH_FAILED",
+        }).Error("Failed to publish order event")
+    }
+    return order, nil
+}
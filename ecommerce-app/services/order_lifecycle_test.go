@@ -0,0 +1,133 @@
+package services_test
+
+import (
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestCanTransitionOrder(t *testing.T) {
+    lifecycle := []string{models.OrderStatusPending, models.OrderStatusPaid, models.OrderStatusPicking, models.OrderStatusShipped, models.OrderStatusDelivered}
+    for i := 0; i < len(lifecycle)-1; i++ {
+        assert.True(t, services.CanTransitionOrder(lifecycle[i], lifecycle[i+1]))
+        assert.False(t, services.CanTransitionOrder(lifecycle[i+1], lifecycle[i]))
+    }
+    assert.False(t, services.CanTransitionOrder(models.OrderStatusPending, models.OrderStatusShipped))
+    assert.False(t, services.CanTransitionOrder(models.OrderStatusShipped, models.OrderStatusCancelled))
+    assert.True(t, services.CanTransitionOrder(models.OrderStatusCancelled, models.OrderStatusRefunded))
+    assert.False(t, services.CanTransitionOrder(models.OrderStatusRefunded, models.OrderStatusPaid))
+}
+
+func TestOrderService_AdvanceOrder(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{{ID: 1, UserID: 1, Status: models.OrderStatusPaid}}}
+    service := services.NewOrderService(orderRepo, nil, nil, nil, newTestLogger())
+
+    order, err := service.AdvanceOrder(9, 1, models.OrderStatusPicking, "")
+    assert.NoError(t, err)
+    assert.Equal(t, models.OrderStatusPicking, order.Status)
+
+    // Test the transition is recorded with its actor
+    transitions := orderRepo.orders[0].Transitions
+    assert.Len(t, transitions, 1)
+    assert.Equal(t, models.OrderStatusPaid, transitions[0].FromStatus)
+    assert.Equal(t, models.OrderActorAdmin, transitions[0].Actor)
+    assert.Equal(t, uint(9), transitions[0].ActorID)
+
+    // Test skipping a step is rejected
+    _, err = service.AdvanceOrder(9, 1, models.OrderStatusDelivered, "")
+    assert.Equal(t, services.ErrInvalidOrderTransition, errors.Cause(err))
+
+    // Test unknown statuses are rejected
+    _, err = service.AdvanceOrder(9, 1, "lost", "")
+    assert.Equal(t, services.ErrInvalidOrderStatus, err)
+}
+
+func TestOrderService_AdvanceOrderMoneyStatuses(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    paymentService := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentSuccess, 0), "whsec", true, newTestLogger())
+    service := services.NewOrderService(orderRepo, nil, nil, nil, newTestLogger())
+
+    // Test paid and refunded cannot be set without moving money
+    _, err := service.AdvanceOrder(9, 1, models.OrderStatusPaid, "")
+    assert.Equal(t, services.ErrOrderStatusManaged, err)
+    _, err = service.AdvanceOrder(9, 1, models.OrderStatusRefunded, "")
+    assert.Equal(t, services.ErrOrderStatusManaged, err)
+
+    // Test a paid order is not cancelled without a way to give the money back
+    _, err = paymentService.PayOrder(1, 1)
+    assert.NoError(t, err)
+    _, err = service.AdvanceOrder(9, 1, models.OrderStatusCancelled, "")
+    assert.Equal(t, services.ErrTransitionOrderFailed, errors.Cause(err))
+    assert.Equal(t, models.OrderStatusPaid, orderRepo.orders[0].Status)
+
+    // Test cancelling a paid order refunds its payment
+    service.Payments = paymentService
+    order, err := service.AdvanceOrder(9, 1, models.OrderStatusCancelled, "customer request")
+    assert.NoError(t, err)
+    assert.Equal(t, models.OrderStatusRefunded, order.Status)
+    payments, _ := paymentService.GetOrderPayments(1, 1)
+    if assert.Len(t, payments, 1) {
+        assert.Equal(t, models.PaymentStatusRefunded, payments[0].Status)
+        assert.Equal(t, 50.0, payments[0].RefundedAmount)
+    }
+}
+
+func TestOrderService_CancelVoidsAuthorization(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    paymentService := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentSuccess, 0), "whsec", true, newTestLogger())
+    paymentService.AutoCapture = false
+    service := services.NewOrderService(orderRepo, nil, nil, nil, newTestLogger())
+    service.Payments = paymentService
+
+    _, err := paymentService.PayOrder(1, 1)
+    assert.NoError(t, err)
+    order, err := service.AdvanceOrder(9, 1, models.OrderStatusCancelled, "")
+    assert.NoError(t, err)
+    assert.Equal(t, models.OrderStatusCancelled, order.Status)
+    payments, _ := paymentService.GetOrderPayments(1, 1)
+    assert.Equal(t, models.PaymentStatusVoided, payments[0].Status)
+}
+
+func TestOrderService_CancelClaimsOrderBeforeReleasingPayments(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    paymentService := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentSuccess, 0), "whsec", true, newTestLogger())
+    service := services.NewOrderService(orderRepo, nil, nil, nil, newTestLogger())
+    service.Payments = paymentService
+    _, err := paymentService.PayOrder(1, 1)
+    assert.NoError(t, err)
+    repo := paymentService.PaymentRepo.(*stubPaymentRepository)
+
+    // Test an order that moved on first keeps its payment
+    orderRepo.orders[0].Status = models.OrderStatusShipped
+    _, err = service.AdvanceOrder(9, 1, models.OrderStatusCancelled, "")
+    assert.Equal(t, services.ErrInvalidOrderTransition, errors.Cause(err))
+    assert.Equal(t, models.PaymentStatusCaptured, repo.payments[0].Status)
+
+    // Test a failed refund leaves the order cancelled until the retry releases it
+    orderRepo.orders[0].Status = models.OrderStatusPaid
+    providerRef := repo.payments[0].ProviderRef
+    repo.payments[0].ProviderRef = "fake_unknown"
+    order, err := service.AdvanceOrder(9, 1, models.OrderStatusCancelled, "")
+    assert.NoError(t, err)
+    assert.Equal(t, models.OrderStatusCancelled, order.Status)
+    assert.Equal(t, models.PaymentStatusCaptured, repo.payments[0].Status)
+
+    repo.payments[0].ProviderRef = providerRef
+    assert.NoError(t, service.RetryPaymentReleases())
+    assert.Equal(t, models.PaymentStatusRefunded, repo.payments[0].Status)
+    assert.Equal(t, models.OrderStatusRefunded, orderRepo.orders[0].Status)
+    orderIDs, _ := paymentService.OrdersAwaitingRelease(10)
+    assert.Empty(t, orderIDs)
+}
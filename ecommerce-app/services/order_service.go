@@ -0,0 +1,357 @@
+package services
+
+import (
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+// Order error types
+var (
+    ErrEmptyCart          = errors.New("cart is empty")
+    ErrOrderNotFound      = errors.New("order not found")
+    ErrPlaceOrderFailed   = errors.New("failed to place order")
+    ErrFetchOrdersFailed  = errors.New("failed to fetch orders")
+    ErrInvalidOrderStatus = errors.New("invalid order status")
+    ErrOrderStatusManaged = errors.New("paid and refunded statuses follow the order's payments")
+)
+
+// PaymentReleaser voids and refunds an order's payments when the order is cancelled
+type PaymentReleaser interface {
+    ReleaseOrderPayments(orderID uint) (bool, error)
+    OrdersAwaitingRelease(limit int) ([]uint, error)
+}
+
+// paymentReleaseBatch is how many cancelled orders RetryPaymentReleases handles per run
+const paymentReleaseBatch = 100
+
+// OrderService handles checkout and order retrieval
+type OrderService struct {
+    OrderRepo   repositories.OrderRepository
+    AddressRepo repositories.AddressRepository
+    CartService *CartService
+    Lifecycle   *OrderLifecycle
+    Payments    PaymentReleaser // releases payments of orders an admin cancels
+    RabbitMQ    *amqp091.Channel
+    Logger      *logrus.Logger
+}
+
+// NewOrderService creates a new OrderService
+func NewOrderService(orderRepo repositories.OrderRepository, addressRepo repositories.AddressRepository, cartService *CartService, rabbitMQ *amqp091.Channel, logger *logrus.Logger) *OrderService {
+    return &OrderService{
+        OrderRepo:   orderRepo,
+        AddressRepo: addressRepo,
+        CartService: cartService,
+        Lifecycle:   NewOrderLifecycle(orderRepo, rabbitMQ, logger),
+        RabbitMQ:    rabbitMQ,
+        Logger:      logger,
+    }
+}
+
+// Checkout turns the user's cart into a pending order shipped to one of the user's
+// addresses (the default one when addressID is 0), pricing it with the applied
+// coupons, the tax for that address and the chosen shipping method. An applied coupon
+// that can no longer be used fails checkout until it is removed from the cart, so the
+// order is never priced differently from the cart summary the user saw.
+func (s *OrderService) Checkout(userID, addressID uint, shippingMethod string) (*models.Order, error) {
+    shipTo, err := s.shippingAddress(userID, addressID)
+    if err != nil {
+        return nil, err
+    }
+    if s.CartService.ShippingService != nil && shippingMethod == "" {
+        return nil, ErrShippingMethodRequired
+    }
+    address := TaxAddress{
+        Country:    shipTo.Country,
+        Region:     shipTo.Region,
+        PostalCode: shipTo.PostalCode,
+    }
+
+    // Read the cart from the database rather than the cache so checkout never prices stale lines
+    cartItems, err := s.CartService.CartRepo.GetCartByUserID(userID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "FETCH_CART_FAILED",
+        }).Error("Failed to fetch cart")
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+    if len(cartItems) == 0 {
+        return nil, ErrEmptyCart
+    }
+    changed, err := s.CartService.revalidateCart(cartItems)
+    if err != nil {
+        return nil, errors.Wrap(ErrFetchCartFailed, err.Error())
+    }
+    if changed > 0 {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "changed":    changed,
+            "error_code": "CART_CHANGED",
+        }).Warn("Checkout blocked until cart changes are acknowledged")
+        return nil, ErrCartChanged
+    }
+    coupons, err := s.CartService.appliedCoupons(userID)
+    if err != nil {
+        return nil, err
+    }
+    for i := range coupons {
+        if err := s.CartService.checkCouponUsage(&coupons[i], userID); err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    userID,
+                "code":       coupons[i].Code,
+                "error":      err,
+                "error_code": "COUPON_NOT_APPLICABLE",
+            }).Warn("Checkout blocked by a coupon that can no longer be used")
+            return nil, err
+        }
+    }
+
+    summary := SummarizeCart(cartItems, coupons, time.Now())
+    if err := applyTax(summary, s.CartService.TaxCalculator, address); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "country":    address.Country,
+            "error":      err,
+            "error_code": "TAX_CALCULATION_FAILED",
+        }).Warn("Failed to calculate tax")
+        return nil, err
+    }
+    if err := applyShipping(summary, s.CartService.ShippingService, address.Country, shippingMethod); err != nil {
+        return nil, err
+    }
+
+    order := buildOrder(userID, shipTo, summary)
+    couponIDs := make([]uint, 0, len(summary.Discounts))
+    for _, line := range summary.Discounts {
+        couponIDs = append(couponIDs, line.CouponID)
+    }
+    if err := s.OrderRepo.PlaceOrder(order, couponIDs); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "PLACE_ORDER_FAILED",
+        }).Error("Failed to place order")
+        switch err {
+        case repositories.ErrOutOfStock:
+            return nil, ErrInsufficientStock
+        case repositories.ErrCouponLimitReached:
+            return nil, ErrCouponUsageLimit
+        }
+        return nil, errors.Wrap(ErrPlaceOrderFailed, err.Error())
+    }
+    s.CartService.invalidateCache(userID)
+
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":  userID,
+        "order_id": order.ID,
+        "total":    order.Total,
+    }).Info("Placed order")
+    return order, nil
+}
+
+// GetOrders returns the user's orders, newest first
+func (s *OrderService) GetOrders(userID uint) ([]models.Order, error) {
+    orders, err := s.OrderRepo.GetOrdersByUserID(userID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "FETCH_ORDERS_FAILED",
+        }).Error("Failed to fetch orders")
+        return nil, errors.Wrap(ErrFetchOrdersFailed, err.Error())
+    }
+    return orders, nil
+}
+
+// GetOrder returns one of the user's orders; other users' orders are reported as not found
+func (s *OrderService) GetOrder(userID, id uint) (*models.Order, error) {
+    order, err := s.OrderRepo.GetOrderByID(id)
+    if err != nil {
+        return nil, errors.Wrap(ErrOrderNotFound, err.Error())
+    }
+    if order.UserID != userID {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "order_id":   id,
+            "error_code": "ORDER_NOT_FOUND",
+        }).Warn("Order belongs to another user")
+        return nil, ErrOrderNotFound
+    }
+    return order, nil
+}
+
+// shippingAddress returns the user's chosen address, or their default address when addressID is 0
+func (s *OrderService) shippingAddress(userID, addressID uint) (*models.Address, error) {
+    if addressID != 0 {
+        address, err := s.AddressRepo.GetAddressByID(addressID)
+        if err != nil {
+            return nil, errors.Wrap(ErrAddressNotFound, err.Error())
+        }
+        if address.UserID != userID {
+            return nil, ErrAddressNotFound
+        }
+        return address, nil
+    }
+    addresses, err := s.AddressRepo.GetAddressesByUserID(userID)
+    if err != nil {
+        return nil, errors.Wrap(ErrFetchAddressesFailed, err.Error())
+    }
+    for i := range addresses {
+        if addresses[i].IsDefault {
+            return &addresses[i], nil
+        }
+    }
+    return nil, ErrShippingAddressRequired
+}
+
+// ListOrders returns orders for the admin view, optionally filtered by status
+func (s *OrderService) ListOrders(status string, page, limit int) ([]models.Order, int64, error) {
+    if status != "" && !IsValidOrderStatus(status) {
+        return nil, 0, ErrInvalidOrderStatus
+    }
+    orders, total, err := s.OrderRepo.ListOrders(status, page, limit)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "status":     status,
+            "error":      err,
+            "error_code": "FETCH_ORDERS_FAILED",
+        }).Error("Failed to list orders")
+        return nil, 0, errors.Wrap(ErrFetchOrdersFailed, err.Error())
+    }
+    return orders, total, nil
+}
+
+// GetOrderByID returns any order with its items and status history, for admins
+func (s *OrderService) GetOrderByID(id uint) (*models.Order, error) {
+    order, err := s.OrderRepo.GetOrderByID(id)
+    if err != nil {
+        return nil, errors.Wrap(ErrOrderNotFound, err.Error())
+    }
+    return order, nil
+}
+
+// AdvanceOrder moves an order to a new status on behalf of an admin. Paid and refunded
+// only follow money moved by the payment service, so they cannot be set here. Cancelling
+// claims the cancellation before any money moves, then voids and refunds the order's
+// payments; an order whose captured funds were refunded moves on from cancelled to
+// refunded. A release that fails leaves the order cancelled for RetryPaymentReleases.
+func (s *OrderService) AdvanceOrder(adminID, orderID uint, status, reason string) (*models.Order, error) {
+    if !IsValidOrderStatus(status) {
+        return nil, ErrInvalidOrderStatus
+    }
+    if status == models.OrderStatusPaid || status == models.OrderStatusRefunded {
+        return nil, ErrOrderStatusManaged
+    }
+    if status == models.OrderStatusCancelled && s.Payments == nil {
+        return nil, errors.Wrap(ErrTransitionOrderFailed, "no payment service to release the order's payments")
+    }
+    actor := OrderActor{Type: models.OrderActorAdmin, ID: adminID}
+    order, err := s.Lifecycle.Transition(orderID, status, actor, reason)
+    if err != nil || status != models.OrderStatusCancelled {
+        return order, err
+    }
+    if refunded, err := s.releasePayments(orderID); err == nil && refunded != nil {
+        return refunded, nil
+    }
+    return order, nil
+}
+
+// RetryPaymentReleases releases the payments of cancelled orders that still hold funds:
+// those whose release failed and those whose payment was still pending when they were
+// cancelled. main.go runs it on a schedule.
+func (s *OrderService) RetryPaymentReleases() error {
+    if s.Payments == nil {
+        return nil
+    }
+    orderIDs, err := s.Payments.OrdersAwaitingRelease(paymentReleaseBatch)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "FETCH_UNRELEASED_ORDERS_FAILED",
+        }).Error("Failed to fetch cancelled orders awaiting payment release")
+        return err
+    }
+    released := 0
+    for _, orderID := range orderIDs {
+        if _, err := s.releasePayments(orderID); err == nil {
+            released++
+        }
+    }
+    if len(orderIDs) > 0 {
+        s.Logger.WithFields(logrus.Fields{
+            "orders":   len(orderIDs),
+            "released": released,
+        }).Info("Retried payment releases of cancelled orders")
+    }
+    return nil
+}
+
+// releasePayments voids and refunds a cancelled order's payments. It returns the order
+// once refunding has moved it on to refunded, or nil while it stays cancelled.
+func (s *OrderService) releasePayments(orderID uint) (*models.Order, error) {
+    refunded, err := s.Payments.ReleaseOrderPayments(orderID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "order_id":   orderID,
+            "error":      err,
+            "error_code": "RELEASE_PAYMENTS_FAILED",
+        }).Error("Failed to release payments of cancelled order; it will be retried")
+        return nil, err
+    }
+    if !refunded {
+        return nil, nil
+    }
+    return s.Lifecycle.Transition(orderID, models.OrderStatusRefunded, SystemActor(), "payments refunded on cancellation")
+}
+
+func buildOrder(userID uint, address *models.Address, summary *CartSummary) *models.Order {
+    order := &models.Order{
+        UserID:           userID,
+        Status:           models.OrderStatusPending,
+        Subtotal:         summary.Subtotal,
+        DiscountTotal:    summary.DiscountTotal,
+        TaxTotal:         summary.TaxTotal,
+        PricesIncludeTax: summary.PricesIncludeTax,
+        ShippingMethod:   summary.ShippingMethod,
+        ShippingTotal:    summary.ShippingTotal,
+        Total:            summary.Total,
+        TaxCountry:       address.Country,
+        TaxRegion:        address.Region,
+        TaxPostalCode:    address.PostalCode,
+        ShipName:         address.Name,
+        ShipLine1:        address.Line1,
+        ShipLine2:        address.Line2,
+        ShipCity:         address.City,
+        ShipRegion:       address.Region,
+        ShipPostalCode:   address.PostalCode,
+        ShipCountry:      address.Country,
+        ShipPhone:        address.Phone,
+        Transitions: []models.OrderStatusTransition{{
+            ToStatus: models.OrderStatusPending,
+            Actor:    models.OrderActorUser,
+            ActorID:  userID,
+        }},
+    }
+    for _, item := range summary.Items {
+        order.Items = append(order.Items, models.OrderItem{
+            ProductID: item.ProductID,
+            Quantity:  item.Quantity,
+            Price:     item.Product.Price,
+        })
+    }
+    for _, line := range summary.TaxLines {
+        order.TaxLines = append(order.TaxLines, models.OrderTaxLine{
+            Name:          line.Name,
+            Rate:          line.Rate,
+            TaxableAmount: line.TaxableAmount,
+            Amount:        line.Amount,
+        })
+    }
+    return order
+}
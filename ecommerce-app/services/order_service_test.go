@@ -0,0 +1,257 @@
+package services_test
+
+import (
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/redis/go-redis/v9"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubCartRepository is an in-memory CartRepository. With products set,
+// AddItemQuantity checks their stock. Adding failProduct fails once.
+type stubCartRepository struct {
+    cartItems   []models.Cart
+    products    *stubProductRepository
+    failProduct uint
+}
+
+func (m *stubCartRepository) AddItem(cartItem *models.Cart) error {
+    m.cartItems = append(m.cartItems, *cartItem)
+    return nil
+}
+
+func (m *stubCartRepository) AddItemQuantity(userID, productID uint, quantity int) (*models.Cart, error) {
+    return m.addItemQuantity(userID, productID, quantity, false)
+}
+
+func (m *stubCartRepository) AddItemQuantityUpToStock(userID, productID uint, quantity int) (*models.Cart, error) {
+    return m.addItemQuantity(userID, productID, quantity, true)
+}
+
+func (m *stubCartRepository) addItemQuantity(userID, productID uint, quantity int, capToStock bool) (*models.Cart, error) {
+    if m.failProduct != 0 && m.failProduct == productID {
+        m.failProduct = 0
+        return nil, errors.New("connection reset")
+    }
+    var product models.Product
+    if m.products != nil {
+        found, err := m.products.GetProductByID(productID)
+        if err != nil {
+            return nil, err
+        }
+        product = *found
+    }
+    var kept []models.Cart
+    line := models.Cart{ID: uint(len(m.cartItems) + 1), UserID: userID, ProductID: productID, Quantity: quantity, PriceAtAdd: product.Price}
+    first := true
+    for _, item := range m.cartItems {
+        if item.UserID != userID || item.ProductID != productID {
+            kept = append(kept, item)
+            continue
+        }
+        line.Quantity += item.Quantity
+        if first {
+            line.ID, line.PriceAtAdd, first = item.ID, item.PriceAtAdd, false
+        }
+    }
+    if m.products != nil && line.Quantity > product.Stock {
+        if !capToStock || product.Stock <= 0 {
+            return nil, repositories.ErrCartQuantityExceedsStock
+        }
+        line.Quantity = product.Stock
+    }
+    line.Product = product
+    m.cartItems = append(kept, line)
+    return &line, nil
+}
+
+func (m *stubCartRepository) GetCartByUserID(userID uint) ([]models.Cart, error) {
+    var results []models.Cart
+    for _, item := range m.cartItems {
+        if item.UserID == userID {
+            results = append(results, item)
+        }
+    }
+    return results, nil
+}
+
+func (m *stubCartRepository) GetCartItemByID(userID, id uint) (*models.Cart, error) {
+    for _, item := range m.cartItems {
+        if item.ID == id && item.UserID == userID {
+            return &item, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubCartRepository) UpdateItem(userID uint, cartItem *models.Cart) error {
+    for i, item := range m.cartItems {
+        if item.ID == cartItem.ID && item.UserID == userID {
+            m.cartItems[i].Quantity = cartItem.Quantity
+            return nil
+        }
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (m *stubCartRepository) RepriceItem(userID, id uint, price float64) error {
+    for i, item := range m.cartItems {
+        if item.ID == id && item.UserID == userID {
+            m.cartItems[i].PriceAtAdd = price
+            return nil
+        }
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (m *stubCartRepository) DeleteItem(userID, id uint) error {
+    for i, item := range m.cartItems {
+        if item.ID == id && item.UserID == userID {
+            m.cartItems = append(m.cartItems[:i], m.cartItems[i+1:]...)
+            return nil
+        }
+    }
+    return gorm.ErrRecordNotFound
+}
+
+// stubCouponRepository is an in-memory CouponRepository
+type stubCouponRepository struct {
+    coupons     []models.Coupon
+    cartCoupons []models.CartCoupon
+    redemptions map[uint]int64
+}
+
+func (m *stubCouponRepository) CreateCoupon(coupon *models.Coupon) error {
+    m.coupons = append(m.coupons, *coupon)
+    return nil
+}
+
+func (m *stubCouponRepository) GetCoupons() ([]models.Coupon, error) {
+    return m.coupons, nil
+}
+
+func (m *stubCouponRepository) GetCouponByID(id uint) (*models.Coupon, error) {
+    for _, coupon := range m.coupons {
+        if coupon.ID == id {
+            return &coupon, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubCouponRepository) GetCouponByCode(code string) (*models.Coupon, error) {
+    for _, coupon := range m.coupons {
+        if coupon.Code == code {
+            return &coupon, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubCouponRepository) UpdateCoupon(coupon *models.Coupon) error {
+    return nil
+}
+
+func (m *stubCouponRepository) DeleteCoupon(id uint) error {
+    return nil
+}
+
+func (m *stubCouponRepository) GetCartCoupons(userID uint) ([]models.CartCoupon, error) {
+    var results []models.CartCoupon
+    for _, cartCoupon := range m.cartCoupons {
+        if cartCoupon.UserID == userID {
+            results = append(results, cartCoupon)
+        }
+    }
+    return results, nil
+}
+
+func (m *stubCouponRepository) AddCartCoupon(cartCoupon *models.CartCoupon) error {
+    coupon, _ := m.GetCouponByID(cartCoupon.CouponID)
+    cartCoupon.Coupon = *coupon
+    m.cartCoupons = append(m.cartCoupons, *cartCoupon)
+    return nil
+}
+
+func (m *stubCouponRepository) RemoveCartCoupon(userID, couponID uint) (bool, error) {
+    return false, nil
+}
+
+func (m *stubCouponRepository) ClearCartCoupons(userID uint) error {
+    return nil
+}
+
+func (m *stubCouponRepository) CountRedemptionsByUser(couponID, userID uint) (int64, error) {
+    return m.redemptions[couponID], nil
+}
+
+// newUnreachableRedis returns a client whose commands fail fast, exercising the
+// services' cache-miss paths
+func newUnreachableRedis() *redis.Client {
+    return redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+}
+
+func TestOrderService_Checkout(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Category: "apparel", Price: 20, Stock: 10, TaxClass: models.TaxClassStandard}
+    cartRepo := &stubCartRepository{cartItems: []models.Cart{{ID: 1, UserID: 1, ProductID: 1, Quantity: 3, Product: shirt}}}
+    couponRepo := &stubCouponRepository{
+        coupons: []models.Coupon{
+            {ID: 1, Code: "TEN", Type: models.CouponTypeFixedAmount, Value: 10, Stackable: true},
+            {ID: 2, Code: "ONCE", Type: models.CouponTypePercentage, Value: 50, Stackable: true, UsageLimitPerUser: 1},
+        },
+        redemptions: map[uint]int64{2: 1},
+    }
+    couponRepo.cartCoupons = []models.CartCoupon{
+        {UserID: 1, CouponID: 1, Coupon: couponRepo.coupons[0]},
+        {UserID: 1, CouponID: 2, Coupon: couponRepo.coupons[1]},
+    }
+    orderRepo := &stubOrderRepository{}
+    cartService := services.NewCartService(cartRepo, newStubProductRepository(shirt), couponRepo, nil, newUnreachableRedis(), newTestLogger())
+    cartService.TaxCalculator = services.NewTableTaxCalculator(testTaxTable(), false)
+    cartService.ShippingService = services.NewShippingService(testShippingMethods(), newTestLogger())
+    addressRepo := &stubAddressRepository{addresses: []models.Address{
+        {ID: 1, UserID: 1, Name: "Ada", Line1: "1 Main St", City: "New York", Region: "NY", PostalCode: "10001", Country: "US", IsDefault: true},
+        {ID: 2, UserID: 2, Name: "Bob", Line1: "2 Main St", City: "Berlin", PostalCode: "10115", Country: "DE", IsDefault: true},
+    }}
+    service := services.NewOrderService(orderRepo, addressRepo, cartService, nil, newTestLogger())
+
+    // Test a shipping method must be chosen and addresses must belong to the user
+    _, err := service.Checkout(1, 0, "")
+    assert.Equal(t, services.ErrShippingMethodRequired, err)
+    _, err = service.Checkout(1, 2, "standard")
+    assert.Equal(t, services.ErrAddressNotFound, err)
+
+    // Test an exhausted per-user coupon blocks checkout until it is removed
+    _, err = service.Checkout(1, 0, "standard")
+    assert.Equal(t, services.ErrCouponUserLimit, err)
+    assert.Empty(t, orderRepo.orders)
+    couponRepo.cartCoupons = couponRepo.cartCoupons[:1]
+
+    order, err := service.Checkout(1, 0, "standard")
+    assert.NoError(t, err)
+    assert.Equal(t, models.OrderStatusPending, order.Status)
+    assert.Equal(t, 60.0, order.Subtotal)
+    // Tax is charged on the discounted amount
+    assert.Equal(t, 10.0, order.DiscountTotal)
+    assert.Equal(t, 2.5, order.TaxTotal)
+    assert.Equal(t, 5.0, order.ShippingTotal)
+    assert.Equal(t, 57.5, order.Total)
+    assert.Equal(t, "10001", order.ShipPostalCode)
+    assert.Equal(t, "NY", order.TaxRegion)
+    assert.Len(t, order.Items, 1)
+    assert.Equal(t, 20.0, order.Items[0].Price)
+    assert.Len(t, order.TaxLines, 1)
+
+    // Test empty cart
+    _, err = service.Checkout(2, 0, "standard")
+    assert.Equal(t, services.ErrEmptyCart, err)
+
+    // Test other users cannot read the order
+    _, err = service.GetOrder(2, order.ID)
+    assert.Equal(t, services.ErrOrderNotFound, err)
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+    "bufio"
+    "crypto/sha1"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "regexp"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+    "golang.org/x/crypto/argon2"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// Password error types
+var (
+    ErrWeakPassword      = errors.New("password does not meet the password policy")
+    ErrBreachedPassword  = errors.New("password appears in a list of breached passwords")
+    ErrIncorrectPassword = errors.New("current password is incorrect")
+    ErrPasswordUnchanged = errors.New("new password must differ from the current one")
+)
+
+// Password hash algorithms
+const (
+    PasswordHashBcrypt   = "bcrypt"
+    PasswordHashArgon2id = "argon2id"
+)
+
+// PasswordPolicy is the set of rules new passwords must satisfy
+type PasswordPolicy struct {
+    MinLength     int
+    MaxLength     int
+    RequireUpper  bool
+    RequireLower  bool
+    RequireDigit  bool
+    RequireSymbol bool
+    // Breached holds SHA-1 hex digests (upper case) of known breached passwords
+    Breached map[string]struct{}
+}
+
+// Validate checks password against the policy. Passwords containing the username or
+// the local part of the email are rejected as well.
+func (p *PasswordPolicy) Validate(password, username, email string) error {
+    length := utf8.RuneCountInString(password)
+    if length < p.MinLength {
+        return errors.Wrapf(ErrWeakPassword, "must be at least %d characters", p.MinLength)
+    }
+    if p.MaxLength > 0 && length > p.MaxLength {
+        return errors.Wrapf(ErrWeakPassword, "must be at most %d characters", p.MaxLength)
+    }
+    var upper, lower, digit, symbol bool
+    for _, r := range password {
+        switch {
+        case unicode.IsUpper(r):
+            upper = true
+        case unicode.IsLower(r):
+            lower = true
+        case unicode.IsDigit(r):
+            digit = true
+        default:
+            symbol = true
+        }
+    }
+    switch {
+    case p.RequireUpper && !upper:
+        return errors.Wrap(ErrWeakPassword, "must contain an upper case letter")
+    case p.RequireLower && !lower:
+        return errors.Wrap(ErrWeakPassword, "must contain a lower case letter")
+    case p.RequireDigit && !digit:
+        return errors.Wrap(ErrWeakPassword, "must contain a digit")
+    case p.RequireSymbol && !symbol:
+        return errors.Wrap(ErrWeakPassword, "must contain a symbol")
+    }
+    lowered := strings.ToLower(password)
+    for _, personal := range []string{username, strings.SplitN(email, "@", 2)[0]} {
+        if len(personal) >= 3 && strings.Contains(lowered, strings.ToLower(personal)) {
+            return errors.Wrap(ErrWeakPassword, "must not contain your username or email")
+        }
+    }
+    if _, ok := p.Breached[sha1Hex(password)]; ok {
+        return ErrBreachedPassword
+    }
+    return nil
+}
+
+// LoadBreachedPasswords reads a breached-password list with one entry per line.
+// Entries may be plain passwords or SHA-1 hex digests, as in the Pwned Passwords
+// download; a ":count" suffix and blank or '#' lines are ignored.
+func LoadBreachedPasswords(path string) (map[string]struct{}, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    breached := make(map[string]struct{})
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        if sha1HexPattern.MatchString(line) {
+            breached[strings.ToUpper(line[:40])] = struct{}{}
+            continue
+        }
+        breached[sha1Hex(line)] = struct{}{}
+    }
+    return breached, scanner.Err()
+}
+
+var sha1HexPattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+func sha1Hex(s string) string {
+    sum := sha1.Sum([]byte(s))
+    return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Argon2Params are the argon2id cost parameters
+type Argon2Params struct {
+    MemoryKiB uint32
+    Time      uint32
+    Threads   uint8
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm and verifies
+// both bcrypt and argon2id hashes, reporting when a stored hash is out of date
+type PasswordHasher struct {
+    Algorithm  string
+    BcryptCost int
+    Argon2     Argon2Params
+}
+
+// Hash hashes password with the configured algorithm
+func (h *PasswordHasher) Hash(password string) (string, error) {
+    if h.Algorithm == PasswordHashBcrypt {
+        hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+        return string(hash), err
+    }
+    salt, err := randomBytes(16)
+    if err != nil {
+        return "", err
+    }
+    key := argon2.IDKey([]byte(password), salt, h.Argon2.Time, h.Argon2.MemoryKiB, h.Argon2.Threads, 32)
+    return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+        h.Argon2.MemoryKiB, h.Argon2.Time, h.Argon2.Threads,
+        base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches hash and, if it does, whether the hash
+// should be replaced because it uses another algorithm or weaker parameters
+func (h *PasswordHasher) Verify(hash, password string) (match bool, rehash bool) {
+    if strings.HasPrefix(hash, "$argon2id$") {
+        params, salt, key, err := parseArgon2Hash(hash)
+        if err != nil {
+            return false, false
+        }
+        computed := argon2.IDKey([]byte(password), salt, params.Time, params.MemoryKiB, params.Threads, uint32(len(key)))
+        if subtle.ConstantTimeCompare(computed, key) != 1 {
+            return false, false
+        }
+        return true, h.Algorithm != PasswordHashArgon2id || params != h.Argon2
+    }
+    if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+        return false, false
+    }
+    cost, err := bcrypt.Cost([]byte(hash))
+    return true, h.Algorithm != PasswordHashBcrypt || err != nil || cost < h.BcryptCost
+}
+
+func parseArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+    var params Argon2Params
+    parts := strings.Split(hash, "$")
+    if len(parts) != 6 {
+        return params, nil, nil, errors.New("malformed argon2id hash")
+    }
+    var version int
+    if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+        return params, nil, nil, errors.New("unsupported argon2 version")
+    }
+    if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.MemoryKiB, &params.Time, &params.Threads); err != nil {
+        return params, nil, nil, err
+    }
+    salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+    if err != nil {
+        return params, nil, nil, err
+    }
+    key, err := base64.RawStdEncoding.DecodeString(parts[5])
+    if err != nil {
+        return params, nil, nil, err
+    }
+    return params, salt, key, nil
+}
+
+// SessionRevoker signs a user out of every session. TokenService implements it.
+type SessionRevoker interface {
+    RevokeAll(userID uint) error
+}
+
+// PasswordService applies the password policy and hashing to users
+type PasswordService struct {
+    UserRepo  repositories.UserRepository
+    Policy    *PasswordPolicy
+    Hasher    *PasswordHasher
+    Sessions  SessionRevoker // optional
+    AuthCache AuthCache      // optional
+    Logger    *logrus.Logger
+}
+
+// NewPasswordService creates a new PasswordService
+func NewPasswordService(userRepo repositories.UserRepository, policy *PasswordPolicy, hasher *PasswordHasher, logger *logrus.Logger) *PasswordService {
+    return &PasswordService{
+        UserRepo: userRepo,
+        Policy:   policy,
+        Hasher:   hasher,
+        Logger:   logger,
+    }
+}
+
+// PreparePassword validates a new password against the policy and returns its hash
+func (s *PasswordService) PreparePassword(password, username, email string) (string, error) {
+    if err := s.Policy.Validate(password, username, email); err != nil {
+        return "", err
+    }
+    return s.Hasher.Hash(password)
+}
+
+// CheckPassword verifies a login password. A match against an outdated hash is
+// transparently rehashed; a failure to store the new hash does not fail the login.
+func (s *PasswordService) CheckPassword(user *models.User, password string) bool {
+    match, rehash := s.Hasher.Verify(user.Password, password)
+    if !match || !rehash {
+        return match
+    }
+    hash, err := s.Hasher.Hash(password)
+    if err == nil {
+        err = s.UserRepo.ReplacePasswordHash(user.ID, user.Password, hash)
+    }
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "error":      err,
+            "error_code": "REHASH_PASSWORD_FAILED",
+        }).Warn("Failed to upgrade password hash")
+        return true
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":   user.ID,
+        "algorithm": s.Hasher.Algorithm,
+    }).Info("Upgraded password hash")
+    return true
+}
+
+// ChangePassword replaces the password after checking the current one. All sessions
+// are signed out, including the caller's; the handler issues the caller new tokens.
+func (s *PasswordService) ChangePassword(userID uint, currentPassword, newPassword string) error {
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    if match, _ := s.Hasher.Verify(user.Password, currentPassword); !match {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error_code": "INCORRECT_PASSWORD",
+        }).Warn("Password change with incorrect current password")
+        return ErrIncorrectPassword
+    }
+    if currentPassword == newPassword {
+        return ErrPasswordUnchanged
+    }
+    hash, err := s.PreparePassword(newPassword, user.Username, user.Email)
+    if err != nil {
+        return err
+    }
+    if err := s.SetPassword(userID, hash); err != nil {
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": userID,
+    }).Info("Password changed")
+    return nil
+}
+
+// SetPassword stores an already prepared hash and signs the user out everywhere
+func (s *PasswordService) SetPassword(userID uint, hash string) error {
+    if err := s.UserRepo.UpdatePassword(userID, hash); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "UPDATE_PASSWORD_FAILED",
+        }).Error("Failed to update password")
+        return err
+    }
+    if s.Sessions != nil {
+        if err := s.Sessions.RevokeAll(userID); err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    userID,
+                "error":      err,
+                "error_code": "REVOKE_TOKEN_FAILED",
+            }).Error("Failed to revoke sessions")
+        }
+    }
+    invalidateCachedUser(s.AuthCache, s.Logger, userID)
+    return nil
+}
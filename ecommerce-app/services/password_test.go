@@ -0,0 +1,122 @@
+package services_test
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params keeps hashing fast in tests
+var testArgon2Params = services.Argon2Params{MemoryKiB: 1024, Time: 1, Threads: 1}
+
+// testPasswordHasher hashes new passwords with argon2id using testArgon2Params
+var testPasswordHasher = &services.PasswordHasher{
+    Algorithm:  services.PasswordHashArgon2id,
+    BcryptCost: bcrypt.MinCost,
+    Argon2:     testArgon2Params,
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+    policy := &services.PasswordPolicy{MinLength: 10, MaxLength: 20, RequireUpper: true, RequireDigit: true}
+
+    assert.NoError(t, policy.Validate("Correct-horse-9", "ann", "ann@example.com"))
+
+    tests := []string{
+        "Short9",                 // too short
+        "Correct-horse-battery9", // too long
+        "correct-horse-9",        // no upper case letter
+        "Correct-horse-x",        // no digit
+        "Hello-Ann-12345",        // contains the username
+    }
+    for _, password := range tests {
+        err := policy.Validate(password, "ann", "someone@example.com")
+        assert.Equal(t, services.ErrWeakPassword, errors.Cause(err), password)
+    }
+
+    // Test the local part of the email is rejected too
+    err := policy.Validate("Annabel-Lee-99", "al", "annabel@example.com")
+    assert.Equal(t, services.ErrWeakPassword, errors.Cause(err))
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "breached.txt")
+    // The second entry is SHA-1("Password1234") with a Pwned Passwords count
+    content := "# common passwords\nletmein12345\n\n5B96672AE7709EAB297550CAE362D5BEE468C57D:42\n"
+    assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+    breached, err := services.LoadBreachedPasswords(path)
+    assert.NoError(t, err)
+    assert.Len(t, breached, 2)
+
+    policy := &services.PasswordPolicy{MinLength: 10, Breached: breached}
+    assert.Equal(t, services.ErrBreachedPassword, policy.Validate("letmein12345", "ann", "ann@example.com"))
+    assert.Equal(t, services.ErrBreachedPassword, policy.Validate("Password1234", "ann", "ann@example.com"))
+    assert.NoError(t, policy.Validate("letmein123456", "ann", "ann@example.com"))
+}
+
+func TestPasswordHasher_Verify(t *testing.T) {
+    hasher := &services.PasswordHasher{Algorithm: services.PasswordHashArgon2id, BcryptCost: bcrypt.MinCost, Argon2: testArgon2Params}
+
+    hash, err := hasher.Hash("Correct-horse-9")
+    assert.NoError(t, err)
+    assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+    match, rehash := hasher.Verify(hash, "Correct-horse-9")
+    assert.True(t, match)
+    assert.False(t, rehash)
+    match, _ = hasher.Verify(hash, "Correct-horse-8")
+    assert.False(t, match)
+
+    // Test stronger parameters mark existing hashes for upgrade
+    stronger := *hasher
+    stronger.Argon2.Time = 2
+    match, rehash = stronger.Verify(hash, "Correct-horse-9")
+    assert.True(t, match)
+    assert.True(t, rehash)
+
+    // Test legacy bcrypt hashes still verify and are marked for upgrade
+    legacy, _ := bcrypt.GenerateFromPassword([]byte("Correct-horse-9"), bcrypt.MinCost)
+    match, rehash = hasher.Verify(string(legacy), "Correct-horse-9")
+    assert.True(t, match)
+    assert.True(t, rehash)
+}
+
+func TestPasswordService_CheckPasswordUpgradesHash(t *testing.T) {
+    legacy, _ := bcrypt.GenerateFromPassword([]byte("Correct-horse-9"), bcrypt.MinCost)
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Password: string(legacy)}}}
+    service := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+
+    user, _ := userRepo.GetUserByID(1)
+    assert.False(t, service.CheckPassword(user, "wrong-password"))
+    assert.Equal(t, string(legacy), userRepo.users[0].Password)
+
+    assert.True(t, service.CheckPassword(user, "Correct-horse-9"))
+    assert.True(t, strings.HasPrefix(userRepo.users[0].Password, "$argon2id$"))
+    // Test an upgrade does not sign the user out
+    assert.Equal(t, 0, userRepo.users[0].TokenVersion)
+}
+
+func TestPasswordService_ChangePassword(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann", Email: "ann@example.com"}}}
+    service := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    sessions := &stubSessionRevoker{}
+    service.Sessions = sessions
+    userRepo.users[0].Password, _ = service.Hasher.Hash("Correct-horse-9")
+
+    assert.Equal(t, services.ErrIncorrectPassword, service.ChangePassword(1, "wrong-password", "Battery-staple-7"))
+    assert.Equal(t, services.ErrPasswordUnchanged, service.ChangePassword(1, "Correct-horse-9", "Correct-horse-9"))
+    assert.Equal(t, services.ErrWeakPassword, errors.Cause(service.ChangePassword(1, "Correct-horse-9", "short")))
+    assert.Empty(t, sessions.revoked)
+
+    assert.NoError(t, service.ChangePassword(1, "Correct-horse-9", "Battery-staple-7"))
+    match, _ := service.Hasher.Verify(userRepo.users[0].Password, "Battery-staple-7")
+    assert.True(t, match)
+    assert.Equal(t, 1, userRepo.users[0].TokenVersion)
+    assert.Equal(t, []uint{1}, sessions.revoked)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "sync"
+    "time"
+
+    "github.com/pkg/errors"
+)
+
+// Payment provider error types
+var (
+    ErrPaymentDeclined       = errors.New("payment declined")
+    ErrPaymentTimeout        = errors.New("payment provider timed out")
+    ErrProviderChargeUnknown = errors.New("unknown provider charge")
+    ErrProviderAmount        = errors.New("amount exceeds what the provider can settle")
+)
+
+// PaymentRequest asks a provider to authorize an amount for an order. Reference is an
+// idempotency key: authorizing the same reference twice returns the first charge.
+type PaymentRequest struct {
+    OrderID   uint
+    Reference string
+    Amount    float64
+}
+
+// PaymentProvider is a payment gateway. Authorize reserves funds and returns the
+// provider's charge reference; Capture settles authorized funds, Void releases them
+// and Refund returns captured funds. Capturing the full amount of a charge that is
+// already fully captured must succeed, so a capture we failed to record can be retried.
+type PaymentProvider interface {
+    Name() string
+    Authorize(request PaymentRequest) (string, error)
+    Capture(providerRef string, amount float64) error
+    Void(providerRef string) error
+    Refund(providerRef string, amount float64) error
+}
+
+// Fake payment provider behaviours
+const (
+    FakePaymentSuccess = "success"
+    FakePaymentDecline = "decline"
+    FakePaymentTimeout = "timeout"
+)
+
+type fakeCharge struct {
+    authorized float64
+    captured   float64
+    refunded   float64
+    voided     bool
+}
+
+// FakePaymentProvider is an in-process gateway for local runs and tests. Behavior
+// decides how authorizations end; Delay simulates gateway latency.
+type FakePaymentProvider struct {
+    Behavior string
+    Delay    time.Duration
+
+    mu      sync.Mutex
+    charges map[string]*fakeCharge
+    refs    map[string]string
+}
+
+// NewFakePaymentProvider creates a FakePaymentProvider; an empty behavior succeeds
+func NewFakePaymentProvider(behavior string, delay time.Duration) *FakePaymentProvider {
+    if behavior == "" {
+        behavior = FakePaymentSuccess
+    }
+    return &FakePaymentProvider{
+        Behavior: behavior,
+        Delay:    delay,
+        charges:  make(map[string]*fakeCharge),
+        refs:     make(map[string]string),
+    }
+}
+
+func (p *FakePaymentProvider) Name() string {
+    return "fake"
+}
+
+func (p *FakePaymentProvider) Authorize(request PaymentRequest) (string, error) {
+    if p.Delay > 0 {
+        time.Sleep(p.Delay)
+    }
+    switch p.Behavior {
+    case FakePaymentDecline:
+        return "", errors.Wrap(ErrPaymentDeclined, "card declined by fake provider")
+    case FakePaymentTimeout:
+        return "", ErrPaymentTimeout
+    }
+
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if ref, ok := p.refs[request.Reference]; ok {
+        return ref, nil
+    }
+    suffix, err := randomHex(12)
+    if err != nil {
+        return "", err
+    }
+    ref := "fake_" + suffix
+    p.refs[request.Reference] = ref
+    p.charges[ref] = &fakeCharge{authorized: request.Amount}
+    return ref, nil
+}
+
+func (p *FakePaymentProvider) Capture(providerRef string, amount float64) error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    charge, ok := p.charges[providerRef]
+    if !ok || charge.voided {
+        return ErrProviderChargeUnknown
+    }
+    if amount == charge.authorized && charge.captured == charge.authorized {
+        return nil
+    }
+    if roundMoney(charge.captured+amount) > charge.authorized {
+        return ErrProviderAmount
+    }
+    charge.captured = roundMoney(charge.captured + amount)
+    return nil
+}
+
+func (p *FakePaymentProvider) Void(providerRef string) error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    charge, ok := p.charges[providerRef]
+    if !ok || charge.captured > 0 {
+        return ErrProviderChargeUnknown
+    }
+    charge.voided = true
+    return nil
+}
+
+func (p *FakePaymentProvider) Refund(providerRef string, amount float64) error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    charge, ok := p.charges[providerRef]
+    if !ok {
+        return ErrProviderChargeUnknown
+    }
+    if roundMoney(charge.refunded+amount) > charge.captured {
+        return ErrProviderAmount
+    }
+    charge.refunded = roundMoney(charge.refunded + amount)
+    return nil
+}
+
+// randomBytes returns n bytes from the system CSPRNG
+func randomBytes(n int) ([]byte, error) {
+    buf := make([]byte, n)
+    if _, err := rand.Read(buf); err != nil {
+        return nil, err
+    }
+    return buf, nil
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+    buf, err := randomBytes(n)
+    if err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,610 @@
+package services
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "math"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// Payment error types
+var (
+    ErrPaymentNotFound          = errors.New("payment not found")
+    ErrPaymentPending           = errors.New("payment is pending confirmation from the provider")
+    ErrPaymentFailed            = errors.New("payment failed")
+    ErrOrderNotPayable          = errors.New("order cannot be paid in its current status")
+    ErrOrderAlreadyPaid         = errors.New("order already has an active payment")
+    ErrInvalidPaymentTransition = errors.New("invalid payment status transition")
+    ErrPaymentStatusChanged     = errors.New("payment status changed concurrently")
+    ErrInvalidCaptureAmount     = errors.New("invalid capture amount")
+    ErrInvalidRefundAmount      = errors.New("invalid refund amount")
+    ErrInvalidWebhookSignature  = errors.New("invalid webhook signature")
+    ErrInvalidWebhookPayload    = errors.New("invalid webhook payload")
+)
+
+// Webhook event types sent by payment providers
+const (
+    PaymentEventAuthorized = "payment.authorized"
+    PaymentEventCaptured   = "payment.captured"
+    PaymentEventFailed     = "payment.failed"
+    PaymentEventVoided     = "payment.voided"
+    PaymentEventRefunded   = "payment.refunded"
+)
+
+// paymentTransitions lists the statuses each payment status may move to
+var paymentTransitions = map[string][]string{
+    models.PaymentStatusPending:           {models.PaymentStatusAuthorized, models.PaymentStatusFailed},
+    models.PaymentStatusAuthorized:        {models.PaymentStatusCaptured, models.PaymentStatusVoided, models.PaymentStatusFailed},
+    models.PaymentStatusCaptured:          {models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded},
+    models.PaymentStatusPartiallyRefunded: {models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded},
+}
+
+// CanTransitionPayment reports whether a payment may move from one status to another
+func CanTransitionPayment(from, to string) bool {
+    for _, next := range paymentTransitions[from] {
+        if next == to {
+            return true
+        }
+    }
+    return false
+}
+
+// PaymentWebhook is the body of an asynchronous payment status update
+type PaymentWebhook struct {
+    EventID     string  `json:"event_id"`
+    Type        string  `json:"type"`
+    Reference   string  `json:"reference"`
+    ProviderRef string  `json:"provider_ref"`
+    Amount      float64 `json:"amount"`
+    Reason      string  `json:"reason"`
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of the body
+func SignWebhookPayload(secret string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a webhook signature in constant time. Without a
+// configured secret every webhook is rejected.
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+    if secret == "" || signature == "" {
+        return false
+    }
+    return hmac.Equal([]byte(SignWebhookPayload(secret, body)), []byte(signature))
+}
+
+// PaymentService takes payment for orders through a PaymentProvider
+type PaymentService struct {
+    PaymentRepo   repositories.PaymentRepository
+    OrderRepo     repositories.OrderRepository
+    Lifecycle     *OrderLifecycle
+    Provider      PaymentProvider
+    WebhookSecret string
+    AutoCapture   bool // capture as soon as the authorization succeeds
+    Logger        *logrus.Logger
+}
+
+// NewPaymentService creates a new PaymentService
+func NewPaymentService(paymentRepo repositories.PaymentRepository, orderRepo repositories.OrderRepository, lifecycle *OrderLifecycle, provider PaymentProvider, webhookSecret string, autoCapture bool, logger *logrus.Logger) *PaymentService {
+    return &PaymentService{
+        PaymentRepo:   paymentRepo,
+        OrderRepo:     orderRepo,
+        Lifecycle:     lifecycle,
+        Provider:      provider,
+        WebhookSecret: webhookSecret,
+        AutoCapture:   autoCapture,
+        Logger:        logger,
+    }
+}
+
+// PayOrder authorizes the order total with the provider. A payment left pending by a
+// provider timeout is retried with the same reference so the customer is never charged twice.
+func (s *PaymentService) PayOrder(userID, orderID uint) (*models.Payment, error) {
+    order, err := s.OrderRepo.GetOrderByID(orderID)
+    if err != nil {
+        return nil, errors.Wrap(ErrOrderNotFound, err.Error())
+    }
+    if order.UserID != userID {
+        return nil, ErrOrderNotFound
+    }
+    if order.Status != models.OrderStatusPending {
+        return nil, ErrOrderNotPayable
+    }
+    payments, err := s.PaymentRepo.GetPaymentsByOrderID(orderID)
+    if err != nil {
+        return nil, errors.Wrap(ErrPaymentFailed, err.Error())
+    }
+
+    var payment *models.Payment
+    for i := range payments {
+        switch payments[i].Status {
+        case models.PaymentStatusPending:
+            payment = &payments[i]
+        case models.PaymentStatusAuthorized, models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded:
+            return nil, ErrOrderAlreadyPaid
+        }
+    }
+    if payment == nil {
+        reference, err := randomHex(16)
+        if err != nil {
+            return nil, errors.Wrap(ErrPaymentFailed, err.Error())
+        }
+        payment = &models.Payment{
+            OrderID:   orderID,
+            Provider:  s.Provider.Name(),
+            Reference: "pay_" + reference,
+            Status:    models.PaymentStatusPending,
+            Amount:    order.Total,
+        }
+        if err := s.PaymentRepo.CreatePayment(payment); err != nil {
+            if err == repositories.ErrOpenPaymentExists {
+                return nil, ErrOrderAlreadyPaid
+            }
+            s.Logger.WithFields(logrus.Fields{
+                "order_id":   orderID,
+                "error":      err,
+                "error_code": "CREATE_PAYMENT_FAILED",
+            }).Error("Failed to create payment")
+            return nil, errors.Wrap(ErrPaymentFailed, err.Error())
+        }
+    }
+
+    providerRef, err := s.Provider.Authorize(PaymentRequest{
+        OrderID:   orderID,
+        Reference: payment.Reference,
+        Amount:    payment.Amount,
+    })
+    switch errors.Cause(err) {
+    case nil:
+    case ErrPaymentTimeout:
+        s.Logger.WithFields(logrus.Fields{
+            "order_id":   orderID,
+            "payment_id": payment.ID,
+            "error_code": "PAYMENT_TIMEOUT",
+        }).Warn("Payment provider timed out; awaiting webhook")
+        return payment, ErrPaymentPending
+    case ErrPaymentDeclined:
+        payment.FailureReason = err.Error()
+        if err := s.transition(payment, models.PaymentStatusFailed); err != nil {
+            return nil, err
+        }
+        s.Logger.WithFields(logrus.Fields{
+            "order_id":   orderID,
+            "payment_id": payment.ID,
+            "error_code": "PAYMENT_DECLINED",
+        }).Warn("Payment declined")
+        return payment, ErrPaymentDeclined
+    default:
+        s.Logger.WithFields(logrus.Fields{
+            "order_id":   orderID,
+            "payment_id": payment.ID,
+            "error":      err,
+            "error_code": "PAYMENT_FAILED",
+        }).Error("Payment authorization failed")
+        return nil, errors.Wrap(ErrPaymentFailed, err.Error())
+    }
+
+    payment.ProviderRef = providerRef
+    if err := s.transition(payment, models.PaymentStatusAuthorized); err != nil {
+        // A concurrent attempt authorized the same reference first
+        if errors.Cause(err) == ErrPaymentStatusChanged {
+            return nil, ErrOrderAlreadyPaid
+        }
+        return nil, err
+    }
+    if s.AutoCapture {
+        if err := s.Provider.Capture(payment.ProviderRef, payment.Amount); err != nil {
+            return nil, s.providerError(payment, "capture", err)
+        }
+        if err := s.capture(payment, payment.Amount); err != nil {
+            return nil, err
+        }
+    }
+    return payment, nil
+}
+
+// GetOrderPayments returns the payments of one of the user's orders
+func (s *PaymentService) GetOrderPayments(userID, orderID uint) ([]models.Payment, error) {
+    order, err := s.OrderRepo.GetOrderByID(orderID)
+    if err != nil {
+        return nil, errors.Wrap(ErrOrderNotFound, err.Error())
+    }
+    if order.UserID != userID {
+        return nil, ErrOrderNotFound
+    }
+    return s.PaymentRepo.GetPaymentsByOrderID(orderID)
+}
+
+// CapturePayment settles an authorized payment and marks its order paid
+func (s *PaymentService) CapturePayment(id uint) (*models.Payment, error) {
+    payment, err := s.getPayment(id)
+    if err != nil {
+        return nil, err
+    }
+    if !CanTransitionPayment(payment.Status, models.PaymentStatusCaptured) {
+        return nil, ErrInvalidPaymentTransition
+    }
+    if err := s.Provider.Capture(payment.ProviderRef, payment.Amount); err != nil {
+        return nil, s.providerError(payment, "capture", err)
+    }
+    if err := s.capture(payment, payment.Amount); err != nil {
+        return nil, err
+    }
+    return payment, nil
+}
+
+// VoidPayment releases an authorization that has not been captured
+func (s *PaymentService) VoidPayment(id uint) (*models.Payment, error) {
+    payment, err := s.getPayment(id)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.void(payment); err != nil {
+        return nil, err
+    }
+    return payment, nil
+}
+
+// RefundPayment returns captured funds; an amount of 0 refunds everything not yet refunded
+func (s *PaymentService) RefundPayment(id uint, amount float64) (*models.Payment, error) {
+    payment, err := s.getPayment(id)
+    if err != nil {
+        return nil, err
+    }
+    if amount == 0 {
+        amount = roundMoney(payment.CapturedAmount - payment.RefundedAmount)
+    }
+    if err := s.refundPayment(payment, roundMoney(amount)); err != nil {
+        return nil, err
+    }
+    if payment.Status == models.PaymentStatusRefunded {
+        s.transitionOrder(payment, models.OrderStatusRefunded)
+    }
+    return payment, nil
+}
+
+// ReleaseOrderPayments gives back everything taken for a cancelled order: authorizations
+// are voided and captured funds refunded in full. The order's status is left to the
+// caller. It reports whether any of the order's payments has been refunded, by this call
+// or an earlier one that failed part-way, and fails with ErrPaymentPending while a
+// payment still awaits the provider.
+func (s *PaymentService) ReleaseOrderPayments(orderID uint) (bool, error) {
+    payments, err := s.PaymentRepo.GetPaymentsByOrderID(orderID)
+    if err != nil {
+        return false, errors.Wrap(ErrPaymentFailed, err.Error())
+    }
+    refunded := false
+    for _, payment := range payments {
+        if payment.Status == models.PaymentStatusPending {
+            return false, ErrPaymentPending
+        }
+        if payment.Status == models.PaymentStatusRefunded {
+            refunded = true
+        }
+    }
+    for i := range payments {
+        payment := &payments[i]
+        switch payment.Status {
+        case models.PaymentStatusAuthorized:
+            if err := s.void(payment); err != nil {
+                return refunded, err
+            }
+        case models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded:
+            if err := s.refundPayment(payment, roundMoney(payment.CapturedAmount-payment.RefundedAmount)); err != nil {
+                return refunded, err
+            }
+            refunded = true
+        }
+    }
+    return refunded, nil
+}
+
+// OrdersAwaitingRelease lists up to limit cancelled orders that still hold authorized or
+// captured funds
+func (s *PaymentService) OrdersAwaitingRelease(limit int) ([]uint, error) {
+    orderIDs, err := s.PaymentRepo.GetOrdersAwaitingRelease(limit)
+    if err != nil {
+        return nil, errors.Wrap(ErrPaymentFailed, err.Error())
+    }
+    return orderIDs, nil
+}
+
+// RefundOrder refunds amount across the order's captured payments, oldest first
+func (s *PaymentService) RefundOrder(orderID uint, amount float64) error {
+    amount = roundMoney(amount)
+    payments, err := s.PaymentRepo.GetPaymentsByOrderID(orderID)
+    if err != nil {
+        return errors.Wrap(ErrPaymentFailed, err.Error())
+    }
+    refundable := 0.0
+    for _, payment := range payments {
+        if payment.Status == models.PaymentStatusCaptured || payment.Status == models.PaymentStatusPartiallyRefunded {
+            refundable += payment.CapturedAmount - payment.RefundedAmount
+        }
+    }
+    if amount <= 0 || amount > roundMoney(refundable) {
+        return ErrInvalidRefundAmount
+    }
+    for i := range payments {
+        if amount == 0 {
+            break
+        }
+        payment := &payments[i]
+        if payment.Status != models.PaymentStatusCaptured && payment.Status != models.PaymentStatusPartiallyRefunded {
+            continue
+        }
+        share := math.Min(amount, roundMoney(payment.CapturedAmount-payment.RefundedAmount))
+        if _, err := s.RefundPayment(payment.ID, share); err != nil {
+            return err
+        }
+        amount = roundMoney(amount - share)
+    }
+    return nil
+}
+
+// HandleWebhook verifies and applies an asynchronous payment status update. Redelivered
+// events and updates that no longer apply to the payment are acknowledged and ignored.
+// An event that fails to apply is forgotten, so the provider's retry applies it again,
+// unless its amount can never apply; that is rejected as ErrInvalidWebhookPayload.
+func (s *PaymentService) HandleWebhook(body []byte, signature string) error {
+    if !VerifyWebhookSignature(s.WebhookSecret, body, signature) {
+        s.Logger.WithFields(logrus.Fields{
+            "error_code": "INVALID_WEBHOOK_SIGNATURE",
+        }).Warn("Rejected payment webhook")
+        return ErrInvalidWebhookSignature
+    }
+    var event PaymentWebhook
+    if err := json.Unmarshal(body, &event); err != nil {
+        return errors.Wrap(ErrInvalidWebhookPayload, err.Error())
+    }
+    if event.EventID == "" || event.Type == "" || event.Reference == "" {
+        return errors.Wrap(ErrInvalidWebhookPayload, "event_id, type and reference are required")
+    }
+    payment, err := s.PaymentRepo.GetPaymentByReference(event.Reference)
+    if err != nil {
+        return errors.Wrap(ErrPaymentNotFound, err.Error())
+    }
+    isNew, err := s.PaymentRepo.RecordWebhookEvent(&models.PaymentWebhookEvent{
+        EventID:   event.EventID,
+        Type:      event.Type,
+        Reference: event.Reference,
+    })
+    if err != nil {
+        return errors.Wrap(ErrPaymentFailed, err.Error())
+    }
+    if !isNew {
+        s.Logger.WithFields(logrus.Fields{
+            "event_id": event.EventID,
+        }).Info("Ignoring redelivered payment webhook")
+        return nil
+    }
+
+    switch event.Type {
+    case PaymentEventAuthorized:
+        if event.ProviderRef != "" {
+            payment.ProviderRef = event.ProviderRef
+        }
+        // A retry after a failed capture finds the payment already authorized
+        if payment.Status != models.PaymentStatusAuthorized {
+            err = s.transition(payment, models.PaymentStatusAuthorized)
+        }
+        if err == nil && s.AutoCapture {
+            if err = s.Provider.Capture(payment.ProviderRef, payment.Amount); err == nil {
+                err = s.capture(payment, payment.Amount)
+            }
+        }
+    case PaymentEventCaptured:
+        amount := event.Amount
+        if amount == 0 {
+            amount = payment.Amount
+        }
+        err = s.capture(payment, amount)
+    case PaymentEventFailed:
+        payment.FailureReason = event.Reason
+        err = s.transition(payment, models.PaymentStatusFailed)
+    case PaymentEventVoided:
+        err = s.transition(payment, models.PaymentStatusVoided)
+    case PaymentEventRefunded:
+        amount := event.Amount
+        if amount == 0 {
+            amount = roundMoney(payment.CapturedAmount - payment.RefundedAmount)
+        }
+        err = s.refund(payment, amount)
+    default:
+        return errors.Wrap(ErrInvalidWebhookPayload, "unknown event type "+event.Type)
+    }
+    if errors.Cause(err) == ErrInvalidPaymentTransition {
+        s.Logger.WithFields(logrus.Fields{
+            "event_id":   event.EventID,
+            "type":       event.Type,
+            "payment_id": payment.ID,
+            "status":     payment.Status,
+            "error_code": "INVALID_PAYMENT_TRANSITION",
+        }).Warn("Ignoring payment webhook that does not apply")
+        return nil
+    }
+    if cause := errors.Cause(err); cause == ErrInvalidCaptureAmount || cause == ErrInvalidRefundAmount {
+        // Redelivering the same amount cannot succeed, so the event stays recorded
+        s.Logger.WithFields(logrus.Fields{
+            "event_id":   event.EventID,
+            "type":       event.Type,
+            "payment_id": payment.ID,
+            "amount":     event.Amount,
+            "error_code": "INVALID_WEBHOOK_AMOUNT",
+        }).Warn("Rejected payment webhook amount")
+        return errors.Wrap(ErrInvalidWebhookPayload, err.Error())
+    }
+    if err != nil {
+        if forgetErr := s.PaymentRepo.ForgetWebhookEvent(event.EventID); forgetErr != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "event_id":   event.EventID,
+                "error":      forgetErr,
+                "error_code": "FORGET_WEBHOOK_EVENT_FAILED",
+            }).Error("Failed to forget unapplied payment webhook; its retry will be ignored")
+        }
+        return err
+    }
+    return nil
+}
+
+func (s *PaymentService) getPayment(id uint) (*models.Payment, error) {
+    payment, err := s.PaymentRepo.GetPaymentByID(id)
+    if err != nil {
+        return nil, errors.Wrap(ErrPaymentNotFound, err.Error())
+    }
+    return payment, nil
+}
+
+// transition moves the payment to a new status and stores it
+func (s *PaymentService) transition(payment *models.Payment, status string) error {
+    return s.update(payment, status, payment.RefundedAmount)
+}
+
+// update moves the payment to a new status and stores it, provided the stored payment
+// still has the payment's current status and the refunded amount given
+func (s *PaymentService) update(payment *models.Payment, status string, fromRefunded float64) error {
+    if !CanTransitionPayment(payment.Status, status) {
+        return errors.Wrap(ErrInvalidPaymentTransition, payment.Status+" -> "+status)
+    }
+    previous := payment.Status
+    payment.Status = status
+    if err := s.PaymentRepo.UpdatePayment(payment, previous, fromRefunded); err != nil {
+        payment.Status = previous
+        if err == repositories.ErrPaymentStatusChanged {
+            return errors.Wrap(ErrPaymentStatusChanged, previous+" -> "+status)
+        }
+        s.Logger.WithFields(logrus.Fields{
+            "payment_id": payment.ID,
+            "status":     status,
+            "error":      err,
+            "error_code": "UPDATE_PAYMENT_FAILED",
+        }).Error("Failed to update payment")
+        return errors.Wrap(ErrPaymentFailed, err.Error())
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "payment_id": payment.ID,
+        "order_id":   payment.OrderID,
+        "from":       previous,
+        "to":         status,
+    }).Info("Payment status changed")
+    return nil
+}
+
+// void releases the payment's authorization with the provider and records it
+func (s *PaymentService) void(payment *models.Payment) error {
+    if !CanTransitionPayment(payment.Status, models.PaymentStatusVoided) {
+        return ErrInvalidPaymentTransition
+    }
+    if err := s.Provider.Void(payment.ProviderRef); err != nil {
+        return s.providerError(payment, "void", err)
+    }
+    return s.transition(payment, models.PaymentStatusVoided)
+}
+
+// refundPayment records a refund and then asks the provider for it, so concurrent
+// refunds cannot both claim the same funds. A refund the provider rejects is taken back.
+func (s *PaymentService) refundPayment(payment *models.Payment, amount float64) error {
+    previous := *payment
+    if err := s.recordRefund(payment, amount); err != nil {
+        if errors.Cause(err) == ErrInvalidPaymentTransition {
+            return ErrInvalidPaymentTransition
+        }
+        return err
+    }
+    if err := s.Provider.Refund(payment.ProviderRef, amount); err != nil {
+        if restoreErr := s.PaymentRepo.UpdatePayment(&previous, payment.Status, payment.RefundedAmount); restoreErr != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "payment_id": payment.ID,
+                "amount":     amount,
+                "error":      restoreErr,
+                "error_code": "RESTORE_REFUND_FAILED",
+            }).Error("Failed to take back refund the provider rejected")
+        }
+        return s.providerError(payment, "refund", err)
+    }
+    return nil
+}
+
+// capture records captured funds, at most the payment's amount, and marks the order paid
+func (s *PaymentService) capture(payment *models.Payment, amount float64) error {
+    if !CanTransitionPayment(payment.Status, models.PaymentStatusCaptured) {
+        return errors.Wrap(ErrInvalidPaymentTransition, payment.Status+" -> "+models.PaymentStatusCaptured)
+    }
+    amount = roundMoney(amount)
+    if amount <= 0 || amount > payment.Amount {
+        return errors.Wrap(ErrInvalidCaptureAmount, fmt.Sprintf("%.2f of %.2f", amount, payment.Amount))
+    }
+    payment.CapturedAmount = amount
+    if err := s.transition(payment, models.PaymentStatusCaptured); err != nil {
+        return err
+    }
+    s.transitionOrder(payment, models.OrderStatusPaid)
+    return nil
+}
+
+// refund records refunded funds; a full refund marks the order refunded
+func (s *PaymentService) refund(payment *models.Payment, amount float64) error {
+    if err := s.recordRefund(payment, amount); err != nil {
+        return err
+    }
+    if payment.Status == models.PaymentStatusRefunded {
+        s.transitionOrder(payment, models.OrderStatusRefunded)
+    }
+    return nil
+}
+
+// recordRefund adds amount to the payment's refunded total and stores it
+func (s *PaymentService) recordRefund(payment *models.Payment, amount float64) error {
+    remaining := roundMoney(payment.CapturedAmount - payment.RefundedAmount)
+    if amount <= 0 || amount > remaining {
+        return ErrInvalidRefundAmount
+    }
+    next := models.PaymentStatusPartiallyRefunded
+    if amount == remaining {
+        next = models.PaymentStatusRefunded
+    }
+    if !CanTransitionPayment(payment.Status, next) {
+        return errors.Wrap(ErrInvalidPaymentTransition, payment.Status+" -> "+next)
+    }
+    refunded := payment.RefundedAmount
+    payment.RefundedAmount = roundMoney(refunded + amount)
+    if err := s.update(payment, next, refunded); err != nil {
+        payment.RefundedAmount = refunded
+        return err
+    }
+    return nil
+}
+
+// transitionOrder follows a payment change on the order. The money has already moved,
+// so an order that cannot follow is logged for manual follow-up instead of failing.
+func (s *PaymentService) transitionOrder(payment *models.Payment, status string) {
+    _, err := s.Lifecycle.Transition(payment.OrderID, status, SystemActor(), "payment "+payment.Status)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "order_id":   payment.OrderID,
+            "payment_id": payment.ID,
+            "status":     status,
+            "error":      err,
+            "error_code": "ORDER_TRANSITION_FAILED",
+        }).Error("Order did not follow payment")
+    }
+}
+
+func (s *PaymentService) providerError(payment *models.Payment, operation string, err error) error {
+    s.Logger.WithFields(logrus.Fields{
+        "payment_id": payment.ID,
+        "operation":  operation,
+        "error":      err,
+        "error_code": "PAYMENT_PROVIDER_FAILED",
+    }).Error("Payment provider request failed")
+    return errors.Wrap(ErrPaymentFailed, err.Error())
+}
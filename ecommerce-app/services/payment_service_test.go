@@ -0,0 +1,343 @@
+package services_test
+
+import (
+    "encoding/json"
+    "fmt"
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubPaymentRepository is an in-memory PaymentRepository. Saving a payment in
+// failStatus fails once.
+type stubPaymentRepository struct {
+    payments   []models.Payment
+    events     map[string]bool
+    failStatus string
+    orders     *stubOrderRepository
+}
+
+func (m *stubPaymentRepository) CreatePayment(payment *models.Payment) error {
+    for _, existing := range m.payments {
+        if existing.OrderID == payment.OrderID && existing.Status != models.PaymentStatusFailed && existing.Status != models.PaymentStatusVoided {
+            return repositories.ErrOpenPaymentExists
+        }
+    }
+    payment.ID = uint(len(m.payments) + 1)
+    m.payments = append(m.payments, *payment)
+    return nil
+}
+
+func (m *stubPaymentRepository) GetPaymentByID(id uint) (*models.Payment, error) {
+    for _, payment := range m.payments {
+        if payment.ID == id {
+            return &payment, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubPaymentRepository) GetPaymentByReference(reference string) (*models.Payment, error) {
+    for _, payment := range m.payments {
+        if payment.Reference == reference {
+            return &payment, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubPaymentRepository) GetPaymentsByOrderID(orderID uint) ([]models.Payment, error) {
+    var results []models.Payment
+    for _, payment := range m.payments {
+        if payment.OrderID == orderID {
+            results = append(results, payment)
+        }
+    }
+    return results, nil
+}
+
+func (m *stubPaymentRepository) GetOrdersAwaitingRelease(limit int) ([]uint, error) {
+    var orderIDs []uint
+    for _, order := range m.orders.orders {
+        if order.Status != models.OrderStatusCancelled {
+            continue
+        }
+        for _, payment := range m.payments {
+            if payment.OrderID == order.ID && (payment.Status == models.PaymentStatusAuthorized || payment.Status == models.PaymentStatusCaptured || payment.Status == models.PaymentStatusPartiallyRefunded) {
+                orderIDs = append(orderIDs, order.ID)
+                break
+            }
+        }
+    }
+    return orderIDs, nil
+}
+
+func (m *stubPaymentRepository) UpdatePayment(payment *models.Payment, fromStatus string, fromRefunded float64) error {
+    if m.failStatus != "" && payment.Status == m.failStatus {
+        m.failStatus = ""
+        return errors.New("connection reset")
+    }
+    for i := range m.payments {
+        if m.payments[i].ID == payment.ID {
+            if m.payments[i].Status != fromStatus || m.payments[i].RefundedAmount != fromRefunded {
+                return repositories.ErrPaymentStatusChanged
+            }
+            m.payments[i] = *payment
+            return nil
+        }
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (m *stubPaymentRepository) RecordWebhookEvent(event *models.PaymentWebhookEvent) (bool, error) {
+    if m.events == nil {
+        m.events = make(map[string]bool)
+    }
+    if m.events[event.EventID] {
+        return false, nil
+    }
+    m.events[event.EventID] = true
+    return true, nil
+}
+
+func (m *stubPaymentRepository) ForgetWebhookEvent(eventID string) error {
+    delete(m.events, eventID)
+    return nil
+}
+
+func TestPaymentService_PayOrder(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    service := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentSuccess, 0), "whsec", true, newTestLogger())
+
+    // Test other users cannot pay the order
+    _, err := service.PayOrder(2, 1)
+    assert.Equal(t, services.ErrOrderNotFound, err)
+
+    payment, err := service.PayOrder(1, 1)
+    assert.NoError(t, err)
+    assert.Equal(t, models.PaymentStatusCaptured, payment.Status)
+    assert.Equal(t, 50.0, payment.CapturedAmount)
+    assert.Equal(t, models.OrderStatusPaid, orderRepo.orders[0].Status)
+
+    // Test partial then full refunds
+    payment, err = service.RefundPayment(payment.ID, 20)
+    assert.NoError(t, err)
+    assert.Equal(t, models.PaymentStatusPartiallyRefunded, payment.Status)
+    _, err = service.RefundPayment(payment.ID, 40)
+    assert.Equal(t, services.ErrInvalidRefundAmount, err)
+    payment, err = service.RefundPayment(payment.ID, 0)
+    assert.NoError(t, err)
+    assert.Equal(t, models.PaymentStatusRefunded, payment.Status)
+    assert.Equal(t, 50.0, payment.RefundedAmount)
+    assert.Equal(t, models.OrderStatusRefunded, orderRepo.orders[0].Status)
+}
+
+func TestPaymentService_PayOrder_Declined(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    service := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentDecline, 0), "whsec", true, newTestLogger())
+
+    payment, err := service.PayOrder(1, 1)
+    assert.Equal(t, services.ErrPaymentDeclined, err)
+    assert.Equal(t, models.PaymentStatusFailed, payment.Status)
+    assert.Equal(t, models.OrderStatusPending, orderRepo.orders[0].Status)
+}
+
+func TestPaymentService_TimeoutResolvedByWebhook(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    service := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentTimeout, 0), "whsec", true, newTestLogger())
+
+    payment, err := service.PayOrder(1, 1)
+    assert.Equal(t, services.ErrPaymentPending, err)
+    assert.Equal(t, models.PaymentStatusPending, payment.Status)
+
+    // Test retrying reuses the pending payment and its reference
+    retried, err := service.PayOrder(1, 1)
+    assert.Equal(t, services.ErrPaymentPending, err)
+    assert.Equal(t, payment.Reference, retried.Reference)
+
+    body, _ := json.Marshal(services.PaymentWebhook{
+        EventID:   "evt_1",
+        Type:      services.PaymentEventCaptured,
+        Reference: payment.Reference,
+        Amount:    50,
+    })
+
+    // Test unsigned and wrongly signed webhooks are rejected
+    assert.Equal(t, services.ErrInvalidWebhookSignature, service.HandleWebhook(body, ""))
+    assert.Equal(t, services.ErrInvalidWebhookSignature, service.HandleWebhook(body, services.SignWebhookPayload("other", body)))
+
+    // A capture cannot skip authorization, so the event is acknowledged but ignored
+    assert.NoError(t, service.HandleWebhook(body, services.SignWebhookPayload("whsec", body)))
+    assert.Equal(t, models.OrderStatusPending, orderRepo.orders[0].Status)
+
+    // Test an authorization webhook leaves the payment ready for manual capture
+    service.AutoCapture = false
+    body, _ = json.Marshal(services.PaymentWebhook{
+        EventID:     "evt_2",
+        Type:        services.PaymentEventAuthorized,
+        Reference:   payment.Reference,
+        ProviderRef: "fake_ref",
+    })
+    assert.NoError(t, service.HandleWebhook(body, services.SignWebhookPayload("whsec", body)))
+    // Test redelivered events are ignored
+    assert.NoError(t, service.HandleWebhook(body, services.SignWebhookPayload("whsec", body)))
+    payments, err := service.GetOrderPayments(1, 1)
+    assert.NoError(t, err)
+    assert.Len(t, payments, 1)
+    assert.Equal(t, models.PaymentStatusAuthorized, payments[0].Status)
+    assert.Equal(t, "fake_ref", payments[0].ProviderRef)
+}
+
+func TestPaymentService_ConcurrentRequests(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    service := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentSuccess, 0), "whsec", true, newTestLogger())
+    payment, err := service.PayOrder(1, 1)
+    assert.NoError(t, err)
+
+    // Test a second payment cannot be opened for the order
+    repo := service.PaymentRepo.(*stubPaymentRepository)
+    err = repo.CreatePayment(&models.Payment{OrderID: 1, Reference: "pay_other", Status: models.PaymentStatusPending, Amount: 50})
+    assert.Equal(t, repositories.ErrOpenPaymentExists, err)
+
+    // Test a refund read before another refund was recorded cannot refund the same funds
+    stale := *payment
+    _, err = service.RefundPayment(payment.ID, 30)
+    assert.NoError(t, err)
+    stale.Status = models.PaymentStatusPartiallyRefunded
+    stale.RefundedAmount = 30
+    err = repo.UpdatePayment(&stale, models.PaymentStatusCaptured, 0)
+    assert.Equal(t, repositories.ErrPaymentStatusChanged, err)
+
+    // Test a refund the provider rejects is taken back
+    repo.payments[0].ProviderRef = "fake_unknown"
+    _, err = service.RefundPayment(payment.ID, 20)
+    assert.Equal(t, services.ErrPaymentFailed, errors.Cause(err))
+    assert.Equal(t, models.PaymentStatusPartiallyRefunded, repo.payments[0].Status)
+    assert.Equal(t, 30.0, repo.payments[0].RefundedAmount)
+}
+
+func TestPaymentService_WebhookRetriedAfterFailedApply(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    service := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentTimeout, 0), "whsec", true, newTestLogger())
+    payment, _ := service.PayOrder(1, 1)
+    provider := service.Provider.(*services.FakePaymentProvider)
+    provider.Behavior = services.FakePaymentSuccess
+    providerRef, _ := provider.Authorize(services.PaymentRequest{OrderID: 1, Reference: payment.Reference, Amount: 50})
+
+    body, _ := json.Marshal(services.PaymentWebhook{
+        EventID:     "evt_1",
+        Type:        services.PaymentEventAuthorized,
+        Reference:   payment.Reference,
+        ProviderRef: providerRef,
+    })
+    signature := services.SignWebhookPayload("whsec", body)
+
+    // Test the funds are captured but recording the capture fails
+    service.PaymentRepo.(*stubPaymentRepository).failStatus = models.PaymentStatusCaptured
+    assert.Error(t, service.HandleWebhook(body, signature))
+    payments, _ := service.GetOrderPayments(1, 1)
+    assert.Equal(t, models.PaymentStatusAuthorized, payments[0].Status)
+    assert.Equal(t, models.OrderStatusPending, orderRepo.orders[0].Status)
+
+    // Test the provider's redelivery is applied rather than ignored
+    assert.NoError(t, service.HandleWebhook(body, signature))
+    payments, _ = service.GetOrderPayments(1, 1)
+    assert.Equal(t, models.PaymentStatusCaptured, payments[0].Status)
+    assert.Equal(t, 50.0, payments[0].CapturedAmount)
+    assert.Equal(t, models.OrderStatusPaid, orderRepo.orders[0].Status)
+
+    // Test the applied event is not applied twice
+    assert.NoError(t, service.HandleWebhook(body, signature))
+    assert.Equal(t, models.OrderStatusPaid, orderRepo.orders[0].Status)
+}
+
+func TestPaymentService_WebhookRejectsCaptureAmounts(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    service := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentSuccess, 0), "whsec", true, newTestLogger())
+    service.AutoCapture = false
+    payment, err := service.PayOrder(1, 1)
+    assert.NoError(t, err)
+
+    // Test captures above the payment's amount or below zero are rejected for good
+    for i, amount := range []float64{80, -10} {
+        body, _ := json.Marshal(services.PaymentWebhook{
+            EventID:   fmt.Sprintf("evt_%d", i),
+            Type:      services.PaymentEventCaptured,
+            Reference: payment.Reference,
+            Amount:    amount,
+        })
+        signature := services.SignWebhookPayload("whsec", body)
+        assert.Equal(t, services.ErrInvalidWebhookPayload, errors.Cause(service.HandleWebhook(body, signature)))
+        assert.NoError(t, service.HandleWebhook(body, signature))
+    }
+    payments, _ := service.GetOrderPayments(1, 1)
+    assert.Equal(t, models.PaymentStatusAuthorized, payments[0].Status)
+    assert.Zero(t, payments[0].CapturedAmount)
+    assert.Equal(t, models.OrderStatusPending, orderRepo.orders[0].Status)
+}
+
+func TestPaymentService_WebhookRefundAmounts(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{
+        {ID: 1, UserID: 1, Status: models.OrderStatusPending, Total: 50},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    service := services.NewPaymentService(&stubPaymentRepository{orders: orderRepo}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentSuccess, 0), "whsec", true, newTestLogger())
+    payment, err := service.PayOrder(1, 1)
+    assert.NoError(t, err)
+    refundEvent := func(eventID string, amount float64) []byte {
+        body, _ := json.Marshal(services.PaymentWebhook{
+            EventID:   eventID,
+            Type:      services.PaymentEventRefunded,
+            Reference: payment.Reference,
+            Amount:    amount,
+        })
+        return body
+    }
+
+    // Test a refund beyond the captured funds is rejected for good
+    body := refundEvent("evt_1", 80)
+    assert.Equal(t, services.ErrInvalidWebhookPayload, errors.Cause(service.HandleWebhook(body, services.SignWebhookPayload("whsec", body))))
+    assert.NoError(t, service.HandleWebhook(body, services.SignWebhookPayload("whsec", body)))
+
+    body = refundEvent("evt_2", 20)
+    assert.NoError(t, service.HandleWebhook(body, services.SignWebhookPayload("whsec", body)))
+
+    // Test a refund without an amount refunds the rest
+    body = refundEvent("evt_3", 0)
+    assert.NoError(t, service.HandleWebhook(body, services.SignWebhookPayload("whsec", body)))
+    payments, _ := service.GetOrderPayments(1, 1)
+    assert.Equal(t, models.PaymentStatusRefunded, payments[0].Status)
+    assert.Equal(t, 50.0, payments[0].RefundedAmount)
+    assert.Equal(t, models.OrderStatusRefunded, orderRepo.orders[0].Status)
+}
+
+func TestCanTransitionPayment(t *testing.T) {
+    assert.True(t, services.CanTransitionPayment(models.PaymentStatusPending, models.PaymentStatusAuthorized))
+    assert.True(t, services.CanTransitionPayment(models.PaymentStatusAuthorized, models.PaymentStatusVoided))
+    assert.False(t, services.CanTransitionPayment(models.PaymentStatusPending, models.PaymentStatusCaptured))
+    assert.False(t, services.CanTransitionPayment(models.PaymentStatusVoided, models.PaymentStatusCaptured))
+    assert.False(t, services.CanTransitionPayment(models.PaymentStatusRefunded, models.PaymentStatusPartiallyRefunded))
+}
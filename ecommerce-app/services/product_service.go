@@ -7,10 +7,16 @@ import (
     "github.com/sirupsen/logrus"
 )
 
+// PriceDropNotifier is notified after a product's price is lowered
+type PriceDropNotifier interface {
+    NotifyPriceDrop(product *models.Product, oldPrice float64)
+}
+
 // ProductService handles business logic for products
 type ProductService struct {
-    ProductRepo repositories.ProductRepository
-    Logger      *logrus.Logger
+    ProductRepo       repositories.ProductRepository
+    PriceDropNotifier PriceDropNotifier // optional
+    Logger            *logrus.Logger
 }
 
 // NewProductService creates a new ProductService
@@ -74,7 +80,21 @@ func (s *ProductService) UpdateProduct(product *models.Product) error {
         }).Warn("Invalid product data")
         return errors.New("invalid product data")
     }
-    err := s.ProductRepo.UpdateProduct(product)
+    existing, err := s.ProductRepo.GetProductByID(product.ID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "product_id": product.ID,
+            "error":      err,
+            "error_code": "PRODUCT_NOT_FOUND",
+        }).Warn("Product not found")
+        return err
+    }
+    // Ratings are maintained by the review worker, never by product updates
+    product.CreatedAt = existing.CreatedAt
+    product.AverageRating = existing.AverageRating
+    product.RatingCount = existing.RatingCount
+
+    err = s.ProductRepo.UpdateProduct(product)
     if err != nil {
         s.Logger.WithFields(logrus.Fields{
             "product_id": product.ID,
@@ -86,6 +106,10 @@ func (s *ProductService) UpdateProduct(product *models.Product) error {
     s.Logger.WithFields(logrus.Fields{
         "product_id": product.ID,
     }).Info("Updated product")
+
+    if s.PriceDropNotifier != nil && product.Price < existing.Price {
+        s.PriceDropNotifier.NotifyPriceDrop(product, existing.Price)
+    }
     return nil
 }
 
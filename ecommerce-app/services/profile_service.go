@@ -0,0 +1,376 @@
+package services
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+// Profile error types
+var (
+    ErrInvalidUsername      = errors.New("username must be 3-32 letters, digits, dots, dashes or underscores")
+    ErrUsernameTaken        = errors.New("username is already taken")
+    ErrNoProfileChanges     = errors.New("no profile changes given")
+    ErrExportNotFound       = errors.New("data export not found")
+    ErrExportInProgress     = errors.New("a data export is already being prepared")
+    ErrExportNotReady       = errors.New("data export is not ready")
+    ErrExportExpired        = errors.New("data export has expired")
+    ErrErasureNotConfirmed  = errors.New(`confirm the erasure by sending "confirm": "DELETE"`)
+    ErrAccountAlreadyErased = errors.New("account has already been erased")
+)
+
+// ErasureConfirmation must accompany every account erasure request
+const ErasureConfirmation = "DELETE"
+
+// erasedUsernamePrefix starts the placeholder username of every erased account, so
+// it cannot be chosen as a real username
+const erasedUsernamePrefix = "deleted-user-"
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,32}$`)
+
+// ProfileInput holds the profile fields a user can change; nil fields are left alone
+type ProfileInput struct {
+    Username *string `json:"username"`
+    Email    *string `json:"email"`
+}
+
+// ProfileService handles self-service profile changes and the data subject rights:
+// exporting a copy of the user's data and erasing the account
+type ProfileService struct {
+    UserRepo    repositories.UserRepository
+    PrivacyRepo repositories.PrivacyRepository
+    Accounts    *AccountService
+    Passwords   *PasswordService
+    RabbitMQ    *amqp091.Channel
+    AuthCache   AuthCache // optional
+    ExportDir   string
+    ExportTTL   time.Duration
+    Logger      *logrus.Logger
+}
+
+// NewProfileService creates a new ProfileService. Exports are written to exportDir
+// and can be downloaded for exportTTL after they are built.
+func NewProfileService(userRepo repositories.UserRepository, privacyRepo repositories.PrivacyRepository, accounts *AccountService, passwords *PasswordService, rabbitMQ *amqp091.Channel, exportDir string, exportTTL time.Duration, logger *logrus.Logger) *ProfileService {
+    return &ProfileService{
+        UserRepo:    userRepo,
+        PrivacyRepo: privacyRepo,
+        Accounts:    accounts,
+        Passwords:   passwords,
+        RabbitMQ:    rabbitMQ,
+        ExportDir:   exportDir,
+        ExportTTL:   exportTTL,
+        Logger:      logger,
+    }
+}
+
+// UpdateProfile applies a username change right away. An email change only starts the
+// confirmation flow; the reported pending address takes over once it is confirmed.
+func (s *ProfileService) UpdateProfile(userID uint, input ProfileInput) (*models.User, error) {
+    if input.Username == nil && input.Email == nil {
+        return nil, ErrNoProfileChanges
+    }
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return nil, errors.Wrap(ErrUserNotFound, err.Error())
+    }
+
+    if input.Username != nil && *input.Username != user.Username {
+        username := strings.TrimSpace(*input.Username)
+        if !usernamePattern.MatchString(username) || strings.HasPrefix(strings.ToLower(username), erasedUsernamePrefix) {
+            return nil, ErrInvalidUsername
+        }
+        if existing, err := s.UserRepo.GetUserByUsername(username); err == nil && existing.ID != user.ID {
+            return nil, ErrUsernameTaken
+        }
+        if err := s.UserRepo.UpdateUsername(user.ID, username); err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    user.ID,
+                "error":      err,
+                "error_code": "UPDATE_USERNAME_FAILED",
+            }).Error("Failed to update username")
+            return nil, err
+        }
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":      user.ID,
+            "old_username": user.Username,
+            "new_username": username,
+        }).Info("Username changed")
+        invalidateCachedUser(s.AuthCache, s.Logger, user.ID)
+    }
+
+    if input.Email != nil && !strings.EqualFold(strings.TrimSpace(*input.Email), user.Email) {
+        if err := s.Accounts.RequestEmailChange(user.ID, *input.Email); err != nil {
+            return nil, err
+        }
+    }
+    return s.UserRepo.GetUserByID(user.ID)
+}
+
+// RequestDataExport queues an export of everything stored about the user. Only one
+// export can be in preparation at a time.
+func (s *ProfileService) RequestDataExport(userID uint) (*models.DataExport, error) {
+    exports, err := s.PrivacyRepo.GetDataExportsByUser(userID)
+    if err != nil {
+        return nil, err
+    }
+    for _, export := range exports {
+        if export.Status == models.DataExportStatusPending || export.Status == models.DataExportStatusProcessing {
+            return nil, ErrExportInProgress
+        }
+    }
+
+    export := &models.DataExport{
+        UserID: userID,
+        Status: models.DataExportStatusPending,
+    }
+    if err := s.PrivacyRepo.CreateDataExport(export); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "CREATE_DATA_EXPORT_FAILED",
+        }).Error("Failed to create data export")
+        return nil, err
+    }
+    message := struct {
+        ExportID uint `json:"export_id"`
+    }{
+        ExportID: export.ID,
+    }
+    if err := publishJSON(s.RabbitMQ, "data_export_queue", message); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "export_id":  export.ID,
+            "error":      err,
+            "error_code": "PUBLISH_FAILED",
+        }).Error("Failed to publish to RabbitMQ")
+        s.failExport(export, "could not be queued")
+        return nil, err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":   userID,
+        "export_id": export.ID,
+    }).Info("Data export requested")
+    return export, nil
+}
+
+// GetDataExports lists the user's exports, newest first
+func (s *ProfileService) GetDataExports(userID uint) ([]models.DataExport, error) {
+    return s.PrivacyRepo.GetDataExportsByUser(userID)
+}
+
+// GetDataExport returns one of the user's exports. Other users' exports are reported
+// as not found.
+func (s *ProfileService) GetDataExport(userID, exportID uint) (*models.DataExport, error) {
+    export, err := s.PrivacyRepo.GetDataExport(exportID)
+    if err != nil || export.UserID != userID {
+        return nil, ErrExportNotFound
+    }
+    return export, nil
+}
+
+// DataExportFile returns the path of a ready export's archive for download
+func (s *ProfileService) DataExportFile(userID, exportID uint) (string, error) {
+    export, err := s.GetDataExport(userID, exportID)
+    if err != nil {
+        return "", err
+    }
+    switch {
+    case export.Status == models.DataExportStatusExpired,
+        export.Status == models.DataExportStatusReady && export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt):
+        return "", ErrExportExpired
+    case export.Status != models.DataExportStatusReady:
+        return "", ErrExportNotReady
+    }
+    return filepath.Join(s.ExportDir, export.FileName), nil
+}
+
+// BuildDataExport writes the archive for a queued export. The worker calls it; a
+// failure is recorded on the export so the user can request another, and the error is
+// returned only when retrying the message could help.
+func (s *ProfileService) BuildDataExport(exportID uint) error {
+    export, err := s.PrivacyRepo.GetDataExport(exportID)
+    if err != nil {
+        // Erasing an account deletes its exports, queued ones included
+        s.Logger.WithFields(logrus.Fields{
+            "export_id":  exportID,
+            "error":      err,
+            "error_code": "DATA_EXPORT_NOT_FOUND",
+        }).Warn("Skipping unknown data export")
+        return nil
+    }
+    if export.Status != models.DataExportStatusPending && export.Status != models.DataExportStatusProcessing {
+        // Already built or given up on; a redelivered message has nothing to do
+        return nil
+    }
+    export.Status = models.DataExportStatusProcessing
+    if err := s.PrivacyRepo.UpdateDataExport(export); err != nil {
+        return err
+    }
+
+    archive, err := s.PrivacyRepo.CollectUserData(export.UserID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "export_id":  export.ID,
+            "error":      err,
+            "error_code": "COLLECT_USER_DATA_FAILED",
+        }).Error("Failed to collect user data")
+        s.failExport(export, "could not collect account data")
+        return err
+    }
+    archive.ExportedAt = time.Now()
+    fileName, err := s.writeArchive(export, archive)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "export_id":  export.ID,
+            "error":      err,
+            "error_code": "WRITE_DATA_EXPORT_FAILED",
+        }).Error("Failed to write data export")
+        s.failExport(export, "could not write the archive")
+        return err
+    }
+
+    now := time.Now()
+    expiresAt := now.Add(s.ExportTTL)
+    export.Status = models.DataExportStatusReady
+    export.FileName = fileName
+    export.CompletedAt = &now
+    export.ExpiresAt = &expiresAt
+    if err := s.PrivacyRepo.UpdateDataExport(export); err != nil {
+        os.Remove(filepath.Join(s.ExportDir, fileName))
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":   export.UserID,
+        "export_id": export.ID,
+    }).Info("Data export ready")
+    return nil
+}
+
+// PurgeExpiredDataExports deletes the archives of exports past their download window
+func (s *ProfileService) PurgeExpiredDataExports() error {
+    exports, err := s.PrivacyRepo.ExpireDataExports(time.Now())
+    if err != nil {
+        return err
+    }
+    for _, export := range exports {
+        s.removeArchive(export)
+    }
+    if len(exports) > 0 {
+        s.Logger.WithFields(logrus.Fields{
+            "count": len(exports),
+        }).Info("Purged expired data exports")
+    }
+    return nil
+}
+
+// EraseAccount anonymises the account and deletes the user's personal data; orders are
+// kept for accounting with the recipient details removed. Accounts with a password
+// must supply it; accounts created through an identity provider only confirm.
+func (s *ProfileService) EraseAccount(userID uint, password, confirm string) error {
+    if confirm != ErasureConfirmation {
+        return ErrErasureNotConfirmed
+    }
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    if user.DeletedAt != nil {
+        return ErrAccountAlreadyErased
+    }
+    if user.Password != UnusablePassword && !s.Passwords.CheckPassword(user, password) {
+        return ErrIncorrectPassword
+    }
+
+    exports, err := s.PrivacyRepo.GetDataExportsByUser(user.ID)
+    if err != nil {
+        return err
+    }
+    placeholder := fmt.Sprintf("%s%d", erasedUsernamePrefix, user.ID)
+    productIDs, err := s.PrivacyRepo.EraseUser(user.ID, placeholder, placeholder+"@erased.invalid", UnusablePassword)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    user.ID,
+            "error":      err,
+            "error_code": "ERASE_USER_FAILED",
+        }).Error("Failed to erase account")
+        return err
+    }
+    for _, export := range exports {
+        s.removeArchive(export)
+    }
+    invalidateCachedUser(s.AuthCache, s.Logger, user.ID)
+
+    // Deleted reviews no longer count towards product ratings
+    for _, productID := range productIDs {
+        message := struct {
+            ProductID uint `json:"product_id"`
+        }{
+            ProductID: productID,
+        }
+        if err := publishJSON(s.RabbitMQ, "review_queue", message); err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "product_id": productID,
+                "error":      err,
+                "error_code": "PUBLISH_FAILED",
+            }).Warn("Failed to queue rating update after erasure")
+        }
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id": user.ID,
+    }).Info("Account erased")
+    return nil
+}
+
+func (s *ProfileService) writeArchive(export *models.DataExport, archive *models.UserDataArchive) (string, error) {
+    if err := os.MkdirAll(s.ExportDir, 0o700); err != nil {
+        return "", err
+    }
+    // The random part keeps archive names unguessable on shared storage
+    suffix, err := randomHex(8)
+    if err != nil {
+        return "", err
+    }
+    fileName := fmt.Sprintf("export-%d-%s.json", export.ID, suffix)
+    body, err := json.MarshalIndent(archive, "", "  ")
+    if err != nil {
+        return "", errors.Wrap(ErrMarshalFailed, err.Error())
+    }
+    if err := os.WriteFile(filepath.Join(s.ExportDir, fileName), body, 0o600); err != nil {
+        return "", err
+    }
+    return fileName, nil
+}
+
+func (s *ProfileService) removeArchive(export models.DataExport) {
+    if export.FileName == "" {
+        return
+    }
+    if err := os.Remove(filepath.Join(s.ExportDir, export.FileName)); err != nil && !os.IsNotExist(err) {
+        s.Logger.WithFields(logrus.Fields{
+            "export_id":  export.ID,
+            "error":      err,
+            "error_code": "REMOVE_DATA_EXPORT_FAILED",
+        }).Warn("Failed to remove data export file")
+    }
+}
+
+func (s *ProfileService) failExport(export *models.DataExport, reason string) {
+    export.Status = models.DataExportStatusFailed
+    export.Error = reason
+    if err := s.PrivacyRepo.UpdateDataExport(export); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "export_id":  export.ID,
+            "error":      err,
+            "error_code": "UPDATE_DATA_EXPORT_FAILED",
+        }).Error("Failed to record data export failure")
+    }
+}
@@ -0,0 +1,267 @@
+package services_test
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubPrivacyRepository keeps exports in memory and erases users from the user stub
+type stubPrivacyRepository struct {
+    users      *stubUserRepository
+    exports    []models.DataExport
+    reviewed   []uint
+    erasedWith []string
+}
+
+func (r *stubPrivacyRepository) CreateDataExport(export *models.DataExport) error {
+    export.ID = uint(len(r.exports) + 1)
+    export.CreatedAt = time.Now()
+    r.exports = append(r.exports, *export)
+    return nil
+}
+
+func (r *stubPrivacyRepository) GetDataExport(id uint) (*models.DataExport, error) {
+    for i := range r.exports {
+        if r.exports[i].ID == id {
+            export := r.exports[i]
+            return &export, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubPrivacyRepository) GetDataExportsByUser(userID uint) ([]models.DataExport, error) {
+    var exports []models.DataExport
+    for _, export := range r.exports {
+        if export.UserID == userID {
+            exports = append(exports, export)
+        }
+    }
+    return exports, nil
+}
+
+func (r *stubPrivacyRepository) UpdateDataExport(export *models.DataExport) error {
+    for i := range r.exports {
+        if r.exports[i].ID == export.ID {
+            r.exports[i] = *export
+            return nil
+        }
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (r *stubPrivacyRepository) ExpireDataExports(before time.Time) ([]models.DataExport, error) {
+    var expired []models.DataExport
+    for i := range r.exports {
+        export := &r.exports[i]
+        if export.Status == models.DataExportStatusReady && export.ExpiresAt.Before(before) {
+            export.Status = models.DataExportStatusExpired
+            expired = append(expired, *export)
+        }
+    }
+    return expired, nil
+}
+
+func (r *stubPrivacyRepository) CollectUserData(userID uint) (*models.UserDataArchive, error) {
+    user := r.users.find(userID)
+    if user == nil {
+        return nil, gorm.ErrRecordNotFound
+    }
+    return &models.UserDataArchive{
+        Profile: models.UserDataProfile{ID: user.ID, Username: user.Username, Email: user.Email, Role: user.Role},
+        Orders:  []models.Order{{ID: 7, UserID: userID, Total: 42}},
+    }, nil
+}
+
+func (r *stubPrivacyRepository) EraseUser(userID uint, username, email, password string) ([]uint, error) {
+    user := r.users.find(userID)
+    if user == nil || user.DeletedAt != nil {
+        return nil, gorm.ErrRecordNotFound
+    }
+    now := time.Now()
+    user.Username, user.Email, user.Password = username, email, password
+    user.DeletedAt = &now
+    user.TokenVersion++
+    r.erasedWith = []string{username, email, password}
+    var kept []models.DataExport
+    for _, export := range r.exports {
+        if export.UserID != userID {
+            kept = append(kept, export)
+        }
+    }
+    r.exports = kept
+    return r.reviewed, nil
+}
+
+func stringPtr(s string) *string {
+    return &s
+}
+
+func TestProfileService_UpdateProfile(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "ann", Email: "ann@example.com"},
+        {ID: 2, Username: "bob", Email: "bob@example.com"},
+    }}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    mailer := &stubMailer{}
+    accounts := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, mailer, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    privacyRepo := &stubPrivacyRepository{users: userRepo}
+    service := services.NewProfileService(userRepo, privacyRepo, accounts, passwords, nil, t.TempDir(), time.Hour, newTestLogger())
+
+    // Test invalid, reserved and taken usernames
+    _, err := service.UpdateProfile(1, services.ProfileInput{Username: stringPtr("a b")})
+    assert.Equal(t, services.ErrInvalidUsername, err)
+    _, err = service.UpdateProfile(1, services.ProfileInput{Username: stringPtr("deleted-user-9")})
+    assert.Equal(t, services.ErrInvalidUsername, err)
+    _, err = service.UpdateProfile(1, services.ProfileInput{Username: stringPtr("BOB")})
+    assert.Equal(t, services.ErrUsernameTaken, err)
+    _, err = service.UpdateProfile(1, services.ProfileInput{})
+    assert.Equal(t, services.ErrNoProfileChanges, err)
+
+    user, err := service.UpdateProfile(1, services.ProfileInput{Username: stringPtr("annie")})
+    assert.NoError(t, err)
+    assert.Equal(t, "annie", user.Username)
+
+    // Test an email change waits for the new address to be confirmed
+    _, err = service.UpdateProfile(1, services.ProfileInput{Email: stringPtr("bob@example.com")})
+    assert.Equal(t, services.ErrEmailInUse, err)
+    _, err = service.UpdateProfile(1, services.ProfileInput{Email: stringPtr("not an address")})
+    assert.Equal(t, services.ErrInvalidEmail, err)
+
+    user, err = service.UpdateProfile(1, services.ProfileInput{Email: stringPtr("ann@new.example")})
+    assert.NoError(t, err)
+    assert.Equal(t, "ann@example.com", user.Email)
+    assert.Equal(t, "ann@new.example", user.PendingEmail)
+    if assert.Len(t, mailer.sent, 1) {
+        assert.Equal(t, "ann@new.example", mailer.sent[0].To)
+        assert.Contains(t, mailer.sent[0].Body, "https://shop.example/confirm-email-change?token=")
+    }
+
+    token := mailedToken(t, mailer.sent[0])
+    assert.NoError(t, service.Accounts.ConfirmEmailChange(token))
+    assert.Equal(t, "ann@new.example", userRepo.users[0].Email)
+    assert.Empty(t, userRepo.users[0].PendingEmail)
+    assert.NotNil(t, userRepo.users[0].EmailVerifiedAt)
+    if assert.Len(t, mailer.sent, 2) {
+        assert.Equal(t, "ann@example.com", mailer.sent[1].To)
+    }
+
+    // Test change tokens are single use
+    assert.Equal(t, services.ErrInvalidUserToken, service.Accounts.ConfirmEmailChange(token))
+}
+
+func TestProfileService_DataExport(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "ann", Email: "ann@example.com", Password: "secret-hash"},
+        {ID: 2, Username: "bob", Email: "bob@example.com"},
+    }}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    accounts := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, &stubMailer{}, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    privacyRepo := &stubPrivacyRepository{users: userRepo}
+    service := services.NewProfileService(userRepo, privacyRepo, accounts, passwords, nil, t.TempDir(), time.Hour, newTestLogger())
+
+    // Test an export that cannot be queued is marked failed
+    _, err := service.RequestDataExport(1)
+    assert.Equal(t, services.ErrPublishFailed, errors.Cause(err))
+    assert.Equal(t, models.DataExportStatusFailed, privacyRepo.exports[0].Status)
+
+    export := &models.DataExport{UserID: 1, Status: models.DataExportStatusPending}
+    privacyRepo.CreateDataExport(export)
+
+    // Test only one export can be in preparation
+    _, err = service.RequestDataExport(1)
+    assert.Equal(t, services.ErrExportInProgress, err)
+    _, err = service.DataExportFile(1, export.ID)
+    assert.Equal(t, services.ErrExportNotReady, err)
+
+    assert.NoError(t, service.BuildDataExport(export.ID))
+    built, _ := service.GetDataExport(1, export.ID)
+    assert.Equal(t, models.DataExportStatusReady, built.Status)
+    assert.NotNil(t, built.ExpiresAt)
+
+    path, err := service.DataExportFile(1, export.ID)
+    assert.NoError(t, err)
+    body, err := os.ReadFile(path)
+    assert.NoError(t, err)
+    var archive models.UserDataArchive
+    assert.NoError(t, json.Unmarshal(body, &archive))
+    assert.Equal(t, "ann@example.com", archive.Profile.Email)
+    assert.Len(t, archive.Orders, 1)
+    assert.NotContains(t, string(body), "secret-hash")
+
+    // Test other users cannot see or download the export
+    _, err = service.GetDataExport(2, export.ID)
+    assert.Equal(t, services.ErrExportNotFound, err)
+    _, err = service.DataExportFile(2, export.ID)
+    assert.Equal(t, services.ErrExportNotFound, err)
+
+    // Test expired exports are gone, files included
+    past := time.Now().Add(-time.Minute)
+    built.ExpiresAt = &past
+    privacyRepo.UpdateDataExport(built)
+    _, err = service.DataExportFile(1, export.ID)
+    assert.Equal(t, services.ErrExportExpired, err)
+    assert.NoError(t, service.PurgeExpiredDataExports())
+    _, err = os.Stat(path)
+    assert.True(t, os.IsNotExist(err))
+    _, err = service.DataExportFile(1, export.ID)
+    assert.Equal(t, services.ErrExportExpired, err)
+
+    // Test exports deleted with their account are skipped
+    assert.NoError(t, service.BuildDataExport(99))
+}
+
+func TestProfileService_EraseAccount(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "ann", Email: "ann@example.com"},
+        {ID: 2, Username: "oidc-user", Email: "oidc@example.com", Password: services.UnusablePassword},
+    }}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    accounts := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, &stubMailer{}, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    privacyRepo := &stubPrivacyRepository{users: userRepo}
+    service := services.NewProfileService(userRepo, privacyRepo, accounts, passwords, nil, t.TempDir(), time.Hour, newTestLogger())
+    cache := &stubAuthCache{}
+    service.AuthCache = cache
+    hash, err := service.Passwords.PreparePassword("Correct-horse-9", "ann", "ann@example.com")
+    assert.NoError(t, err)
+    userRepo.users[0].Password = hash
+
+    export := &models.DataExport{UserID: 1, Status: models.DataExportStatusPending}
+    privacyRepo.CreateDataExport(export)
+    assert.NoError(t, service.BuildDataExport(export.ID))
+    archive, _ := service.DataExportFile(1, export.ID)
+
+    // Test erasure must be confirmed and, with a password, authenticated
+    assert.Equal(t, services.ErrErasureNotConfirmed, service.EraseAccount(1, "Correct-horse-9", "yes"))
+    assert.Equal(t, services.ErrIncorrectPassword, service.EraseAccount(1, "wrong-password", services.ErasureConfirmation))
+    assert.Equal(t, "ann", userRepo.users[0].Username)
+
+    assert.NoError(t, service.EraseAccount(1, "Correct-horse-9", services.ErasureConfirmation))
+    user := userRepo.users[0]
+    assert.Equal(t, "deleted-user-1", user.Username)
+    assert.Equal(t, "deleted-user-1@erased.invalid", user.Email)
+    assert.Equal(t, services.UnusablePassword, user.Password)
+    assert.NotNil(t, user.DeletedAt)
+    assert.Equal(t, []uint{1}, cache.users)
+    _, err = os.Stat(archive)
+    assert.True(t, os.IsNotExist(err))
+    assert.Empty(t, privacyRepo.exports)
+
+    assert.Equal(t, services.ErrAccountAlreadyErased, service.EraseAccount(1, "", services.ErasureConfirmation))
+
+    // Test accounts without a password only need the confirmation
+    assert.NoError(t, service.EraseAccount(2, "", services.ErasureConfirmation))
+    assert.Equal(t, "deleted-user-2", userRepo.users[1].Username)
+
+    entries, _ := os.ReadDir(filepath.Dir(archive))
+    assert.Empty(t, entries)
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+    "fmt"
+    "math"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/pkg/errors"
+)
+
+// Coupon error types
+var (
+    ErrCouponNotFound      = errors.New("coupon not found")
+    ErrCouponNotActive     = errors.New("coupon is not active yet")
+    ErrCouponExpired       = errors.New("coupon has expired")
+    ErrCouponUsageLimit    = errors.New("coupon usage limit reached")
+    ErrCouponUserLimit     = errors.New("coupon already used the maximum number of times")
+    ErrCouponMinCartValue  = errors.New("cart value is below the coupon minimum")
+    ErrCouponNotApplicable = errors.New("coupon does not apply to any item in the cart")
+    ErrCouponNotStackable  = errors.New("coupon cannot be combined with the coupons already applied")
+    ErrInvalidCoupon       = errors.New("invalid coupon data")
+)
+
+// DiscountLine is a single coupon discount in a cart total
+type DiscountLine struct {
+    CouponID    uint    `json:"coupon_id"`
+    Code        string  `json:"code"`
+    Description string  `json:"description"`
+    Amount      float64 `json:"amount"`
+}
+
+// CartSummary is a user's cart with its calculated totals
+type CartSummary struct {
+    Items            []models.Cart   `json:"items"`
+    Subtotal         float64         `json:"subtotal"`
+    Discounts        []DiscountLine  `json:"discounts"`
+    DiscountTotal    float64         `json:"discount_total"`
+    FreeShipping     bool            `json:"free_shipping"`
+    TaxLines         []TaxLine       `json:"tax_lines"`
+    TaxTotal         float64         `json:"tax_total"`
+    PricesIncludeTax bool            `json:"prices_include_tax"`
+    ShippingQuotes   []ShippingQuote `json:"shipping_quotes,omitempty"`
+    ShippingMethod   string          `json:"shipping_method,omitempty"`
+    ShippingTotal    float64         `json:"shipping_total"`
+    Total            float64         `json:"total"`
+}
+
+// ValidateCouponDefinition checks that an admin-supplied coupon is well formed
+func ValidateCouponDefinition(coupon *models.Coupon) error {
+    if coupon.Code == "" {
+        return errors.Wrap(ErrInvalidCoupon, "code is required")
+    }
+    switch coupon.Type {
+    case models.CouponTypePercentage:
+        if coupon.Value <= 0 || coupon.Value > 100 {
+            return errors.Wrap(ErrInvalidCoupon, "percentage must be between 0 and 100")
+        }
+    case models.CouponTypeFixedAmount:
+        if coupon.Value <= 0 {
+            return errors.Wrap(ErrInvalidCoupon, "amount must be positive")
+        }
+    case models.CouponTypeFreeShipping:
+    case models.CouponTypeBuyXGetY:
+        if coupon.BuyQuantity < 1 || coupon.GetQuantity < 1 {
+            return errors.Wrap(ErrInvalidCoupon, "buy and get quantities must be positive")
+        }
+    default:
+        return errors.Wrap(ErrInvalidCoupon, "unknown coupon type")
+    }
+    if coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt) {
+        return errors.Wrap(ErrInvalidCoupon, "ends_at must be after starts_at")
+    }
+    if coupon.UsageLimit < 0 || coupon.UsageLimitPerUser < 0 || coupon.MinCartValue < 0 {
+        return errors.Wrap(ErrInvalidCoupon, "limits must not be negative")
+    }
+    return nil
+}
+
+// CheckCouponApplicable verifies the coupon's validity window, minimum cart value and
+// product/category scope against the cart. Usage limits need the repository and are
+// checked by the caller.
+func CheckCouponApplicable(coupon *models.Coupon, items []models.Cart, now time.Time) error {
+    if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+        return ErrCouponNotActive
+    }
+    if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+        return ErrCouponExpired
+    }
+    if cartSubtotal(items) < coupon.MinCartValue {
+        return ErrCouponMinCartValue
+    }
+    for _, item := range items {
+        if couponCoversItem(coupon, item) {
+            return nil
+        }
+    }
+    return ErrCouponNotApplicable
+}
+
+// CheckCouponStacking enforces the stacking rule: a non-stackable coupon must be the
+// only coupon on the cart, while stackable coupons combine with each other.
+func CheckCouponStacking(coupon *models.Coupon, applied []models.Coupon) error {
+    for _, other := range applied {
+        if other.ID == coupon.ID {
+            continue
+        }
+        if !coupon.Stackable || !other.Stackable {
+            return ErrCouponNotStackable
+        }
+    }
+    return nil
+}
+
+// SummarizeCart totals the cart and applies the coupons in order, skipping coupons that
+// no longer apply. The discount total never exceeds the subtotal.
+func SummarizeCart(items []models.Cart, coupons []models.Coupon, now time.Time) *CartSummary {
+    summary := &CartSummary{
+        Items:     items,
+        Subtotal:  roundMoney(cartSubtotal(items)),
+        Discounts: []DiscountLine{},
+        TaxLines:  []TaxLine{},
+    }
+    remaining := summary.Subtotal
+    for i := range coupons {
+        coupon := &coupons[i]
+        if CheckCouponApplicable(coupon, items, now) != nil {
+            continue
+        }
+        if coupon.Type == models.CouponTypeFreeShipping {
+            summary.FreeShipping = true
+            summary.Discounts = append(summary.Discounts, DiscountLine{
+                CouponID:    coupon.ID,
+                Code:        coupon.Code,
+                Description: "Free shipping",
+            })
+            continue
+        }
+        amount := roundMoney(math.Min(couponDiscount(coupon, items), remaining))
+        if amount <= 0 {
+            continue
+        }
+        remaining = roundMoney(remaining - amount)
+        summary.DiscountTotal = roundMoney(summary.DiscountTotal + amount)
+        summary.Discounts = append(summary.Discounts, DiscountLine{
+            CouponID:    coupon.ID,
+            Code:        coupon.Code,
+            Description: describeCoupon(coupon),
+            Amount:      amount,
+        })
+    }
+    summary.Total = roundMoney(summary.Subtotal - summary.DiscountTotal)
+    return summary
+}
+
+func couponDiscount(coupon *models.Coupon, items []models.Cart) float64 {
+    eligible := 0.0
+    freeUnits := 0.0
+    for _, item := range items {
+        if !couponCoversItem(coupon, item) {
+            continue
+        }
+        eligible += item.Product.Price * float64(item.Quantity)
+        if coupon.Type == models.CouponTypeBuyXGetY {
+            bundles := item.Quantity / (coupon.BuyQuantity + coupon.GetQuantity)
+            freeUnits += float64(bundles*coupon.GetQuantity) * item.Product.Price
+        }
+    }
+    switch coupon.Type {
+    case models.CouponTypePercentage:
+        return eligible * coupon.Value / 100
+    case models.CouponTypeFixedAmount:
+        return math.Min(coupon.Value, eligible)
+    case models.CouponTypeBuyXGetY:
+        return freeUnits
+    }
+    return 0
+}
+
+func couponCoversItem(coupon *models.Coupon, item models.Cart) bool {
+    if len(coupon.ProductIDs) == 0 && len(coupon.Categories) == 0 {
+        return true
+    }
+    for _, id := range coupon.ProductIDs {
+        if id == item.ProductID {
+            return true
+        }
+    }
+    for _, category := range coupon.Categories {
+        if category != "" && category == item.Product.Category {
+            return true
+        }
+    }
+    return false
+}
+
+func describeCoupon(coupon *models.Coupon) string {
+    switch coupon.Type {
+    case models.CouponTypePercentage:
+        return fmt.Sprintf("%g%% off", coupon.Value)
+    case models.CouponTypeFixedAmount:
+        return fmt.Sprintf("%.2f off", coupon.Value)
+    case models.CouponTypeBuyXGetY:
+        return fmt.Sprintf("Buy %d get %d free", coupon.BuyQuantity, coupon.GetQuantity)
+    }
+    return coupon.Code
+}
+
+func cartSubtotal(items []models.Cart) float64 {
+    subtotal := 0.0
+    for _, item := range items {
+        subtotal += item.Product.Price * float64(item.Quantity)
+    }
+    return subtotal
+}
+
+// roundMoney rounds a currency amount to cents
+func roundMoney(amount float64) float64 {
+    return math.Round(amount*100) / 100
+}
@@ -0,0 +1,100 @@
+package services_test
+
+import (
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+func testCart() []models.Cart {
+    return []models.Cart{
+        {ID: 1, ProductID: 1, Quantity: 3, Product: models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Category: "apparel", Price: 20}},
+        {ID: 2, ProductID: 2, Quantity: 1, Product: models.Product{Model: gorm.Model{ID: 2}, Name: "Mug", Category: "kitchen", Price: 10}},
+    }
+}
+
+func TestSummarizeCart(t *testing.T) {
+    now := time.Now()
+
+    // Test no coupons
+    summary := services.SummarizeCart(testCart(), nil, now)
+    assert.Equal(t, 70.0, summary.Subtotal)
+    assert.Equal(t, 70.0, summary.Total)
+    assert.Empty(t, summary.Discounts)
+
+    // Test percentage coupon scoped to a category
+    summary = services.SummarizeCart(testCart(), []models.Coupon{
+        {ID: 1, Code: "APPAREL10", Type: models.CouponTypePercentage, Value: 10, Categories: []string{"apparel"}},
+    }, now)
+    assert.Equal(t, 6.0, summary.DiscountTotal)
+    assert.Equal(t, 64.0, summary.Total)
+
+    // Test fixed amount is capped at the eligible value
+    summary = services.SummarizeCart(testCart(), []models.Coupon{
+        {ID: 2, Code: "MUG15", Type: models.CouponTypeFixedAmount, Value: 15, ProductIDs: []uint{2}},
+    }, now)
+    assert.Equal(t, 10.0, summary.DiscountTotal)
+
+    // Test buy 2 get 1 free on the shirt line
+    summary = services.SummarizeCart(testCart(), []models.Coupon{
+        {ID: 3, Code: "B2G1", Type: models.CouponTypeBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+    }, now)
+    assert.Equal(t, 20.0, summary.DiscountTotal)
+    assert.Equal(t, "Buy 2 get 1 free", summary.Discounts[0].Description)
+
+    // Test free shipping adds a zero-amount line
+    summary = services.SummarizeCart(testCart(), []models.Coupon{
+        {ID: 4, Code: "SHIPFREE", Type: models.CouponTypeFreeShipping},
+    }, now)
+    assert.True(t, summary.FreeShipping)
+    assert.Equal(t, 70.0, summary.Total)
+
+    // Test discounts never exceed the subtotal
+    summary = services.SummarizeCart(testCart(), []models.Coupon{
+        {ID: 5, Code: "HALF", Type: models.CouponTypePercentage, Value: 50, Stackable: true},
+        {ID: 6, Code: "FIFTY", Type: models.CouponTypeFixedAmount, Value: 50, Stackable: true},
+    }, now)
+    assert.Equal(t, 70.0, summary.DiscountTotal)
+    assert.Equal(t, 0.0, summary.Total)
+
+    // Test expired coupons are skipped
+    past := now.Add(-time.Hour)
+    summary = services.SummarizeCart(testCart(), []models.Coupon{
+        {ID: 7, Code: "OLD", Type: models.CouponTypePercentage, Value: 10, EndsAt: &past},
+    }, now)
+    assert.Equal(t, 0.0, summary.DiscountTotal)
+}
+
+func TestCheckCouponApplicable(t *testing.T) {
+    now := time.Now()
+    future := now.Add(time.Hour)
+    past := now.Add(-time.Hour)
+
+    assert.Equal(t, services.ErrCouponNotActive, services.CheckCouponApplicable(&models.Coupon{StartsAt: &future}, testCart(), now))
+    assert.Equal(t, services.ErrCouponExpired, services.CheckCouponApplicable(&models.Coupon{EndsAt: &past}, testCart(), now))
+    assert.Equal(t, services.ErrCouponMinCartValue, services.CheckCouponApplicable(&models.Coupon{MinCartValue: 100}, testCart(), now))
+    assert.Equal(t, services.ErrCouponNotApplicable, services.CheckCouponApplicable(&models.Coupon{Categories: []string{"garden"}}, testCart(), now))
+    assert.NoError(t, services.CheckCouponApplicable(&models.Coupon{StartsAt: &past, EndsAt: &future, MinCartValue: 70}, testCart(), now))
+}
+
+func TestCheckCouponStacking(t *testing.T) {
+    stackable := models.Coupon{ID: 1, Stackable: true}
+    otherStackable := models.Coupon{ID: 2, Stackable: true}
+    exclusive := models.Coupon{ID: 3}
+
+    assert.NoError(t, services.CheckCouponStacking(&exclusive, nil))
+    assert.NoError(t, services.CheckCouponStacking(&stackable, []models.Coupon{otherStackable}))
+    assert.Equal(t, services.ErrCouponNotStackable, services.CheckCouponStacking(&exclusive, []models.Coupon{stackable}))
+    assert.Equal(t, services.ErrCouponNotStackable, services.CheckCouponStacking(&stackable, []models.Coupon{exclusive}))
+}
+
+func TestValidateCouponDefinition(t *testing.T) {
+    assert.Error(t, services.ValidateCouponDefinition(&models.Coupon{Code: "X", Type: models.CouponTypePercentage, Value: 150}))
+    assert.Error(t, services.ValidateCouponDefinition(&models.Coupon{Code: "X", Type: models.CouponTypeBuyXGetY}))
+    assert.Error(t, services.ValidateCouponDefinition(&models.Coupon{Code: "X", Type: "mystery"}))
+    assert.NoError(t, services.ValidateCouponDefinition(&models.Coupon{Code: "X", Type: models.CouponTypeFixedAmount, Value: 5}))
+}
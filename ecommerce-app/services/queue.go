@@ -0,0 +1,35 @@
+package services
+
+import (
+    "context"
+    "encoding/json"
+
+    "github.com/pkg/errors"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// publishJSON marshals message and publishes it to queue on the default exchange
+func publishJSON(ch *amqp091.Channel, queue string, message interface{}) error {
+    if ch == nil {
+        return errors.Wrap(ErrPublishFailed, "no channel")
+    }
+    body, err := json.Marshal(message)
+    if err != nil {
+        return errors.Wrap(ErrMarshalFailed, err.Error())
+    }
+    err = ch.PublishWithContext(
+        context.Background(),
+        "",
+        queue,
+        false,
+        false,
+        amqp091.Publishing{
+            ContentType: "application/json",
+            Body:        body,
+        },
+    )
+    if err != nil {
+        return errors.Wrap(ErrPublishFailed, err.Error())
+    }
+    return nil
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// Return error types
+var (
+    ErrReturnNotFound          = errors.New("return not found")
+    ErrInvalidReturn           = errors.New("invalid return request")
+    ErrOrderNotReturnable      = errors.New("only delivered orders can be returned")
+    ErrReturnQuantityExceeded  = errors.New("return quantity exceeds the quantity ordered")
+    ErrInvalidReturnTransition = errors.New("invalid return status transition")
+    ErrInvalidReturnStatus     = errors.New("invalid return status")
+    ErrUpdateReturnFailed      = errors.New("failed to update return")
+    ErrReturnStatusChanged     = errors.New("return status changed concurrently")
+)
+
+// ReturnEventsQueue receives a ReturnEvent every time a return changes status
+const ReturnEventsQueue = "return_events"
+
+// returnTransitions lists the statuses each return status may move to
+var returnTransitions = map[string][]string{
+    models.ReturnStatusRequested: {models.ReturnStatusApproved, models.ReturnStatusRejected},
+    models.ReturnStatusApproved:  {models.ReturnStatusReceived},
+    models.ReturnStatusReceived:  {models.ReturnStatusRefunded},
+}
+
+// Refunder issues refunds through the payment layer
+type Refunder interface {
+    RefundOrder(orderID uint, amount float64) error
+}
+
+// ReturnItemInput is one order line a customer wants to return
+type ReturnItemInput struct {
+    OrderItemID uint   `json:"order_item_id" binding:"required"`
+    Quantity    int    `json:"quantity" binding:"required"`
+    Reason      string `json:"reason" binding:"required"`
+}
+
+// ReturnEvent is published to ReturnEventsQueue on every return status change
+type ReturnEvent struct {
+    ReturnID     uint    `json:"return_id"`
+    OrderID      uint    `json:"order_id"`
+    UserID       uint    `json:"user_id"`
+    Status       string  `json:"status"`
+    RefundAmount float64 `json:"refund_amount"`
+}
+
+// ReturnService runs the returns (RMA) workflow: requested, approved or rejected,
+// received (items restocked) and refunded
+type ReturnService struct {
+    ReturnRepo repositories.ReturnRepository
+    OrderRepo  repositories.OrderRepository
+    Refunder   Refunder
+    RabbitMQ   *amqp091.Channel
+    Logger     *logrus.Logger
+}
+
+// NewReturnService creates a new ReturnService
+func NewReturnService(returnRepo repositories.ReturnRepository, orderRepo repositories.OrderRepository, refunder Refunder, rabbitMQ *amqp091.Channel, logger *logrus.Logger) *ReturnService {
+    return &ReturnService{
+        ReturnRepo: returnRepo,
+        OrderRepo:  orderRepo,
+        Refunder:   refunder,
+        RabbitMQ:   rabbitMQ,
+        Logger:     logger,
+    }
+}
+
+// RequestReturn opens a return for lines of one of the user's delivered orders
+func (s *ReturnService) RequestReturn(userID, orderID uint, items []ReturnItemInput) (*models.ReturnRequest, error) {
+    order, err := s.OrderRepo.GetOrderByID(orderID)
+    if err != nil {
+        return nil, errors.Wrap(ErrOrderNotFound, err.Error())
+    }
+    if order.UserID != userID {
+        return nil, ErrOrderNotFound
+    }
+    if order.Status != models.OrderStatusDelivered {
+        return nil, ErrOrderNotReturnable
+    }
+    if len(items) == 0 {
+        return nil, errors.Wrap(ErrInvalidReturn, "at least one item is required")
+    }
+
+    request := &models.ReturnRequest{
+        OrderID: orderID,
+        UserID:  userID,
+        Status:  models.ReturnStatusRequested,
+    }
+    for _, input := range items {
+        orderItem := findOrderItem(order, input.OrderItemID)
+        if orderItem == nil {
+            return nil, errors.Wrap(ErrInvalidReturn, "item is not part of the order")
+        }
+        reason := strings.TrimSpace(input.Reason)
+        if input.Quantity <= 0 || reason == "" {
+            return nil, errors.Wrap(ErrInvalidReturn, "quantity and reason are required")
+        }
+        if input.Quantity > orderItem.Quantity {
+            return nil, ErrReturnQuantityExceeded
+        }
+        request.Items = append(request.Items, models.ReturnItem{
+            OrderItemID: orderItem.ID,
+            ProductID:   orderItem.ProductID,
+            Quantity:    input.Quantity,
+            Reason:      reason,
+        })
+    }
+    if err := s.ReturnRepo.CreateReturn(request); err != nil {
+        if err == repositories.ErrReturnQuantityExceeded {
+            return nil, ErrReturnQuantityExceeded
+        }
+        s.Logger.WithFields(logrus.Fields{
+            "order_id":   orderID,
+            "error":      err,
+            "error_code": "CREATE_RETURN_FAILED",
+        }).Error("Failed to create return")
+        return nil, errors.Wrap(ErrUpdateReturnFailed, err.Error())
+    }
+    s.publish(request)
+    return request, nil
+}
+
+// GetReturns returns the user's returns, newest first
+func (s *ReturnService) GetReturns(userID uint) ([]models.ReturnRequest, error) {
+    return s.ReturnRepo.GetReturnsByUserID(userID)
+}
+
+// GetReturn returns one of the user's returns; other users' returns are reported as not found
+func (s *ReturnService) GetReturn(userID, id uint) (*models.ReturnRequest, error) {
+    request, err := s.ReturnRepo.GetReturnByID(id)
+    if err != nil {
+        return nil, errors.Wrap(ErrReturnNotFound, err.Error())
+    }
+    if request.UserID != userID {
+        return nil, ErrReturnNotFound
+    }
+    return request, nil
+}
+
+// ListReturns returns returns for the admin queue, oldest first
+func (s *ReturnService) ListReturns(status string, page, limit int) ([]models.ReturnRequest, int64, error) {
+    switch status {
+    case "", models.ReturnStatusRequested, models.ReturnStatusApproved, models.ReturnStatusRejected,
+        models.ReturnStatusReceived, models.ReturnStatusRefunded:
+    default:
+        return nil, 0, ErrInvalidReturnStatus
+    }
+    return s.ReturnRepo.ListReturns(status, page, limit)
+}
+
+// ApproveReturn approves a return for refund. An amount of 0 refunds the returned
+// lines' share of what the customer paid, excluding shipping; admins may approve less.
+func (s *ReturnService) ApproveReturn(id uint, amount float64, note string) (*models.ReturnRequest, error) {
+    request, err := s.getReturn(id)
+    if err != nil {
+        return nil, err
+    }
+    order, err := s.OrderRepo.GetOrderByID(request.OrderID)
+    if err != nil {
+        return nil, errors.Wrap(ErrOrderNotFound, err.Error())
+    }
+    refundable := refundableAmount(order, request.Items)
+    if amount == 0 {
+        amount = refundable
+    }
+    if amount < 0 || roundMoney(amount) > refundable {
+        return nil, errors.Wrap(ErrInvalidRefundAmount, "amount exceeds the value of the returned items")
+    }
+    request.RefundAmount = roundMoney(amount)
+    request.AdminNote = note
+    if err := s.transition(request, models.ReturnStatusApproved); err != nil {
+        return nil, err
+    }
+    return request, nil
+}
+
+// RejectReturn rejects a requested return
+func (s *ReturnService) RejectReturn(id uint, note string) (*models.ReturnRequest, error) {
+    request, err := s.getReturn(id)
+    if err != nil {
+        return nil, err
+    }
+    request.AdminNote = note
+    if err := s.transition(request, models.ReturnStatusRejected); err != nil {
+        return nil, err
+    }
+    return request, nil
+}
+
+// ReceiveReturn records that the returned items arrived and puts them back in stock
+func (s *ReturnService) ReceiveReturn(id uint) (*models.ReturnRequest, error) {
+    request, err := s.getReturn(id)
+    if err != nil {
+        return nil, err
+    }
+    if !canTransitionReturn(request.Status, models.ReturnStatusReceived) {
+        return nil, ErrInvalidReturnTransition
+    }
+    request.Status = models.ReturnStatusReceived
+    if err := s.ReturnRepo.ReceiveReturn(request); err != nil {
+        if err == gorm.ErrRecordNotFound {
+            s.Logger.WithFields(logrus.Fields{
+                "return_id":  id,
+                "error_code": "RESTOCK_PRODUCT_NOT_FOUND",
+            }).Warn("Returned product no longer exists")
+            return nil, ErrProductNotFound
+        }
+        return nil, s.updateError(request, err)
+    }
+    s.publish(request)
+    return request, nil
+}
+
+// RefundReturn refunds the approved amount through the payment layer. The return is
+// marked refunded first so concurrent requests cannot refund it twice, and goes back to
+// received if the refund fails.
+func (s *ReturnService) RefundReturn(id uint) (*models.ReturnRequest, error) {
+    request, err := s.getReturn(id)
+    if err != nil {
+        return nil, err
+    }
+    if !canTransitionReturn(request.Status, models.ReturnStatusRefunded) {
+        return nil, ErrInvalidReturnTransition
+    }
+    request.Status = models.ReturnStatusRefunded
+    if err := s.ReturnRepo.UpdateReturn(request, models.ReturnStatusReceived); err != nil {
+        return nil, s.updateError(request, err)
+    }
+    if request.RefundAmount > 0 {
+        if err := s.Refunder.RefundOrder(request.OrderID, request.RefundAmount); err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "return_id":  id,
+                "order_id":   request.OrderID,
+                "amount":     request.RefundAmount,
+                "error":      err,
+                "error_code": "RETURN_REFUND_FAILED",
+            }).Error("Failed to refund return")
+            request.Status = models.ReturnStatusReceived
+            if restoreErr := s.ReturnRepo.UpdateReturn(request, models.ReturnStatusRefunded); restoreErr != nil {
+                s.Logger.WithFields(logrus.Fields{
+                    "return_id":  id,
+                    "error":      restoreErr,
+                    "error_code": "UPDATE_RETURN_FAILED",
+                }).Error("Failed to move unrefunded return back to received")
+            }
+            return nil, err
+        }
+    }
+    s.publish(request)
+    return request, nil
+}
+
+func (s *ReturnService) getReturn(id uint) (*models.ReturnRequest, error) {
+    request, err := s.ReturnRepo.GetReturnByID(id)
+    if err != nil {
+        return nil, errors.Wrap(ErrReturnNotFound, err.Error())
+    }
+    return request, nil
+}
+
+// transition moves the return to a new status, stores it and publishes a ReturnEvent
+func (s *ReturnService) transition(request *models.ReturnRequest, status string) error {
+    if !canTransitionReturn(request.Status, status) {
+        return errors.Wrap(ErrInvalidReturnTransition, request.Status+" -> "+status)
+    }
+    from := request.Status
+    request.Status = status
+    if err := s.ReturnRepo.UpdateReturn(request, from); err != nil {
+        return s.updateError(request, err)
+    }
+    s.publish(request)
+    return nil
+}
+
+func (s *ReturnService) updateError(request *models.ReturnRequest, err error) error {
+    if err == repositories.ErrReturnStatusChanged {
+        return ErrReturnStatusChanged
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "return_id":  request.ID,
+        "status":     request.Status,
+        "error":      err,
+        "error_code": "UPDATE_RETURN_FAILED",
+    }).Error("Failed to update return")
+    return errors.Wrap(ErrUpdateReturnFailed, err.Error())
+}
+
+func (s *ReturnService) publish(request *models.ReturnRequest) {
+    s.Logger.WithFields(logrus.Fields{
+        "return_id": request.ID,
+        "order_id":  request.OrderID,
+        "status":    request.Status,
+    }).Info("Return status changed")
+    event := ReturnEvent{
+        ReturnID:     request.ID,
+        OrderID:      request.OrderID,
+        UserID:       request.UserID,
+        Status:       request.Status,
+        RefundAmount: request.RefundAmount,
+    }
+    if err := publishJSON(s.RabbitMQ, ReturnEventsQueue, event); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "return_id":  request.ID,
+            "error":      err,
+            "error_code": "PUBLISH_FAILED",
+        }).Error("Failed to publish return event")
+    }
+}
+
+func canTransitionReturn(from, to string) bool {
+    for _, next := range returnTransitions[from] {
+        if next == to {
+            return true
+        }
+    }
+    return false
+}
+
+func findOrderItem(order *models.Order, id uint) *models.OrderItem {
+    for i := range order.Items {
+        if order.Items[i].ID == id {
+            return &order.Items[i]
+        }
+    }
+    return nil
+}
+
+// refundableAmount is what the customer paid for the returned lines: their list price
+// scaled by the order's ratio of goods paid (after discounts, with tax) to subtotal
+func refundableAmount(order *models.Order, items []models.ReturnItem) float64 {
+    if order.Subtotal <= 0 {
+        return 0
+    }
+    ratio := (order.Total - order.ShippingTotal) / order.Subtotal
+    amount := 0.0
+    for _, item := range items {
+        if orderItem := findOrderItem(order, item.OrderItemID); orderItem != nil {
+            amount += orderItem.Price * float64(item.Quantity)
+        }
+    }
+    return roundMoney(amount * ratio)
+}
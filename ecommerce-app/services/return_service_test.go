@@ -0,0 +1,195 @@
+package services_test
+
+import (
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubReturnRepository is an in-memory ReturnRepository; receiving a return restocks
+// products
+type stubReturnRepository struct {
+    returns  []models.ReturnRequest
+    products *stubProductRepository
+    orders   *stubOrderRepository
+}
+
+func (m *stubReturnRepository) CreateReturn(request *models.ReturnRequest) error {
+    returned := make(map[uint]int)
+    for _, existing := range m.returns {
+        if existing.OrderID != request.OrderID || existing.Status == models.ReturnStatusRejected {
+            continue
+        }
+        for _, item := range existing.Items {
+            returned[item.OrderItemID] += item.Quantity
+        }
+    }
+    order, err := m.orders.GetOrderByID(request.OrderID)
+    if err != nil {
+        return err
+    }
+    for _, item := range request.Items {
+        returned[item.OrderItemID] += item.Quantity
+    }
+    for _, item := range order.Items {
+        if returned[item.ID] > item.Quantity {
+            return repositories.ErrReturnQuantityExceeded
+        }
+    }
+    request.ID = uint(len(m.returns) + 1)
+    m.returns = append(m.returns, *request)
+    return nil
+}
+
+func (m *stubReturnRepository) GetReturnByID(id uint) (*models.ReturnRequest, error) {
+    for _, request := range m.returns {
+        if request.ID == id {
+            return &request, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubReturnRepository) GetReturnsByUserID(userID uint) ([]models.ReturnRequest, error) {
+    var results []models.ReturnRequest
+    for _, request := range m.returns {
+        if request.UserID == userID {
+            results = append(results, request)
+        }
+    }
+    return results, nil
+}
+
+func (m *stubReturnRepository) ListReturns(status string, page, limit int) ([]models.ReturnRequest, int64, error) {
+    return m.returns, int64(len(m.returns)), nil
+}
+
+func (m *stubReturnRepository) UpdateReturn(request *models.ReturnRequest, fromStatus string) error {
+    for i := range m.returns {
+        if m.returns[i].ID == request.ID {
+            if m.returns[i].Status != fromStatus {
+                return repositories.ErrReturnStatusChanged
+            }
+            m.returns[i] = *request
+            return nil
+        }
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (m *stubReturnRepository) ReceiveReturn(request *models.ReturnRequest) error {
+    for _, item := range request.Items {
+        if _, ok := m.products.products[item.ProductID]; !ok {
+            return gorm.ErrRecordNotFound
+        }
+    }
+    if err := m.UpdateReturn(request, models.ReturnStatusApproved); err != nil {
+        return err
+    }
+    for _, item := range request.Items {
+        if err := m.products.AdjustStock(item.ProductID, item.Quantity); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func TestReturnService_Workflow(t *testing.T) {
+    shirt := models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5}
+    productRepo := newStubProductRepository(shirt)
+    // 3 shirts at 20 with a 10 discount and 5 shipping: goods were paid at 50/60 of list price
+    orderRepo := &stubOrderRepository{orders: []models.Order{{
+        ID: 1, UserID: 1, Status: models.OrderStatusDelivered,
+        Subtotal: 60, DiscountTotal: 10, ShippingTotal: 5, Total: 55,
+        Items: []models.OrderItem{{ID: 7, OrderID: 1, ProductID: 1, Quantity: 3, Price: 20}},
+    }}}
+    paymentRepo := &stubPaymentRepository{}
+    provider := services.NewFakePaymentProvider(services.FakePaymentSuccess, 0)
+    ref, _ := provider.Authorize(services.PaymentRequest{OrderID: 1, Reference: "pay_1", Amount: 55})
+    assert.NoError(t, provider.Capture(ref, 55))
+    paymentRepo.CreatePayment(&models.Payment{OrderID: 1, Reference: "pay_1", ProviderRef: ref, Status: models.PaymentStatusCaptured, Amount: 55, CapturedAmount: 55})
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    payments := services.NewPaymentService(paymentRepo, orderRepo, lifecycle, provider, "", false, newTestLogger())
+    returnRepo := &stubReturnRepository{products: productRepo, orders: orderRepo}
+    service := services.NewReturnService(returnRepo, orderRepo, payments, nil, newTestLogger())
+
+    // Test a reason is required and quantities cannot exceed what was ordered
+    _, err := service.RequestReturn(1, 1, []services.ReturnItemInput{{OrderItemID: 7, Quantity: 1}})
+    assert.Equal(t, services.ErrInvalidReturn, errors.Cause(err))
+    _, err = service.RequestReturn(1, 1, []services.ReturnItemInput{{OrderItemID: 7, Quantity: 4, Reason: "too small"}})
+    assert.Equal(t, services.ErrReturnQuantityExceeded, err)
+    _, err = service.RequestReturn(1, 1, []services.ReturnItemInput{
+        {OrderItemID: 7, Quantity: 2, Reason: "too small"},
+        {OrderItemID: 7, Quantity: 2, Reason: "wrong colour"},
+    })
+    assert.Equal(t, services.ErrReturnQuantityExceeded, err)
+    _, err = service.RequestReturn(2, 1, []services.ReturnItemInput{{OrderItemID: 7, Quantity: 1, Reason: "too small"}})
+    assert.Equal(t, services.ErrOrderNotFound, err)
+
+    request, err := service.RequestReturn(1, 1, []services.ReturnItemInput{{OrderItemID: 7, Quantity: 2, Reason: "too small"}})
+    assert.NoError(t, err)
+    assert.Equal(t, models.ReturnStatusRequested, request.Status)
+    _, err = service.RequestReturn(1, 1, []services.ReturnItemInput{{OrderItemID: 7, Quantity: 2, Reason: "too small"}})
+    assert.Equal(t, services.ErrReturnQuantityExceeded, err)
+
+    // Test refunds cannot happen before the items are received
+    _, err = service.RefundReturn(request.ID)
+    assert.Equal(t, services.ErrInvalidReturnTransition, err)
+
+    request, err = service.ApproveReturn(request.ID, 0, "")
+    assert.NoError(t, err)
+    assert.InDelta(t, 33.33, request.RefundAmount, 0.001)
+
+    stale := returnRepo.returns[0]
+    request, err = service.ReceiveReturn(request.ID)
+    assert.NoError(t, err)
+    assert.Equal(t, 7, productRepo.products[1].Stock)
+
+    // Test a return read before it was received cannot be received and restocked again
+    stale.Status = models.ReturnStatusReceived
+    assert.Equal(t, repositories.ErrReturnStatusChanged, returnRepo.ReceiveReturn(&stale))
+    assert.Equal(t, 7, productRepo.products[1].Stock)
+
+    request, err = service.RefundReturn(request.ID)
+    assert.NoError(t, err)
+    assert.Equal(t, models.ReturnStatusRefunded, request.Status)
+    payment, _ := paymentRepo.GetPaymentByID(1)
+    assert.Equal(t, models.PaymentStatusPartiallyRefunded, payment.Status)
+    assert.InDelta(t, 33.33, payment.RefundedAmount, 0.001)
+    assert.Equal(t, models.OrderStatusDelivered, orderRepo.orders[0].Status)
+}
+
+func TestReturnService_ReceiveReturnWithDeletedProduct(t *testing.T) {
+    productRepo := newStubProductRepository()
+    orderRepo := &stubOrderRepository{orders: []models.Order{{ID: 1, UserID: 1, Status: models.OrderStatusDelivered}}}
+    returnRepo := &stubReturnRepository{products: productRepo, orders: orderRepo, returns: []models.ReturnRequest{{
+        ID: 1, OrderID: 1, UserID: 1, Status: models.ReturnStatusApproved,
+        Items: []models.ReturnItem{{OrderItemID: 7, ProductID: 1, Quantity: 1}},
+    }}}
+    service := services.NewReturnService(returnRepo, orderRepo, nil, nil, newTestLogger())
+
+    // Test a return of a deleted product is reported instead of received without restocking
+    _, err := service.ReceiveReturn(1)
+    assert.Equal(t, services.ErrProductNotFound, err)
+    assert.Equal(t, models.ReturnStatusApproved, returnRepo.returns[0].Status)
+}
+
+func TestReturnService_RefundFailureKeepsReturnReceived(t *testing.T) {
+    orderRepo := &stubOrderRepository{orders: []models.Order{{ID: 1, UserID: 1, Status: models.OrderStatusDelivered, Total: 20}}}
+    returnRepo := &stubReturnRepository{returns: []models.ReturnRequest{
+        {ID: 1, OrderID: 1, UserID: 1, Status: models.ReturnStatusReceived, RefundAmount: 20},
+    }}
+    lifecycle := services.NewOrderLifecycle(orderRepo, nil, newTestLogger())
+    payments := services.NewPaymentService(&stubPaymentRepository{}, orderRepo, lifecycle, services.NewFakePaymentProvider(services.FakePaymentSuccess, 0), "", false, newTestLogger())
+    service := services.NewReturnService(returnRepo, orderRepo, payments, nil, newTestLogger())
+
+    // Test an order with nothing captured cannot be refunded and the return can be retried
+    _, err := service.RefundReturn(1)
+    assert.Equal(t, services.ErrInvalidRefundAmount, err)
+    assert.Equal(t, models.ReturnStatusReceived, returnRepo.returns[0].Status)
+}
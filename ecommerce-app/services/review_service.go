@@ -0,0 +1,237 @@
+package services
+
+import (
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+const maxReviewBodyLength = 5000
+
+// Review error types
+var (
+    ErrInvalidRating       = errors.New("rating must be between 1 and 5")
+    ErrInvalidReviewBody   = errors.New("review text is required and must be at most 5000 characters")
+    ErrNotPurchased        = errors.New("product has not been purchased")
+    ErrAlreadyReviewed     = errors.New("product already reviewed")
+    ErrReviewNotFound      = errors.New("review not found")
+    ErrInvalidReviewStatus = errors.New("invalid review status")
+    ErrInvalidReviewSort   = errors.New("invalid review sort")
+    ErrCreateReviewFailed  = errors.New("failed to create review")
+    ErrUpdateReviewFailed  = errors.New("failed to update review")
+    ErrFetchReviewsFailed  = errors.New("failed to fetch reviews")
+)
+
+// ReviewService handles business logic for product reviews
+type ReviewService struct {
+    ReviewRepo  repositories.ReviewRepository
+    ProductRepo repositories.ProductRepository
+    OrderRepo   repositories.OrderRepository
+    RabbitMQ    *amqp091.Channel
+    Logger      *logrus.Logger
+}
+
+// NewReviewService creates a new ReviewService
+func NewReviewService(reviewRepo repositories.ReviewRepository, productRepo repositories.ProductRepository, orderRepo repositories.OrderRepository, rabbitMQ *amqp091.Channel, logger *logrus.Logger) *ReviewService {
+    return &ReviewService{
+        ReviewRepo:  reviewRepo,
+        ProductRepo: productRepo,
+        OrderRepo:   orderRepo,
+        RabbitMQ:    rabbitMQ,
+        Logger:      logger,
+    }
+}
+
+// CreateReview submits a review for moderation; only purchasers may review a product
+func (s *ReviewService) CreateReview(userID, productID uint, rating int, body string) (*models.Review, error) {
+    if rating < 1 || rating > 5 {
+        s.Logger.WithFields(logrus.Fields{
+            "rating":     rating,
+            "error_code": "INVALID_RATING",
+        }).Warn("Invalid rating")
+        return nil, ErrInvalidRating
+    }
+    body = strings.TrimSpace(body)
+    if body == "" || len(body) > maxReviewBodyLength {
+        s.Logger.WithFields(logrus.Fields{
+            "length":     len(body),
+            "error_code": "INVALID_REVIEW_BODY",
+        }).Warn("Invalid review body")
+        return nil, ErrInvalidReviewBody
+    }
+    if _, err := s.ProductRepo.GetProductByID(productID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "product_id": productID,
+            "error":      err,
+            "error_code": "PRODUCT_NOT_FOUND",
+        }).Warn("Product not found")
+        return nil, errors.Wrap(ErrProductNotFound, err.Error())
+    }
+    purchased, err := s.OrderRepo.HasPurchasedProduct(userID, productID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "product_id": productID,
+            "error":      err,
+            "error_code": "PURCHASE_CHECK_FAILED",
+        }).Error("Failed to check purchase history")
+        return nil, errors.Wrap(ErrCreateReviewFailed, err.Error())
+    }
+    if !purchased {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "product_id": productID,
+            "error_code": "NOT_PURCHASED",
+        }).Warn("Review attempted without purchase")
+        return nil, ErrNotPurchased
+    }
+    if existing, err := s.ReviewRepo.GetReviewByUserAndProduct(userID, productID); err == nil && existing != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "product_id": productID,
+            "review_id":  existing.ID,
+            "error_code": "ALREADY_REVIEWED",
+        }).Warn("Product already reviewed")
+        return nil, ErrAlreadyReviewed
+    }
+
+    review := &models.Review{
+        UserID:    userID,
+        ProductID: productID,
+        Rating:    rating,
+        Body:      body,
+        Status:    models.ReviewStatusPending,
+    }
+    if err := s.ReviewRepo.CreateReview(review); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "product_id": productID,
+            "error":      err,
+            "error_code": "CREATE_REVIEW_FAILED",
+        }).Error("Failed to create review")
+        return nil, errors.Wrap(ErrCreateReviewFailed, err.Error())
+    }
+
+    s.Logger.WithFields(logrus.Fields{
+        "review_id":  review.ID,
+        "user_id":    userID,
+        "product_id": productID,
+        "rating":     rating,
+    }).Info("Created review pending moderation")
+    return review, nil
+}
+
+// ListProductReviews returns approved reviews for a product with pagination and sorting
+func (s *ReviewService) ListProductReviews(productID uint, sort string, page, limit int) ([]models.Review, int64, error) {
+    if !repositories.IsValidReviewSort(sort) {
+        s.Logger.WithFields(logrus.Fields{
+            "sort":       sort,
+            "error_code": "INVALID_REVIEW_SORT",
+        }).Warn("Invalid review sort")
+        return nil, 0, ErrInvalidReviewSort
+    }
+    reviews, total, err := s.ReviewRepo.ListReviewsByProduct(productID, models.ReviewStatusApproved, sort, page, limit)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "product_id": productID,
+            "error":      err,
+            "error_code": "FETCH_REVIEWS_FAILED",
+        }).Error("Failed to fetch reviews")
+        return nil, 0, errors.Wrap(ErrFetchReviewsFailed, err.Error())
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "product_id": productID,
+        "count":      len(reviews),
+        "total":      total,
+    }).Info("Fetched product reviews")
+    return reviews, total, nil
+}
+
+// ListReviewsByStatus returns reviews in a moderation status, oldest first
+func (s *ReviewService) ListReviewsByStatus(status string, page, limit int) ([]models.Review, int64, error) {
+    if !isValidReviewStatus(status) {
+        return nil, 0, ErrInvalidReviewStatus
+    }
+    reviews, total, err := s.ReviewRepo.ListReviewsByStatus(status, page, limit)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "status":     status,
+            "error":      err,
+            "error_code": "FETCH_REVIEWS_FAILED",
+        }).Error("Failed to fetch reviews")
+        return nil, 0, errors.Wrap(ErrFetchReviewsFailed, err.Error())
+    }
+    return reviews, total, nil
+}
+
+// ModerateReview sets a review's moderation status and schedules a rating recalculation
+func (s *ReviewService) ModerateReview(id uint, status string) (*models.Review, error) {
+    if !isValidReviewStatus(status) {
+        s.Logger.WithFields(logrus.Fields{
+            "review_id":  id,
+            "status":     status,
+            "error_code": "INVALID_REVIEW_STATUS",
+        }).Warn("Invalid review status")
+        return nil, ErrInvalidReviewStatus
+    }
+    review, err := s.ReviewRepo.GetReviewByID(id)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "review_id":  id,
+            "error":      err,
+            "error_code": "REVIEW_NOT_FOUND",
+        }).Warn("Review not found")
+        return nil, errors.Wrap(ErrReviewNotFound, err.Error())
+    }
+    if review.Status == status {
+        return review, nil
+    }
+
+    review.Status = status
+    if err := s.ReviewRepo.UpdateReview(review); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "review_id":  id,
+            "error":      err,
+            "error_code": "UPDATE_REVIEW_FAILED",
+        }).Error("Failed to update review")
+        return nil, errors.Wrap(ErrUpdateReviewFailed, err.Error())
+    }
+
+    // The status change is committed; a failed publish is logged rather than returned,
+    // since a retry would find the status unchanged and not publish again
+    s.publishRatingUpdate(review.ProductID)
+
+    s.Logger.WithFields(logrus.Fields{
+        "review_id":  id,
+        "product_id": review.ProductID,
+        "status":     status,
+    }).Info("Moderated review")
+    return review, nil
+}
+
+func (s *ReviewService) publishRatingUpdate(productID uint) {
+    message := struct {
+        ProductID uint `json:"product_id"`
+    }{
+        ProductID: productID,
+    }
+    if err := publishJSON(s.RabbitMQ, "review_queue", message); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "product_id": productID,
+            "error":      err,
+            "error_code": "PUBLISH_FAILED",
+        }).Error("Failed to publish to RabbitMQ")
+    }
+}
+
+func isValidReviewStatus(status string) bool {
+    switch status {
+    case models.ReviewStatusPending, models.ReviewStatusApproved, models.ReviewStatusRejected:
+        return true
+    }
+    return false
+}
@@ -0,0 +1,271 @@
+package services_test
+
+import (
+    "io"
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubProductRepository is an in-memory ProductRepository keyed by product ID
+type stubProductRepository struct {
+    products map[uint]*models.Product
+}
+
+func newStubProductRepository(products ...models.Product) *stubProductRepository {
+    repo := &stubProductRepository{products: make(map[uint]*models.Product)}
+    for i := range products {
+        product := products[i]
+        repo.products[product.ID] = &product
+    }
+    return repo
+}
+
+func (m *stubProductRepository) CreateProduct(product *models.Product) error {
+    m.products[product.ID] = product
+    return nil
+}
+
+func (m *stubProductRepository) GetProducts() ([]models.Product, error) {
+    var results []models.Product
+    for _, product := range m.products {
+        results = append(results, *product)
+    }
+    return results, nil
+}
+
+func (m *stubProductRepository) GetProductByID(id uint) (*models.Product, error) {
+    product, ok := m.products[id]
+    if !ok {
+        return nil, gorm.ErrRecordNotFound
+    }
+    copied := *product
+    return &copied, nil
+}
+
+func (m *stubProductRepository) SearchProducts(query string, page, limit int) ([]models.Product, error) {
+    return nil, nil
+}
+
+func (m *stubProductRepository) UpdateProduct(product *models.Product) error {
+    m.products[product.ID] = product
+    return nil
+}
+
+func (m *stubProductRepository) DeleteProduct(id uint) error {
+    delete(m.products, id)
+    return nil
+}
+
+func (m *stubProductRepository) UpdateRating(id uint, average float64, count int) error {
+    m.products[id].AverageRating = average
+    m.products[id].RatingCount = count
+    return nil
+}
+
+func (m *stubProductRepository) AdjustStock(id uint, delta int) error {
+    product, ok := m.products[id]
+    if !ok {
+        return gorm.ErrRecordNotFound
+    }
+    if product.Stock+delta < 0 {
+        return repositories.ErrStockWouldGoNegative
+    }
+    product.Stock += delta
+    return nil
+}
+
+// stubOrderRepository records placed orders and which (user, product) pairs have been purchased
+type stubOrderRepository struct {
+    orders    []models.Order
+    purchased map[[2]uint]bool
+}
+
+func (m *stubOrderRepository) PlaceOrder(order *models.Order, couponIDs []uint) error {
+    order.ID = uint(len(m.orders) + 1)
+    m.orders = append(m.orders, *order)
+    return nil
+}
+
+func (m *stubOrderRepository) GetOrderByID(id uint) (*models.Order, error) {
+    for _, order := range m.orders {
+        if order.ID == id {
+            return &order, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubOrderRepository) GetOrdersByUserID(userID uint) ([]models.Order, error) {
+    var results []models.Order
+    for _, order := range m.orders {
+        if order.UserID == userID {
+            results = append(results, order)
+        }
+    }
+    return results, nil
+}
+
+func (m *stubOrderRepository) HasPurchasedProduct(userID, productID uint) (bool, error) {
+    return m.purchased[[2]uint{userID, productID}], nil
+}
+
+func (m *stubOrderRepository) ListOrders(status string, page, limit int) ([]models.Order, int64, error) {
+    var results []models.Order
+    for _, order := range m.orders {
+        if status == "" || order.Status == status {
+            results = append(results, order)
+        }
+    }
+    return results, int64(len(results)), nil
+}
+
+func (m *stubOrderRepository) TransitionOrderStatus(transition *models.OrderStatusTransition, restock bool) error {
+    for i := range m.orders {
+        if m.orders[i].ID == transition.OrderID {
+            if m.orders[i].Status != transition.FromStatus {
+                return repositories.ErrOrderStatusChanged
+            }
+            m.orders[i].Status = transition.ToStatus
+            m.orders[i].Transitions = append(m.orders[i].Transitions, *transition)
+            return nil
+        }
+    }
+    return gorm.ErrRecordNotFound
+}
+
+// stubReviewRepository is an in-memory ReviewRepository
+type stubReviewRepository struct {
+    reviews []models.Review
+}
+
+func (m *stubReviewRepository) CreateReview(review *models.Review) error {
+    review.ID = uint(len(m.reviews) + 1)
+    m.reviews = append(m.reviews, *review)
+    return nil
+}
+
+func (m *stubReviewRepository) GetReviewByID(id uint) (*models.Review, error) {
+    for _, review := range m.reviews {
+        if review.ID == id {
+            return &review, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubReviewRepository) GetReviewByUserAndProduct(userID, productID uint) (*models.Review, error) {
+    for _, review := range m.reviews {
+        if review.UserID == userID && review.ProductID == productID {
+            return &review, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubReviewRepository) ListReviewsByProduct(productID uint, status, sort string, page, limit int) ([]models.Review, int64, error) {
+    var results []models.Review
+    for _, review := range m.reviews {
+        if review.ProductID == productID && review.Status == status {
+            results = append(results, review)
+        }
+    }
+    return results, int64(len(results)), nil
+}
+
+func (m *stubReviewRepository) ListReviewsByStatus(status string, page, limit int) ([]models.Review, int64, error) {
+    return nil, 0, nil
+}
+
+func (m *stubReviewRepository) UpdateReview(review *models.Review) error {
+    for i := range m.reviews {
+        if m.reviews[i].ID == review.ID {
+            m.reviews[i] = *review
+        }
+    }
+    return nil
+}
+
+func (m *stubReviewRepository) GetRatingStats(productID uint) (float64, int, error) {
+    return 0, 0, nil
+}
+
+func newTestLogger() *logrus.Logger {
+    logger := logrus.New()
+    logger.SetOutput(io.Discard)
+    return logger
+}
+
+func TestReviewService_CreateReview(t *testing.T) {
+    productRepo := newStubProductRepository(models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 29.99, Stock: 10})
+    orderRepo := &stubOrderRepository{purchased: map[[2]uint]bool{{1, 1}: true}}
+    reviewRepo := &stubReviewRepository{}
+    service := services.NewReviewService(reviewRepo, productRepo, orderRepo, nil, newTestLogger())
+
+    // Test rating out of range
+    _, err := service.CreateReview(1, 1, 6, "Great shirt")
+    assert.Equal(t, services.ErrInvalidRating, err)
+
+    // Test empty body
+    _, err = service.CreateReview(1, 1, 5, "   ")
+    assert.Equal(t, services.ErrInvalidReviewBody, err)
+
+    // Test unknown product
+    _, err = service.CreateReview(1, 2, 5, "Great shirt")
+    assert.Equal(t, services.ErrProductNotFound, errors.Cause(err))
+
+    // Test product not purchased
+    _, err = service.CreateReview(2, 1, 5, "Great shirt")
+    assert.Equal(t, services.ErrNotPurchased, err)
+
+    // Test valid review starts pending
+    review, err := service.CreateReview(1, 1, 5, "Great shirt")
+    assert.NoError(t, err)
+    assert.Equal(t, models.ReviewStatusPending, review.Status)
+    assert.Len(t, reviewRepo.reviews, 1)
+
+    // Test second review of the same product
+    _, err = service.CreateReview(1, 1, 4, "Still great")
+    assert.Equal(t, services.ErrAlreadyReviewed, err)
+}
+
+func TestReviewService_ModerateReview(t *testing.T) {
+    reviewRepo := &stubReviewRepository{reviews: []models.Review{
+        {ID: 1, ProductID: 1, Rating: 5, Status: models.ReviewStatusPending},
+    }}
+    service := services.NewReviewService(reviewRepo, newStubProductRepository(), &stubOrderRepository{}, nil, newTestLogger())
+
+    // Test invalid status
+    _, err := service.ModerateReview(1, "hidden")
+    assert.Equal(t, services.ErrInvalidReviewStatus, err)
+
+    // Test the committed status change is returned even though the rating update cannot be published
+    review, err := service.ModerateReview(1, models.ReviewStatusApproved)
+    assert.NoError(t, err)
+    assert.Equal(t, models.ReviewStatusApproved, review.Status)
+    assert.Equal(t, models.ReviewStatusApproved, reviewRepo.reviews[0].Status)
+}
+
+func TestReviewService_ListProductReviews(t *testing.T) {
+    reviewRepo := &stubReviewRepository{reviews: []models.Review{
+        {ID: 1, ProductID: 1, Rating: 5, Status: models.ReviewStatusApproved},
+        {ID: 2, ProductID: 1, Rating: 1, Status: models.ReviewStatusPending},
+    }}
+    service := services.NewReviewService(reviewRepo, newStubProductRepository(), &stubOrderRepository{}, nil, newTestLogger())
+
+    // Test only approved reviews are listed
+    reviews, total, err := service.ListProductReviews(1, "newest", 1, 10)
+    assert.NoError(t, err)
+    assert.Equal(t, int64(1), total)
+    assert.Equal(t, uint(1), reviews[0].ID)
+
+    // Test invalid sort
+    _, _, err = service.ListProductReviews(1, "random", 1, 10)
+    assert.Equal(t, services.ErrInvalidReviewSort, err)
+}
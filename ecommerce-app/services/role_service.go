@@ -0,0 +1,344 @@
+package services
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
+)
+
+// Role error types
+var (
+    ErrInvalidRole          = errors.New("invalid role data")
+    ErrRoleNotFound         = errors.New("role not found")
+    ErrRoleExists           = errors.New("role already exists")
+    ErrRoleInUse            = errors.New("role is assigned to users")
+    ErrBuiltInRole          = errors.New("built-in roles cannot be deleted")
+    ErrUserNotFound         = errors.New("user not found")
+    ErrCannotChangeOwnRole  = errors.New("admins cannot change their own role")
+    ErrCannotEditOwnRole    = errors.New("admins cannot edit the role they hold")
+    ErrAdminRolePermissions = errors.New("the admin role's permissions cannot be changed")
+    ErrRoleBeyondCaller     = errors.New("role grants permissions the caller lacks")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// AuthCache drops cached authorization state so role changes apply immediately
+type AuthCache interface {
+    InvalidateUser(userID uint) error
+    InvalidateRole(role string) error
+}
+
+// RoleService manages roles, their permissions and which role each user holds
+type RoleService struct {
+    RoleRepo  repositories.RoleRepository
+    UserRepo  repositories.UserRepository
+    AuthCache AuthCache // optional
+    Logger    *logrus.Logger
+}
+
+// NewRoleService creates a new RoleService
+func NewRoleService(roleRepo repositories.RoleRepository, userRepo repositories.UserRepository, logger *logrus.Logger) *RoleService {
+    return &RoleService{
+        RoleRepo: roleRepo,
+        UserRepo: userRepo,
+        Logger:   logger,
+    }
+}
+
+// EnsureDefaultRoles creates the built-in roles and grants admin any permission added
+// to the catalog since it was created
+func (s *RoleService) EnsureDefaultRoles() error {
+    defaults := []models.Role{
+        {Name: models.RoleAdmin, Description: "Full access", Permissions: append([]string{}, models.AllPermissions...)},
+        {Name: models.RoleUser, Description: "Customer", Permissions: []string{}},
+    }
+    for i := range defaults {
+        existing, err := s.RoleRepo.GetRoleByName(defaults[i].Name)
+        if err != nil {
+            if err := s.RoleRepo.CreateRole(&defaults[i]); err != nil {
+                return err
+            }
+            continue
+        }
+        if existing.Name != models.RoleAdmin {
+            continue
+        }
+        missing := missingPermissions(existing, models.AllPermissions)
+        if len(missing) == 0 {
+            continue
+        }
+        existing.Permissions = append(existing.Permissions, missing...)
+        if err := s.RoleRepo.UpdateRole(existing); err != nil {
+            return err
+        }
+        s.invalidateRole(existing.Name)
+    }
+    return nil
+}
+
+// GetRoles lists all roles
+func (s *RoleService) GetRoles() ([]models.Role, error) {
+    return s.RoleRepo.GetRoles()
+}
+
+// CreateRole validates and stores a new role. callerID must hold every permission the
+// role grants.
+func (s *RoleService) CreateRole(callerID uint, role *models.Role) error {
+    if err := validateRole(role); err != nil {
+        return err
+    }
+    caller, err := s.callerRole(callerID)
+    if err != nil {
+        return err
+    }
+    if err := s.checkWithinCaller(callerID, caller, role.Name, role.Permissions); err != nil {
+        return err
+    }
+    if _, err := s.RoleRepo.GetRoleByName(role.Name); err == nil {
+        return ErrRoleExists
+    }
+    role.ID = 0
+    if err := s.RoleRepo.CreateRole(role); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "role":       role.Name,
+            "error":      err,
+            "error_code": "CREATE_ROLE_FAILED",
+        }).Error("Failed to create role")
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "role":        role.Name,
+        "permissions": role.Permissions,
+    }).Info("Created role")
+    return nil
+}
+
+// UpdateRole replaces a role's description and permissions. callerID must hold every
+// permission the role grants before and after the change, and may not edit their own
+// role; the built-in admin role always keeps every permission.
+func (s *RoleService) UpdateRole(callerID uint, name string, update *models.Role) (*models.Role, error) {
+    role, err := s.RoleRepo.GetRoleByName(name)
+    if err != nil {
+        return nil, errors.Wrap(ErrRoleNotFound, err.Error())
+    }
+    update.Name = role.Name
+    if err := validateRole(update); err != nil {
+        return nil, err
+    }
+    caller, err := s.callerRole(callerID)
+    if err != nil {
+        return nil, err
+    }
+    if caller.Name == role.Name {
+        return nil, ErrCannotEditOwnRole
+    }
+    if role.Name == models.RoleAdmin && (len(missingPermissions(role, update.Permissions)) > 0 || len(missingPermissions(update, role.Permissions)) > 0) {
+        return nil, ErrAdminRolePermissions
+    }
+    if err := s.checkWithinCaller(callerID, caller, role.Name, append(append([]string{}, role.Permissions...), update.Permissions...)); err != nil {
+        return nil, err
+    }
+    role.Description = update.Description
+    role.Permissions = update.Permissions
+    if err := s.RoleRepo.UpdateRole(role); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "role":       name,
+            "error":      err,
+            "error_code": "UPDATE_ROLE_FAILED",
+        }).Error("Failed to update role")
+        return nil, err
+    }
+    s.invalidateRole(role.Name)
+    s.Logger.WithFields(logrus.Fields{
+        "role":        role.Name,
+        "permissions": role.Permissions,
+    }).Info("Updated role permissions")
+    return role, nil
+}
+
+// DeleteRole removes a custom role that no user holds
+func (s *RoleService) DeleteRole(name string) error {
+    if name == models.RoleAdmin || name == models.RoleUser {
+        return ErrBuiltInRole
+    }
+    role, err := s.RoleRepo.GetRoleByName(name)
+    if err != nil {
+        return errors.Wrap(ErrRoleNotFound, err.Error())
+    }
+    count, err := s.RoleRepo.CountUsersWithRole(name)
+    if err != nil {
+        return err
+    }
+    if count > 0 {
+        return ErrRoleInUse
+    }
+    if err := s.RoleRepo.DeleteRole(role.ID); err != nil {
+        return err
+    }
+    s.invalidateRole(name)
+    return nil
+}
+
+// AssignRole gives a user a role. adminID must hold every permission of both the new
+// role and the user's current one. The user's existing tokens are retired so the new
+// role takes effect on their next request.
+func (s *RoleService) AssignRole(adminID, userID uint, roleName string) error {
+    if adminID == userID {
+        return ErrCannotChangeOwnRole
+    }
+    role, err := s.RoleRepo.GetRoleByName(roleName)
+    if err != nil {
+        return errors.Wrap(ErrRoleNotFound, err.Error())
+    }
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    caller, err := s.callerRole(adminID)
+    if err != nil {
+        return err
+    }
+    current, err := rolePermissions(s.RoleRepo, user.Role)
+    if err != nil {
+        return err
+    }
+    if err := s.checkWithinCaller(adminID, caller, role.Name, role.Permissions); err != nil {
+        return err
+    }
+    if err := s.checkWithinCaller(adminID, caller, current.Name, current.Permissions); err != nil {
+        return err
+    }
+    if err := s.UserRepo.UpdateUserRole(userID, roleName); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "role":       roleName,
+            "error":      err,
+            "error_code": "ASSIGN_ROLE_FAILED",
+        }).Error("Failed to assign role")
+        return err
+    }
+    invalidateCachedUser(s.AuthCache, s.Logger, userID)
+    s.Logger.WithFields(logrus.Fields{
+        "admin_id":      adminID,
+        "user_id":       userID,
+        "previous_role": user.Role,
+        "role":          roleName,
+    }).Info("Assigned role")
+    return nil
+}
+
+// callerRole returns the role held by the user making a change
+func (s *RoleService) callerRole(callerID uint) (*models.Role, error) {
+    caller, err := s.UserRepo.GetUserByID(callerID)
+    if err != nil {
+        return nil, errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    return rolePermissions(s.RoleRepo, caller.Role)
+}
+
+// checkWithinCaller rejects permissions of role that the caller's role lacks, so no one
+// can hand out more access than they hold
+func (s *RoleService) checkWithinCaller(callerID uint, caller *models.Role, role string, permissions []string) error {
+    missing := missingPermissions(caller, permissions)
+    if len(missing) == 0 {
+        return nil
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "caller_id":  callerID,
+        "role":       role,
+        "missing":    missing,
+        "error_code": "ROLE_BEYOND_CALLER",
+    }).Warn("Rejected role change beyond the caller's permissions")
+    return errors.Wrap(ErrRoleBeyondCaller, "permissions not held by the caller: "+strings.Join(missing, ", "))
+}
+
+func (s *RoleService) invalidateRole(name string) {
+    if s.AuthCache == nil {
+        return
+    }
+    if err := s.AuthCache.InvalidateRole(name); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "role":       name,
+            "error":      err,
+            "error_code": "AUTH_CACHE_INVALIDATE_FAILED",
+        }).Warn("Failed to invalidate cached role permissions")
+    }
+}
+
+// invalidateCachedUser drops a user's cached authorization state, logging rather than
+// returning a failure since the caller's change is already committed
+func invalidateCachedUser(cache AuthCache, logger *logrus.Logger, userID uint) {
+    if cache == nil {
+        return
+    }
+    if err := cache.InvalidateUser(userID); err != nil {
+        logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "AUTH_CACHE_INVALIDATE_FAILED",
+        }).Warn("Failed to invalidate cached user")
+    }
+}
+
+// validateRole normalises the name and permissions and rejects unknown permissions
+func validateRole(role *models.Role) error {
+    role.Name = strings.ToLower(strings.TrimSpace(role.Name))
+    if !roleNamePattern.MatchString(role.Name) {
+        return errors.Wrap(ErrInvalidRole, "name must be 2-32 lowercase letters, digits, '-' or '_'")
+    }
+    permissions, err := normalizePermissions(role.Permissions)
+    if err != nil {
+        return errors.Wrap(ErrInvalidRole, err.Error())
+    }
+    role.Permissions = permissions
+    return nil
+}
+
+// normalizePermissions trims, de-duplicates and sorts permissions, rejecting any
+// missing from the catalog
+func normalizePermissions(permissions []string) ([]string, error) {
+    known := make(map[string]bool, len(models.AllPermissions))
+    for _, p := range models.AllPermissions {
+        known[p] = true
+    }
+    seen := make(map[string]bool, len(permissions))
+    result := []string{}
+    for _, p := range permissions {
+        p = strings.TrimSpace(p)
+        if !known[p] {
+            return nil, fmt.Errorf("unknown permission %q", p)
+        }
+        if !seen[p] {
+            seen[p] = true
+            result = append(result, p)
+        }
+    }
+    sort.Strings(result)
+    return result, nil
+}
+
+// rolePermissions looks up a role; an unknown role grants nothing
+func rolePermissions(roleRepo repositories.RoleRepository, name string) (*models.Role, error) {
+    role, err := roleRepo.GetRoleByName(name)
+    if err == gorm.ErrRecordNotFound {
+        return &models.Role{Name: name}, nil
+    }
+    return role, err
+}
+
+func missingPermissions(role *models.Role, permissions []string) []string {
+    var missing []string
+    for _, p := range permissions {
+        if !role.HasPermission(p) {
+            missing = append(missing, p)
+        }
+    }
+    return missing
+}
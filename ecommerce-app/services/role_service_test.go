@@ -0,0 +1,381 @@
+package services_test
+
+import (
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubRoleRepository keeps roles in memory
+type stubRoleRepository struct {
+    roles []models.Role
+    users *stubUserRepository
+}
+
+func (r *stubRoleRepository) CreateRole(role *models.Role) error {
+    role.ID = uint(len(r.roles) + 1)
+    r.roles = append(r.roles, *role)
+    return nil
+}
+
+func (r *stubRoleRepository) GetRoles() ([]models.Role, error) {
+    return r.roles, nil
+}
+
+func (r *stubRoleRepository) GetRoleByName(name string) (*models.Role, error) {
+    for i := range r.roles {
+        if r.roles[i].Name == name {
+            role := r.roles[i]
+            return &role, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubRoleRepository) UpdateRole(role *models.Role) error {
+    for i := range r.roles {
+        if r.roles[i].ID == role.ID {
+            r.roles[i] = *role
+        }
+    }
+    return nil
+}
+
+func (r *stubRoleRepository) DeleteRole(id uint) error {
+    for i := range r.roles {
+        if r.roles[i].ID == id {
+            r.roles = append(r.roles[:i], r.roles[i+1:]...)
+            return nil
+        }
+    }
+    return nil
+}
+
+func (r *stubRoleRepository) CountUsersWithRole(name string) (int64, error) {
+    var count int64
+    for _, user := range r.users.users {
+        if user.Role == name {
+            count++
+        }
+    }
+    return count, nil
+}
+
+// stubUserRepository keeps users in memory
+type stubUserRepository struct {
+    users []models.User
+}
+
+func (r *stubUserRepository) find(id uint) *models.User {
+    for i := range r.users {
+        if r.users[i].ID == id {
+            return &r.users[i]
+        }
+    }
+    return nil
+}
+
+func (r *stubUserRepository) CreateUser(user *models.User) error {
+    for _, existing := range r.users {
+        if strings.EqualFold(existing.Username, user.Username) || strings.EqualFold(existing.Email, user.Email) {
+            return errors.New("duplicate key value violates unique constraint")
+        }
+    }
+    user.ID = uint(len(r.users) + 1)
+    r.users = append(r.users, *user)
+    return nil
+}
+
+func (r *stubUserRepository) GetUserByID(id uint) (*models.User, error) {
+    if user := r.find(id); user != nil {
+        found := *user
+        return &found, nil
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubUserRepository) GetUserByEmail(email string) (*models.User, error) {
+    for i := range r.users {
+        if strings.EqualFold(r.users[i].Email, email) {
+            found := r.users[i]
+            return &found, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubUserRepository) GetUserByUsername(username string) (*models.User, error) {
+    for i := range r.users {
+        if strings.EqualFold(r.users[i].Username, username) {
+            found := r.users[i]
+            return &found, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubUserRepository) MarkEmailVerified(id uint) error {
+    user := r.find(id)
+    if user == nil {
+        return gorm.ErrRecordNotFound
+    }
+    if user.EmailVerifiedAt == nil {
+        now := time.Now()
+        user.EmailVerifiedAt = &now
+    }
+    return nil
+}
+
+func (r *stubUserRepository) UpdateUsername(id uint, username string) error {
+    user := r.find(id)
+    if user == nil {
+        return gorm.ErrRecordNotFound
+    }
+    user.Username = username
+    return nil
+}
+
+func (r *stubUserRepository) SetPendingEmail(id uint, email string) error {
+    user := r.find(id)
+    if user == nil {
+        return gorm.ErrRecordNotFound
+    }
+    user.PendingEmail = email
+    return nil
+}
+
+func (r *stubUserRepository) ConfirmEmailChange(id uint, email string) (bool, error) {
+    user := r.find(id)
+    if user == nil || user.PendingEmail == "" || user.PendingEmail != email {
+        return false, nil
+    }
+    now := time.Now()
+    user.Email = email
+    user.PendingEmail = ""
+    user.EmailVerifiedAt = &now
+    return true, nil
+}
+
+func (r *stubUserRepository) UpdatePassword(id uint, hash string) error {
+    user := r.find(id)
+    if user == nil {
+        return gorm.ErrRecordNotFound
+    }
+    user.Password = hash
+    user.TokenVersion++
+    return nil
+}
+
+func (r *stubUserRepository) ReplacePasswordHash(id uint, oldHash, newHash string) error {
+    if user := r.find(id); user != nil && user.Password == oldHash {
+        user.Password = newHash
+    }
+    return nil
+}
+
+func (r *stubUserRepository) UpdateUserRole(id uint, role string) error {
+    user := r.find(id)
+    if user == nil {
+        return gorm.ErrRecordNotFound
+    }
+    user.Role = role
+    user.TokenVersion++
+    return nil
+}
+
+func (r *stubUserRepository) BumpTokenVersion(id uint) error {
+    user := r.find(id)
+    if user == nil {
+        return gorm.ErrRecordNotFound
+    }
+    user.TokenVersion++
+    return nil
+}
+
+func (r *stubUserRepository) ListUsers(search, role string, page, limit int) ([]models.User, int64, error) {
+    var matched []models.User
+    for _, user := range r.users {
+        text := strings.ToLower(user.Username + " " + user.Email)
+        if strings.Contains(text, strings.ToLower(search)) && (role == "" || user.Role == role) {
+            matched = append(matched, user)
+        }
+    }
+    start := (page - 1) * limit
+    if start > len(matched) {
+        start = len(matched)
+    }
+    end := start + limit
+    if end > len(matched) {
+        end = len(matched)
+    }
+    return matched[start:end], int64(len(matched)), nil
+}
+
+func (r *stubUserRepository) SuspendUser(id uint, reason string) error {
+    user := r.find(id)
+    if user == nil {
+        return gorm.ErrRecordNotFound
+    }
+    now := time.Now()
+    user.SuspendedAt = &now
+    user.SuspendedReason = reason
+    user.TokenVersion++
+    return nil
+}
+
+func (r *stubUserRepository) ReactivateUser(id uint) error {
+    user := r.find(id)
+    if user == nil {
+        return gorm.ErrRecordNotFound
+    }
+    user.SuspendedAt = nil
+    user.SuspendedReason = ""
+    return nil
+}
+
+// stubAuthCache records invalidations
+type stubAuthCache struct {
+    users []uint
+    roles []string
+}
+
+func (c *stubAuthCache) InvalidateUser(userID uint) error {
+    c.users = append(c.users, userID)
+    return nil
+}
+
+func (c *stubAuthCache) InvalidateRole(role string) error {
+    c.roles = append(c.roles, role)
+    return nil
+}
+
+func TestRoleService_EnsureDefaultRoles(t *testing.T) {
+    userRepo := &stubUserRepository{}
+    roleRepo := &stubRoleRepository{users: userRepo}
+    service := services.NewRoleService(roleRepo, userRepo, newTestLogger())
+    cache := &stubAuthCache{}
+    service.AuthCache = cache
+    assert.NoError(t, service.EnsureDefaultRoles())
+    admin, err := roleRepo.GetRoleByName(models.RoleAdmin)
+    assert.NoError(t, err)
+    assert.ElementsMatch(t, models.AllPermissions, admin.Permissions)
+    _, err = roleRepo.GetRoleByName(models.RoleUser)
+    assert.NoError(t, err)
+
+    // Test admin is granted permissions added to the catalog later
+    roleRepo.roles[0].Permissions = []string{models.PermissionAdminAccess}
+    assert.NoError(t, service.EnsureDefaultRoles())
+    admin, _ = roleRepo.GetRoleByName(models.RoleAdmin)
+    assert.ElementsMatch(t, models.AllPermissions, admin.Permissions)
+    assert.Equal(t, []string{models.RoleAdmin}, cache.roles)
+    assert.Len(t, roleRepo.roles, 2)
+}
+
+func TestRoleService_CreateAndUpdateRole(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Role: models.RoleAdmin}}}
+    roleRepo := &stubRoleRepository{users: userRepo}
+    service := services.NewRoleService(roleRepo, userRepo, newTestLogger())
+    cache := &stubAuthCache{}
+    service.AuthCache = cache
+    assert.NoError(t, service.EnsureDefaultRoles())
+
+    role := &models.Role{Name: " Support ", Permissions: []string{models.PermissionOrdersRefund, models.PermissionAdminAccess, models.PermissionOrdersRefund}}
+    assert.NoError(t, service.CreateRole(1, role))
+    assert.Equal(t, "support", role.Name)
+    assert.Equal(t, []string{models.PermissionAdminAccess, models.PermissionOrdersRefund}, role.Permissions)
+
+    // Test duplicate names and unknown permissions are rejected
+    assert.Equal(t, services.ErrRoleExists, service.CreateRole(1, &models.Role{Name: "support"}))
+    err := service.CreateRole(1, &models.Role{Name: "auditor", Permissions: []string{"orders:delete"}})
+    assert.Equal(t, services.ErrInvalidRole, errors.Cause(err))
+
+    updated, err := service.UpdateRole(1, "support", &models.Role{Permissions: []string{models.PermissionProductsWrite}})
+    assert.NoError(t, err)
+    assert.Equal(t, "support", updated.Name)
+    assert.Equal(t, []string{models.PermissionProductsWrite}, updated.Permissions)
+    assert.Equal(t, []string{"support"}, cache.roles)
+}
+
+func TestRoleService_DeleteRole(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{{ID: 1, Role: models.RoleAdmin}, {ID: 2, Role: "support"}}}
+    roleRepo := &stubRoleRepository{users: userRepo}
+    service := services.NewRoleService(roleRepo, userRepo, newTestLogger())
+    service.AuthCache = &stubAuthCache{}
+    assert.NoError(t, service.EnsureDefaultRoles())
+    assert.NoError(t, service.CreateRole(1, &models.Role{Name: "support"}))
+    assert.NoError(t, service.CreateRole(1, &models.Role{Name: "auditor"}))
+
+    assert.Equal(t, services.ErrBuiltInRole, service.DeleteRole(models.RoleAdmin))
+    assert.Equal(t, services.ErrRoleInUse, service.DeleteRole("support"))
+    assert.NoError(t, service.DeleteRole("auditor"))
+    assert.Equal(t, services.ErrRoleNotFound, errors.Cause(service.DeleteRole("auditor")))
+}
+
+func TestRoleService_AssignRole(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Role: models.RoleAdmin},
+        {ID: 2, Role: models.RoleUser},
+    }}
+    roleRepo := &stubRoleRepository{users: userRepo}
+    service := services.NewRoleService(roleRepo, userRepo, newTestLogger())
+    cache := &stubAuthCache{}
+    service.AuthCache = cache
+    assert.NoError(t, service.EnsureDefaultRoles())
+
+    assert.NoError(t, service.AssignRole(1, 2, models.RoleAdmin))
+    assert.Equal(t, models.RoleAdmin, userRepo.users[1].Role)
+    // Test the change retires the user's outstanding tokens
+    assert.Equal(t, 1, userRepo.users[1].TokenVersion)
+    assert.Equal(t, []uint{2}, cache.users)
+
+    assert.Equal(t, services.ErrCannotChangeOwnRole, service.AssignRole(1, 1, models.RoleUser))
+    assert.Equal(t, services.ErrRoleNotFound, errors.Cause(service.AssignRole(1, 2, "owner")))
+    assert.Equal(t, services.ErrUserNotFound, errors.Cause(service.AssignRole(1, 9, models.RoleUser)))
+}
+
+func TestRoleService_RejectsEscalation(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Role: models.RoleAdmin},
+        {ID: 2, Role: "support"},
+        {ID: 3, Role: models.RoleUser},
+        {ID: 4, Role: "owner"},
+    }}
+    roleRepo := &stubRoleRepository{users: userRepo}
+    service := services.NewRoleService(roleRepo, userRepo, newTestLogger())
+    service.AuthCache = &stubAuthCache{}
+    assert.NoError(t, service.EnsureDefaultRoles())
+    assert.NoError(t, service.CreateRole(1, &models.Role{Name: "support", Permissions: []string{models.PermissionUsersManage, models.PermissionOrdersRefund}}))
+    assert.NoError(t, service.CreateRole(1, &models.Role{Name: "owner", Permissions: models.AllPermissions}))
+
+    // Test roles cannot grant more than the caller holds
+    err := service.CreateRole(2, &models.Role{Name: "root", Permissions: []string{models.PermissionAdminAccess}})
+    assert.Equal(t, services.ErrRoleBeyondCaller, errors.Cause(err))
+    assert.NoError(t, service.CreateRole(2, &models.Role{Name: "refunds", Permissions: []string{models.PermissionOrdersRefund}}))
+    _, err = service.UpdateRole(2, "refunds", &models.Role{Permissions: models.AllPermissions})
+    assert.Equal(t, services.ErrRoleBeyondCaller, errors.Cause(err))
+
+    // Test the caller's own role and the admin role's permissions are off limits
+    _, err = service.UpdateRole(2, "support", &models.Role{Permissions: models.AllPermissions})
+    assert.Equal(t, services.ErrCannotEditOwnRole, err)
+    _, err = service.UpdateRole(4, models.RoleAdmin, &models.Role{Permissions: []string{models.PermissionUsersManage}})
+    assert.Equal(t, services.ErrAdminRolePermissions, err)
+    _, err = service.UpdateRole(2, models.RoleAdmin, &models.Role{Permissions: []string{}})
+    assert.Equal(t, services.ErrAdminRolePermissions, err)
+    updated, err := service.UpdateRole(4, models.RoleAdmin, &models.Role{Description: "Everything", Permissions: models.AllPermissions})
+    assert.NoError(t, err)
+    assert.Equal(t, "Everything", updated.Description)
+    admin, _ := roleRepo.GetRoleByName(models.RoleAdmin)
+    assert.ElementsMatch(t, models.AllPermissions, admin.Permissions)
+
+    // Test users can only be moved between roles within the caller's
+    assert.Equal(t, services.ErrRoleBeyondCaller, errors.Cause(service.AssignRole(2, 3, models.RoleAdmin)))
+    assert.Equal(t, services.ErrRoleBeyondCaller, errors.Cause(service.AssignRole(2, 1, models.RoleUser)))
+    assert.NoError(t, service.AssignRole(2, 3, "refunds"))
+    assert.Equal(t, "refunds", userRepo.users[2].Role)
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+    "math"
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// Shipping error types
+var (
+    ErrInvalidShippingMethod   = errors.New("invalid shipping method data")
+    ErrShippingMethodNotFound  = errors.New("shipping method not found")
+    ErrShippingMethodRequired  = errors.New("shipping method is required")
+    ErrShippingUnavailable     = errors.New("shipping method is not available for this cart")
+    ErrFetchShippingFailed     = errors.New("failed to fetch shipping methods")
+    ErrShippingAddressRequired = errors.New("shipping address is required")
+)
+
+// volumetricDivisor converts a parcel's volume in cubic centimetres to its
+// volumetric weight in kilograms, as most carriers do
+const volumetricDivisor = 5000.0
+
+// ShippingQuote is the price of shipping a cart with one method
+type ShippingQuote struct {
+    Code     string  `json:"code"`
+    Name     string  `json:"name"`
+    WeightKg float64 `json:"weight_kg"`
+    Price    float64 `json:"price"`
+    Free     bool    `json:"free"`
+}
+
+// BillableWeight returns the weight carriers charge for: for every unit the greater of
+// its actual weight and its volumetric weight
+func BillableWeight(items []models.Cart) float64 {
+    total := 0.0
+    for _, item := range items {
+        product := item.Product
+        volumetric := product.LengthCm * product.WidthCm * product.HeightCm / volumetricDivisor
+        total += math.Max(product.WeightKg, volumetric) * float64(item.Quantity)
+    }
+    return math.Round(total*1000) / 1000
+}
+
+// QuoteShipping prices a cart with one shipping method. merchandise is the cart value
+// after discounts; freeShipping is set when a coupon waives shipping.
+func QuoteShipping(method *models.ShippingMethod, items []models.Cart, merchandise float64, freeShipping bool, country string) (*ShippingQuote, error) {
+    if !method.Active || !shipsTo(method, country) {
+        return nil, ErrShippingUnavailable
+    }
+    quote := &ShippingQuote{
+        Code:     method.Code,
+        Name:     method.Name,
+        WeightKg: BillableWeight(items),
+    }
+    switch method.RateType {
+    case models.ShippingRateFlat:
+        quote.Price = method.FlatRate
+    case models.ShippingRateWeightBased:
+        // Tiers may be stored in any order; the lightest tier that covers the parcel applies
+        var tier *models.ShippingRateTier
+        for i := range method.RateTiers {
+            candidate := &method.RateTiers[i]
+            if quote.WeightKg <= candidate.MaxWeightKg && (tier == nil || candidate.MaxWeightKg < tier.MaxWeightKg) {
+                tier = candidate
+            }
+        }
+        if tier == nil {
+            return nil, errors.Wrap(ErrShippingUnavailable, "parcel exceeds the heaviest rate tier")
+        }
+        quote.Price = tier.Price
+    default:
+        return nil, ErrInvalidShippingMethod
+    }
+    if freeShipping || (method.FreeOverAmount > 0 && merchandise >= method.FreeOverAmount) {
+        quote.Price = 0
+        quote.Free = true
+    }
+    quote.Price = roundMoney(quote.Price)
+    return quote, nil
+}
+
+func shipsTo(method *models.ShippingMethod, country string) bool {
+    if len(method.Countries) == 0 {
+        return true
+    }
+    for _, c := range method.Countries {
+        if strings.EqualFold(c, country) {
+            return true
+        }
+    }
+    return false
+}
+
+// ValidateShippingMethod checks that an admin-supplied shipping method is well formed
+func ValidateShippingMethod(method *models.ShippingMethod) error {
+    method.Code = strings.ToLower(strings.TrimSpace(method.Code))
+    for i, country := range method.Countries {
+        method.Countries[i] = strings.ToUpper(strings.TrimSpace(country))
+        if !countryCodePattern.MatchString(method.Countries[i]) {
+            return errors.Wrap(ErrInvalidShippingMethod, "countries must be ISO 3166-1 alpha-2 codes")
+        }
+    }
+    if method.Code == "" || method.Name == "" {
+        return errors.Wrap(ErrInvalidShippingMethod, "code and name are required")
+    }
+    if method.FreeOverAmount < 0 {
+        return errors.Wrap(ErrInvalidShippingMethod, "free_over_amount cannot be negative")
+    }
+    switch method.RateType {
+    case models.ShippingRateFlat:
+        if method.FlatRate < 0 {
+            return errors.Wrap(ErrInvalidShippingMethod, "flat_rate cannot be negative")
+        }
+    case models.ShippingRateWeightBased:
+        if len(method.RateTiers) == 0 {
+            return errors.Wrap(ErrInvalidShippingMethod, "weight based methods need rate tiers")
+        }
+        for _, tier := range method.RateTiers {
+            if tier.MaxWeightKg <= 0 || tier.Price < 0 {
+                return errors.Wrap(ErrInvalidShippingMethod, "rate tiers need a positive max_weight_kg and a non-negative price")
+            }
+        }
+    default:
+        return errors.Wrap(ErrInvalidShippingMethod, "rate_type must be flat or weight_based")
+    }
+    return nil
+}
+
+// ShippingService manages shipping methods and quotes carts against them
+type ShippingService struct {
+    ShippingRepo repositories.ShippingRepository
+    Logger       *logrus.Logger
+}
+
+// NewShippingService creates a new ShippingService
+func NewShippingService(shippingRepo repositories.ShippingRepository, logger *logrus.Logger) *ShippingService {
+    return &ShippingService{
+        ShippingRepo: shippingRepo,
+        Logger:       logger,
+    }
+}
+
+// CreateShippingMethod validates and stores a shipping method with its rate tiers
+func (s *ShippingService) CreateShippingMethod(method *models.ShippingMethod) error {
+    if err := ValidateShippingMethod(method); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "code":       method.Code,
+            "error":      err,
+            "error_code": "INVALID_SHIPPING_METHOD",
+        }).Warn("Invalid shipping method data")
+        return err
+    }
+    method.ID = 0
+    if err := s.ShippingRepo.CreateShippingMethod(method); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "code":       method.Code,
+            "error":      err,
+            "error_code": "CREATE_SHIPPING_METHOD_FAILED",
+        }).Error("Failed to create shipping method")
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "shipping_method_id": method.ID,
+        "code":               method.Code,
+    }).Info("Created shipping method")
+    return nil
+}
+
+// GetShippingMethods lists shipping methods; customers only see active ones
+func (s *ShippingService) GetShippingMethods(activeOnly bool) ([]models.ShippingMethod, error) {
+    methods, err := s.ShippingRepo.GetShippingMethods(activeOnly)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "FETCH_SHIPPING_FAILED",
+        }).Error("Failed to fetch shipping methods")
+        return nil, errors.Wrap(ErrFetchShippingFailed, err.Error())
+    }
+    return methods, nil
+}
+
+// UpdateShippingMethod replaces a shipping method and its rate tiers
+func (s *ShippingService) UpdateShippingMethod(id uint, method *models.ShippingMethod) error {
+    existing, err := s.ShippingRepo.GetShippingMethodByID(id)
+    if err != nil {
+        return errors.Wrap(ErrShippingMethodNotFound, err.Error())
+    }
+    if err := ValidateShippingMethod(method); err != nil {
+        return err
+    }
+    method.ID = existing.ID
+    method.CreatedAt = existing.CreatedAt
+    if err := s.ShippingRepo.UpdateShippingMethod(method); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "shipping_method_id": id,
+            "error":              err,
+            "error_code":         "UPDATE_SHIPPING_METHOD_FAILED",
+        }).Error("Failed to update shipping method")
+        return err
+    }
+    return nil
+}
+
+// DeleteShippingMethod removes a shipping method
+func (s *ShippingService) DeleteShippingMethod(id uint) error {
+    if _, err := s.ShippingRepo.GetShippingMethodByID(id); err != nil {
+        return errors.Wrap(ErrShippingMethodNotFound, err.Error())
+    }
+    return s.ShippingRepo.DeleteShippingMethod(id)
+}
+
+// QuoteAll prices the cart with every active method that ships to the country,
+// skipping methods that cannot carry it
+func (s *ShippingService) QuoteAll(items []models.Cart, merchandise float64, freeShipping bool, country string) ([]ShippingQuote, error) {
+    methods, err := s.GetShippingMethods(true)
+    if err != nil {
+        return nil, err
+    }
+    quotes := []ShippingQuote{}
+    for i := range methods {
+        quote, err := QuoteShipping(&methods[i], items, merchandise, freeShipping, country)
+        if err != nil {
+            continue
+        }
+        quotes = append(quotes, *quote)
+    }
+    return quotes, nil
+}
+
+// Quote prices the cart with the method identified by code
+func (s *ShippingService) Quote(code string, items []models.Cart, merchandise float64, freeShipping bool, country string) (*ShippingQuote, error) {
+    method, err := s.ShippingRepo.GetShippingMethodByCode(strings.ToLower(strings.TrimSpace(code)))
+    if err != nil {
+        return nil, errors.Wrap(ErrShippingMethodNotFound, err.Error())
+    }
+    quote, err := QuoteShipping(method, items, merchandise, freeShipping, country)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "code":       code,
+            "country":    country,
+            "error":      err,
+            "error_code": "SHIPPING_UNAVAILABLE",
+        }).Warn("Shipping method unavailable")
+        return nil, err
+    }
+    return quote, nil
+}
+
+// applyShipping adds shipping quotes to the summary and, when a method is chosen,
+// its price to the total. Shipping is not taxed.
+func applyShipping(summary *CartSummary, shipping *ShippingService, country, code string) error {
+    if shipping == nil || len(summary.Items) == 0 {
+        return nil
+    }
+    merchandise := roundMoney(summary.Subtotal - summary.DiscountTotal)
+    quotes, err := shipping.QuoteAll(summary.Items, merchandise, summary.FreeShipping, country)
+    if err != nil {
+        return err
+    }
+    summary.ShippingQuotes = quotes
+    if code == "" {
+        return nil
+    }
+    quote, err := shipping.Quote(code, summary.Items, merchandise, summary.FreeShipping, country)
+    if err != nil {
+        return err
+    }
+    summary.ShippingMethod = quote.Code
+    summary.ShippingTotal = quote.Price
+    summary.Total = roundMoney(summary.Total + quote.Price)
+    return nil
+}
@@ -0,0 +1,196 @@
+package services_test
+
+import (
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubAddressRepository is an in-memory AddressRepository
+type stubAddressRepository struct {
+    addresses []models.Address
+}
+
+func (m *stubAddressRepository) CreateAddress(address *models.Address) error {
+    address.ID = uint(len(m.addresses) + 1)
+    m.addresses = append(m.addresses, *address)
+    return nil
+}
+
+func (m *stubAddressRepository) GetAddressesByUserID(userID uint) ([]models.Address, error) {
+    var results []models.Address
+    for _, address := range m.addresses {
+        if address.UserID == userID {
+            results = append(results, address)
+        }
+    }
+    return results, nil
+}
+
+func (m *stubAddressRepository) GetAddressByID(id uint) (*models.Address, error) {
+    for _, address := range m.addresses {
+        if address.ID == id {
+            return &address, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubAddressRepository) UpdateAddress(address *models.Address) error {
+    for i := range m.addresses {
+        if m.addresses[i].ID == address.ID {
+            m.addresses[i] = *address
+        }
+    }
+    return nil
+}
+
+func (m *stubAddressRepository) DeleteAddress(id uint) error {
+    return nil
+}
+
+func (m *stubAddressRepository) SetDefaultAddress(userID, id uint) error {
+    for i := range m.addresses {
+        if m.addresses[i].UserID == userID {
+            m.addresses[i].IsDefault = m.addresses[i].ID == id
+        }
+    }
+    return nil
+}
+
+// stubShippingRepository is an in-memory ShippingRepository
+type stubShippingRepository struct {
+    methods []models.ShippingMethod
+}
+
+func (m *stubShippingRepository) CreateShippingMethod(method *models.ShippingMethod) error {
+    method.ID = uint(len(m.methods) + 1)
+    m.methods = append(m.methods, *method)
+    return nil
+}
+
+func (m *stubShippingRepository) GetShippingMethods(activeOnly bool) ([]models.ShippingMethod, error) {
+    var results []models.ShippingMethod
+    for _, method := range m.methods {
+        if method.Active || !activeOnly {
+            results = append(results, method)
+        }
+    }
+    return results, nil
+}
+
+func (m *stubShippingRepository) GetShippingMethodByID(id uint) (*models.ShippingMethod, error) {
+    for _, method := range m.methods {
+        if method.ID == id {
+            return &method, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubShippingRepository) GetShippingMethodByCode(code string) (*models.ShippingMethod, error) {
+    for _, method := range m.methods {
+        if method.Code == code {
+            return &method, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubShippingRepository) UpdateShippingMethod(method *models.ShippingMethod) error {
+    return nil
+}
+
+func (m *stubShippingRepository) DeleteShippingMethod(id uint) error {
+    return nil
+}
+
+func testShippingMethods() *stubShippingRepository {
+    return &stubShippingRepository{methods: []models.ShippingMethod{
+        {ID: 1, Code: "standard", Name: "Standard", RateType: models.ShippingRateFlat, FlatRate: 5, FreeOverAmount: 100, Active: true},
+        {ID: 2, Code: "express", Name: "Express", RateType: models.ShippingRateWeightBased, Countries: []string{"US"}, Active: true,
+            RateTiers: []models.ShippingRateTier{{MaxWeightKg: 10, Price: 25}, {MaxWeightKg: 2, Price: 12}}},
+    }}
+}
+
+func TestQuoteShipping(t *testing.T) {
+    methods := testShippingMethods().methods
+    flat, express := &methods[0], &methods[1]
+    // 0.5 kg actual but 30x20x10 cm is 1.2 kg volumetric
+    box := models.Product{Model: gorm.Model{ID: 1}, Price: 20, WeightKg: 0.5, LengthCm: 30, WidthCm: 20, HeightCm: 10}
+    items := []models.Cart{{ProductID: 1, Quantity: 1, Product: box}}
+    assert.Equal(t, 1.2, services.BillableWeight(items))
+
+    quote, err := services.QuoteShipping(flat, items, 20, false, "DE")
+    assert.NoError(t, err)
+    assert.Equal(t, 5.0, quote.Price)
+
+    // Test the lightest covering tier applies regardless of tier order
+    quote, err = services.QuoteShipping(express, items, 20, false, "US")
+    assert.NoError(t, err)
+    assert.Equal(t, 12.0, quote.Price)
+
+    items[0].Quantity = 5
+    quote, err = services.QuoteShipping(express, items, 100, false, "US")
+    assert.NoError(t, err)
+    assert.Equal(t, 25.0, quote.Price)
+
+    // Test parcels heavier than every tier cannot ship
+    items[0].Quantity = 10
+    _, err = services.QuoteShipping(express, items, 200, false, "US")
+    assert.Equal(t, services.ErrShippingUnavailable, errors.Cause(err))
+
+    // Test country restrictions
+    items[0].Quantity = 1
+    _, err = services.QuoteShipping(express, items, 20, false, "DE")
+    assert.Equal(t, services.ErrShippingUnavailable, err)
+
+    // Test free over threshold and free shipping coupons
+    quote, err = services.QuoteShipping(flat, items, 100, false, "US")
+    assert.NoError(t, err)
+    assert.True(t, quote.Free)
+    assert.Equal(t, 0.0, quote.Price)
+    quote, err = services.QuoteShipping(express, items, 20, true, "US")
+    assert.NoError(t, err)
+    assert.Equal(t, 0.0, quote.Price)
+}
+
+func TestValidateAddress(t *testing.T) {
+    address := models.Address{Name: "Ada", Line1: "1 Main St", City: "Springfield", Region: "il", PostalCode: "62701", Country: "us"}
+    assert.NoError(t, services.ValidateAddress(&address))
+    assert.Equal(t, "US", address.Country)
+    assert.Equal(t, "IL", address.Region)
+
+    // Test postal code format per country
+    address.PostalCode = "6270"
+    assert.Equal(t, services.ErrInvalidAddress, errors.Cause(services.ValidateAddress(&address)))
+    gb := models.Address{Name: "Ada", Line1: "10 Downing St", City: "London", PostalCode: "sw1a 2aa", Country: "GB"}
+    assert.NoError(t, services.ValidateAddress(&gb))
+
+    // Test US addresses need a state
+    address.PostalCode = "62701"
+    address.Region = ""
+    assert.Equal(t, services.ErrInvalidAddress, errors.Cause(services.ValidateAddress(&address)))
+
+    // Test country must be an ISO code
+    gb.Country = "GBR"
+    assert.Equal(t, services.ErrInvalidAddress, errors.Cause(services.ValidateAddress(&gb)))
+}
+
+func TestAddressService_FirstAddressIsDefault(t *testing.T) {
+    service := services.NewAddressService(&stubAddressRepository{}, newTestLogger())
+    first := models.Address{Name: "Ada", Line1: "1 Main St", City: "Berlin", PostalCode: "10115", Country: "DE"}
+    second := first
+    assert.NoError(t, service.CreateAddress(1, &first))
+    assert.NoError(t, service.CreateAddress(1, &second))
+    assert.True(t, first.IsDefault)
+    assert.False(t, second.IsDefault)
+
+    // Test other users cannot read the address
+    _, err := service.GetAddress(2, first.ID)
+    assert.Equal(t, services.ErrAddressNotFound, err)
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/pkg/errors"
+)
+
+// Tax error types
+var (
+    ErrTaxAddressRequired = errors.New("country is required to calculate tax")
+    ErrTaxRatesFailed     = errors.New("failed to load tax rates")
+)
+
+// TaxAddress identifies the tax jurisdiction of a sale
+type TaxAddress struct {
+    Country    string `json:"country"`
+    Region     string `json:"region"`
+    PostalCode string `json:"postal_code"`
+}
+
+// TaxableLine is an amount, after discounts, taxed under a product tax class
+type TaxableLine struct {
+    ProductID uint
+    TaxClass  string
+    Amount    float64
+}
+
+// TaxLine is the tax collected at a single rate
+type TaxLine struct {
+    Name          string  `json:"name"`
+    Rate          float64 `json:"rate"`
+    TaxableAmount float64 `json:"taxable_amount"`
+    Amount        float64 `json:"amount"`
+}
+
+// TaxResult is the outcome of a tax calculation. When PricesIncludeTax is set the
+// tax is already contained in the line amounts and must not be added to the total.
+type TaxResult struct {
+    Lines            []TaxLine
+    Total            float64
+    PricesIncludeTax bool
+}
+
+// TaxCalculator calculates tax for a sale. TableTaxCalculator is the built-in
+// implementation; an external tax service can be plugged in by implementing it.
+type TaxCalculator interface {
+    CalculateTax(address TaxAddress, lines []TaxableLine) (*TaxResult, error)
+}
+
+// TaxRateProvider supplies the tax table rows for a country
+type TaxRateProvider interface {
+    GetTaxRatesByCountry(country string) ([]models.TaxRate, error)
+}
+
+// TableTaxCalculator calculates tax from a table of rates keyed by country, region,
+// postal code prefix and product tax class
+type TableTaxCalculator struct {
+    Rates            TaxRateProvider
+    PricesIncludeTax bool
+}
+
+// NewTableTaxCalculator creates a new TableTaxCalculator
+func NewTableTaxCalculator(rates TaxRateProvider, pricesIncludeTax bool) *TableTaxCalculator {
+    return &TableTaxCalculator{Rates: rates, PricesIncludeTax: pricesIncludeTax}
+}
+
+// CalculateTax implements TaxCalculator
+func (c *TableTaxCalculator) CalculateTax(address TaxAddress, lines []TaxableLine) (*TaxResult, error) {
+    country := strings.ToUpper(strings.TrimSpace(address.Country))
+    if country == "" {
+        return nil, ErrTaxAddressRequired
+    }
+    rates, err := c.Rates.GetTaxRatesByCountry(country)
+    if err != nil {
+        return nil, errors.Wrap(ErrTaxRatesFailed, err.Error())
+    }
+
+    result := &TaxResult{Lines: []TaxLine{}, PricesIncludeTax: c.PricesIncludeTax}
+    index := make(map[uint]int)
+    for _, line := range lines {
+        taxClass := line.TaxClass
+        if taxClass == "" {
+            taxClass = models.TaxClassStandard
+        }
+        if taxClass == models.TaxClassExempt || line.Amount <= 0 {
+            continue
+        }
+        rate := matchTaxRate(rates, address, taxClass)
+        if rate == nil || rate.Rate <= 0 {
+            continue
+        }
+        tax := line.Amount * rate.Rate
+        if c.PricesIncludeTax {
+            tax = line.Amount - line.Amount/(1+rate.Rate)
+        }
+        i, ok := index[rate.ID]
+        if !ok {
+            i = len(result.Lines)
+            index[rate.ID] = i
+            result.Lines = append(result.Lines, TaxLine{Name: rate.Name, Rate: rate.Rate})
+        }
+        result.Lines[i].TaxableAmount += line.Amount
+        result.Lines[i].Amount += tax
+    }
+    for i := range result.Lines {
+        result.Lines[i].TaxableAmount = roundMoney(result.Lines[i].TaxableAmount)
+        result.Lines[i].Amount = roundMoney(result.Lines[i].Amount)
+        result.Total = roundMoney(result.Total + result.Lines[i].Amount)
+    }
+    return result, nil
+}
+
+// matchTaxRate returns the most specific rate for the address and tax class: a postal
+// code prefix match beats a region match, which beats a country-wide rate
+func matchTaxRate(rates []models.TaxRate, address TaxAddress, taxClass string) *models.TaxRate {
+    region := strings.ToUpper(strings.TrimSpace(address.Region))
+    postalCode := strings.ToUpper(strings.ReplaceAll(address.PostalCode, " ", ""))
+
+    var best *models.TaxRate
+    bestScore := -1
+    for i := range rates {
+        rate := &rates[i]
+        if rate.TaxClass != taxClass {
+            continue
+        }
+        score := 0
+        if rate.Region != "" {
+            if !strings.EqualFold(rate.Region, region) {
+                continue
+            }
+            score = 1
+        }
+        if rate.PostalCodePrefix != "" {
+            prefix := strings.ToUpper(strings.ReplaceAll(rate.PostalCodePrefix, " ", ""))
+            if !strings.HasPrefix(postalCode, prefix) {
+                continue
+            }
+            score = 10 + len(prefix)
+        }
+        if score > bestScore {
+            best, bestScore = rate, score
+        }
+    }
+    return best
+}
+
+// applyTax adds tax lines to the summary, spreading its discount across the lines in
+// proportion to their value so tax is charged on what the customer actually pays
+func applyTax(summary *CartSummary, calculator TaxCalculator, address TaxAddress) error {
+    if calculator == nil || len(summary.Items) == 0 {
+        return nil
+    }
+    lines := make([]TaxableLine, 0, len(summary.Items))
+    remainingDiscount := summary.DiscountTotal
+    for i, item := range summary.Items {
+        amount := item.Product.Price * float64(item.Quantity)
+        discount := 0.0
+        if summary.Subtotal > 0 {
+            discount = roundMoney(summary.DiscountTotal * amount / summary.Subtotal)
+        }
+        if i == len(summary.Items)-1 {
+            discount = remainingDiscount
+        }
+        remainingDiscount = roundMoney(remainingDiscount - discount)
+        lines = append(lines, TaxableLine{
+            ProductID: item.ProductID,
+            TaxClass:  item.Product.TaxClass,
+            Amount:    roundMoney(amount - discount),
+        })
+    }
+
+    result, err := calculator.CalculateTax(address, lines)
+    if err != nil {
+        return err
+    }
+    summary.TaxLines = result.Lines
+    summary.TaxTotal = result.Total
+    summary.PricesIncludeTax = result.PricesIncludeTax
+    if !result.PricesIncludeTax {
+        summary.Total = roundMoney(summary.Total + result.Total)
+    }
+    return nil
+}
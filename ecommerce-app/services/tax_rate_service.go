@@ -0,0 +1,89 @@
+package services
+
+import (
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// Tax rate error types
+var (
+    ErrInvalidTaxRate  = errors.New("invalid tax rate data")
+    ErrTaxRateNotFound = errors.New("tax rate not found")
+)
+
+// TaxRateService manages the tax table used by TableTaxCalculator
+type TaxRateService struct {
+    TaxRateRepo repositories.TaxRateRepository
+    Logger      *logrus.Logger
+}
+
+// NewTaxRateService creates a new TaxRateService
+func NewTaxRateService(taxRateRepo repositories.TaxRateRepository, logger *logrus.Logger) *TaxRateService {
+    return &TaxRateService{
+        TaxRateRepo: taxRateRepo,
+        Logger:      logger,
+    }
+}
+
+// CreateTaxRate validates and stores a tax table row
+func (s *TaxRateService) CreateTaxRate(rate *models.TaxRate) error {
+    rate.Country = strings.ToUpper(strings.TrimSpace(rate.Country))
+    rate.Region = strings.ToUpper(strings.TrimSpace(rate.Region))
+    rate.PostalCodePrefix = strings.ToUpper(strings.ReplaceAll(rate.PostalCodePrefix, " ", ""))
+    if rate.TaxClass == "" {
+        rate.TaxClass = models.TaxClassStandard
+    }
+    if len(rate.Country) != 2 || rate.Name == "" || rate.Rate < 0 || rate.Rate >= 1 {
+        s.Logger.WithFields(logrus.Fields{
+            "country":    rate.Country,
+            "rate":       rate.Rate,
+            "error_code": "INVALID_TAX_RATE",
+        }).Warn("Invalid tax rate data")
+        return ErrInvalidTaxRate
+    }
+    switch rate.TaxClass {
+    case models.TaxClassStandard, models.TaxClassReduced, models.TaxClassExempt:
+    default:
+        return errors.Wrap(ErrInvalidTaxRate, "unknown tax class")
+    }
+    if err := s.TaxRateRepo.CreateTaxRate(rate); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "CREATE_TAX_RATE_FAILED",
+        }).Error("Failed to create tax rate")
+        return err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "tax_rate_id": rate.ID,
+        "country":     rate.Country,
+        "region":      rate.Region,
+        "rate":        rate.Rate,
+    }).Info("Created tax rate")
+    return nil
+}
+
+// GetTaxRates retrieves the whole tax table
+func (s *TaxRateService) GetTaxRates() ([]models.TaxRate, error) {
+    return s.TaxRateRepo.GetTaxRates()
+}
+
+// DeleteTaxRate removes a tax table row
+func (s *TaxRateService) DeleteTaxRate(id uint) error {
+    deleted, err := s.TaxRateRepo.DeleteTaxRate(id)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "tax_rate_id": id,
+            "error":       err,
+            "error_code":  "DELETE_TAX_RATE_FAILED",
+        }).Error("Failed to delete tax rate")
+        return err
+    }
+    if !deleted {
+        return ErrTaxRateNotFound
+    }
+    return nil
+}
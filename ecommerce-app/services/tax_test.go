@@ -0,0 +1,89 @@
+package services_test
+
+import (
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/stretchr/testify/assert"
+)
+
+// stubTaxRateProvider serves a fixed tax table
+type stubTaxRateProvider struct {
+    rates []models.TaxRate
+}
+
+func (m *stubTaxRateProvider) GetTaxRatesByCountry(country string) ([]models.TaxRate, error) {
+    var results []models.TaxRate
+    for _, rate := range m.rates {
+        if rate.Country == country {
+            results = append(results, rate)
+        }
+    }
+    return results, nil
+}
+
+func testTaxTable() *stubTaxRateProvider {
+    return &stubTaxRateProvider{rates: []models.TaxRate{
+        {ID: 1, Country: "US", TaxClass: models.TaxClassStandard, Name: "US", Rate: 0.05},
+        {ID: 2, Country: "US", Region: "CA", TaxClass: models.TaxClassStandard, Name: "California", Rate: 0.0725},
+        {ID: 3, Country: "US", Region: "CA", PostalCodePrefix: "941", TaxClass: models.TaxClassStandard, Name: "San Francisco", Rate: 0.08625},
+        {ID: 4, Country: "DE", TaxClass: models.TaxClassStandard, Name: "MwSt", Rate: 0.19},
+        {ID: 5, Country: "DE", TaxClass: models.TaxClassReduced, Name: "MwSt reduced", Rate: 0.07},
+    }}
+}
+
+func TestTableTaxCalculator_Specificity(t *testing.T) {
+    calculator := services.NewTableTaxCalculator(testTaxTable(), false)
+    lines := []services.TaxableLine{{ProductID: 1, TaxClass: models.TaxClassStandard, Amount: 100}}
+
+    // Test postal code prefix beats region
+    result, err := calculator.CalculateTax(services.TaxAddress{Country: "us", Region: "ca", PostalCode: "94103"}, lines)
+    assert.NoError(t, err)
+    assert.Equal(t, "San Francisco", result.Lines[0].Name)
+    assert.Equal(t, 8.63, result.Total)
+
+    // Test region beats country
+    result, err = calculator.CalculateTax(services.TaxAddress{Country: "US", Region: "CA", PostalCode: "90001"}, lines)
+    assert.NoError(t, err)
+    assert.Equal(t, "California", result.Lines[0].Name)
+
+    // Test country-wide fallback
+    result, err = calculator.CalculateTax(services.TaxAddress{Country: "US", Region: "NY"}, lines)
+    assert.NoError(t, err)
+    assert.Equal(t, 5.0, result.Total)
+
+    // Test unknown country has no tax
+    result, err = calculator.CalculateTax(services.TaxAddress{Country: "FR"}, lines)
+    assert.NoError(t, err)
+    assert.Empty(t, result.Lines)
+
+    // Test missing country
+    _, err = calculator.CalculateTax(services.TaxAddress{}, lines)
+    assert.Equal(t, services.ErrTaxAddressRequired, err)
+}
+
+func TestTableTaxCalculator_TaxClasses(t *testing.T) {
+    lines := []services.TaxableLine{
+        {ProductID: 1, TaxClass: models.TaxClassStandard, Amount: 100},
+        {ProductID: 2, TaxClass: models.TaxClassReduced, Amount: 50},
+        {ProductID: 3, TaxClass: models.TaxClassExempt, Amount: 20},
+        {ProductID: 4, Amount: 100},
+    }
+
+    // Test exclusive pricing groups lines by rate
+    result, err := services.NewTableTaxCalculator(testTaxTable(), false).CalculateTax(services.TaxAddress{Country: "DE"}, lines)
+    assert.NoError(t, err)
+    assert.Len(t, result.Lines, 2)
+    assert.Equal(t, 200.0, result.Lines[0].TaxableAmount)
+    assert.Equal(t, 38.0, result.Lines[0].Amount)
+    assert.Equal(t, 3.5, result.Lines[1].Amount)
+    assert.Equal(t, 41.5, result.Total)
+    assert.False(t, result.PricesIncludeTax)
+
+    // Test inclusive pricing extracts the tax from the amount
+    result, err = services.NewTableTaxCalculator(testTaxTable(), true).CalculateTax(services.TaxAddress{Country: "DE"}, lines[:1])
+    assert.NoError(t, err)
+    assert.Equal(t, 15.97, result.Total)
+    assert.True(t, result.PricesIncludeTax)
+}
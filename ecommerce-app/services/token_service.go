@@ -0,0 +1,199 @@
+package services
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// Token error types
+var (
+    ErrInvalidRefreshToken = errors.New("invalid refresh token")
+    ErrRefreshTokenExpired = errors.New("refresh token expired")
+    ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+    ErrIssueTokenFailed    = errors.New("failed to issue token")
+)
+
+// AccessTokenIssuer signs a short-lived access token for the user
+type AccessTokenIssuer func(userID uint) (string, error)
+
+// TokenPair is returned by login and refresh
+type TokenPair struct {
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    TokenType    string `json:"token_type"`
+    ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+}
+
+// TokenService issues access tokens alongside rotating, server-side refresh tokens.
+// Suspended users are refused tokens however they log in.
+type TokenService struct {
+    RefreshTokenRepo repositories.RefreshTokenRepository
+    UserRepo         repositories.UserRepository
+    IssueAccessToken AccessTokenIssuer
+    AccessTokenTTL   time.Duration
+    RefreshTokenTTL  time.Duration
+    Logger           *logrus.Logger
+}
+
+// NewTokenService creates a new TokenService
+func NewTokenService(refreshTokenRepo repositories.RefreshTokenRepository, userRepo repositories.UserRepository, issuer AccessTokenIssuer, accessTTL, refreshTTL time.Duration, logger *logrus.Logger) *TokenService {
+    return &TokenService{
+        RefreshTokenRepo: refreshTokenRepo,
+        UserRepo:         userRepo,
+        IssueAccessToken: issuer,
+        AccessTokenTTL:   accessTTL,
+        RefreshTokenTTL:  refreshTTL,
+        Logger:           logger,
+    }
+}
+
+// IssueTokens starts a new refresh token family for a fresh login
+func (s *TokenService) IssueTokens(userID uint) (*TokenPair, error) {
+    if err := s.checkUser(userID); err != nil {
+        return nil, err
+    }
+    familyID, err := randomHex(16)
+    if err != nil {
+        return nil, errors.Wrap(ErrIssueTokenFailed, err.Error())
+    }
+    return s.issue(userID, familyID)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token is
+// consumed; presenting it again revokes every token in its family, since either the
+// client or an attacker holds a stolen copy.
+func (s *TokenService) Refresh(refreshToken string) (*TokenPair, error) {
+    token, err := s.RefreshTokenRepo.GetRefreshTokenByHash(hashToken(refreshToken))
+    if err != nil {
+        return nil, ErrInvalidRefreshToken
+    }
+    if token.RevokedAt != nil {
+        return nil, ErrInvalidRefreshToken
+    }
+    if token.UsedAt != nil {
+        return nil, s.reuseDetected(token)
+    }
+    if time.Now().After(token.ExpiresAt) {
+        return nil, ErrRefreshTokenExpired
+    }
+    if err := s.checkUser(token.UserID); err != nil {
+        return nil, err
+    }
+    consumed, err := s.RefreshTokenRepo.MarkRefreshTokenUsed(token.ID)
+    if err != nil {
+        return nil, errors.Wrap(ErrIssueTokenFailed, err.Error())
+    }
+    if !consumed {
+        return nil, s.reuseDetected(token)
+    }
+    return s.issue(token.UserID, token.FamilyID)
+}
+
+// Logout revokes the refresh token family the token belongs to. Tokens of other
+// users are ignored so a logout cannot be used to probe them.
+func (s *TokenService) Logout(userID uint, refreshToken string) error {
+    token, err := s.RefreshTokenRepo.GetRefreshTokenByHash(hashToken(refreshToken))
+    if err != nil || token.UserID != userID {
+        return nil
+    }
+    if err := s.RefreshTokenRepo.RevokeFamily(token.FamilyID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "REVOKE_TOKEN_FAILED",
+        }).Error("Failed to revoke refresh tokens")
+        return err
+    }
+    return nil
+}
+
+// RevokeAll revokes every refresh token of the user, signing them out everywhere
+func (s *TokenService) RevokeAll(userID uint) error {
+    return s.RefreshTokenRepo.RevokeAllForUser(userID)
+}
+
+// checkUser refuses tokens to suspended users
+func (s *TokenService) checkUser(userID uint) error {
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return errors.Wrap(ErrIssueTokenFailed, err.Error())
+    }
+    if user.SuspendedAt != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error_code": "ACCOUNT_SUSPENDED",
+        }).Warn("Tokens refused for suspended account")
+        return ErrAccountSuspended
+    }
+    return nil
+}
+
+func (s *TokenService) issue(userID uint, familyID string) (*TokenPair, error) {
+    accessToken, err := s.IssueAccessToken(userID)
+    if err != nil {
+        return nil, errors.Wrap(ErrIssueTokenFailed, err.Error())
+    }
+    refreshToken, hash, err := newOpaqueToken()
+    if err != nil {
+        return nil, errors.Wrap(ErrIssueTokenFailed, err.Error())
+    }
+    record := &models.RefreshToken{
+        UserID:    userID,
+        FamilyID:  familyID,
+        TokenHash: hash,
+        ExpiresAt: time.Now().Add(s.RefreshTokenTTL),
+    }
+    if err := s.RefreshTokenRepo.CreateRefreshToken(record); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "CREATE_REFRESH_TOKEN_FAILED",
+        }).Error("Failed to store refresh token")
+        return nil, errors.Wrap(ErrIssueTokenFailed, err.Error())
+    }
+    return &TokenPair{
+        AccessToken:  accessToken,
+        RefreshToken: refreshToken,
+        TokenType:    "Bearer",
+        ExpiresIn:    int(s.AccessTokenTTL.Seconds()),
+    }, nil
+}
+
+func (s *TokenService) reuseDetected(token *models.RefreshToken) error {
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":    token.UserID,
+        "family_id":  token.FamilyID,
+        "error_code": "REFRESH_TOKEN_REUSE",
+    }).Warn("Refresh token reused; revoking token family")
+    if err := s.RefreshTokenRepo.RevokeFamily(token.FamilyID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "family_id":  token.FamilyID,
+            "error":      err,
+            "error_code": "REVOKE_TOKEN_FAILED",
+        }).Error("Failed to revoke refresh token family")
+    }
+    return ErrRefreshTokenReused
+}
+
+// newOpaqueToken returns a random URL-safe token and the hash to store for it
+func newOpaqueToken() (string, string, error) {
+    raw, err := randomBytes(32)
+    if err != nil {
+        return "", "", err
+    }
+    token := base64.RawURLEncoding.EncodeToString(raw)
+    return token, hashToken(token), nil
+}
+
+// hashToken is how opaque tokens are stored, so a database leak yields no usable tokens
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
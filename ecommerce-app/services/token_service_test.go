@@ -0,0 +1,165 @@
+package services_test
+
+import (
+    "fmt"
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubRefreshTokenRepository keeps refresh tokens in memory
+type stubRefreshTokenRepository struct {
+    tokens []models.RefreshToken
+}
+
+func (r *stubRefreshTokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+    token.ID = uint(len(r.tokens) + 1)
+    r.tokens = append(r.tokens, *token)
+    return nil
+}
+
+func (r *stubRefreshTokenRepository) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+    for i := range r.tokens {
+        if r.tokens[i].TokenHash == hash {
+            token := r.tokens[i]
+            return &token, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stubRefreshTokenRepository) MarkRefreshTokenUsed(id uint) (bool, error) {
+    for i := range r.tokens {
+        if r.tokens[i].ID == id && r.tokens[i].UsedAt == nil {
+            now := time.Now()
+            r.tokens[i].UsedAt = &now
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+func (r *stubRefreshTokenRepository) RevokeFamily(familyID string) error {
+    for i := range r.tokens {
+        if r.tokens[i].FamilyID == familyID && r.tokens[i].RevokedAt == nil {
+            now := time.Now()
+            r.tokens[i].RevokedAt = &now
+        }
+    }
+    return nil
+}
+
+func (r *stubRefreshTokenRepository) RevokeAllForUser(userID uint) error {
+    for i := range r.tokens {
+        if r.tokens[i].UserID == userID && r.tokens[i].RevokedAt == nil {
+            now := time.Now()
+            r.tokens[i].RevokedAt = &now
+        }
+    }
+    return nil
+}
+
+// newStubAccessTokenIssuer issues a distinct access token on every call
+func newStubAccessTokenIssuer() services.AccessTokenIssuer {
+    issued := 0
+    return func(userID uint) (string, error) {
+        issued++
+        return fmt.Sprintf("access-%d-%d", userID, issued), nil
+    }
+}
+
+func TestTokenService_RefreshRotates(t *testing.T) {
+    repo := &stubRefreshTokenRepository{}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann"}}}
+    service := services.NewTokenService(repo, users, newStubAccessTokenIssuer(), 15*time.Minute, time.Hour, newTestLogger())
+
+    pair, err := service.IssueTokens(1)
+    assert.NoError(t, err)
+    assert.Equal(t, 900, pair.ExpiresIn)
+    assert.NotEqual(t, pair.RefreshToken, repo.tokens[0].TokenHash)
+
+    rotated, err := service.Refresh(pair.RefreshToken)
+    assert.NoError(t, err)
+    assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+    assert.NotEqual(t, pair.AccessToken, rotated.AccessToken)
+    assert.Equal(t, repo.tokens[0].FamilyID, repo.tokens[1].FamilyID)
+
+    // Test the rotated token can be used in turn
+    _, err = service.Refresh(rotated.RefreshToken)
+    assert.NoError(t, err)
+}
+
+func TestTokenService_ReuseRevokesFamily(t *testing.T) {
+    repo := &stubRefreshTokenRepository{}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann"}}}
+    service := services.NewTokenService(repo, users, newStubAccessTokenIssuer(), 15*time.Minute, time.Hour, newTestLogger())
+
+    pair, _ := service.IssueTokens(1)
+    rotated, err := service.Refresh(pair.RefreshToken)
+    assert.NoError(t, err)
+
+    // Test replaying the consumed token is detected
+    _, err = service.Refresh(pair.RefreshToken)
+    assert.Equal(t, services.ErrRefreshTokenReused, err)
+
+    // Test the legitimate successor is revoked along with it
+    _, err = service.Refresh(rotated.RefreshToken)
+    assert.Equal(t, services.ErrInvalidRefreshToken, err)
+
+    // Test other logins of the same user are unaffected
+    other, _ := service.IssueTokens(1)
+    _, err = service.Refresh(other.RefreshToken)
+    assert.NoError(t, err)
+}
+
+func TestTokenService_RefreshRejectsUnknownAndExpired(t *testing.T) {
+    repo := &stubRefreshTokenRepository{}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann"}}}
+    service := services.NewTokenService(repo, users, newStubAccessTokenIssuer(), 15*time.Minute, time.Hour, newTestLogger())
+
+    _, err := service.Refresh("not-a-token")
+    assert.Equal(t, services.ErrInvalidRefreshToken, err)
+
+    pair, _ := service.IssueTokens(1)
+    repo.tokens[0].ExpiresAt = time.Now().Add(-time.Minute)
+    _, err = service.Refresh(pair.RefreshToken)
+    assert.Equal(t, services.ErrRefreshTokenExpired, err)
+}
+
+func TestTokenService_Logout(t *testing.T) {
+    repo := &stubRefreshTokenRepository{}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann"}}}
+    service := services.NewTokenService(repo, users, newStubAccessTokenIssuer(), 15*time.Minute, time.Hour, newTestLogger())
+
+    pair, _ := service.IssueTokens(1)
+
+    // Test another user's logout leaves the token alone
+    assert.NoError(t, service.Logout(2, pair.RefreshToken))
+    assert.Nil(t, repo.tokens[0].RevokedAt)
+
+    assert.NoError(t, service.Logout(1, pair.RefreshToken))
+    _, err := service.Refresh(pair.RefreshToken)
+    assert.Equal(t, services.ErrInvalidRefreshToken, err)
+}
+
+func TestTokenService_RefusesSuspendedUsers(t *testing.T) {
+    repo := &stubRefreshTokenRepository{}
+    users := &stubUserRepository{users: []models.User{{ID: 1, Username: "ann"}}}
+    service := services.NewTokenService(repo, users, newStubAccessTokenIssuer(), 15*time.Minute, time.Hour, newTestLogger())
+    pair, err := service.IssueTokens(1)
+    assert.NoError(t, err)
+
+    suspendedAt := time.Now()
+    service.UserRepo.(*stubUserRepository).users[0].SuspendedAt = &suspendedAt
+    _, err = service.IssueTokens(1)
+    assert.Equal(t, services.ErrAccountSuspended, err)
+
+    // Test an existing refresh token no longer works either
+    _, err = service.Refresh(pair.RefreshToken)
+    assert.Equal(t, services.ErrAccountSuspended, err)
+    assert.Nil(t, repo.tokens[0].UsedAt)
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/sirupsen/logrus"
+)
+
+// User administration error types
+var (
+    ErrAccountSuspended       = errors.New("account is suspended")
+    ErrUserAlreadySuspended   = errors.New("user is already suspended")
+    ErrUserNotSuspended       = errors.New("user is not suspended")
+    ErrUserErased             = errors.New("user account has been erased")
+    ErrCannotManageSelf       = errors.New("admins cannot suspend, reset or impersonate themselves")
+    ErrCannotImpersonateAdmin = errors.New("users with admin access cannot be impersonated")
+    ErrReasonRequired         = errors.New("a reason is required")
+    ErrAuditFailed            = errors.New("failed to record audit log")
+    ErrImpersonationDisabled  = errors.New("impersonation is not configured")
+)
+
+// AdminActor identifies the admin behind an action for the audit log
+type AdminActor struct {
+    ID uint
+    IP string
+}
+
+// ImpersonationIssuer signs an access token for user that records impersonatorID as
+// the real caller
+type ImpersonationIssuer func(user *models.User, impersonatorID uint) (string, error)
+
+// ImpersonationToken is a short-lived access token acting as another user. It comes
+// without a refresh token.
+type ImpersonationToken struct {
+    AccessToken string `json:"access_token"`
+    TokenType   string `json:"token_type"`
+    ExpiresIn   int    `json:"expires_in"`
+    UserID      uint   `json:"user_id"`
+}
+
+// UserAdminService lets admins find users, change their role, suspend and reactivate
+// them, force a password reset and impersonate them. Every change is written to the
+// audit log.
+type UserAdminService struct {
+    UserRepo         repositories.UserRepository
+    RoleRepo         repositories.RoleRepository
+    AuditRepo        repositories.AuditLogRepository
+    Roles            *RoleService
+    Accounts         *AccountService
+    Sessions         SessionRevoker      // optional
+    AuthCache        AuthCache           // optional
+    Impersonation    ImpersonationIssuer // optional; impersonation is disabled without it
+    ImpersonationTTL time.Duration
+    Logger           *logrus.Logger
+}
+
+// NewUserAdminService creates a new UserAdminService
+func NewUserAdminService(userRepo repositories.UserRepository, roleRepo repositories.RoleRepository, auditRepo repositories.AuditLogRepository, roles *RoleService, accounts *AccountService, logger *logrus.Logger) *UserAdminService {
+    return &UserAdminService{
+        UserRepo:  userRepo,
+        RoleRepo:  roleRepo,
+        AuditRepo: auditRepo,
+        Roles:     roles,
+        Accounts:  accounts,
+        Logger:    logger,
+    }
+}
+
+// ListUsers returns a page of users matching search on username or email
+func (s *UserAdminService) ListUsers(search, role string, page, limit int) ([]models.User, int64, error) {
+    return s.UserRepo.ListUsers(strings.TrimSpace(search), role, page, limit)
+}
+
+// GetUser returns a single user
+func (s *UserAdminService) GetUser(userID uint) (*models.User, error) {
+    user, err := s.UserRepo.GetUserByID(userID)
+    if err != nil {
+        return nil, errors.Wrap(ErrUserNotFound, err.Error())
+    }
+    return user, nil
+}
+
+// GetAuditLog returns the actions taken on a user, newest first
+func (s *UserAdminService) GetAuditLog(userID uint, page, limit int) ([]models.AuditLog, int64, error) {
+    return s.AuditRepo.GetAuditLogsByTarget(userID, page, limit)
+}
+
+// ChangeRole gives a user a role through RoleService, which keeps it within the
+// admin's own, and records the change
+func (s *UserAdminService) ChangeRole(actor AdminActor, userID uint, role string) error {
+    if actor.ID == userID {
+        return ErrCannotChangeOwnRole
+    }
+    user, err := s.manageableUser(actor, userID)
+    if err != nil {
+        return err
+    }
+    if err := s.Roles.AssignRole(actor.ID, userID, role); err != nil {
+        return err
+    }
+    s.audit(actor, models.AuditUserRoleChanged, userID, "", fmt.Sprintf("%s -> %s", user.Role, role))
+    return nil
+}
+
+// Suspend blocks a user: their tokens and sessions stop working at once and they
+// cannot log in until reactivated
+func (s *UserAdminService) Suspend(actor AdminActor, userID uint, reason string) error {
+    reason = strings.TrimSpace(reason)
+    if reason == "" {
+        return ErrReasonRequired
+    }
+    user, err := s.manageableUser(actor, userID)
+    if err != nil {
+        return err
+    }
+    if user.SuspendedAt != nil {
+        return ErrUserAlreadySuspended
+    }
+    if err := s.UserRepo.SuspendUser(userID, reason); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "SUSPEND_USER_FAILED",
+        }).Error("Failed to suspend user")
+        return err
+    }
+    s.signOut(userID)
+    s.audit(actor, models.AuditUserSuspended, userID, reason, "")
+    return nil
+}
+
+// Reactivate lifts a suspension
+func (s *UserAdminService) Reactivate(actor AdminActor, userID uint) error {
+    user, err := s.GetUser(userID)
+    if err != nil {
+        return err
+    }
+    if user.SuspendedAt == nil {
+        return ErrUserNotSuspended
+    }
+    if err := s.UserRepo.ReactivateUser(userID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "REACTIVATE_USER_FAILED",
+        }).Error("Failed to reactivate user")
+        return err
+    }
+    invalidateCachedUser(s.AuthCache, s.Logger, userID)
+    s.audit(actor, models.AuditUserReactivated, userID, "", "")
+    return nil
+}
+
+// ForcePasswordReset discards the user's password, signs them out everywhere and mails
+// a reset link. They cannot log in with a password until they follow it.
+func (s *UserAdminService) ForcePasswordReset(actor AdminActor, userID uint, reason string) error {
+    user, err := s.manageableUser(actor, userID)
+    if err != nil {
+        return err
+    }
+    if err := s.UserRepo.UpdatePassword(userID, UnusablePassword); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "FORCE_PASSWORD_RESET_FAILED",
+        }).Error("Failed to discard password")
+        return err
+    }
+    s.signOut(userID)
+    s.audit(actor, models.AuditPasswordResetForced, userID, strings.TrimSpace(reason), "")
+    return s.Accounts.RequestPasswordReset(user.Email)
+}
+
+// Impersonate issues a short-lived access token acting as the user, for support staff
+// to see what the user sees. The token is marked with the admin's ID, and the audit
+// entry is written before the token is issued.
+func (s *UserAdminService) Impersonate(actor AdminActor, userID uint, reason string) (*ImpersonationToken, error) {
+    reason = strings.TrimSpace(reason)
+    if reason == "" {
+        return nil, ErrReasonRequired
+    }
+    if s.Impersonation == nil {
+        return nil, ErrImpersonationDisabled
+    }
+    user, err := s.manageableUser(actor, userID)
+    if err != nil {
+        return nil, err
+    }
+    if user.SuspendedAt != nil {
+        return nil, ErrAccountSuspended
+    }
+    // Impersonating another admin would let one admin act with another's powers
+    role, err := s.RoleRepo.GetRoleByName(user.Role)
+    if err != nil {
+        return nil, errors.Wrap(ErrRoleNotFound, err.Error())
+    }
+    if role.HasPermission(models.PermissionAdminAccess) {
+        return nil, ErrCannotImpersonateAdmin
+    }
+
+    entry := &models.AuditLog{
+        ActorID:      actor.ID,
+        Action:       models.AuditImpersonationStarted,
+        TargetUserID: userID,
+        Reason:       reason,
+        Details:      fmt.Sprintf("expires in %s", s.ImpersonationTTL),
+        IP:           actor.IP,
+    }
+    if err := s.AuditRepo.CreateAuditLog(entry); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "admin_id":   actor.ID,
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "AUDIT_LOG_FAILED",
+        }).Error("Refusing impersonation that could not be audited")
+        return nil, errors.Wrap(ErrAuditFailed, err.Error())
+    }
+    token, err := s.Impersonation(user, actor.ID)
+    if err != nil {
+        return nil, err
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "admin_id": actor.ID,
+        "user_id":  userID,
+        "reason":   reason,
+        "ip":       actor.IP,
+    }).Warn("Admin started impersonating user")
+    return &ImpersonationToken{
+        AccessToken: token,
+        TokenType:   "Bearer",
+        ExpiresIn:   int(s.ImpersonationTTL.Seconds()),
+        UserID:      userID,
+    }, nil
+}
+
+// manageableUser loads a user an admin may act on: not themselves and not erased
+func (s *UserAdminService) manageableUser(actor AdminActor, userID uint) (*models.User, error) {
+    if actor.ID == userID {
+        return nil, ErrCannotManageSelf
+    }
+    user, err := s.GetUser(userID)
+    if err != nil {
+        return nil, err
+    }
+    if user.DeletedAt != nil {
+        return nil, ErrUserErased
+    }
+    return user, nil
+}
+
+func (s *UserAdminService) signOut(userID uint) {
+    if s.Sessions != nil {
+        if err := s.Sessions.RevokeAll(userID); err != nil {
+            s.Logger.WithFields(logrus.Fields{
+                "user_id":    userID,
+                "error":      err,
+                "error_code": "REVOKE_SESSIONS_FAILED",
+            }).Error("Failed to revoke sessions")
+        }
+    }
+    invalidateCachedUser(s.AuthCache, s.Logger, userID)
+}
+
+// audit records a completed action. The action already happened, so a failed write
+// is logged rather than returned.
+func (s *UserAdminService) audit(actor AdminActor, action string, userID uint, reason, details string) {
+    entry := &models.AuditLog{
+        ActorID:      actor.ID,
+        Action:       action,
+        TargetUserID: userID,
+        Reason:       reason,
+        Details:      details,
+        IP:           actor.IP,
+    }
+    fields := logrus.Fields{
+        "admin_id": actor.ID,
+        "user_id":  userID,
+        "action":   action,
+        "ip":       actor.IP,
+    }
+    if err := s.AuditRepo.CreateAuditLog(entry); err != nil {
+        fields["error"] = err
+        fields["error_code"] = "AUDIT_LOG_FAILED"
+        s.Logger.WithFields(fields).Error("Failed to record audit log")
+        return
+    }
+    s.Logger.WithFields(fields).Info("Admin action on user")
+}
@@ -0,0 +1,215 @@
+package services_test
+
+import (
+    "testing"
+    "time"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+)
+
+// stubAuditLogRepository keeps audit entries in memory
+type stubAuditLogRepository struct {
+    entries []models.AuditLog
+    fail    bool
+}
+
+func (r *stubAuditLogRepository) CreateAuditLog(entry *models.AuditLog) error {
+    if r.fail {
+        return errors.New("database unavailable")
+    }
+    entry.ID = uint(len(r.entries) + 1)
+    r.entries = append(r.entries, *entry)
+    return nil
+}
+
+func (r *stubAuditLogRepository) GetAuditLogsByTarget(userID uint, page, limit int) ([]models.AuditLog, int64, error) {
+    var entries []models.AuditLog
+    for i := len(r.entries) - 1; i >= 0; i-- {
+        if r.entries[i].TargetUserID == userID {
+            entries = append(entries, r.entries[i])
+        }
+    }
+    return entries, int64(len(entries)), nil
+}
+
+func TestUserAdminService_ListUsers(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "root", Email: "root@example.com", Role: models.RoleAdmin},
+        {ID: 2, Username: "ann", Email: "ann@example.com", Role: models.RoleUser, Password: "hash"},
+        {ID: 3, Username: "other-admin", Email: "admin2@example.com", Role: models.RoleAdmin},
+    }}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    accounts := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, &stubMailer{}, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    roles := services.NewRoleService(&stubRoleRepository{users: userRepo}, userRepo, newTestLogger())
+    assert.NoError(t, roles.EnsureDefaultRoles())
+    service := services.NewUserAdminService(userRepo, roles.RoleRepo, &stubAuditLogRepository{}, roles, accounts, newTestLogger())
+    service.AuthCache = &stubAuthCache{}
+
+    users, total, err := service.ListUsers(" ANN ", "", 1, 10)
+    assert.NoError(t, err)
+    assert.Equal(t, int64(1), total)
+    if assert.Len(t, users, 1) {
+        assert.Equal(t, "ann", users[0].Username)
+    }
+
+    users, total, _ = service.ListUsers("", models.RoleAdmin, 2, 1)
+    assert.Equal(t, int64(2), total)
+    if assert.Len(t, users, 1) {
+        assert.Equal(t, uint(3), users[0].ID)
+    }
+}
+
+func TestUserAdminService_SuspendAndReactivate(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "root", Email: "root@example.com", Role: models.RoleAdmin},
+        {ID: 2, Username: "ann", Email: "ann@example.com", Role: models.RoleUser, Password: "hash"},
+        {ID: 3, Username: "other-admin", Email: "admin2@example.com", Role: models.RoleAdmin},
+    }}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    accounts := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, &stubMailer{}, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    roles := services.NewRoleService(&stubRoleRepository{users: userRepo}, userRepo, newTestLogger())
+    assert.NoError(t, roles.EnsureDefaultRoles())
+    auditRepo := &stubAuditLogRepository{}
+    service := services.NewUserAdminService(userRepo, roles.RoleRepo, auditRepo, roles, accounts, newTestLogger())
+    sessions := &stubSessionRevoker{}
+    passwords.Sessions = sessions
+    service.Sessions = sessions
+    service.AuthCache = &stubAuthCache{}
+    admin := services.AdminActor{ID: 1, IP: "10.0.0.1"}
+
+    assert.Equal(t, services.ErrReasonRequired, service.Suspend(admin, 2, "  "))
+    assert.Equal(t, services.ErrCannotManageSelf, service.Suspend(admin, 1, "testing"))
+    assert.Equal(t, services.ErrUserNotFound, errors.Cause(service.Suspend(admin, 99, "testing")))
+
+    assert.NoError(t, service.Suspend(admin, 2, "chargeback fraud"))
+    user := userRepo.users[1]
+    assert.NotNil(t, user.SuspendedAt)
+    assert.Equal(t, "chargeback fraud", user.SuspendedReason)
+    // Test existing tokens and sessions stop working
+    assert.Equal(t, 1, user.TokenVersion)
+    assert.Equal(t, []uint{2}, sessions.revoked)
+    assert.Equal(t, services.ErrUserAlreadySuspended, service.Suspend(admin, 2, "again"))
+
+    assert.NoError(t, service.Reactivate(admin, 2))
+    assert.Nil(t, userRepo.users[1].SuspendedAt)
+    assert.Equal(t, services.ErrUserNotSuspended, service.Reactivate(admin, 2))
+
+    entries, total, _ := service.GetAuditLog(2, 1, 10)
+    assert.Equal(t, int64(2), total)
+    assert.Equal(t, models.AuditUserReactivated, entries[0].Action)
+    assert.Equal(t, models.AuditUserSuspended, entries[1].Action)
+    assert.Equal(t, "chargeback fraud", entries[1].Reason)
+    assert.Equal(t, "10.0.0.1", auditRepo.entries[0].IP)
+}
+
+func TestUserAdminService_ChangeRoleAndForcePasswordReset(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "root", Email: "root@example.com", Role: models.RoleAdmin},
+        {ID: 2, Username: "ann", Email: "ann@example.com", Role: models.RoleUser, Password: "hash"},
+        {ID: 3, Username: "other-admin", Email: "admin2@example.com", Role: models.RoleAdmin},
+    }}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    mailer := &stubMailer{}
+    accounts := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, mailer, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    roles := services.NewRoleService(&stubRoleRepository{users: userRepo}, userRepo, newTestLogger())
+    assert.NoError(t, roles.EnsureDefaultRoles())
+    auditRepo := &stubAuditLogRepository{}
+    service := services.NewUserAdminService(userRepo, roles.RoleRepo, auditRepo, roles, accounts, newTestLogger())
+    sessions := &stubSessionRevoker{}
+    passwords.Sessions = sessions
+    service.Sessions = sessions
+    service.AuthCache = &stubAuthCache{}
+    admin := services.AdminActor{ID: 1}
+
+    assert.NoError(t, service.ChangeRole(admin, 2, models.RoleAdmin))
+    assert.Equal(t, models.RoleAdmin, userRepo.users[1].Role)
+    if assert.Len(t, auditRepo.entries, 1) {
+        assert.Equal(t, models.AuditUserRoleChanged, auditRepo.entries[0].Action)
+        assert.Equal(t, "user -> admin", auditRepo.entries[0].Details)
+    }
+    assert.Equal(t, services.ErrCannotChangeOwnRole, service.ChangeRole(admin, 1, models.RoleUser))
+
+    // Test a users:manage holder cannot hand out a stronger role, even to an account they control
+    assert.NoError(t, service.Roles.CreateRole(1, &models.Role{Name: "support", Permissions: []string{models.PermissionUsersManage}}))
+    userRepo.users = append(userRepo.users, models.User{ID: 4, Username: "sam", Role: "support"}, models.User{ID: 5, Username: "sock", Role: models.RoleUser})
+    support := services.AdminActor{ID: 4}
+    assert.Equal(t, services.ErrRoleBeyondCaller, errors.Cause(service.ChangeRole(support, 5, models.RoleAdmin)))
+    assert.Equal(t, models.RoleUser, userRepo.users[4].Role)
+
+    // Test erased accounts keep their role
+    erasedAt := time.Now()
+    userRepo.users[4].DeletedAt = &erasedAt
+    assert.Equal(t, services.ErrUserErased, service.ChangeRole(admin, 5, models.RoleAdmin))
+    assert.Len(t, auditRepo.entries, 1)
+
+    assert.NoError(t, service.ForcePasswordReset(admin, 2, "credential stuffing"))
+    assert.Equal(t, services.UnusablePassword, userRepo.users[1].Password)
+    assert.Equal(t, []uint{2}, sessions.revoked)
+    if assert.Len(t, mailer.sent, 1) {
+        assert.Equal(t, "ann@example.com", mailer.sent[0].To)
+        // Test the mailed link sets a new password
+        assert.NoError(t, service.Accounts.ResetPassword(mailedToken(t, mailer.sent[0]), "n3w-Passw0rd"))
+    }
+    assert.Equal(t, models.AuditPasswordResetForced, auditRepo.entries[1].Action)
+}
+
+func TestUserAdminService_Impersonate(t *testing.T) {
+    userRepo := &stubUserRepository{users: []models.User{
+        {ID: 1, Username: "root", Email: "root@example.com", Role: models.RoleAdmin},
+        {ID: 2, Username: "ann", Email: "ann@example.com", Role: models.RoleUser, Password: "hash"},
+        {ID: 3, Username: "other-admin", Email: "admin2@example.com", Role: models.RoleAdmin},
+    }}
+    passwords := services.NewPasswordService(userRepo, &services.PasswordPolicy{MinLength: 10, MaxLength: 128}, testPasswordHasher, newTestLogger())
+    accounts := services.NewAccountService(userRepo, &stubUserTokenRepository{}, passwords, &stubMailer{}, "https://shop.example/", 48*time.Hour, time.Hour, newTestLogger())
+    roles := services.NewRoleService(&stubRoleRepository{users: userRepo}, userRepo, newTestLogger())
+    assert.NoError(t, roles.EnsureDefaultRoles())
+    auditRepo := &stubAuditLogRepository{}
+    service := services.NewUserAdminService(userRepo, roles.RoleRepo, auditRepo, roles, accounts, newTestLogger())
+    service.AuthCache = &stubAuthCache{}
+    admin := services.AdminActor{ID: 1, IP: "10.0.0.1"}
+
+    // Test impersonation is off until an issuer is configured
+    _, err := service.Impersonate(admin, 2, "support ticket 42")
+    assert.Equal(t, services.ErrImpersonationDisabled, err)
+
+    var issuedFor, issuedBy uint
+    service.Impersonation = func(user *models.User, impersonatorID uint) (string, error) {
+        issuedFor, issuedBy = user.ID, impersonatorID
+        return "impersonation-token", nil
+    }
+
+    _, err = service.Impersonate(admin, 2, "")
+    assert.Equal(t, services.ErrReasonRequired, err)
+    _, err = service.Impersonate(admin, 1, "support ticket 42")
+    assert.Equal(t, services.ErrCannotManageSelf, err)
+    _, err = service.Impersonate(admin, 3, "support ticket 42")
+    assert.Equal(t, services.ErrCannotImpersonateAdmin, err)
+
+    // Test nothing is issued when the audit entry cannot be written
+    auditRepo.fail = true
+    _, err = service.Impersonate(admin, 2, "support ticket 42")
+    assert.Equal(t, services.ErrAuditFailed, errors.Cause(err))
+    assert.Zero(t, issuedFor)
+    auditRepo.fail = false
+
+    token, err := service.Impersonate(admin, 2, "support ticket 42")
+    assert.NoError(t, err)
+    assert.Equal(t, "impersonation-token", token.AccessToken)
+    assert.Equal(t, uint(2), issuedFor)
+    assert.Equal(t, uint(1), issuedBy)
+    if assert.Len(t, auditRepo.entries, 1) {
+        entry := auditRepo.entries[0]
+        assert.Equal(t, models.AuditImpersonationStarted, entry.Action)
+        assert.Equal(t, uint(1), entry.ActorID)
+        assert.Equal(t, "support ticket 42", entry.Reason)
+    }
+
+    // Test suspended users cannot be impersonated
+    assert.NoError(t, service.Suspend(admin, 2, "fraud"))
+    _, err = service.Impersonate(admin, 2, "support ticket 43")
+    assert.Equal(t, services.ErrAccountSuspended, err)
+    assert.NotNil(t, userRepo.users[1].SuspendedAt)
+}
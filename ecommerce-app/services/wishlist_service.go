@@ -0,0 +1,352 @@
+package services
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "strings"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/pkg/errors"
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+// Wishlist error types
+var (
+    ErrInvalidWishlistName  = errors.New("wishlist name is required and must be at most 100 characters")
+    ErrWishlistNotFound     = errors.New("wishlist not found")
+    ErrWishlistItemNotFound = errors.New("product is not on the wishlist")
+    ErrCreateWishlistFailed = errors.New("failed to create wishlist")
+    ErrUpdateWishlistFailed = errors.New("failed to update wishlist")
+    ErrDeleteWishlistFailed = errors.New("failed to delete wishlist")
+    ErrFetchWishlistsFailed = errors.New("failed to fetch wishlists")
+    ErrShareTokenFailed     = errors.New("failed to generate share token")
+)
+
+// WishlistService handles business logic for wishlists
+type WishlistService struct {
+    WishlistRepo repositories.WishlistRepository
+    ProductRepo  repositories.ProductRepository
+    CartService  *CartService
+    RabbitMQ     *amqp091.Channel
+    Logger       *logrus.Logger
+}
+
+// NewWishlistService creates a new WishlistService
+func NewWishlistService(wishlistRepo repositories.WishlistRepository, productRepo repositories.ProductRepository, cartService *CartService, rabbitMQ *amqp091.Channel, logger *logrus.Logger) *WishlistService {
+    return &WishlistService{
+        WishlistRepo: wishlistRepo,
+        ProductRepo:  productRepo,
+        CartService:  cartService,
+        RabbitMQ:     rabbitMQ,
+        Logger:       logger,
+    }
+}
+
+// CreateWishlist creates a named wishlist for the user
+func (s *WishlistService) CreateWishlist(userID uint, name string) (*models.Wishlist, error) {
+    name = strings.TrimSpace(name)
+    if name == "" || len(name) > 100 {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error_code": "INVALID_WISHLIST_NAME",
+        }).Warn("Invalid wishlist name")
+        return nil, ErrInvalidWishlistName
+    }
+    wishlist := &models.Wishlist{UserID: userID, Name: name}
+    if err := s.WishlistRepo.CreateWishlist(wishlist); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "CREATE_WISHLIST_FAILED",
+        }).Error("Failed to create wishlist")
+        return nil, errors.Wrap(ErrCreateWishlistFailed, err.Error())
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":     userID,
+        "wishlist_id": wishlist.ID,
+    }).Info("Created wishlist")
+    return wishlist, nil
+}
+
+// GetWishlists returns all of the user's wishlists with their items
+func (s *WishlistService) GetWishlists(userID uint) ([]models.Wishlist, error) {
+    wishlists, err := s.WishlistRepo.GetWishlistsByUserID(userID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":    userID,
+            "error":      err,
+            "error_code": "FETCH_WISHLISTS_FAILED",
+        }).Error("Failed to fetch wishlists")
+        return nil, errors.Wrap(ErrFetchWishlistsFailed, err.Error())
+    }
+    return wishlists, nil
+}
+
+// GetWishlist returns one of the user's wishlists; other users' wishlists are reported as not found
+func (s *WishlistService) GetWishlist(userID, id uint) (*models.Wishlist, error) {
+    wishlist, err := s.WishlistRepo.GetWishlistByID(id)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":     userID,
+            "wishlist_id": id,
+            "error":       err,
+            "error_code":  "WISHLIST_NOT_FOUND",
+        }).Warn("Wishlist not found")
+        return nil, errors.Wrap(ErrWishlistNotFound, err.Error())
+    }
+    if wishlist.UserID != userID {
+        s.Logger.WithFields(logrus.Fields{
+            "user_id":     userID,
+            "wishlist_id": id,
+            "error_code":  "WISHLIST_NOT_FOUND",
+        }).Warn("Wishlist belongs to another user")
+        return nil, ErrWishlistNotFound
+    }
+    return wishlist, nil
+}
+
+// RenameWishlist changes the name of one of the user's wishlists
+func (s *WishlistService) RenameWishlist(userID, id uint, name string) (*models.Wishlist, error) {
+    name = strings.TrimSpace(name)
+    if name == "" || len(name) > 100 {
+        return nil, ErrInvalidWishlistName
+    }
+    wishlist, err := s.GetWishlist(userID, id)
+    if err != nil {
+        return nil, err
+    }
+    wishlist.Name = name
+    if err := s.WishlistRepo.UpdateWishlist(wishlist); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "wishlist_id": id,
+            "error":       err,
+            "error_code":  "UPDATE_WISHLIST_FAILED",
+        }).Error("Failed to update wishlist")
+        return nil, errors.Wrap(ErrUpdateWishlistFailed, err.Error())
+    }
+    return wishlist, nil
+}
+
+// DeleteWishlist deletes one of the user's wishlists and its items
+func (s *WishlistService) DeleteWishlist(userID, id uint) error {
+    if _, err := s.GetWishlist(userID, id); err != nil {
+        return err
+    }
+    if err := s.WishlistRepo.DeleteWishlist(id); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "wishlist_id": id,
+            "error":       err,
+            "error_code":  "DELETE_WISHLIST_FAILED",
+        }).Error("Failed to delete wishlist")
+        return errors.Wrap(ErrDeleteWishlistFailed, err.Error())
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":     userID,
+        "wishlist_id": id,
+    }).Info("Deleted wishlist")
+    return nil
+}
+
+// AddItem adds a product to one of the user's wishlists; stock is not checked or reserved
+func (s *WishlistService) AddItem(userID, wishlistID, productID uint) error {
+    if _, err := s.GetWishlist(userID, wishlistID); err != nil {
+        return err
+    }
+    if _, err := s.ProductRepo.GetProductByID(productID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "product_id": productID,
+            "error":      err,
+            "error_code": "PRODUCT_NOT_FOUND",
+        }).Warn("Product not found")
+        return errors.Wrap(ErrProductNotFound, err.Error())
+    }
+    item := &models.WishlistItem{WishlistID: wishlistID, ProductID: productID}
+    if err := s.WishlistRepo.AddItem(item); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "wishlist_id": wishlistID,
+            "product_id":  productID,
+            "error":       err,
+            "error_code":  "UPDATE_WISHLIST_FAILED",
+        }).Error("Failed to add wishlist item")
+        return errors.Wrap(ErrUpdateWishlistFailed, err.Error())
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":     userID,
+        "wishlist_id": wishlistID,
+        "product_id":  productID,
+    }).Info("Added product to wishlist")
+    return nil
+}
+
+// RemoveItem removes a product from one of the user's wishlists
+func (s *WishlistService) RemoveItem(userID, wishlistID, productID uint) error {
+    if _, err := s.GetWishlist(userID, wishlistID); err != nil {
+        return err
+    }
+    removed, err := s.WishlistRepo.RemoveItem(wishlistID, productID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "wishlist_id": wishlistID,
+            "product_id":  productID,
+            "error":       err,
+            "error_code":  "UPDATE_WISHLIST_FAILED",
+        }).Error("Failed to remove wishlist item")
+        return errors.Wrap(ErrUpdateWishlistFailed, err.Error())
+    }
+    if !removed {
+        return ErrWishlistItemNotFound
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":     userID,
+        "wishlist_id": wishlistID,
+        "product_id":  productID,
+    }).Info("Removed product from wishlist")
+    return nil
+}
+
+// MoveToCart adds a wishlist product to the cart through CartService.AddToCartNow and,
+// only once the cart line is written, removes it from the wishlist. A queued add could
+// still fail after the item was gone, so moves never go through the cart worker.
+func (s *WishlistService) MoveToCart(userID, wishlistID, productID uint, quantity int) error {
+    wishlist, err := s.GetWishlist(userID, wishlistID)
+    if err != nil {
+        return err
+    }
+    found := false
+    for _, item := range wishlist.Items {
+        if item.ProductID == productID {
+            found = true
+            break
+        }
+    }
+    if !found {
+        return ErrWishlistItemNotFound
+    }
+    if _, err := s.CartService.AddToCartNow(userID, productID, quantity); err != nil {
+        return err
+    }
+    if _, err := s.WishlistRepo.RemoveItem(wishlistID, productID); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "wishlist_id": wishlistID,
+            "product_id":  productID,
+            "error":       err,
+            "error_code":  "UPDATE_WISHLIST_FAILED",
+        }).Error("Failed to remove moved wishlist item")
+        return errors.Wrap(ErrUpdateWishlistFailed, err.Error())
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":     userID,
+        "wishlist_id": wishlistID,
+        "product_id":  productID,
+        "quantity":    quantity,
+    }).Info("Moved wishlist item to cart")
+    return nil
+}
+
+// EnableSharing assigns a public share token to the wishlist, reusing an existing one
+func (s *WishlistService) EnableSharing(userID, id uint) (*models.Wishlist, error) {
+    wishlist, err := s.GetWishlist(userID, id)
+    if err != nil {
+        return nil, err
+    }
+    if wishlist.ShareToken != nil {
+        return wishlist, nil
+    }
+    buf := make([]byte, 16)
+    if _, err := rand.Read(buf); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "wishlist_id": id,
+            "error":       err,
+            "error_code":  "SHARE_TOKEN_FAILED",
+        }).Error("Failed to generate share token")
+        return nil, errors.Wrap(ErrShareTokenFailed, err.Error())
+    }
+    token := hex.EncodeToString(buf)
+    wishlist.ShareToken = &token
+    if err := s.WishlistRepo.UpdateWishlist(wishlist); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "wishlist_id": id,
+            "error":       err,
+            "error_code":  "UPDATE_WISHLIST_FAILED",
+        }).Error("Failed to update wishlist")
+        return nil, errors.Wrap(ErrUpdateWishlistFailed, err.Error())
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "user_id":     userID,
+        "wishlist_id": id,
+    }).Info("Enabled wishlist sharing")
+    return wishlist, nil
+}
+
+// DisableSharing revokes the wishlist's share token so existing links stop working
+func (s *WishlistService) DisableSharing(userID, id uint) error {
+    wishlist, err := s.GetWishlist(userID, id)
+    if err != nil {
+        return err
+    }
+    wishlist.ShareToken = nil
+    if err := s.WishlistRepo.UpdateWishlist(wishlist); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "wishlist_id": id,
+            "error":       err,
+            "error_code":  "UPDATE_WISHLIST_FAILED",
+        }).Error("Failed to update wishlist")
+        return errors.Wrap(ErrUpdateWishlistFailed, err.Error())
+    }
+    return nil
+}
+
+// GetSharedWishlist returns a wishlist by its public share token
+func (s *WishlistService) GetSharedWishlist(token string) (*models.Wishlist, error) {
+    wishlist, err := s.WishlistRepo.GetWishlistByShareToken(token)
+    if err != nil {
+        return nil, errors.Wrap(ErrWishlistNotFound, err.Error())
+    }
+    return wishlist, nil
+}
+
+// NotifyPriceDrop implements PriceDropNotifier by publishing a price-drop event for
+// every user with the product on a wishlist
+func (s *WishlistService) NotifyPriceDrop(product *models.Product, oldPrice float64) {
+    userIDs, err := s.WishlistRepo.GetUserIDsWatchingProduct(product.ID)
+    if err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "product_id": product.ID,
+            "error":      err,
+            "error_code": "FETCH_WISHLISTS_FAILED",
+        }).Error("Failed to find wishlists for price drop")
+        return
+    }
+    if len(userIDs) == 0 {
+        return
+    }
+    message := struct {
+        ProductID uint    `json:"product_id"`
+        Name      string  `json:"name"`
+        OldPrice  float64 `json:"old_price"`
+        NewPrice  float64 `json:"new_price"`
+        UserIDs   []uint  `json:"user_ids"`
+    }{
+        ProductID: product.ID,
+        Name:      product.Name,
+        OldPrice:  oldPrice,
+        NewPrice:  product.Price,
+        UserIDs:   userIDs,
+    }
+    if err := publishJSON(s.RabbitMQ, "price_drop_queue", message); err != nil {
+        s.Logger.WithFields(logrus.Fields{
+            "product_id": product.ID,
+            "error":      err,
+            "error_code": "PUBLISH_FAILED",
+        }).Error("Failed to publish price drop")
+        return
+    }
+    s.Logger.WithFields(logrus.Fields{
+        "product_id": product.ID,
+        "old_price":  oldPrice,
+        "new_price":  product.Price,
+        "users":      len(userIDs),
+    }).Info("Published wishlist price drop")
+}
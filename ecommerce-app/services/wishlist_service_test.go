@@ -0,0 +1,162 @@
+package services_test
+
+import (
+    "testing"
+
+    "github.com/inquisitivefrog/ecommerce-app/models"
+    "github.com/inquisitivefrog/ecommerce-app/services"
+    "github.com/pkg/errors"
+    "github.com/stretchr/testify/assert"
+    "gorm.io/gorm"
+)
+
+// stubWishlistRepository is an in-memory WishlistRepository
+type stubWishlistRepository struct {
+    wishlists map[uint]*models.Wishlist
+}
+
+func (m *stubWishlistRepository) CreateWishlist(wishlist *models.Wishlist) error {
+    wishlist.ID = uint(len(m.wishlists) + 1)
+    m.wishlists[wishlist.ID] = wishlist
+    return nil
+}
+
+func (m *stubWishlistRepository) GetWishlistsByUserID(userID uint) ([]models.Wishlist, error) {
+    var results []models.Wishlist
+    for _, wishlist := range m.wishlists {
+        if wishlist.UserID == userID {
+            results = append(results, *wishlist)
+        }
+    }
+    return results, nil
+}
+
+func (m *stubWishlistRepository) GetWishlistByID(id uint) (*models.Wishlist, error) {
+    wishlist, ok := m.wishlists[id]
+    if !ok {
+        return nil, gorm.ErrRecordNotFound
+    }
+    return wishlist, nil
+}
+
+func (m *stubWishlistRepository) GetWishlistByShareToken(token string) (*models.Wishlist, error) {
+    for _, wishlist := range m.wishlists {
+        if wishlist.ShareToken != nil && *wishlist.ShareToken == token {
+            return wishlist, nil
+        }
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (m *stubWishlistRepository) UpdateWishlist(wishlist *models.Wishlist) error {
+    m.wishlists[wishlist.ID] = wishlist
+    return nil
+}
+
+func (m *stubWishlistRepository) DeleteWishlist(id uint) error {
+    delete(m.wishlists, id)
+    return nil
+}
+
+func (m *stubWishlistRepository) AddItem(item *models.WishlistItem) error {
+    wishlist := m.wishlists[item.WishlistID]
+    wishlist.Items = append(wishlist.Items, *item)
+    return nil
+}
+
+func (m *stubWishlistRepository) RemoveItem(wishlistID, productID uint) (bool, error) {
+    wishlist := m.wishlists[wishlistID]
+    for i, item := range wishlist.Items {
+        if item.ProductID == productID {
+            wishlist.Items = append(wishlist.Items[:i], wishlist.Items[i+1:]...)
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+func (m *stubWishlistRepository) GetUserIDsWatchingProduct(productID uint) ([]uint, error) {
+    return nil, nil
+}
+
+// recordingPriceDropNotifier records price drop notifications
+type recordingPriceDropNotifier struct {
+    oldPrices []float64
+}
+
+func (m *recordingPriceDropNotifier) NotifyPriceDrop(product *models.Product, oldPrice float64) {
+    m.oldPrices = append(m.oldPrices, oldPrice)
+}
+
+func TestWishlistService_Ownership(t *testing.T) {
+    productRepo := newStubProductRepository(models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 29.99, Stock: 0})
+    wishlistRepo := &stubWishlistRepository{wishlists: make(map[uint]*models.Wishlist)}
+    service := services.NewWishlistService(wishlistRepo, productRepo, nil, nil, newTestLogger())
+
+    wishlist, err := service.CreateWishlist(1, " Birthday ")
+    assert.NoError(t, err)
+    assert.Equal(t, "Birthday", wishlist.Name)
+
+    // Test out-of-stock products can still be wishlisted
+    assert.NoError(t, service.AddItem(1, wishlist.ID, 1))
+    assert.Len(t, wishlistRepo.wishlists[wishlist.ID].Items, 1)
+
+    // Test another user's wishlist is reported as not found
+    _, err = service.GetWishlist(2, wishlist.ID)
+    assert.Equal(t, services.ErrWishlistNotFound, err)
+    err = service.AddItem(2, wishlist.ID, 1)
+    assert.Equal(t, services.ErrWishlistNotFound, errors.Cause(err))
+
+    // Test removing a product that is not on the wishlist
+    err = service.RemoveItem(1, wishlist.ID, 2)
+    assert.Equal(t, services.ErrWishlistItemNotFound, err)
+
+    // Test share links resolve until sharing is disabled
+    shared, err := service.EnableSharing(1, wishlist.ID)
+    assert.NoError(t, err)
+    token := *shared.ShareToken
+    _, err = service.GetSharedWishlist(token)
+    assert.NoError(t, err)
+    assert.NoError(t, service.DisableSharing(1, wishlist.ID))
+    _, err = service.GetSharedWishlist(token)
+    assert.Equal(t, services.ErrWishlistNotFound, errors.Cause(err))
+}
+
+func TestWishlistService_MoveToCart(t *testing.T) {
+    products := newStubProductRepository(models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 20, Stock: 5})
+    cartRepo := &stubCartRepository{products: products}
+    cartService := services.NewCartService(cartRepo, products, &stubCouponRepository{}, nil, newUnreachableRedis(), newTestLogger())
+    wishlistRepo := &stubWishlistRepository{wishlists: make(map[uint]*models.Wishlist)}
+    service := services.NewWishlistService(wishlistRepo, products, cartService, nil, newTestLogger())
+    wishlist, _ := service.CreateWishlist(1, "Later")
+    assert.NoError(t, service.AddItem(1, wishlist.ID, 1))
+
+    // Test a move that cannot be added keeps the wishlist item
+    assert.Equal(t, services.ErrInsufficientStock, service.MoveToCart(1, wishlist.ID, 1, 9))
+    assert.Len(t, wishlistRepo.wishlists[wishlist.ID].Items, 1)
+
+    // Test a move writes the cart line even when adds are queued
+    assert.NoError(t, service.MoveToCart(1, wishlist.ID, 1, 2))
+    assert.Empty(t, wishlistRepo.wishlists[wishlist.ID].Items)
+    if assert.Len(t, cartRepo.cartItems, 1) {
+        assert.Equal(t, 2, cartRepo.cartItems[0].Quantity)
+    }
+}
+
+func TestProductService_UpdateProduct_PriceDrop(t *testing.T) {
+    productRepo := newStubProductRepository(models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 29.99, Stock: 10, AverageRating: 4.5, RatingCount: 2})
+    notifier := &recordingPriceDropNotifier{}
+    service := services.NewProductService(productRepo, newTestLogger())
+    service.PriceDropNotifier = notifier
+
+    // Test price increase does not notify and ratings are preserved
+    err := service.UpdateProduct(&models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 34.99, Stock: 10})
+    assert.NoError(t, err)
+    assert.Empty(t, notifier.oldPrices)
+    assert.Equal(t, 4.5, productRepo.products[1].AverageRating)
+
+    // Test price drop notifies with the previous price
+    err = service.UpdateProduct(&models.Product{Model: gorm.Model{ID: 1}, Name: "Shirt", Price: 19.99, Stock: 10})
+    assert.NoError(t, err)
+    assert.Equal(t, []float64{34.99}, notifier.oldPrices)
+}
@@ -0,0 +1,29 @@
+package worker
+
+import (
+    "time"
+
+    "github.com/sirupsen/logrus"
+)
+
+// RunAbandonedCartJob looks for abandoned carts and sends due reminders every
+// interval. AbandonedCartService.ProcessAbandonedCarts implements process. An interval
+// that is not positive disables the job.
+func RunAbandonedCartJob(process func() error, interval time.Duration) {
+    if interval <= 0 {
+        logrus.WithFields(logrus.Fields{
+            "interval": interval,
+        }).Warn("Abandoned cart job disabled")
+        return
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        if err := process(); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "error":      err,
+                "error_code": "PROCESS_ABANDONED_CARTS_FAILED",
+            }).Error("Failed to process abandoned carts")
+        }
+    }
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+    "encoding/json"
+    "time"
+
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+// CartEvent represents a message from the cart events queue, published once an item
+// has been added to a cart in either cart mode
+type CartEvent struct {
+    UserID       uint      `json:"user_id"`
+    ProductID    uint      `json:"product_id"`
+    Quantity     int       `json:"quantity"`
+    LineQuantity int       `json:"line_quantity"`
+    OccurredAt   time.Time `json:"occurred_at"`
+}
+
+// CartEventHandler reacts to a cart event; returning an error requeues the event
+type CartEventHandler func(event CartEvent) error
+
+// LogCartEvent writes every add to cart to the worker log
+func LogCartEvent(event CartEvent) error {
+    logrus.WithFields(logrus.Fields{
+        "user_id":       event.UserID,
+        "product_id":    event.ProductID,
+        "quantity":      event.Quantity,
+        "line_quantity": event.LineQuantity,
+    }).Info("Item added to cart")
+    return nil
+}
+
+// RunCartEventWorker consumes the cart events queue and passes each event to every handler
+func RunCartEventWorker(ch *amqp091.Channel, handlers ...CartEventHandler) {
+    msgs, err := ch.Consume(
+        "cart_events", // Queue
+        "",            // Consumer
+        false,         // Auto-ack
+        false,         // Exclusive
+        false,         // No-local
+        false,         // No-wait
+        nil,           // Args
+    )
+    if err != nil {
+        logrus.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "CONSUME_FAILED",
+        }).Fatal("Failed to consume RabbitMQ queue")
+    }
+
+    logrus.Info("Worker started, waiting for cart events")
+
+    for msg := range msgs {
+        var event CartEvent
+        if err := json.Unmarshal(msg.Body, &event); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "error":      err,
+                "error_code": "UNMARSHAL_FAILED",
+            }).Warn("Failed to unmarshal cart event")
+            msg.Nack(false, false) // multiple=false, requeue=false
+            continue
+        }
+
+        failed := false
+        for _, handle := range handlers {
+            if err := handle(event); err != nil {
+                logrus.WithFields(logrus.Fields{
+                    "user_id":    event.UserID,
+                    "product_id": event.ProductID,
+                    "error":      err,
+                    "error_code": "CART_EVENT_FAILED",
+                }).Error("Failed to handle cart event")
+                failed = true
+                break
+            }
+        }
+        if failed {
+            msg.Nack(false, true) // multiple=false, requeue=true
+            continue
+        }
+        msg.Ack(false)
+    }
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+    "encoding/json"
+    "time"
+
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+// DataExportMessage represents a message from the data export queue
+type DataExportMessage struct {
+    ExportID uint `json:"export_id"`
+}
+
+// DataExportBuilder builds the archive of one export; returning an error requeues
+// the message. ProfileService.BuildDataExport implements it.
+type DataExportBuilder func(exportID uint) error
+
+// RunDataExportWorker builds the personal data archives users request
+func RunDataExportWorker(build DataExportBuilder, ch *amqp091.Channel) {
+    msgs, err := ch.Consume(
+        "data_export_queue", // Queue
+        "",                  // Consumer
+        false,               // Auto-ack
+        false,               // Exclusive
+        false,               // No-local
+        false,               // No-wait
+        nil,                 // Args
+    )
+    if err != nil {
+        logrus.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "CONSUME_FAILED",
+        }).Fatal("Failed to consume RabbitMQ queue")
+    }
+
+    logrus.Info("Worker started, waiting for data export messages")
+
+    for msg := range msgs {
+        var exportMsg DataExportMessage
+        if err := json.Unmarshal(msg.Body, &exportMsg); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "error":      err,
+                "error_code": "UNMARSHAL_FAILED",
+            }).Warn("Failed to unmarshal data export message")
+            msg.Nack(false, false) // multiple=false, requeue=false
+            continue
+        }
+
+        if err := build(exportMsg.ExportID); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "export_id":  exportMsg.ExportID,
+                "error":      err,
+                "error_code": "BUILD_DATA_EXPORT_FAILED",
+            }).Error("Failed to build data export")
+            msg.Nack(false, true) // multiple=false, requeue=true
+            continue
+        }
+        msg.Ack(false)
+    }
+}
+
+// RunDataExportCleanup deletes expired export archives every interval. An interval that
+// is not positive disables the cleanup.
+func RunDataExportCleanup(purge func() error, interval time.Duration) {
+    if interval <= 0 {
+        logrus.WithFields(logrus.Fields{
+            "interval": interval,
+        }).Warn("Data export cleanup disabled")
+        return
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        if err := purge(); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "error":      err,
+                "error_code": "PURGE_DATA_EXPORTS_FAILED",
+            }).Error("Failed to purge expired data exports")
+        }
+    }
+}
@@ -0,0 +1,91 @@
+package worker
+
+import (
+    "encoding/json"
+    "time"
+
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+// OrderEvent represents a message from the order events queue, published on every
+// order status transition
+type OrderEvent struct {
+    OrderID    uint      `json:"order_id"`
+    UserID     uint      `json:"user_id"`
+    FromStatus string    `json:"from_status"`
+    ToStatus   string    `json:"to_status"`
+    Actor      string    `json:"actor"`
+    ActorID    uint      `json:"actor_id"`
+    Reason     string    `json:"reason"`
+    Total      float64   `json:"total"`
+    OccurredAt time.Time `json:"occurred_at"`
+}
+
+// OrderEventHandler reacts to an order event; returning an error requeues the event
+type OrderEventHandler func(event OrderEvent) error
+
+// LogOrderEvent writes every order transition to the worker log
+func LogOrderEvent(event OrderEvent) error {
+    logrus.WithFields(logrus.Fields{
+        "order_id": event.OrderID,
+        "user_id":  event.UserID,
+        "from":     event.FromStatus,
+        "to":       event.ToStatus,
+        "actor":    event.Actor,
+        "actor_id": event.ActorID,
+    }).Info("Order status changed")
+    return nil
+}
+
+// RunOrderEventWorker consumes the order events queue and passes each event to every handler
+func RunOrderEventWorker(ch *amqp091.Channel, handlers ...OrderEventHandler) {
+    msgs, err := ch.Consume(
+        "order_events", // Queue
+        "",             // Consumer
+        false,          // Auto-ack
+        false,          // Exclusive
+        false,          // No-local
+        false,          // No-wait
+        nil,            // Args
+    )
+    if err != nil {
+        logrus.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "CONSUME_FAILED",
+        }).Fatal("Failed to consume RabbitMQ queue")
+    }
+
+    logrus.Info("Worker started, waiting for order events")
+
+    for msg := range msgs {
+        var event OrderEvent
+        if err := json.Unmarshal(msg.Body, &event); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "error":      err,
+                "error_code": "UNMARSHAL_FAILED",
+            }).Warn("Failed to unmarshal order event")
+            msg.Nack(false, false) // multiple=false, requeue=false
+            continue
+        }
+
+        failed := false
+        for _, handle := range handlers {
+            if err := handle(event); err != nil {
+                logrus.WithFields(logrus.Fields{
+                    "order_id":   event.OrderID,
+                    "to":         event.ToStatus,
+                    "error":      err,
+                    "error_code": "ORDER_EVENT_FAILED",
+                }).Error("Failed to handle order event")
+                failed = true
+                break
+            }
+        }
+        if failed {
+            msg.Nack(false, true) // multiple=false, requeue=true
+            continue
+        }
+        msg.Ack(false)
+    }
+}
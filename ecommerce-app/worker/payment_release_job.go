@@ -0,0 +1,29 @@
+package worker
+
+import (
+    "time"
+
+    "github.com/sirupsen/logrus"
+)
+
+// RunPaymentReleaseJob releases the payments of cancelled orders that still hold funds
+// every interval. OrderService.RetryPaymentReleases implements release. An interval that
+// is not positive disables the job.
+func RunPaymentReleaseJob(release func() error, interval time.Duration) {
+    if interval <= 0 {
+        logrus.WithFields(logrus.Fields{
+            "interval": interval,
+        }).Warn("Payment release job disabled")
+        return
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        if err := release(); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "error":      err,
+                "error_code": "RETRY_PAYMENT_RELEASES_FAILED",
+            }).Error("Failed to retry payment releases")
+        }
+    }
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+    "encoding/json"
+    "math"
+
+    "github.com/inquisitivefrog/ecommerce-app/repositories"
+    "github.com/rabbitmq/amqp091-go"
+    "github.com/sirupsen/logrus"
+)
+
+// ReviewMessage represents a message from the review queue
+type ReviewMessage struct {
+    ProductID uint `json:"product_id"`
+}
+
+// RunReviewWorker recalculates a product's aggregated rating whenever a review is moderated
+func RunReviewWorker(reviewRepo repositories.ReviewRepository, productRepo repositories.ProductRepository, ch *amqp091.Channel) {
+    msgs, err := ch.Consume(
+        "review_queue", // Queue
+        "",             // Consumer
+        false,          // Auto-ack
+        false,          // Exclusive
+        false,          // No-local
+        false,          // No-wait
+        nil,            // Args
+    )
+    if err != nil {
+        logrus.WithFields(logrus.Fields{
+            "error":      err,
+            "error_code": "CONSUME_FAILED",
+        }).Fatal("Failed to consume RabbitMQ queue")
+    }
+
+    logrus.Info("Worker started, waiting for review messages")
+
+    for msg := range msgs {
+        var reviewMsg ReviewMessage
+        if err := json.Unmarshal(msg.Body, &reviewMsg); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "error":      err,
+                "error_code": "UNMARSHAL_FAILED",
+            }).Warn("Failed to unmarshal review message")
+            msg.Nack(false, false) // multiple=false, requeue=false
+            continue
+        }
+
+        average, count, err := reviewRepo.GetRatingStats(reviewMsg.ProductID)
+        if err != nil {
+            logrus.WithFields(logrus.Fields{
+                "product_id": reviewMsg.ProductID,
+                "error":      err,
+                "error_code": "RATING_STATS_FAILED",
+            }).Error("Failed to compute rating stats")
+            msg.Nack(false, true) // multiple=false, requeue=true
+            continue
+        }
+
+        average = math.Round(average*100) / 100
+        if err := productRepo.UpdateRating(reviewMsg.ProductID, average, count); err != nil {
+            logrus.WithFields(logrus.Fields{
+                "product_id": reviewMsg.ProductID,
+                "error":      err,
+                "error_code": "UPDATE_RATING_FAILED",
+            }).Error("Failed to update product rating")
+            msg.Nack(false, true) // multiple=false, requeue=true
+            continue
+        }
+
+        logrus.WithFields(logrus.Fields{
+            "product_id":     reviewMsg.ProductID,
+            "average_rating": average,
+            "rating_count":   count,
+        }).Info("Updated product rating")
+        msg.Ack(false)
+    }
+}
@@ -4,23 +4,31 @@ import (
     "context"
     "encoding/json"
     "strconv"
+    "time"
 
-    "github.com/inquisitivefrog/ecommerce-app/models"
     "github.com/inquisitivefrog/ecommerce-app/repositories"
     "github.com/rabbitmq/amqp091-go"
     "github.com/redis/go-redis/v9"
     "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
 )
 
 // CartMessage represents a message from the cart queue
 type CartMessage struct {
-    UserID    uint `json:"user_id"`
-    ProductID uint `json:"product_id"`
-    Quantity  int  `json:"quantity"`
+    UserID      uint   `json:"user_id"`
+    ProductID   uint   `json:"product_id"`
+    Quantity    int    `json:"quantity"`
+    OperationID string `json:"operation_id,omitempty"`
 }
 
-// RunCartWorker runs the cart worker to process RabbitMQ messages
-func RunCartWorker(repo repositories.CartRepository, ch *amqp091.Channel, redisClient *redis.Client) {
+// CartOperationRecorder stores the outcome of a queued add to cart; err is nil on
+// success
+type CartOperationRecorder func(operationID string, err error)
+
+// RunCartWorker runs the cart worker to process RabbitMQ messages. Each add goes
+// through the same transactional write as sync cart mode, and its outcome is passed
+// to record when the message carries an operation ID.
+func RunCartWorker(repo repositories.CartRepository, ch *amqp091.Channel, redisClient *redis.Client, record CartOperationRecorder) {
     msgs, err := ch.Consume(
         "cart_queue", // Queue
         "",           // Consumer
@@ -50,12 +58,20 @@ func RunCartWorker(repo repositories.CartRepository, ch *amqp091.Channel, redisC
             continue
         }
 
-        cartItem := &models.Cart{
-            UserID:    cartMsg.UserID,
-            ProductID: cartMsg.ProductID,
-            Quantity:  cartMsg.Quantity,
+        cartItem, err := repo.AddItemQuantity(cartMsg.UserID, cartMsg.ProductID, cartMsg.Quantity)
+        if err == repositories.ErrCartQuantityExceedsStock || err == gorm.ErrRecordNotFound {
+            // Retrying cannot help: the product is gone or there is not enough stock
+            logrus.WithFields(logrus.Fields{
+                "user_id":    cartMsg.UserID,
+                "product_id": cartMsg.ProductID,
+                "error":      err,
+                "error_code": "ADD_ITEM_REJECTED",
+            }).Warn("Rejected cart item")
+            recordCartOperation(record, cartMsg.OperationID, err)
+            msg.Nack(false, false) // multiple=false, requeue=false
+            continue
         }
-        if err := repo.AddItem(cartItem); err != nil { // Changed back to AddItem
+        if err != nil {
             logrus.WithFields(logrus.Fields{
                 "user_id":    cartMsg.UserID,
                 "product_id": cartMsg.ProductID,
@@ -76,6 +92,15 @@ func RunCartWorker(repo repositories.CartRepository, ch *amqp091.Channel, redisC
             }).Warn("Failed to invalidate cache")
         }
 
+        recordCartOperation(record, cartMsg.OperationID, nil)
+        publishCartEvent(ch, CartEvent{
+            UserID:       cartMsg.UserID,
+            ProductID:    cartMsg.ProductID,
+            Quantity:     cartMsg.Quantity,
+            LineQuantity: cartItem.Quantity,
+            OccurredAt:   time.Now(),
+        })
+
         logrus.WithFields(logrus.Fields{
             "user_id":    cartMsg.UserID,
             "product_id": cartMsg.ProductID,
@@ -84,3 +109,28 @@ func RunCartWorker(repo repositories.CartRepository, ch *amqp091.Channel, redisC
         msg.Ack(false)
     }
 }
+
+func recordCartOperation(record CartOperationRecorder, operationID string, err error) {
+    if record != nil && operationID != "" {
+        record(operationID, err)
+    }
+}
+
+// publishCartEvent queues the side effects of an applied add. The item is already in
+// the cart, so a failure is only logged.
+func publishCartEvent(ch *amqp091.Channel, event CartEvent) {
+    body, err := json.Marshal(event)
+    if err == nil {
+        err = ch.PublishWithContext(context.Background(), "", "cart_events", false, false, amqp091.Publishing{
+            ContentType: "application/json",
+            Body:        body,
+        })
+    }
+    if err != nil {
+        logrus.WithFields(logrus.Fields{
+            "user_id":    event.UserID,
+            "error":      err,
+            "error_code": "PUBLISH_FAILED",
+        }).Warn("Failed to publish cart event")
+    }
+}
@@ -32,6 +32,14 @@ func (m *mockCartRepository) AddItem(cartItem *models.Cart) error {
     return nil
 }
 
+func (m *mockCartRepository) AddItemQuantity(userID, productID uint, quantity int) (*models.Cart, error) {
+    cartItem := &models.Cart{UserID: userID, ProductID: productID, Quantity: quantity}
+    if err := m.AddItem(cartItem); err != nil {
+        return nil, err
+    }
+    return cartItem, nil
+}
+
 func (m *mockCartRepository) GetCartByUserID(userID uint) ([]models.Cart, error) {
     if m.err != nil {
         return nil, m.err
@@ -45,15 +53,19 @@ func (m *mockCartRepository) GetCartByUserID(userID uint) ([]models.Cart, error)
     return results, nil
 }
 
-func (m *mockCartRepository) GetCartItemByID(id uint) (*models.Cart, error) {
+func (m *mockCartRepository) GetCartItemByID(userID, id uint) (*models.Cart, error) {
     return nil, nil // Not used in worker
 }
 
-func (m *mockCartRepository) UpdateItem(cartItem *models.Cart) error {
+func (m *mockCartRepository) UpdateItem(userID uint, cartItem *models.Cart) error {
+    return nil // Not used in worker
+}
+
+func (m *mockCartRepository) RepriceItem(userID, id uint, price float64) error {
     return nil // Not used in worker
 }
 
-func (m *mockCartRepository) DeleteItem(id uint) error {
+func (m *mockCartRepository) DeleteItem(userID, id uint) error {
     return nil // Not used in worker
 }
 